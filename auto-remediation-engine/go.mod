@@ -1,3 +1,7 @@
 module auto-remediation-engine
 
 go 1.22.5
+
+require quantity v0.0.0
+
+replace quantity => ../quantity
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"quantity"
+)
 
 // Pod represents a Kubernetes pod we're monitoring
 // WHY: We need to track pod state, resources, and health
@@ -12,9 +16,53 @@ type Pod struct {
 	Restarts   int       // How many times it restarted
 	CPU        string    // CPU request (e.g., "500m")
 	Memory     string    // Memory request (e.g., "512Mi")
+	Containers []Container // Per-container requests and limits, when known
 	CreatedAt  time.Time // When pod was created
 }
 
+// Container is one container of a pod with its requests and limits
+// WHY: Remediations like memory increases change a specific container,
+// and limits matter as much as requests for OOMKills
+type Container struct {
+	Name      string
+	Init      bool // Init container, only runs before the app containers
+	Resources quantity.ResourceRequirements
+}
+
+// Requests returns what the scheduler reserves for the pod
+// WHY: Uses the containers when we have them (init containers and limits
+// follow Kubernetes rules) and falls back to the CPU/Memory strings
+func (p Pod) Requests() (quantity.ResourceList, error) {
+	if len(p.Containers) > 0 {
+		var app, init []quantity.ResourceRequirements
+		for _, c := range p.Containers {
+			if c.Init {
+				init = append(init, c.Resources)
+			} else {
+				app = append(app, c.Resources)
+			}
+		}
+		return quantity.PodRequests(app, init, nil), nil
+	}
+
+	requests := quantity.ResourceList{}
+	if p.CPU != "" {
+		cpu, err := quantity.Parse(p.CPU)
+		if err != nil {
+			return nil, err
+		}
+		requests[quantity.CPU] = cpu
+	}
+	if p.Memory != "" {
+		memory, err := quantity.Parse(p.Memory)
+		if err != nil {
+			return nil, err
+		}
+		requests[quantity.Memory] = memory
+	}
+	return requests, nil
+}
+
 // RemediationAction represents an action the system can take
 // WHY: We need to know what action was taken, when, and why
 type RemediationAction struct {
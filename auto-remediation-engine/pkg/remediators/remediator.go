@@ -1,6 +1,8 @@
 package remediators
 
 import (
+	"fmt"
+
 	"auto-remediation-engine/pkg/logger"
 	"auto-remediation-engine/pkg/models"
 )
@@ -69,17 +71,25 @@ func NewMemoryIncreaser(log *logger.Logger, percent int) *MemoryIncreaser {
 // Remediate increases memory for a pod
 func (mi *MemoryIncreaser) Remediate(pod models.Pod) (models.RemediationAction, error) {
 	mi.log.Info("Increasing memory for pod: " + pod.Name)
-	
+
+	// WHY: Quantity math keeps Kubernetes units ("512Mi" * 1.5 = "768Mi")
+	requests, err := pod.Requests()
+	if err != nil {
+		return models.RemediationAction{}, fmt.Errorf("reading memory request of %s: %w", pod.Name, err)
+	}
+	current := requests.Memory()
+	increased := current.MulFraction(int64(100+mi.incrementPercent), 100)
+
 	// TODO: Actually update the deployment and commit to Git
-	
+
 	action := models.RemediationAction{
 		Type:    "memory_increase",
 		Pod:     pod,
 		Status:  "completed",
 		Reason:  "Pod was OOMKilled",
-		Message: "Memory increased by " + string(rune(mi.incrementPercent)) + "%",
+		Message: fmt.Sprintf("Memory increased by %d%% (%s -> %s)", mi.incrementPercent, current, increased),
 	}
-	
+
 	return action, nil
 }
 
@@ -0,0 +1,122 @@
+// cost-bench drives the watcher, cost index and live stream with synthetic
+// pod churn and reports how many events per second they sustain, next to
+// what re-pricing every pod on each read would cost.
+//
+//	go run ./cmd/cost-bench -pods 20000 -events 200000
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/index"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/pricing"
+	"cost-detector/pkg/stream"
+	"cost-detector/pkg/watcher"
+)
+
+func main() {
+	pods := flag.Int("pods", 20000, "pods in the simulated cluster")
+	events := flag.Int("events", 200000, "pod events to replay")
+	namespaces := flag.Int("namespaces", 200, "namespaces")
+	nodes := flag.Int("nodes", 1000, "nodes")
+	subscribers := flag.Int("subscribers", 10, "live stream subscribers reading events")
+	seed := flag.Int64("seed", 1, "random seed")
+	flag.Parse()
+
+	rng := rand.New(rand.NewSource(*seed))
+	watchr := watcher.NewWatcher("bench")
+	calc := calculator.NewCalculator()
+	calc.Nodes = watchr
+	calc.Strategies = []pricing.Strategy{pricing.NewNodeCapacityPricing(pricing.DefaultCatalog())}
+	types := []string{"m5.xlarge", "m5.2xlarge", "c5.2xlarge", "r5.xlarge"}
+	for i := 0; i < *nodes; i++ {
+		watchr.AddNode(&models.Node{Name: fmt.Sprintf("node-%d", i), InstanceType: types[i%len(types)], CPU: 8, Memory: 32})
+	}
+
+	costIndex := index.NewIndex(watchr, calc, []string{"environment"})
+	broker := stream.NewBroker(costIndex)
+	for i := 0; i < *subscribers; i++ {
+		_, sub := broker.Subscribe("")
+		go func() {
+			for range sub.Events {
+			}
+		}()
+	}
+
+	newPod := func(i int) *models.Pod {
+		return &models.Pod{
+			Name:      fmt.Sprintf("pod-%d", i),
+			Namespace: fmt.Sprintf("ns-%d", i%*namespaces),
+			Workload:  fmt.Sprintf("app-%d", i%(*namespaces*5)),
+			NodeName:  fmt.Sprintf("node-%d", rng.Intn(*nodes)),
+			Labels:    map[string]string{"team": fmt.Sprintf("team-%d", i%40), "environment": []string{"prod", "staging", "dev"}[i%3]},
+			CPU:       float64(1+rng.Intn(8)) / 4,
+			Memory:    float64(1 + rng.Intn(16)),
+		}
+	}
+
+	start := time.Now()
+	for i := 0; i < *pods; i++ {
+		watchr.Add(newPod(i))
+	}
+	report("initial adds", *pods, time.Since(start))
+
+	// Churn: 40% resize, 30% replace (delete + add), 30% new pods
+	next := *pods
+	start = time.Now()
+	replayed := 0
+	for replayed < *events {
+		i := rng.Intn(next)
+		switch r := rng.Intn(10); {
+		case r < 4:
+			pod := newPod(i)
+			watchr.Add(pod)
+			replayed++
+		case r < 7:
+			watchr.Delete(fmt.Sprintf("ns-%d", i%*namespaces), fmt.Sprintf("pod-%d", i))
+			watchr.Add(newPod(next))
+			next++
+			replayed += 2
+		default:
+			watchr.Add(newPod(next))
+			next++
+			replayed++
+		}
+	}
+	report("churn", replayed, time.Since(start))
+
+	reads := 100000
+	start = time.Now()
+	for i := 0; i < reads; i++ {
+		costIndex.Total(index.ByNamespace, fmt.Sprintf("ns-%d", i%*namespaces))
+	}
+	report("index total reads", reads, time.Since(start))
+
+	all := watchr.Pods()
+	start = time.Now()
+	total := calc.CalculateHourlyCost(all)
+	fmt.Printf("%-20s %8d pods in %v (one full re-price)\n", "CalculateHourlyCost", len(all), time.Since(start).Round(time.Microsecond))
+
+	if indexed := costIndex.Cluster().CostPerHr; abs(indexed-total) > 1e-6*total {
+		fmt.Fprintf(os.Stderr, "index total $%.4f/hr does not match full re-price $%.4f/hr\n", indexed, total)
+		os.Exit(1)
+	}
+	fmt.Printf("index and full re-price agree: $%.2f/hr across %d pods\n", total, len(all))
+}
+
+func report(what string, n int, d time.Duration) {
+	fmt.Printf("%-20s %8d in %v (%.0f/s)\n", what, n, d.Round(time.Microsecond), float64(n)/d.Seconds())
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"cost-detector/pkg/ledger"
+)
+
+const diffUsage = `Compare spend between two points in time from the cost ledger.
+
+Usage:
+  cost-detector diff --from <time> [--to <time>] [--json]
+
+Times are RFC 3339, "2006-01-02 15:04" (UTC), "yesterday 09:00", "now" or a
+duration ago such as "24h". The ledger is read from --ledger, or from a running
+detector's API with --server.
+
+Examples:
+  cost-detector diff --from "yesterday 09:00"
+  cost-detector diff --from 2024-05-01T09:00:00Z --to 2024-05-01T12:00:00Z
+  cost-detector diff --from 6h --server http://cost-detector:8080 > postmortem.md
+
+Flags:
+`
+
+// runDiff prints the cost diff between two ledger snapshots as Markdown
+func runDiff(args []string) {
+	flags := flag.NewFlagSet("cost-detector diff", flag.ExitOnError)
+	from := flags.String("from", "", "start of the comparison (required)")
+	to := flags.String("to", "now", "end of the comparison")
+	dir := flags.String("ledger", os.Getenv("LEDGER_DIR"), "cost ledger directory (env LEDGER_DIR)")
+	server := flags.String("server", os.Getenv("COST_API_URL"), "read the ledger from a running cost-detector API instead (env COST_API_URL)")
+	asJSON := flags.Bool("json", false, "print JSON instead of Markdown")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, diffUsage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *from == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	diff, err := loadDiff(*from, *to, *dir, *server)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(diff)
+		return
+	}
+	fmt.Print(diff.Markdown())
+}
+
+// loadDiff compares snapshots from the cost API when server is set, else from the ledger directory
+func loadDiff(from string, to string, dir string, server string) (*ledger.Diff, error) {
+	if server != "" {
+		return fetchDiff(server, from, to)
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("set --ledger (LEDGER_DIR) or --server (COST_API_URL)")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	start, err := ledger.ParseTime(from, now)
+	if err != nil {
+		return nil, err
+	}
+	end, err := ledger.ParseTime(to, now)
+	if err != nil {
+		return nil, err
+	}
+	costLedger, err := ledger.Open(dir, 0, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return costLedger.Diff(start, end)
+}
+
+// fetchDiff asks a running detector for the diff
+func fetchDiff(server string, from string, to string) (*ledger.Diff, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(server + "/api/v1/diff?" + url.Values{"from": {from}, "to": {to}}.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		body, _ := io.ReadAll(resp.Body)
+		json.Unmarshal(body, &apiErr)
+		return nil, fmt.Errorf("cost API returned %s: %s", resp.Status, apiErr.Error)
+	}
+	var diff ledger.Diff
+	if err := json.NewDecoder(resp.Body).Decode(&diff); err != nil {
+		return nil, fmt.Errorf("decoding cost API response: %w", err)
+	}
+	return &diff, nil
+}
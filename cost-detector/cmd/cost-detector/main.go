@@ -1,70 +1,1028 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 	"cost-detector/pkg/alerts"
+	"cost-detector/pkg/api"
+	"cost-detector/pkg/backstage"
+	"cost-detector/pkg/batch"
 	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/carbon"
+	"cost-detector/pkg/clock"
+	"cost-detector/pkg/compliance"
 	"cost-detector/pkg/config"
+	"cost-detector/pkg/costpolicy"
+	"cost-detector/pkg/cur"
+	"cost-detector/pkg/hpa"
+	"cost-detector/pkg/index"
+	"cost-detector/pkg/kube"
+	"cost-detector/pkg/leader"
+	"cost-detector/pkg/ledger"
 	"cost-detector/pkg/logger"
 	"cost-detector/pkg/models"
+	"cost-detector/pkg/network"
+	"cost-detector/pkg/notify"
+	"cost-detector/pkg/outbox"
+	"cost-detector/pkg/preview"
+	"cost-detector/pkg/pricing"
+	"cost-detector/pkg/prometheus"
+	"cost-detector/pkg/replay"
+	"cost-detector/pkg/simulator"
+	"cost-detector/pkg/stream"
 	"cost-detector/pkg/teams"
+	"cost-detector/pkg/unitcost"
 	"cost-detector/pkg/watcher"
+	"cost-detector/pkg/writeback"
+	"quantity"
 )
 
 func main() {
-	fmt.Println("🚀 Cost Detector Starting...")
-	fmt.Println("")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "replay":
+			runReplay(os.Args[2:])
+			return
+		case "outbox":
+			runOutbox(os.Args[2:])
+			return
+		}
+	}
 
 	// Load configuration
 	cfg := config.LoadConfig()
-	log := logger.NewLogger(cfg.LogLevel)
+	log := logger.NewLogger(cfg.LogLevel, cfg.LogFormat)
 
-	log.Info("Cost Detector initialized")
-	log.Info(fmt.Sprintf("Cluster: %s", cfg.ClusterName))
-	log.Info(fmt.Sprintf("Cost threshold: $%.2f/hr", cfg.CostThreshold))
+	log.Info("Cost Detector starting")
+	if cfg.ClusterName != "" {
+		log = log.With("cluster", cfg.ClusterName)
+	}
+	log.Info("Cost threshold", "costPerHr", cfg.CostThreshold)
 
 	// Initialize components
 	watchr := watcher.NewWatcher(cfg.ClusterName)
+	watchr.Log = log
+	catalog := pricing.DefaultCatalog()
 	calculator := calculator.NewCalculator()
+	calculator.Nodes = watchr
+	calculator.Strategies = pricingStrategies(cfg, catalog)
+	calculator.ExtraSidecars = cfg.SidecarContainers
+	if cfg.CarbonEnabled {
+		energy, err := energyModel(cfg)
+		if err != nil {
+			log.Error("Carbon estimates disabled", "error", err)
+		} else {
+			calculator.Energy = energy
+		}
+	}
 	alerter := alerts.NewAlerter(cfg.CostThreshold)
-	teamsClient := teams.NewTeamsClient(cfg.TeamsWebhookURL)
 
-	// Example: Simulate some pods
-	pods := []*models.Pod{
-		{Name: "app-1", Namespace: "production", CPU: 2, Memory: 4},
-		{Name: "app-2", Namespace: "production", CPU: 4, Memory: 8},
-		{Name: "debug-app", Namespace: "debug", CPU: 16, Memory: 64}, // Expensive!
+	// Alerts are written to the outbox before delivery and retried until
+	// Teams takes them; on disk when OUTBOX_DIR is set so they survive restarts
+	teams := teams.NewTeamsClient(cfg.TeamsWebhookURL)
+	teams.Log = log
+	teamsClient, err := outbox.Open(cfg.OutboxDir, teams, log)
+	if err != nil {
+		log.Error("Alert outbox unavailable, keeping it in memory", "dir", cfg.OutboxDir, "error", err)
+		teamsClient, _ = outbox.Open("", teams, log)
+	}
+	teamsClient.MaxAttempts = cfg.OutboxMaxAttempts
+	teamsClient.Backoff = time.Duration(cfg.OutboxBackoff) * time.Second
+	if pending := teamsClient.Pending(); pending > 0 {
+		log.Info("Resuming alert delivery", "alerts", pending, "dir", cfg.OutboxDir)
+	}
+
+	// Alerts are batched into one digest per channel and held through quiet hours
+	notifier := notify.NewScheduler(teamsClient, alerter, clock.Real{}, log)
+	if err := notifyDefaults(cfg, notifier); err != nil {
+		log.Error("Invalid notification settings", "error", err)
+	}
+
+	// Run until SIGTERM (or Ctrl-C), then drain
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Budgets, exemptions and routes come from a versioned budgets.yaml;
+	// refuse to start on an invalid one so a bad rollout is caught early
+	var policyFile *alerts.PolicyFile
+	if cfg.BudgetsFile != "" {
+		policyFile = alerts.NewPolicyFile(cfg.BudgetsFile, alerter)
+		if _, err := policyFile.Reload(); err != nil {
+			log.Error("Invalid budgets file", "file", cfg.BudgetsFile, "error", err)
+			return
+		}
+		policy := alerter.Policy()
+		log.Info("Loaded budgets", "namespaces", len(policy.Namespaces), "teams", len(policy.Teams), "file", cfg.BudgetsFile)
+	}
+
+	// Alerts go to the pod's Backstage owner when a catalog is configured,
+	// otherwise to its team label
+	ownerOf := (*models.Pod).Team
+	var entities *backstage.Catalog
+	if cfg.BackstageCatalogDir != "" {
+		entities = backstage.NewCatalog(cfg.BackstageCatalogDir)
+		if err := entities.Load(); err != nil {
+			log.Error("Reading the Backstage catalog failed", "dir", cfg.BackstageCatalogDir, "error", err)
+		}
+		log.Info("Loaded Backstage components", "components", len(entities.Components()), "dir", cfg.BackstageCatalogDir)
+		ownerOf = entities.Owner
+	}
+
+	// Outside a cluster, simulate some pods
+	cluster, err := kube.NewInClusterClient()
+	if err == nil {
+		watchr.Client = cluster
+	} else {
+		log.Info("Not running in a cluster, simulating pods", "error", err)
+		simulatePods(watchr)
+	}
+
+	// With several replicas only the Lease holder sends alerts
+	var elector *leader.Elector
+	if cfg.LeaderElection {
+		if cluster == nil {
+			log.Error("Leader election disabled: not running in a cluster")
+		} else {
+			elector = leader.NewElector(cluster, cfg.LeaderElectionNS, cfg.LeaderElectionLease, cfg.LeaderElectionID,
+				time.Duration(cfg.LeaderElectionSeconds)*time.Second, log)
+			elector.OnChange(func(leading bool) {
+				if leading {
+					log.Info("Became leader, sending alerts", "identity", cfg.LeaderElectionID)
+				} else {
+					log.Info("Not the leader, alerts are suppressed", "holder", elector.Holder())
+				}
+			})
+			teamsClient.Gate = elector.IsLeader
+			go elector.Run(ctx)
+		}
 	}
+	teamsClient.Start()
 
-	log.Info(fmt.Sprintf("Found %d pods", len(pods)))
+	// Start watcher
+	if err := watchr.Start(); err != nil {
+		log.Error("Failed to start watcher", "error", err)
+		return
+	}
+
+	// Serve the cost API for dashboards and kubectl-cost
+	server := api.NewServer(cfg.APIAddr, watchr, calculator)
+	server.AddSimulator(simulator.NewSimulator(catalog))
+	traffic := network.NewTracker(watchr, cfg.InternetEgressPrice, cfg.CrossAZPrice)
+	server.AddNetwork(traffic, cfg.FlowLogsToken)
+	reconciler := cur.NewReconciler(cfg.ClusterName, watchr, catalog, calculator, cfg.CURCalibration)
+	reconciler.MinHours = cfg.CURMinHours
+	server.AddReconciliation(reconciler)
+	costIndex := index.NewIndex(watchr, calculator, cfg.IndexLabels)
+	server.UseIndex(costIndex)
+	server.AddMetrics()
+	server.AddStream(stream.NewBroker(costIndex))
+	server.AddBudgets(alerter, policyFile)
+	if cfg.AlertActionsURL != "" {
+		// Alert cards link back here to acknowledge or snooze them
+		if cfg.AlertActionsSecret == "" {
+			log.Error("Alert actions disabled: ALERT_ACTIONS_SECRET is not set")
+		} else {
+			notifier.Signer = alerts.NewSigner(cfg.AlertActionsURL, cfg.AlertActionsSecret)
+			proxies, err := api.ParseProxies(cfg.TrustedProxies)
+			if err != nil {
+				log.Error("Trusting no proxies, actions are recorded as anonymous", "error", err)
+			}
+			server.AddAlertActions(alerter, notifier.Signer, proxies)
+			if cfg.AcksFile != "" {
+				if err := alerter.LoadAcks(cfg.AcksFile, time.Now()); err != nil {
+					log.Error("Reading acks failed", "file", cfg.AcksFile, "error", err)
+				}
+			}
+		}
+	}
+	batchTracker := batch.NewTracker(watchr, calculator)
+	batchTracker.AnomalyFactor = cfg.BatchAnomalyFactor
+	batchTracker.MinHistory = cfg.BatchMinHistory
+	batchTracker.History = cfg.BatchHistory
+	batchTracker.OnAnomaly(func(a batch.Anomaly) {
+		log.Warning(a.Message(), "namespace", a.Run.Namespace, "cronjob", a.Run.CronJob, "team", a.Run.Team, "cost", a.Run.Cost)
+		sendAlert(log, notifier, &models.CostAlert{
+			Team:      a.Run.Team,
+			Service:   "cronjob/" + a.Run.Namespace + "/" + a.Run.CronJob,
+			Kind:      models.AlertCronJob,
+			CostPerHr: a.Run.CostPerHr(),
+			Message:   a.Message(),
+			Severity:  alerts.SeverityWarning,
+		})
+	})
+	server.AddBatch(batchTracker)
+	hpaTracker := hpa.NewTracker(watchr, calculator)
+	hpaTracker.History = cfg.HPAHistory
+	server.AddHPA(hpaTracker)
+	checker := compliance.NewChecker(watchr, calculator, cfg.ComplianceLabels)
+	server.AddCompliance(checker)
+	if entities != nil {
+		server.AddBackstage(entities)
+	}
+
+	// The ledger keeps what each namespace has cost so far, on disk when
+	// LEDGER_DIR is set so it survives restarts
+	retention := time.Duration(cfg.LedgerRetentionDays) * 24 * time.Hour
+	costLedger, err := ledger.Open(cfg.LedgerDir, retention, watchr, calculator)
+	if err != nil {
+		log.Error("Cost ledger unavailable, keeping it in memory", "dir", cfg.LedgerDir, "error", err)
+		costLedger, _ = ledger.Open("", retention, watchr, calculator)
+	}
+	server.AddDiff(costLedger)
+	notifier.Summarizer = notify.NewSummarizer(costIndex, costLedger)
+	var previews *preview.Manager
+	if cfg.PreviewEnabled {
+		if client, err := kube.NewInClusterClient(); err != nil {
+			log.Error("Preview environments disabled", "error", err)
+		} else {
+			previews = preview.NewManager(client, costLedger, cfg.PreviewCostCap,
+				time.Duration(cfg.PreviewMaxAgeHours)*time.Hour, time.Duration(cfg.PreviewGrace)*time.Second)
+			previews.Teardown = cfg.PreviewTeardown
+			server.AddPreviews(previews)
+		}
+	}
+	var draining atomic.Bool
+	server.AddHealth(map[string]api.Check{
+		"watcher": func() error {
+			if !watchr.Synced() {
+				return fmt.Errorf("pods and nodes not listed yet")
+			}
+			return nil
+		},
+		"shutdown": func() error {
+			if draining.Load() {
+				return fmt.Errorf("draining")
+			}
+			return nil
+		},
+	})
+	if err := server.Start(); err != nil {
+		log.Error("Failed to start cost API", "addr", cfg.APIAddr, "error", err)
+		return
+	}
+	log.Info("Cost API listening", "addr", cfg.APIAddr)
+
+	// Wait for the first list of pods and nodes; /readyz fails until then
+	syncCtx, cancelSync := context.WithTimeout(ctx, 2*time.Minute)
+	if err := watchr.WaitForSync(syncCtx); err != nil {
+		log.Warning("Watcher not synced yet, continuing", "error", err)
+	}
+	cancelSync()
+	pods := watchr.Pods()
+	log.Info("Found pods", "pods", len(pods))
 
 	// Calculate total cost
 	totalCost := calculator.CalculateHourlyCost(pods)
-	log.Info(fmt.Sprintf("Total hourly cost: $%.2f", totalCost))
+	log.Info("Total hourly cost", "costPerHr", totalCost)
 
 	// Check for alerts
 	for _, pod := range pods {
 		podCost := calculator.CalculatePodCost(pod)
-		log.Info(fmt.Sprintf("Pod %s cost: $%.2f/hr", pod.Name, podCost))
+		log.Debug("Pod cost", "pod", pod.Name, "namespace", pod.Namespace, "team", ownerOf(pod), "costPerHr", podCost)
 
-		if alerter.ShouldAlert(podCost) {
-			alert := alerter.CreateAlert("platform-team", pod.Name, podCost)
-			teamsClient.SendAlert(alert)
+		if alert := alerter.CheckPod(pod, ownerOf(pod), podCost, time.Now()); alert != nil {
+			sendAlert(log, notifier, alert)
 		}
 	}
 
-	// Start watcher
-	if err := watchr.Start(); err != nil {
-		log.Error(fmt.Sprintf("Failed to start watcher: %v", err))
-		return
+	// From here on a pod alerts when it starts costing more than the threshold;
+	// handlers run under the index lock, so the alerts are sent from outside it
+	podAlerts := newAlertQueue(notifier, log)
+	go podAlerts.Run(ctx)
+	costIndex.OnChange(func(c index.Change) {
+		if c.Type == watcher.PodDeleted {
+			return
+		}
+		if alert := alerter.CheckPodChange(c.Pod, c.Old, ownerOf(c.Pod), c.Cost, c.OldCost, time.Now()); alert != nil {
+			podAlerts.Add(alert)
+		}
+	})
+
+	// Record pod and node events for offline replay
+	var recorder *replay.Recorder
+	if cfg.RecordFile != "" {
+		if recorder, err = replay.NewRecorder(cfg.RecordFile, watchr, clock.Real{}); err != nil {
+			log.Error("Event recording disabled", "file", cfg.RecordFile, "error", err)
+			recorder = nil
+		} else {
+			log.Info("Recording pod and node events", "file", cfg.RecordFile)
+		}
 	}
 
-	log.Info("Cost Detector running. Simulating for 5 seconds then exiting...")
-	
-	// Run for 5 seconds then exit (for testing)
-	time.Sleep(5 * time.Second)
-	
+	// Background loops run until shutdown
+	startRepricing(ctx, cfg, costIndex, log)
+	go notifier.Run(ctx, time.Second)
+	startLedger(ctx, cfg, costLedger, log)
+	if err := startCronJobSync(ctx, cfg, batchTracker, log); err != nil {
+		log.Error("CronJob schedules unavailable, monthly projections disabled", "error", err)
+	}
+	if err := startHPASync(ctx, cfg, hpaTracker, alerter, notifier, log); err != nil {
+		log.Error("HPAs unavailable, max-scale projections disabled", "error", err)
+	}
+	if previews != nil {
+		startPreviews(ctx, cfg, previews, notifier, log)
+	}
+	startBudgetChecks(ctx, cfg, alerter, costIndex, notifier, log)
+	if policyFile != nil {
+		startPolicyReload(ctx, cfg, policyFile, notifier, log)
+	}
+	if cfg.ComplianceNotify || cfg.LabelWebhookEnabled {
+		if err := startCompliance(ctx, cfg, checker, notifier, log); err != nil {
+			log.Error("Label compliance disabled", "error", err)
+		}
+	}
+	if cfg.CostPoliciesEnabled {
+		if err := startCostPolicies(ctx, cfg, alerter, costIndex, log); err != nil {
+			log.Error("CostPolicy reconciler disabled", "error", err)
+		}
+	}
+	if entities != nil {
+		startCatalogReload(ctx, cfg, entities, log)
+	}
+	if cfg.FlowLogsDir != "" {
+		startFlowLogs(ctx, cfg, traffic, log)
+	}
+	if cfg.CURPath != "" {
+		startReconciliation(ctx, cfg, reconciler, log)
+	}
+	if cfg.UnitMetricsFile != "" {
+		if err := startUnitCost(ctx, cfg, server, watchr, calculator, notifier, log); err != nil {
+			log.Error("Unit economics disabled", "error", err)
+		}
+	}
+	if cfg.WritebackEnabled {
+		if err := startWriteback(ctx, cfg, watchr, calculator, log); err != nil {
+			log.Error("Annotation write-back disabled", "error", err)
+		}
+	}
+
+	log.Info("Cost Detector running")
+	<-ctx.Done()
+	stop()
+	log.Info("Shutting down, draining...")
+	draining.Store(true)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error("Cost API shutdown failed", "error", err)
+	}
 	watchr.Stop()
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			log.Error("Closing the event recording failed", "file", cfg.RecordFile, "error", err)
+		} else {
+			log.Info("Recorded events", "events", recorder.Count(), "file", cfg.RecordFile)
+		}
+	}
+	if _, err := costLedger.Record(time.Now()); err != nil {
+		log.Error("Final cost ledger snapshot failed", "error", err)
+	}
+	podAlerts.Flush()
+	if held := notifier.Flush(); held > 0 {
+		log.Info("Sent pending digests early", "digests", held)
+	}
+	if unsent, err := teamsClient.Drain(shutdownCtx); err != nil && cfg.OutboxDir != "" {
+		log.Warning("Alerts not delivered, left for the next run", "alerts", unsent, "dir", cfg.OutboxDir, "error", err)
+	} else if err != nil {
+		log.Error("Alerts not delivered before shutdown", "alerts", unsent, "error", err)
+	}
+	if elector != nil {
+		if err := elector.Release(shutdownCtx); err != nil {
+			log.Error("Releasing the leader lease failed", "lease", cfg.LeaderElectionLease, "error", err)
+		}
+	}
 	log.Info("Cost Detector stopped cleanly ✅")
+}
+
+// simulatePods adds example pods and nodes, for running outside a cluster
+func simulatePods(watchr *watcher.Watcher) {
+	pods := []*models.Pod{
+		{Name: "app-1", Namespace: "production", Workload: "app", NodeName: "ip-10-0-1-10", IP: "10.0.1.101", CPU: 2, Memory: 4},
+		{Name: "app-2", Namespace: "production", Workload: "app", NodeName: "ip-10-0-1-10", IP: "10.0.1.102", CPU: 4, Memory: 8},
+		{Name: "debug-app", Namespace: "debug", Workload: "debug-app", NodeName: "ip-10-0-2-20", IP: "10.0.2.201", CPU: 16, Memory: 64}, // Expensive!
+		{Name: "batch-worker", Namespace: "batch", Workload: "batch-worker", NodeName: "ip-10-0-3-30", CPU: 4, Memory: 8},
+		{Name: "webhook", Namespace: "platform", Workload: "webhook", NodeName: "fargate-ip-10-0-4-40", CPU: 0.5, Memory: 1},
+	}
+	checkout := &models.Pod{Name: "checkout-7d9f8", Namespace: "production", Workload: "checkout", NodeName: "ip-10-0-1-10"}
+	checkout.SetContainers([]models.Container{
+		{Name: "istio-init", Init: true, Resources: resources("100m", "128Mi")},
+		{Name: "checkout", Resources: resources("1", "2Gi")},
+		{Name: "istio-proxy", Resources: resources("100m", "128Mi")},
+		{Name: "fluent-bit", Resources: resources("50m", "64Mi")},
+	}, nil)
+	pods = append(pods, checkout)
+
+	for _, pod := range pods {
+		watchr.Add(pod)
+	}
+	nodes := []*models.Node{
+		{Name: "ip-10-0-1-10", InstanceType: "m5.4xlarge", InstanceID: "i-0a1b2c3d4e5f60001", Zone: "us-east-1a", IPs: []string{"10.0.1.10"}, CPU: 16, Memory: 64},
+		{Name: "ip-10-0-2-20", InstanceType: "m5.8xlarge", InstanceID: "i-0a1b2c3d4e5f60002", Zone: "us-east-1b", IPs: []string{"10.0.2.20"}, CPU: 32, Memory: 128},
+		{Name: "ip-10-0-3-30", InstanceType: "c5.2xlarge", InstanceID: "i-0a1b2c3d4e5f60003", Zone: "us-east-1c", IPs: []string{"10.0.3.30"}, CPU: 8, Memory: 16,
+			Labels: map[string]string{pricing.KarpenterCapacityTypeLabel: pricing.Spot}},
+		{Name: "fargate-ip-10-0-4-40", Labels: map[string]string{pricing.FargateComputeTypeLabel: "fargate"}},
+	}
+	for _, node := range nodes {
+		watchr.AddNode(node)
+	}
+}
+
+// resources builds container requests for the simulated pods
+func resources(cpu string, memory string) quantity.ResourceRequirements {
+	return quantity.ResourceRequirements{Requests: quantity.ResourceList{
+		quantity.CPU:    quantity.MustParse(cpu),
+		quantity.Memory: quantity.MustParse(memory),
+	}}
+}
+
+// energyModel builds the carbon model from the bundled coefficients and config
+func energyModel(cfg *config.Config) (*carbon.Model, error) {
+	energy := carbon.NewModel(cfg.CarbonRegion)
+	energy.PUE = cfg.CarbonPUE
+	energy.Utilization = cfg.CarbonUtilization
+	for region, intensity := range cfg.CarbonIntensity {
+		energy.Intensity[region] = intensity
+	}
+	if cfg.CarbonCoefficientsFile != "" {
+		if err := energy.LoadCoefficients(cfg.CarbonCoefficientsFile); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := energy.Intensity[cfg.CarbonRegion]; !ok {
+		return nil, fmt.Errorf("no carbon intensity for region %s; set CARBON_INTENSITY=%s=<gCO2e/kWh>", cfg.CarbonRegion, cfg.CarbonRegion)
+	}
+	return energy, nil
+}
+
+// notifyDefaults applies the notification settings for the default channel
+func notifyDefaults(cfg *config.Config, notifier *notify.Scheduler) error {
+	prefs, err := notifyPreferences(cfg)
+	if err != nil {
+		return err
+	}
+	notifier.Defaults = prefs
+	if notifier.SummaryAt, err = alerts.ParseTimeOfDay(cfg.SummaryTime); err != nil {
+		return fmt.Errorf("SUMMARY_TIME: %w", err)
+	}
+	return nil
+}
+
+// notifyPreferences reads the default channel's digest window, quiet hours
+// and summaries
+func notifyPreferences(cfg *config.Config) (notify.Preferences, error) {
+	location, err := time.LoadLocation(cfg.NotifyTimezone)
+	if err != nil {
+		return notify.Preferences{}, fmt.Errorf("NOTIFY_TIMEZONE: %w", err)
+	}
+	for _, period := range cfg.Summaries {
+		if period != alerts.SummaryDaily && period != alerts.SummaryWeekly {
+			return notify.Preferences{}, fmt.Errorf("SUMMARIES: %q is not daily or weekly", period)
+		}
+	}
+	prefs := notify.Preferences{
+		Window:    time.Duration(cfg.DigestWindow) * time.Second,
+		Location:  location,
+		Summaries: cfg.Summaries,
+	}
+	if cfg.QuietHours != "" {
+		if prefs.Quiet, err = alerts.ParseQuietHours(cfg.QuietHours); err != nil {
+			return notify.Preferences{}, fmt.Errorf("QUIET_HOURS: %w", err)
+		}
+	}
+	return prefs, nil
+}
+
+// pricingStrategies builds the per-pod pricing strategies: Fargate pods pay
+// per vCPU/GB, EC2 pods pay their share of the node, and on-demand usage gets
+// the Savings Plan discount when one is configured
+func pricingStrategies(cfg *config.Config, catalog *pricing.Catalog) []pricing.Strategy {
+	strategies := []pricing.Strategy{
+		pricing.NewFargatePricing(cfg.FargateVCPUPrice, cfg.FargateGBPrice),
+		pricing.NewNodeCapacityPricing(catalog),
+	}
+	if cfg.SavingsPlanDiscount > 0 && cfg.SavingsPlanCoverage > 0 {
+		for i, strategy := range strategies {
+			strategies[i] = pricing.NewSavingsPlanPricing(strategy, cfg.SavingsPlanDiscount, cfg.SavingsPlanCoverage)
+		}
+	}
+	return strategies
+}
+
+// startRepricing periodically prices every indexed pod again, so node
+// arrivals and pricing calibration reach the running totals
+func startRepricing(ctx context.Context, cfg *config.Config, costIndex *index.Index, log *logger.Logger) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.RepriceInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if repriced := costIndex.Reprice(); repriced > 0 {
+				log.Debug("Repriced pods", "pods", repriced)
+			}
+		}
+	}()
+}
+
+// startBudgetChecks periodically compares namespace and team spend with
+// their budgets, alerting when a scope starts firing or gets more severe
+func startBudgetChecks(ctx context.Context, cfg *config.Config, alerter *alerts.Alerter, costIndex *index.Index,
+	teamsClient teams.Sender, log *logger.Logger) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.BudgetCheckInterval) * time.Second)
+		defer ticker.Stop()
+		firing := alerts.NewFiring()
+		for {
+			send, resolved := firing.Update(costpolicy.CheckBudgets(alerter, costIndex, time.Now()))
+			for _, alert := range send {
+				log.Warning(alert.Message, "team", alert.Team, "service", alert.Service, "severity", alert.Severity, "costPerHr", alert.CostPerHr)
+				sendAlert(log, teamsClient, alert)
+			}
+			for _, alert := range resolved {
+				log.Info("Back within budget", "service", alert.Service, "kind", alert.Kind)
+				if err := alerter.Resolve(alert); err != nil {
+					log.Error("Saving acks failed", "error", err)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// startCompliance notifies namespace owners about workloads missing
+// chargeback labels and serves the webhook that fills them in from the namespace
+func startCompliance(ctx context.Context, cfg *config.Config, checker *compliance.Checker,
+	teamsClient teams.Sender, log *logger.Logger) error {
+	// Namespace labels name the owner to notify and are what the webhook copies
+	var namespaces *compliance.NamespaceCache
+	if client, err := kube.NewInClusterClient(); err == nil {
+		namespaces = compliance.NewNamespaceCache(client, time.Minute)
+		checker.NamespaceLabels = func(namespace string) map[string]string {
+			labels, _ := namespaces.Labels(ctx, namespace)
+			return labels
+		}
+	} else if cfg.LabelWebhookEnabled {
+		return err
+	}
+
+	if cfg.LabelWebhookEnabled {
+		webhookServer := compliance.NewWebhookServer(cfg.LabelWebhookAddr, cfg.LabelWebhookCertFile, cfg.LabelWebhookKeyFile,
+			compliance.NewWebhook(namespaces, cfg.ComplianceLabels))
+		if err := webhookServer.Start(); err != nil {
+			return err
+		}
+		go func() {
+			<-ctx.Done()
+			webhookServer.Stop()
+		}()
+		log.Info("Label webhook listening", "addr", cfg.LabelWebhookAddr)
+	}
+
+	if cfg.ComplianceNotify {
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.ComplianceInterval) * time.Second)
+			defer ticker.Stop()
+			for {
+				report := checker.Report("")
+				log.Info("Label compliance", "attributablePercent", report.AttributedPercent, "workloadsMissingLabels", len(report.Workloads),
+					"labels", strings.Join(report.Labels, ","))
+				for _, alert := range report.Alerts(5) {
+					sendAlert(log, teamsClient, alert)
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// startCostPolicies periodically loads CostPolicy resources into the
+// alerter and writes their spend back as status conditions
+func startCostPolicies(ctx context.Context, cfg *config.Config, alerter *alerts.Alerter, costIndex *index.Index, log *logger.Logger) error {
+	client, err := kube.NewInClusterClient()
+	if err != nil {
+		return err
+	}
+	reconciler := costpolicy.NewReconciler(client, alerter, costIndex)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.CostPolicyInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			loaded, err := reconciler.Reconcile(ctx)
+			if err != nil {
+				log.Error("CostPolicy reconcile failed", "error", err)
+			}
+			log.Debug("Loaded CostPolicies", "costPolicies", loaded)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Info("Reconciling CostPolicies", "every", seconds(cfg.CostPolicyInterval))
+	return nil
+}
+
+// startPolicyReload periodically reloads budgets.yaml, so merged policy
+// changes apply without a restart. Invalid edits are rejected and reported.
+func startPolicyReload(ctx context.Context, cfg *config.Config, policyFile *alerts.PolicyFile,
+	teamsClient teams.Sender, log *logger.Logger) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.BudgetsReloadInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			changed, err := policyFile.Reload()
+			if err != nil {
+				log.Error("Rejected budgets file, keeping the previous policy", "file", cfg.BudgetsFile, "error", err)
+				sendAlert(log, teamsClient, &models.CostAlert{
+					Service:  cfg.BudgetsFile,
+					Kind:     models.AlertPolicy,
+					Message:  fmt.Sprintf("Rejected an invalid edit, keeping the previous policy:\n%v", err),
+					Severity: alerts.SeverityWarning,
+				})
+			} else if changed {
+				log.Info("Reloaded budgets", "file", cfg.BudgetsFile, "checksum", policyFile.Status().Checksum[:12])
+			}
+		}
+	}()
+}
+
+// startCronJobSync periodically reads CronJob schedules, so each CronJob's
+// runs can be projected over a month
+func startCronJobSync(ctx context.Context, cfg *config.Config, batchTracker *batch.Tracker, log *logger.Logger) error {
+	client, err := kube.NewInClusterClient()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.CronJobSyncInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			var cronJobs kube.CronJobList
+			if err := client.Get(ctx, kube.CronJobsPath, &cronJobs); err != nil {
+				log.Error("Listing CronJobs failed", "error", err)
+			} else {
+				for _, err := range batchTracker.SetCronJobs(cronJobs.Items) {
+					log.Error(err.Error())
+				}
+				log.Debug("Read CronJob schedules", "cronJobs", len(cronJobs.Items))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// startHPASync periodically reads HPAs, prices each autoscaled workload at
+// its bounds, and alerts when a namespace would be over budget at max scale
+func startHPASync(ctx context.Context, cfg *config.Config, hpaTracker *hpa.Tracker, alerter *alerts.Alerter,
+	teamsClient teams.Sender, log *logger.Logger) error {
+	client, err := kube.NewInClusterClient()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.HPASyncInterval) * time.Second)
+		defer ticker.Stop()
+		firing := alerts.NewFiring()
+		for {
+			var hpas kube.HPAList
+			if err := client.Get(ctx, kube.HPAsPath, &hpas); err != nil {
+				log.Error("Listing HPAs failed", "error", err)
+			} else {
+				for _, event := range hpaTracker.SetHPAs(hpas.Items) {
+					log.Info(event.Message(), "namespace", event.Namespace, "workload", event.Workload, "team", event.Team, "cost", event.Cost)
+				}
+				log.Debug("Read HPAs", "hpas", len(hpas.Items))
+
+				var fired []*models.CostAlert
+				for _, exposure := range hpaTracker.Exposures() {
+					if alert := alerter.CheckExposure(exposure.Namespace, exposure.MaxCostPerHr, time.Now()); alert != nil {
+						fired = append(fired, alert)
+					}
+				}
+				send, resolved := firing.Update(fired)
+				for _, alert := range send {
+					log.Warning(alert.Message, "service", alert.Service, "severity", alert.Severity, "costPerHr", alert.CostPerHr)
+					sendAlert(log, teamsClient, alert)
+				}
+				for _, alert := range resolved {
+					log.Info("Back within budget at max scale", "service", alert.Service)
+					if err := alerter.Resolve(alert); err != nil {
+						log.Error("Saving acks failed", "error", err)
+					}
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// startLedger periodically snapshots every workload's cost into the ledger
+func startLedger(ctx context.Context, cfg *config.Config, costLedger *ledger.Ledger, log *logger.Logger) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.LedgerInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			if snapshot, err := costLedger.Record(time.Now()); err != nil {
+				log.Error("Cost ledger snapshot failed", "error", err)
+			} else {
+				log.Debug("Recorded workloads in the cost ledger", "workloads", len(snapshot.Workloads))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// startPreviews periodically checks preview namespaces against their cost
+// cap and maximum age, warning owners and reporting each teardown's final cost
+func startPreviews(ctx context.Context, cfg *config.Config, previews *preview.Manager,
+	teamsClient teams.Sender, log *logger.Logger) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.PreviewInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			notices, err := previews.Check(ctx, time.Now())
+			if err != nil {
+				log.Error("Preview environment check failed", "error", err)
+			}
+			for _, notice := range notices {
+				log.Info(notice.Message, "team", notice.Team, "service", notice.Service, "severity", notice.Severity)
+				sendAlert(log, teamsClient, notice)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Info("Tracking preview environments", "every", seconds(cfg.PreviewInterval), "costCap", cfg.PreviewCostCap,
+		"maxAgeHours", cfg.PreviewMaxAgeHours)
+}
+
+// startCatalogReload periodically reloads Backstage entity files, so
+// ownership changes merged to the catalog (or pulled by git-sync) apply
+func startCatalogReload(ctx context.Context, cfg *config.Config, entities *backstage.Catalog, log *logger.Logger) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.BackstageReloadInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := entities.Load(); err != nil {
+				log.Error("Reloading the Backstage catalog failed", "dir", cfg.BackstageCatalogDir, "error", err)
+			}
+			log.Debug("Reloaded Backstage components", "components", len(entities.Components()))
+		}
+	}()
+}
+
+// startFlowLogs periodically prices new VPC flow log files
+func startFlowLogs(ctx context.Context, cfg *config.Config, traffic *network.Tracker, log *logger.Logger) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.FlowLogsInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			priced, errs := traffic.IngestDir(cfg.FlowLogsDir)
+			for _, err := range errs {
+				log.Error("Flow log ingest failed", "error", err)
+			}
+			if priced > 0 {
+				log.Info("Priced flow log records", "records", priced)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Info("Reading VPC flow logs", "dir", cfg.FlowLogsDir, "every", seconds(cfg.FlowLogsInterval))
+}
+
+// startReconciliation periodically imports the Cost and Usage Report and
+// calibrates pricing against it
+func startReconciliation(ctx context.Context, cfg *config.Config, reconciler *cur.Reconciler, log *logger.Logger) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.CURInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			report, err := reconciler.Import(cfg.CURPath)
+			if err != nil {
+				log.Error("CUR reconciliation failed", "error", err)
+			} else {
+				log.Info("CUR reconciliation", "billed", report.BilledCost, "estimated", report.EstimatedCost,
+					"instances", report.Instances, "driftPercent", report.DriftPercent)
+				for _, change := range report.Calibrated {
+					log.Info("Calibrated", "change", change)
+				}
+				for _, failure := range report.Errors {
+					log.Error("Skipped CUR file", "error", failure)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Info("Reconciling with the Cost and Usage Report", "path", cfg.CURPath, "every", seconds(cfg.CURInterval))
+}
+
+// startUnitCost periodically samples cost per business unit and alerts
+// when it rises sharply after a deploy
+func startUnitCost(ctx context.Context, cfg *config.Config, server *api.Server, watchr *watcher.Watcher,
+	calc *calculator.Calculator, teamsClient teams.Sender, log *logger.Logger) error {
+	if cfg.PrometheusURL == "" {
+		return fmt.Errorf("UNIT_METRICS_FILE is set but PROMETHEUS_URL is not")
+	}
+	metrics, err := unitcost.LoadMetrics(cfg.UnitMetricsFile)
+	if err != nil {
+		return err
+	}
+	tracker := unitcost.NewTracker(metrics, prometheus.NewClient(cfg.PrometheusURL, cfg.PrometheusToken), watchr, calc)
+	tracker.Window = time.Duration(cfg.UnitCostWindow) * time.Second
+	tracker.Threshold = cfg.UnitCostRegression
+	server.AddUnitCost(tracker)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.UnitCostInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			regressions, err := tracker.Sample(ctx, time.Now())
+			if err != nil {
+				log.Error("Unit cost sample incomplete", "error", err)
+			}
+			for _, r := range regressions {
+				log.Info(r.Message())
+				sendAlert(log, teamsClient, &models.CostAlert{
+					Team:      r.Team,
+					Service:   r.Service,
+					Kind:      models.AlertUnitCost,
+					CostPerHr: r.CostPerHr,
+					Message:   r.Message(),
+					Severity:  "warning",
+				})
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Info("Tracking cost per unit", "services", len(metrics), "every", seconds(cfg.UnitCostInterval))
+	return nil
+}
+
+// startWriteback periodically patches pod and namespace costs as annotations
+func startWriteback(ctx context.Context, cfg *config.Config, watchr *watcher.Watcher, calc *calculator.Calculator, log *logger.Logger) error {
+	client, err := kube.NewInClusterClient()
+	if err != nil {
+		return err
+	}
+	writer := writeback.NewWriter(client, calc, time.Duration(cfg.WritebackMinInterval)*time.Second, cfg.WritebackQPS)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.WritebackInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			patched, err := writer.Sync(ctx, watchr.Pods())
+			if err != nil {
+				log.Error("Cost write-back failed", "error", err)
+			} else {
+				log.Debug("Cost write-back patched objects", "objects", patched)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Info("Writing cost annotations", "every", seconds(cfg.WritebackInterval))
+	return nil
+}
+
+// seconds formats an interval setting in seconds for logs, e.g. "5m0s"
+func seconds(n int) string {
+	return (time.Duration(n) * time.Second).String()
+}
+
+// sendAlert hands an alert over for delivery, logging it when that fails:
+// the loops raising alerts have no one else to tell
+func sendAlert(log *logger.Logger, sender teams.Sender, alert *models.CostAlert) {
+	if err := sender.SendAlert(alert); err != nil {
+		log.Error("Sending alert failed", "service", alert.Service, "kind", alert.Kind, "route", alert.Route, "error", err)
+	}
+}
+
+// alertQueue holds alerts raised under a lock until a goroutine outside it
+// hands them to the sender, in the order they were raised
+type alertQueue struct {
+	sender teams.Sender
+	log    *logger.Logger
+
+	mu      sync.Mutex
+	pending []*models.CostAlert
+	ready   chan struct{}
+}
+
+// newAlertQueue creates a queue sending to sender
+func newAlertQueue(sender teams.Sender, log *logger.Logger) *alertQueue {
+	return &alertQueue{sender: sender, log: log, ready: make(chan struct{}, 1)}
+}
+
+// Add queues an alert without blocking
+func (q *alertQueue) Add(alert *models.CostAlert) {
+	q.mu.Lock()
+	q.pending = append(q.pending, alert)
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends queued alerts as they arrive until ctx is done
+func (q *alertQueue) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.ready:
+		}
+		q.Flush()
+	}
+}
+
+// Flush sends the alerts queued so far
+func (q *alertQueue) Flush() {
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+	for _, alert := range pending {
+		sendAlert(q.log, q.sender, alert)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"cost-detector/pkg/outbox"
+	"cost-detector/pkg/teams"
+)
+
+const outboxUsage = `Inspect and replay alerts that could not be delivered to Teams.
+
+Alerts that fail OUTBOX_MAX_ATTEMPTS times are moved to the dead-letter
+queue in OUTBOX_DIR/dead. Replay sends them again, to the webhook each alert
+was routed to or TEAMS_WEBHOOK_URL, and removes the ones delivered.
+
+Usage:
+  cost-detector outbox list [--pending] [--json]
+  cost-detector outbox replay [<id>...]
+  cost-detector outbox drop (<id>... | --all)
+
+Flags:
+`
+
+// runOutbox lists, replays or drops dead-lettered alerts
+func runOutbox(args []string) {
+	flags := flag.NewFlagSet("cost-detector outbox", flag.ExitOnError)
+	dir := flags.String("dir", os.Getenv("OUTBOX_DIR"), "outbox directory (env OUTBOX_DIR)")
+	pending := flags.Bool("pending", false, "list alerts still being retried instead of dead-lettered ones")
+	all := flags.Bool("all", false, "drop every dead-lettered alert")
+	asJSON := flags.Bool("json", false, "print JSON")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, outboxUsage)
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	command := args[0]
+	flags.Parse(args[1:])
+	ids := flags.Args()
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "error: set --dir (OUTBOX_DIR)")
+		os.Exit(2)
+	}
+
+	var err error
+	switch command {
+	case "list":
+		sub := outbox.DeadDir
+		if *pending {
+			sub = outbox.PendingDir
+		}
+		var entries []outbox.Entry
+		if entries, err = outbox.List(*dir, sub); err == nil {
+			printEntries(entries, *asJSON)
+		}
+	case "replay":
+		var delivered, failed []outbox.Entry
+		delivered, failed, err = outbox.Redeliver(*dir, ids, teams.NewTeamsClient(os.Getenv("TEAMS_WEBHOOK_URL")))
+		fmt.Printf("Delivered %d alerts\n", len(delivered))
+		if len(failed) > 0 {
+			fmt.Printf("%d failed again and stay in the dead-letter queue:\n\n", len(failed))
+			printEntries(failed, *asJSON)
+			if err == nil {
+				os.Exit(1)
+			}
+		}
+	case "drop":
+		if len(ids) == 0 && !*all {
+			fmt.Fprintln(os.Stderr, "error: name the alerts to drop, or pass --all")
+			os.Exit(2)
+		}
+		var dropped []outbox.Entry
+		dropped, err = outbox.Discard(*dir, ids)
+		fmt.Printf("Dropped %d alerts\n", len(dropped))
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// printEntries lists outbox entries, oldest first
+func printEntries(entries []outbox.Entry, asJSON bool) {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(entries)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintln(tw, "ID\tCREATED\tATTEMPTS\tSEVERITY\tSERVICE\tROUTE\tLAST ERROR")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", e.ID, e.Created.UTC().Format(time.RFC3339), e.Attempts,
+			e.Alert.Severity, e.Alert.Service, e.Alert.Route, e.LastError)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"cost-detector/pkg/alerts"
+	"cost-detector/pkg/backstage"
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/config"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/pricing"
+	"cost-detector/pkg/replay"
+	"cost-detector/pkg/teams"
+)
+
+const replayUsage = `Replay recorded pod and node events through pricing, alerting and
+notification on a fake clock, and list the alerts they raise.
+
+Record with RECORD_FILE=/data/events.jsonl on a running detector. Thresholds,
+budgets and pricing come from the same environment variables the detector
+reads, so a recorded day can be checked against a changed budgets.yaml.
+
+Usage:
+  cost-detector replay --file events.jsonl [--speed 3600] [--budgets budgets.yaml] [--json]
+
+Flags:
+`
+
+// runReplay replays a recording and prints the alerts it raised
+func runReplay(args []string) {
+	cfg := config.LoadConfig()
+	flags := flag.NewFlagSet("cost-detector replay", flag.ExitOnError)
+	file := flags.String("file", cfg.RecordFile, "recording to replay (env RECORD_FILE)")
+	speed := flags.Float64("speed", 0, "recorded seconds per second, e.g. 3600; 0 replays as fast as possible")
+	budgets := flags.String("budgets", cfg.BudgetsFile, "budgets.yaml to check against (env BUDGETS_FILE)")
+	threshold := flags.Float64("threshold", cfg.CostThreshold, "per-pod alert threshold in $/hr (env COST_THRESHOLD)")
+	interval := flags.Duration("budget-interval", time.Duration(cfg.BudgetCheckInterval)*time.Second, "recorded time between budget checks")
+	notify := flags.Bool("notify", false, "also send the alerts to Teams (TEAMS_WEBHOOK_URL)")
+	asJSON := flags.Bool("json", false, "print the result as JSON, e.g. to compare with a known-good replay")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, replayUsage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *file == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	records, err := replay.ReadFile(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	calc := calculator.NewCalculator()
+	calc.Strategies = pricingStrategies(cfg, pricing.DefaultCatalog())
+	calc.ExtraSidecars = cfg.SidecarContainers
+	alerter := alerts.NewAlerter(*threshold)
+	if *budgets != "" {
+		policy, err := alerts.LoadPolicy(*budgets)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		alerter.SetPolicy(policy)
+	}
+	var sender teams.Sender = discard{}
+	if *notify {
+		sender = teams.NewTeamsClient(cfg.TeamsWebhookURL)
+	}
+
+	replayer := replay.NewReplayer(calc, alerter, sender)
+	replayer.Speed = *speed
+	replayer.BudgetInterval = *interval
+	if replayer.Notify, err = notifyPreferences(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	// The result goes to stdout
+	replayer.Log.SetOutput(os.Stderr)
+	replayer.IndexLabels = cfg.IndexLabels
+	if cfg.BackstageCatalogDir != "" {
+		entities := backstage.NewCatalog(cfg.BackstageCatalogDir)
+		if err := entities.Load(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: Backstage catalog: %v\n", err)
+			os.Exit(1)
+		}
+		replayer.Owner = entities.Owner
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	result, err := replayer.Run(ctx, records)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay stopped: %v\n", err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+		return
+	}
+	printReplay(result)
+}
+
+// printReplay lists alerts and recoveries in recorded time order
+func printReplay(result *replay.Result) {
+	fmt.Printf("Replayed %d records from %s to %s with %d budget checks: %d alerts\n\n",
+		result.Records, result.From.Format(time.RFC3339), result.To.Format(time.RFC3339), result.Checks, len(result.Alerts))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintln(tw, "TIME\tSEVERITY\tTEAM\tSERVICE\t$/HR\tMESSAGE")
+	events := append(append([]replay.Sent{}, result.Alerts...), result.Resolved...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	for _, sent := range events {
+		alert := sent.Alert
+		if alert.Severity == "" {
+			fmt.Fprintf(tw, "%s\tresolved\t\t%s\t\tback within budget\n", sent.Time.Format(time.RFC3339), alert.Service)
+			continue
+		}
+		// A digest lists its alerts a line each
+		message := strings.ReplaceAll(alert.Message, "\n", "; ")
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.2f\t%s\n", sent.Time.Format(time.RFC3339), alert.Severity, alert.Team,
+			alert.Service, alert.CostPerHr, message)
+	}
+}
+
+// discard drops alerts; the replay result lists them
+type discard struct{}
+
+func (discard) SendAlert(*models.CostAlert) error { return nil }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"cost-detector/pkg/compliance"
+)
+
+// runCompliance lists workloads missing chargeback labels, most expensive first
+func runCompliance(args []string) {
+	flags := flag.NewFlagSet("kubectl-cost compliance", flag.ExitOnError)
+	server := flags.String("server", getEnv("COST_API_URL", "http://localhost:8080"), "cost-detector API URL (env COST_API_URL)")
+	namespace := flags.String("n", "", "only show this namespace")
+	flags.Parse(args)
+
+	var report compliance.Report
+	if err := fetchJSON(*server, "/api/v1/compliance", query(map[string]string{"namespace": *namespace}), &report); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%.1f%% of $%.2f/hr is attributable; $%.2f/hr is missing %s\n\n",
+		report.AttributedPercent, report.TotalCostPerHr, report.UnattributedPerHr, strings.Join(report.Labels, " or "))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintln(tw, "NAMESPACE\tWORKLOAD\tPODS\tMISSING\t$/HR\t$/MONTH")
+	for _, w := range report.Workloads {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%.2f\t%.2f\n", w.Namespace, w.Name, w.Pods, strings.Join(w.Missing, ","), w.CostPerHr, w.CostPerMonth)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"cost-detector/pkg/api"
+	"cost-detector/pkg/models"
+)
+
+const usage = `Show Kubernetes costs from cost-detector.
+
+Usage:
+  kubectl cost [namespace|workload|pod|team|node|label:<key>] [flags]
+  kubectl cost simulate [--spot-namespace ns] [--graviton] [--families m6g,c6g]
+  kubectl cost overhead
+  kubectl cost compliance [-n namespace]
+
+Examples:
+  kubectl cost                      # cost per namespace
+  kubectl cost workload -n payments # cost per workload in "payments"
+  kubectl cost team                 # cost per team label
+  kubectl cost label:environment    # cost per value of an indexed label
+  kubectl cost simulate --graviton  # cheapest node set on Graviton
+  kubectl cost overhead             # sidecar and platform overhead per namespace
+  kubectl cost compliance           # workloads missing team / cost-center labels
+
+Flags:
+`
+
+func main() {
+	flags := flag.NewFlagSet("kubectl-cost", flag.ExitOnError)
+	server := flags.String("server", getEnv("COST_API_URL", "http://localhost:8080"), "cost-detector API URL (env COST_API_URL)")
+	namespace := flags.String("n", "", "only show this namespace")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "simulate":
+			runSimulate(args[1:])
+			return
+		case "overhead":
+			runOverhead(args[1:])
+			return
+		case "compliance":
+			runCompliance(args[1:])
+			return
+		}
+	}
+
+	groupBy := "namespace"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		groupBy, args = args[0], args[1:]
+	}
+	flags.Parse(args)
+
+	var costs api.CostsResponse
+	err := fetchJSON(*server, "/api/v1/costs", query(map[string]string{"groupBy": groupBy, "namespace": *namespace}), &costs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	printCosts(&costs)
+}
+
+// fetchJSON reads a cost API endpoint and decodes the response into out
+func fetchJSON(server string, path string, query url.Values, out interface{}) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(server + path + "?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("cost API returned %s: %s", resp.Status, apiErr.Error)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding cost API response: %w", err)
+	}
+	return nil
+}
+
+// query builds query parameters, skipping empty values
+func query(params map[string]string) url.Values {
+	values := url.Values{}
+	for k, v := range params {
+		if v != "" {
+			values.Set(k, v)
+		}
+	}
+	return values
+}
+
+// printCosts prints a cost table, most expensive first (the API already sorts).
+// Estimated emissions are added as a last column when the API has them.
+func printCosts(costs *api.CostsResponse) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	// Workloads and pods live in a namespace; other groupings stand alone
+	scoped := costs.GroupBy == "workload" || costs.GroupBy == "pod"
+	column := strings.ToUpper(strings.TrimPrefix(costs.GroupBy, "label:"))
+	emissions := func(gramsPerHr float64) string {
+		if costs.TotalCO2e <= 0 {
+			return "\n"
+		}
+		return fmt.Sprintf("\t%.1f\n", gramsPerHr*models.HoursPerMonth/1000)
+	}
+	header := emissions(0)
+	if costs.TotalCO2e > 0 {
+		header = "\tKGCO2E/MONTH\n"
+	}
+	switch {
+	case costs.GroupBy == "namespace":
+		fmt.Fprint(tw, "NAMESPACE\tPODS\tCPU\tMEMORY(GiB)\t$/HR\tNETWORK $/HR\t$/MONTH"+header)
+	case scoped:
+		fmt.Fprintf(tw, "NAMESPACE\t%s\tPODS\tCPU\tMEMORY(GiB)\t$/HR\t$/MONTH"+header, column)
+	default:
+		fmt.Fprintf(tw, "%s\tPODS\tCPU\tMEMORY(GiB)\t$/HR\t$/MONTH"+header, column)
+	}
+	for _, item := range costs.Items {
+		switch {
+		case costs.GroupBy == "namespace":
+			fmt.Fprintf(tw, "%s\t%d\t%.2f\t%.1f\t%.2f\t%.2f\t%.2f%s", item.Name, item.Pods, item.CPU, item.Memory,
+				item.CostPerHr, item.NetworkCostPerHr, (item.CostPerHr+item.NetworkCostPerHr)*models.HoursPerMonth, emissions(item.CO2ePerHr))
+		case scoped:
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%.2f\t%.1f\t%.2f\t%.2f%s", item.Namespace, item.Name, item.Pods, item.CPU, item.Memory,
+				item.CostPerHr, item.CostPerHr*models.HoursPerMonth, emissions(item.CO2ePerHr))
+		default:
+			fmt.Fprintf(tw, "%s\t%d\t%.2f\t%.1f\t%.2f\t%.2f%s", item.Name, item.Pods, item.CPU, item.Memory,
+				item.CostPerHr, item.CostPerHr*models.HoursPerMonth, emissions(item.CO2ePerHr))
+		}
+	}
+	compute, network := 0.0, 0.0
+	for _, item := range costs.Items {
+		compute += item.CostPerHr
+		network += item.NetworkCostPerHr
+	}
+	switch {
+	case costs.GroupBy == "namespace":
+		fmt.Fprintf(tw, "TOTAL\t\t\t\t%.2f\t%.2f\t%.2f%s", compute, network, costs.TotalCost*models.HoursPerMonth, emissions(costs.TotalCO2e))
+	case scoped:
+		fmt.Fprintf(tw, "TOTAL\t\t\t\t\t%.2f\t%.2f%s", compute, costs.TotalCost*models.HoursPerMonth, emissions(costs.TotalCO2e))
+	default:
+		fmt.Fprintf(tw, "TOTAL\t\t\t\t%.2f\t%.2f%s", compute, costs.TotalCost*models.HoursPerMonth, emissions(costs.TotalCO2e))
+	}
+}
+
+// getEnv gets an env var with a default
+func getEnv(key string, defaultVal string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultVal
+}
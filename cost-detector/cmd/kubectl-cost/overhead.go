@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"cost-detector/pkg/models"
+)
+
+// runOverhead shows platform overhead (sidecars, injected init containers)
+// next to application cost for each namespace
+func runOverhead(args []string) {
+	flags := flag.NewFlagSet("kubectl-cost overhead", flag.ExitOnError)
+	server := flags.String("server", getEnv("COST_API_URL", "http://localhost:8080"), "cost-detector API URL (env COST_API_URL)")
+	flags.Parse(args)
+
+	var summaries []models.OverheadSummary
+	if err := fetchJSON(*server, "/api/v1/overhead", nil, &summaries); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintln(tw, "NAMESPACE\tAPP $/HR\tOVERHEAD $/HR\tOVERHEAD %\tTOP SIDECARS")
+	for _, s := range summaries {
+		fmt.Fprintf(tw, "%s\t%.2f\t%.2f\t%.1f%%\t%s\n",
+			s.Namespace, s.ApplicationCost, s.OverheadCost, s.OverheadPercent, topSidecars(s.BySidecar, 3))
+	}
+}
+
+// topSidecars lists the most expensive sidecar kinds, e.g. "istio-proxy $0.02"
+func topSidecars(bySidecar map[string]float64, n int) string {
+	kinds := make([]string, 0, len(bySidecar))
+	for kind := range bySidecar {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return bySidecar[kinds[i]] > bySidecar[kinds[j]] })
+	if len(kinds) > n {
+		kinds = kinds[:n]
+	}
+
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%s $%.3f", kind, bySidecar[kind])
+	}
+	return strings.Join(parts, ", ")
+}
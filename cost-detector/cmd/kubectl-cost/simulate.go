@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/simulator"
+)
+
+// stringList is a flag that can be repeated or given comma-separated
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runSimulate asks the cost API for the cheapest node set under a what-if scenario
+func runSimulate(args []string) {
+	flags := flag.NewFlagSet("kubectl-cost simulate", flag.ExitOnError)
+	server := flags.String("server", getEnv("COST_API_URL", "http://localhost:8080"), "cost-detector API URL (env COST_API_URL)")
+	var spotNamespaces, families stringList
+	flags.Var(&spotNamespaces, "spot-namespace", "move this namespace to spot capacity (repeatable)")
+	flags.Var(&families, "families", "only use these instance families, e.g. m6g,c6g")
+	graviton := flags.Bool("graviton", false, "only use Graviton (arm64) instance types")
+	flags.Parse(args)
+
+	params := map[string]string{
+		"spotNamespaces": spotNamespaces.String(),
+		"families":       families.String(),
+	}
+	if *graviton {
+		params["graviton"] = strconv.FormatBool(*graviton)
+	}
+
+	var plan simulator.Plan
+	if err := fetchJSON(*server, "/api/v1/simulate", query(params), &plan); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	printPlan(&plan)
+}
+
+// printPlan prints the planned node set and the savings against today
+func printPlan(plan *simulator.Plan) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "INSTANCE TYPE\tCAPACITY\tCOUNT\t$/HR\t$/MONTH")
+	for _, group := range plan.Nodes {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.2f\t%.2f\n",
+			group.InstanceType, group.CapacityType, group.Count, group.CostPerHr, group.CostPerHr*models.HoursPerMonth)
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t%d\t%.2f\t%.2f\n", plan.NodeCount, plan.CostPerHr, plan.CostPerHr*models.HoursPerMonth)
+	tw.Flush()
+
+	fmt.Println()
+	if plan.CurrentCost > 0 {
+		fmt.Printf("Today: %d nodes at $%.2f/hr. Savings: $%.2f/hr ($%.2f/month, %.1f%%)\n",
+			plan.CurrentNodes, plan.CurrentCost, plan.SavingsPerHr, plan.SavingsPerHr*models.HoursPerMonth, plan.SavingsPercent)
+	} else {
+		fmt.Println("Today's node cost is unknown (instance types missing from the catalog), so no savings are shown.")
+	}
+	if len(plan.Unschedulable) > 0 {
+		fmt.Printf("Pods that fit no allowed instance type: %s\n", strings.Join(plan.Unschedulable, ", "))
+	}
+}
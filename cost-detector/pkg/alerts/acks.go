@@ -0,0 +1,264 @@
+package alerts
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cost-detector/pkg/models"
+)
+
+// Actions an alert's owner can take from its card
+const (
+	ActionAcknowledge = "ack"       // Silence the alert until it gets more severe or resolves
+	ActionSnooze4h    = "snooze4h"  // Silence the alert for 4 hours
+	ActionSnooze24h   = "snooze24h" // Silence the alert for a day
+)
+
+// AcknowledgeFor is how long an acknowledgement holds for alerts that are
+// never resolved, such as a pod over the threshold
+const AcknowledgeFor = 7 * 24 * time.Hour
+
+// LinkValidity is how long the action links on an alert card work
+const LinkValidity = 7 * 24 * time.Hour
+
+// ErrUnknownAction is returned for an action that isn't acknowledge or a snooze
+var ErrUnknownAction = errors.New("unknown action")
+
+// snoozes maps the snooze actions to how long they silence an alert
+var snoozes = map[string]time.Duration{ActionSnooze4h: 4 * time.Hour, ActionSnooze24h: 24 * time.Hour}
+
+// actionTitles labels the action buttons
+var actionTitles = []struct{ action, title string }{
+	{ActionAcknowledge, "Acknowledge"},
+	{ActionSnooze4h, "Snooze 4h"},
+	{ActionSnooze24h, "Snooze 24h"},
+}
+
+// Ack records that someone acknowledged or snoozed an alert
+type Ack struct {
+	Service  string    `json:"service"`
+	Kind     string    `json:"kind,omitempty"` // Alert kind, e.g. "budget"; other kinds for the service still go out
+	Route    string    `json:"route,omitempty"`
+	Severity string    `json:"severity"` // Severity acknowledged; a more severe alert still goes out
+	Action   string    `json:"action"`
+	By       string    `json:"by"`
+	At       time.Time `json:"at"`
+	Until    time.Time `json:"until"`
+}
+
+// Snoozed reports whether the ack silences its kind of alert for its
+// service whatever the severity
+func (a Ack) Snoozed() bool {
+	return a.Action != ActionAcknowledge
+}
+
+// String describes the ack for digests, e.g. "snoozed by jane until 14:00 UTC"
+func (a Ack) String() string {
+	if a.Snoozed() {
+		return fmt.Sprintf("snoozed by %s until %s", a.By, a.Until.UTC().Format("Jan 2 15:04 MST"))
+	}
+	return fmt.Sprintf("acknowledged by %s at %s", a.By, a.At.UTC().Format("Jan 2 15:04 MST"))
+}
+
+// key is the key of the alerts the ack applies to
+func (a Ack) key() string {
+	return (&models.CostAlert{Kind: a.Kind, Service: a.Service}).Key()
+}
+
+// LoadAcks keeps acks in a JSONL file from now on, one ack per line, and
+// picks up the ones a previous run left there that haven't expired. A
+// missing file is no error.
+func (a *Alerter) LoadAcks(path string, now time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acksFile = path
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		var ack Ack
+		if err := json.Unmarshal(scanner.Bytes(), &ack); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if now.Before(ack.Until) {
+			a.acks[ack.key()] = ack
+		}
+	}
+	return scanner.Err()
+}
+
+// saveAcks rewrites the acks file, if there is one; a.mu must be held
+func (a *Alerter) saveAcks() error {
+	if a.acksFile == "" {
+		return nil
+	}
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	for _, ack := range a.acks {
+		if err := encoder.Encode(ack); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(a.acksFile+".tmp", b.Bytes(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(a.acksFile+".tmp", a.acksFile)
+}
+
+// Acknowledge records an action on a kind of alert for a service, replacing
+// any earlier one. The ack holds even if saving it to the acks file fails.
+func (a *Alerter) Acknowledge(kind string, service string, route string, severity string, action string, by string, now time.Time) (Ack, error) {
+	until := now.Add(AcknowledgeFor)
+	if snooze, ok := snoozes[action]; ok {
+		until = now.Add(snooze)
+	} else if action != ActionAcknowledge {
+		return Ack{}, fmt.Errorf("%w %q", ErrUnknownAction, action)
+	}
+	ack := Ack{Service: service, Kind: kind, Route: route, Severity: severity, Action: action, By: by, At: now, Until: until}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acks[ack.key()] = ack
+	if err := a.saveAcks(); err != nil {
+		return ack, fmt.Errorf("saving acks: %w", err)
+	}
+	return ack, nil
+}
+
+// Silenced returns the ack in effect for an alert's kind and service, and
+// whether it keeps the alert from being sent. An acknowledged alert is sent
+// again when it gets more severe.
+func (a *Alerter) Silenced(alert *models.CostAlert, now time.Time) (*Ack, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	ack, ok := a.acks[alert.Key()]
+	if !ok || !now.Before(ack.Until) {
+		return nil, false
+	}
+	return &ack, ack.Snoozed() || severityRank[alert.Severity] <= severityRank[ack.Severity]
+}
+
+// Resolve forgets the ack of an alert that stopped firing, so it alerts
+// afresh the next time
+func (a *Alerter) Resolve(alert *models.CostAlert) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.acks[alert.Key()]; !ok {
+		return nil
+	}
+	delete(a.acks, alert.Key())
+	return a.saveAcks()
+}
+
+// Acks returns the acks in effect at now, newest first, dropping expired
+// ones. Expired acks left in the acks file are dropped when it's loaded.
+func (a *Alerter) Acks(now time.Time) []Ack {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	acks := make([]Ack, 0, len(a.acks))
+	for key, ack := range a.acks {
+		if !now.Before(ack.Until) {
+			delete(a.acks, key)
+			continue
+		}
+		acks = append(acks, ack)
+	}
+	sort.Slice(acks, func(i, j int) bool { return acks[i].At.After(acks[j].At) })
+	return acks
+}
+
+// ActionRequest is a verified action link
+type ActionRequest struct {
+	Service  string
+	Kind     string
+	Route    string
+	Severity string
+	Action   string
+	Expires  time.Time
+}
+
+// Signer signs action links to the detector's callback endpoint, so only
+// links from an alert card can acknowledge or snooze an alert
+type Signer struct {
+	BaseURL string // Where the detector's API is reachable, e.g. "https://cost.example.com"
+
+	secret []byte
+}
+
+// NewSigner creates a signer for links to baseURL
+func NewSigner(baseURL string, secret string) *Signer {
+	return &Signer{BaseURL: strings.TrimSuffix(baseURL, "/"), secret: []byte(secret)}
+}
+
+// Links returns the acknowledge and snooze links for an alert
+func (s *Signer) Links(alert *models.CostAlert, now time.Time) []models.Action {
+	expires := strconv.FormatInt(now.Add(LinkValidity).Unix(), 10)
+	links := make([]models.Action, 0, len(actionTitles))
+	for _, a := range actionTitles {
+		query := url.Values{
+			"service":  {alert.Service},
+			"kind":     {alert.Kind},
+			"route":    {alert.Route},
+			"severity": {alert.Severity},
+			"action":   {a.action},
+			"expires":  {expires},
+		}
+		query.Set("sig", s.sign(query))
+		links = append(links, models.Action{Title: a.title, URL: s.BaseURL + "/api/v1/alerts/action?" + query.Encode()})
+	}
+	return links
+}
+
+// Verify checks an action link's signature and expiry
+func (s *Signer) Verify(query url.Values, now time.Time) (*ActionRequest, error) {
+	sig, err := hex.DecodeString(query.Get("sig"))
+	if err != nil || !hmac.Equal(sig, s.mac(query)) {
+		return nil, errors.New("invalid signature")
+	}
+	unix, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid expiry")
+	}
+	request := &ActionRequest{
+		Service:  query.Get("service"),
+		Kind:     query.Get("kind"),
+		Route:    query.Get("route"),
+		Severity: query.Get("severity"),
+		Action:   query.Get("action"),
+		Expires:  time.Unix(unix, 0),
+	}
+	if !now.Before(request.Expires) {
+		return nil, fmt.Errorf("link expired at %s", request.Expires.UTC().Format(time.RFC3339))
+	}
+	return request, nil
+}
+
+// sign returns the hex signature of a link's parameters
+func (s *Signer) sign(query url.Values) string {
+	return hex.EncodeToString(s.mac(query))
+}
+
+// mac signs the parameters that make up an action, in a fixed order
+func (s *Signer) mac(query url.Values) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	for _, key := range []string{"service", "kind", "route", "severity", "action", "expires"} {
+		h.Write([]byte(key + "=" + url.QueryEscape(query.Get(key)) + "\n"))
+	}
+	return h.Sum(nil)
+}
@@ -1,37 +1,301 @@
 package alerts
 
-import "cost-detector/pkg/models"
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cost-detector/pkg/models"
+)
 
 // Alerter handles alert logic and decisions
 type Alerter struct {
 	ThresholdPerHour float64 // Alert if cost exceeds this per hour
+
+	mu         sync.RWMutex
+	policy     *Policy
+	guardrails []Guardrail
+	acks       map[string]Ack // Alert key -> acknowledgement or snooze
+	acksFile   string         // JSONL file acks are kept in, empty to keep them in memory
+}
+
+// Guardrail is a budget over a set of namespaces, e.g. from a CostPolicy resource
+type Guardrail struct {
+	Name       string   // Alert service, e.g. "costpolicy/payments/checkout"
+	Namespaces []string // Namespaces whose cost counts against the budget
+	Budget     Budget
+	Routes     []string // Policy routes to notify, the default route when there are no targets
+	Webhooks   []string // Teams webhooks to notify directly
 }
 
 // NewAlerter creates a new alerter
 func NewAlerter(threshold float64) *Alerter {
 	return &Alerter{
 		ThresholdPerHour: threshold,
+		policy:           &Policy{Version: PolicyVersion},
+		acks:             make(map[string]Ack),
+	}
+}
+
+// SetPolicy replaces the budgets, exemptions and routes alerts are checked against
+func (a *Alerter) SetPolicy(policy *Policy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.policy = policy
+}
+
+// Policy returns the policy in effect
+func (a *Alerter) Policy() *Policy {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.policy
+}
+
+// SetGuardrails replaces the namespace-set budgets checked besides the policy
+func (a *Alerter) SetGuardrails(guardrails []Guardrail) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.guardrails = guardrails
+}
+
+// Guardrails returns the namespace-set budgets in effect
+func (a *Alerter) Guardrails() []Guardrail {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.guardrails
+}
+
+// podThreshold is the policy's per-pod threshold, or ThresholdPerHour
+func (a *Alerter) podThreshold(policy *Policy) float64 {
+	if policy.Defaults.PodThresholdPerHour > 0 {
+		return policy.Defaults.PodThresholdPerHour
 	}
+	return a.ThresholdPerHour
 }
 
 // ShouldAlert checks if we should send an alert
 func (a *Alerter) ShouldAlert(costPerHour float64) bool {
-	return costPerHour > a.ThresholdPerHour
+	return costPerHour > a.podThreshold(a.Policy())
 }
 
 // CreateAlert creates an alert message
 func (a *Alerter) CreateAlert(team string, service string, costPerHour float64) *models.CostAlert {
-	severity := "info"
-	if costPerHour > a.ThresholdPerHour*2 {
-		severity = "critical"
-	} else if costPerHour > a.ThresholdPerHour {
-		severity = "warning"
-	}
-	
-	return &models.CostAlert{
+	policy := a.Policy()
+	threshold := a.podThreshold(policy)
+	severity := severityOf(costPerHour/threshold, policy.Defaults.Severities)
+	if severity == "" {
+		severity = SeverityInfo
+	}
+
+	alert := &models.CostAlert{
 		Team:      team,
 		Service:   service,
+		Kind:      models.AlertPod,
 		CostPerHr: costPerHour,
 		Severity:  severity,
 	}
+	policy.route(alert, policy.Defaults.Route)
+	return alert
+}
+
+// CheckPod returns an alert when a pod costs more than the per-pod threshold
+// and isn't exempt, or nil
+func (a *Alerter) CheckPod(pod *models.Pod, team string, costPerHour float64, now time.Time) *models.CostAlert {
+	policy := a.Policy()
+	if _, exempt := policy.Exempt(pod.Namespace, team, pod.Workload, now); exempt {
+		return nil
+	}
+	if costPerHour <= a.podThreshold(policy) {
+		return nil
+	}
+	alert := a.CreateAlert(team, pod.Name, costPerHour)
+	if !policy.allowed(alert) {
+		return nil
+	}
+	return alert
+}
+
+// CheckPodChange returns an alert when a pod newly goes over the per-pod
+// threshold: it's new, or it was under the threshold before it changed
+func (a *Alerter) CheckPodChange(pod *models.Pod, old *models.Pod, team string, costPerHour float64, oldCost float64, now time.Time) *models.CostAlert {
+	alert := a.CheckPod(pod, team, costPerHour, now)
+	if alert == nil || (old != nil && a.CheckPod(old, team, oldCost, now) != nil) {
+		return nil
+	}
+	return alert
+}
+
+// CheckBudgets checks namespace and team totals against their budgets and
+// guardrails against the spend of their namespaces, returning what fires
+func (a *Alerter) CheckBudgets(namespaces []models.CostSummary, teams []models.CostSummary,
+	spend func(namespaces []string) float64, now time.Time) []*models.CostAlert {
+	var fired []*models.CostAlert
+	for _, ns := range namespaces {
+		if alert := a.CheckNamespace(ns.Name, ns.CostPerHr, now); alert != nil {
+			fired = append(fired, alert)
+		}
+	}
+	for _, team := range teams {
+		if alert := a.CheckTeam(team.Name, team.CostPerHr, now); alert != nil {
+			fired = append(fired, alert)
+		}
+	}
+	for _, guardrail := range a.Guardrails() {
+		fired = append(fired, a.CheckGuardrail(guardrail, spend(guardrail.Namespaces))...)
+	}
+	return fired
+}
+
+// CheckNamespace returns an alert when a namespace's total cost is over its
+// hourly threshold or on track to exceed its monthly budget, or nil
+func (a *Alerter) CheckNamespace(namespace string, costPerHour float64, now time.Time) *models.CostAlert {
+	policy := a.Policy()
+	budget, ok := policy.Namespaces[namespace]
+	if !ok {
+		return nil
+	}
+	if _, exempt := policy.Exempt(namespace, "", "", now); exempt {
+		return nil
+	}
+	return policy.check(budget, models.AlertBudget, "", "namespace/"+namespace, costPerHour)
+}
+
+// CheckExposure returns an alert when a namespace would be over its hourly
+// threshold or monthly budget with every HPA in it at its maximum, or nil
+func (a *Alerter) CheckExposure(namespace string, maxCostPerHour float64, now time.Time) *models.CostAlert {
+	policy := a.Policy()
+	budget, ok := policy.Namespaces[namespace]
+	if !ok {
+		return nil
+	}
+	if _, exempt := policy.Exempt(namespace, "", "", now); exempt {
+		return nil
+	}
+	alert := policy.check(budget, models.AlertMaxScale, "", "namespace/"+namespace+" at max scale", maxCostPerHour)
+	if alert != nil {
+		alert.Message = strings.NewReplacer(" costs ", " would cost ", " is on track to spend ", " would spend ").Replace(alert.Message)
+	}
+	return alert
+}
+
+// CheckTeam returns an alert when a team's total cost is over its hourly
+// threshold or on track to exceed its monthly budget, or nil
+func (a *Alerter) CheckTeam(team string, costPerHour float64, now time.Time) *models.CostAlert {
+	policy := a.Policy()
+	budget, ok := policy.Teams[team]
+	if !ok {
+		return nil
+	}
+	if _, exempt := policy.Exempt("", team, "", now); exempt {
+		return nil
+	}
+	return policy.check(budget, models.AlertBudget, team, "team/"+team, costPerHour)
+}
+
+// CheckGuardrail returns one alert per notification target when a guardrail's
+// namespaces together cost more than its budget allows, or nil
+func (a *Alerter) CheckGuardrail(guardrail Guardrail, costPerHour float64) []*models.CostAlert {
+	policy := a.Policy()
+	alert := policy.Evaluate(guardrail.Budget, guardrail.Name, costPerHour)
+	if alert == nil {
+		return nil
+	}
+	alert.Kind = models.AlertGuardrail
+
+	routes := guardrail.Routes
+	if len(routes) == 0 && len(guardrail.Webhooks) == 0 {
+		routes = []string{policy.Defaults.Route}
+	}
+	var alerts []*models.CostAlert
+	for _, route := range routes {
+		routed := *alert
+		policy.route(&routed, route)
+		if policy.allowed(&routed) {
+			alerts = append(alerts, &routed)
+		}
+	}
+	for _, webhook := range guardrail.Webhooks {
+		targeted := *alert
+		targeted.Route = guardrail.Name
+		targeted.WebhookURL = webhook
+		alerts = append(alerts, &targeted)
+	}
+	return alerts
+}
+
+// check compares a scope's cost with its budget and routes the alert
+func (p *Policy) check(budget Budget, kind string, team string, service string, costPerHour float64) *models.CostAlert {
+	alert := p.Evaluate(budget, service, costPerHour)
+	if alert == nil {
+		return nil
+	}
+	alert.Kind = kind
+	alert.Team = team
+	route := budget.Route
+	if route == "" {
+		route = p.Defaults.Route
+	}
+	p.route(alert, route)
+	if !p.allowed(alert) {
+		return nil
+	}
+	return alert
+}
+
+// Evaluate compares a cost with a budget, keeping the more severe of the
+// hourly threshold and the monthly projection. It returns an unrouted alert,
+// or nil when the cost is within budget.
+func (p *Policy) Evaluate(budget Budget, service string, costPerHour float64) *models.CostAlert {
+	severities := budget.Severities
+	if severities == nil {
+		severities = p.Defaults.Severities
+	}
+
+	var alert *models.CostAlert
+	consider := func(ratio float64, message string) {
+		severity := severityOf(ratio, severities)
+		if severity == "" || (alert != nil && severityRank[alert.Severity] >= severityRank[severity]) {
+			return
+		}
+		alert = &models.CostAlert{Service: service, CostPerHr: costPerHour, Severity: severity, Message: message}
+	}
+	if budget.ThresholdPerHour > 0 {
+		consider(costPerHour/budget.ThresholdPerHour,
+			fmt.Sprintf("%s costs $%.2f/hr, over its $%.2f/hr threshold", service, costPerHour, budget.ThresholdPerHour))
+	}
+	if budget.MonthlyBudget > 0 {
+		projected := costPerHour * models.HoursPerMonth
+		consider(projected/budget.MonthlyBudget,
+			fmt.Sprintf("%s is on track to spend $%.0f this month, over its $%.0f budget", service, projected, budget.MonthlyBudget))
+	}
+	return alert
+}
+
+// route points an alert at a named route's webhook
+func (p *Policy) route(alert *models.CostAlert, name string) {
+	if r, ok := p.Routes[name]; ok {
+		alert.Route = name
+		alert.WebhookURL = r.Webhook()
+	}
+}
+
+// allowed reports whether an alert meets its route's minimum severity
+func (p *Policy) allowed(alert *models.CostAlert) bool {
+	r, ok := p.Routes[alert.Route]
+	return !ok || r.MinSeverity == "" || severityRank[alert.Severity] >= severityRank[r.MinSeverity]
+}
+
+// severityOf maps how far over its limit a cost is to a severity, or "" when it isn't over
+func severityOf(ratio float64, s *Severities) string {
+	if s == nil {
+		s = &DefaultSeverities
+	}
+	switch {
+	case ratio > s.Critical:
+		return SeverityCritical
+	case ratio > s.Warning:
+		return SeverityWarning
+	}
+	return ""
 }
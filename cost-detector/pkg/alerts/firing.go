@@ -0,0 +1,47 @@
+package alerts
+
+import (
+	"sort"
+
+	"cost-detector/pkg/models"
+)
+
+// Firing remembers which budget alerts are firing and at what severity, so
+// a scope is notified when it starts firing or gets more (or less) severe,
+// not on every check
+type Firing struct {
+	sent map[string]*models.CostAlert // Alert key -> alert sent
+}
+
+// NewFiring creates an empty set of firing alerts
+func NewFiring() *Firing {
+	return &Firing{sent: make(map[string]*models.CostAlert)}
+}
+
+// Update records the alerts firing now. It returns those to send and the
+// last alerts sent for scopes that stopped firing, sorted by key.
+func (f *Firing) Update(fired []*models.CostAlert) (send []*models.CostAlert, resolved []*models.CostAlert) {
+	still := make(map[string]*models.CostAlert)
+	for _, alert := range fired {
+		if alert == nil {
+			continue
+		}
+		key := alert.Key()
+		if sent, ok := f.sent[key]; ok && sent.Severity == alert.Severity {
+			still[key] = sent
+			continue
+		}
+		if _, ok := still[key]; !ok {
+			still[key] = alert
+		}
+		send = append(send, alert)
+	}
+	for key, alert := range f.sent {
+		if _, ok := still[key]; !ok {
+			resolved = append(resolved, alert)
+		}
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].Key() < resolved[j].Key() })
+	f.sent = still
+	return send, resolved
+}
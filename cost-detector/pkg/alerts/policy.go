@@ -0,0 +1,273 @@
+package alerts
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"cost-detector/pkg/jsonschema"
+	"cost-detector/pkg/yaml"
+)
+
+// PolicyVersion is the budgets.yaml format this build understands
+const PolicyVersion = 1
+
+// PolicySchema is the JSON schema of budgets.yaml, which editors and CI
+// check the file with too
+//
+//go:embed budgets.schema.json
+var PolicySchema []byte
+
+// policySchema and budgetSchema are PolicySchema parsed, and its budget
+// definition for budgets set outside budgets.yaml
+var policySchema, budgetSchema = func() (*jsonschema.Schema, *jsonschema.Schema) {
+	schema, err := jsonschema.Parse(PolicySchema)
+	if err != nil {
+		panic(err)
+	}
+	budget, err := schema.Def("budget")
+	if err != nil {
+		panic(err)
+	}
+	return schema, budget
+}()
+
+// Severities, lowest first
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// severityRank orders severities for route filtering
+var severityRank = map[string]int{SeverityInfo: 0, SeverityWarning: 1, SeverityCritical: 2}
+
+// Policy is the declarative alerting policy kept in budgets.yaml
+type Policy struct {
+	Version    int               `json:"version"`
+	Defaults   Defaults          `json:"defaults"`
+	Namespaces map[string]Budget `json:"namespaces,omitempty"`
+	Teams      map[string]Budget `json:"teams,omitempty"`
+	Exemptions []Exemption       `json:"exemptions,omitempty"`
+	Routes     map[string]Route  `json:"routes,omitempty"`
+}
+
+// Defaults apply to every pod, and to namespaces and teams that don't set their own
+type Defaults struct {
+	PodThresholdPerHour float64     `json:"podThresholdPerHour,omitempty"` // Alert when one pod costs more, 0 for COST_THRESHOLD
+	Severities          *Severities `json:"severities,omitempty"`
+	Route               string      `json:"route,omitempty"`
+}
+
+// Budget limits what a namespace or team spends
+type Budget struct {
+	ThresholdPerHour float64     `json:"thresholdPerHour,omitempty"` // Alert when the total cost per hour exceeds this
+	MonthlyBudget    float64     `json:"monthlyBudget,omitempty"`    // Alert when the current rate would spend more in a month
+	Severities       *Severities `json:"severities,omitempty"`
+	Route            string      `json:"route,omitempty"`
+}
+
+// Severities sets how far over a threshold or budget an alert becomes a
+// warning or critical, as multiples of it (default 1 and 2)
+type Severities struct {
+	Warning  float64 `json:"warning"`
+	Critical float64 `json:"critical"`
+}
+
+// DefaultSeverities alert at warning over the threshold and critical at twice it
+var DefaultSeverities = Severities{Warning: 1, Critical: 2}
+
+// Exemption silences alerts for a namespace, team or workload. Every field
+// that is set has to match.
+type Exemption struct {
+	Namespace string `json:"namespace,omitempty"`
+	Team      string `json:"team,omitempty"`
+	Workload  string `json:"workload,omitempty"`
+	Reason    string `json:"reason"`
+	Expires   string `json:"expires,omitempty"` // Last day the exemption applies, e.g. "2026-11-30"
+
+	expires time.Time
+}
+
+// Route sends alerts to a Teams channel. Digest, quiet hours and time zone
+// default to the detector's settings for the default channel.
+type Route struct {
+	WebhookURL    string   `json:"webhookUrl,omitempty"`
+	WebhookURLEnv string   `json:"webhookUrlEnv,omitempty"` // Environment variable holding the webhook, to keep it out of Git
+	MinSeverity   string   `json:"minSeverity,omitempty"`   // Drop alerts below this severity
+	DigestWindow  string   `json:"digestWindow,omitempty"`  // Send alerts raised within this long as one digest, e.g. "5m"; "0s" sends each
+	QuietHours    string   `json:"quietHours,omitempty"`    // Hold non-critical alerts in this window, e.g. "22:00-07:00"
+	Timezone      string   `json:"timezone,omitempty"`      // Time zone of quietHours and summaries, e.g. "Europe/Berlin"
+	Summaries     []string `json:"summaries,omitempty"`     // Summary digests to send: daily, weekly
+}
+
+// ParsePolicy decodes and validates a budgets.yaml file. Unknown fields are
+// an error, so a typo can't silently disable a budget.
+func ParsePolicy(data []byte) (*Policy, error) {
+	// The file as written first, so unknown fields and wrong types are
+	// reported with their paths
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if err := policySchema.Validate("", doc); err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, err
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// LoadPolicy reads and validates a budgets.yaml file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// Validate checks the policy against PolicySchema, then what a schema
+// can't express, reporting every problem with the path of the field at fault
+func (p *Policy) Validate() error {
+	var errs []error
+	if err := policySchema.Validate("", p); err != nil {
+		errs = append(errs, err)
+	}
+	fail := func(path string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+
+	p.validateSeverities("defaults.severities", p.Defaults.Severities, fail)
+	p.validateRoute("defaults.route", p.Defaults.Route, fail)
+	for _, scope := range []struct {
+		name    string
+		budgets map[string]Budget
+	}{{"namespaces", p.Namespaces}, {"teams", p.Teams}} {
+		for _, name := range sortedKeys(scope.budgets) {
+			budget := scope.budgets[name]
+			path := scope.name + "." + name
+			if name == "" {
+				fail(scope.name, "empty name")
+			}
+			p.validateSeverities(path+".severities", budget.Severities, fail)
+			p.validateRoute(path+".route", budget.Route, fail)
+		}
+	}
+
+	for i := range p.Exemptions {
+		// The schema checks the date
+		exemption := &p.Exemptions[i]
+		exemption.expires, _ = time.Parse(time.DateOnly, exemption.Expires)
+	}
+
+	for _, name := range sortedKeys(p.Routes) {
+		route := p.Routes[name]
+		path := "routes." + name
+		if route.WebhookURLEnv != "" && os.Getenv(route.WebhookURLEnv) == "" {
+			fail(path+".webhookUrlEnv", "environment variable %s is not set", route.WebhookURLEnv)
+		}
+		if _, err := ParseQuietHours(route.QuietHours); route.QuietHours != "" && err != nil {
+			fail(path+".quietHours", "%v", err)
+		}
+		if _, err := time.LoadLocation(route.Timezone); err != nil {
+			fail(path+".timezone", "unknown time zone %q", route.Timezone)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateBudget checks a budget defined outside budgets.yaml, e.g. in a
+// CostPolicy resource, against the schema's budget and the policy's routes
+func (p *Policy) ValidateBudget(budget Budget) error {
+	var errs []error
+	if err := budgetSchema.Validate("spec", budget); err != nil {
+		errs = append(errs, err)
+	}
+	fail := func(path string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+	p.validateSeverities("spec.severities", budget.Severities, fail)
+	p.validateRoute("spec.route", budget.Route, fail)
+	return errors.Join(errs...)
+}
+
+// validateSeverities checks that critical is no lower than warning; the
+// schema checks that both are positive
+func (p *Policy) validateSeverities(path string, s *Severities, fail func(string, string, ...interface{})) {
+	if s == nil {
+		return
+	}
+	if s.Critical < s.Warning {
+		fail(path+".critical", "must be at least warning (%g)", s.Warning)
+	}
+}
+
+// validateRoute checks that a referenced route is defined
+func (p *Policy) validateRoute(path string, name string, fail func(string, string, ...interface{})) {
+	if name == "" {
+		return
+	}
+	if _, ok := p.Routes[name]; !ok {
+		fail(path, "route %q is not defined in routes", name)
+	}
+}
+
+// Webhook returns the Teams webhook a route posts to
+func (r Route) Webhook() string {
+	if r.WebhookURLEnv != "" {
+		return os.Getenv(r.WebhookURLEnv)
+	}
+	return r.WebhookURL
+}
+
+// Redacted returns a copy of the policy without webhook URLs, for serving over the API
+func (p *Policy) Redacted() *Policy {
+	redacted := *p
+	redacted.Routes = make(map[string]Route, len(p.Routes))
+	for name, route := range p.Routes {
+		if route.WebhookURL != "" {
+			route.WebhookURL = "(redacted)"
+		}
+		redacted.Routes[name] = route
+	}
+	return &redacted
+}
+
+// Exempt reports whether an exemption covers the namespace, team and
+// workload (any may be empty) on the given day, and why
+func (p *Policy) Exempt(namespace string, team string, workload string, now time.Time) (string, bool) {
+	for _, exemption := range p.Exemptions {
+		if !exemption.expires.IsZero() && now.After(exemption.expires.AddDate(0, 0, 1)) {
+			continue
+		}
+		if (exemption.Namespace == "" || exemption.Namespace == namespace) &&
+			(exemption.Team == "" || exemption.Team == team) &&
+			(exemption.Workload == "" || exemption.Workload == workload) {
+			return exemption.Reason, true
+		}
+	}
+	return "", false
+}
+
+// sortedKeys returns a map's keys in order, so errors come out the same way every time
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,119 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cost-detector/pkg/yaml"
+)
+
+const budgetsFile = "../../config/budgets.yaml"
+
+func TestBudgetsFile(t *testing.T) {
+	t.Setenv("TEAMS_WEBHOOK_URL", "https://example.webhook.office.com/platform")
+	t.Setenv("TEAMS_PAYMENTS_WEBHOOK_URL", "https://example.webhook.office.com/payments")
+	data, err := os.ReadFile(budgetsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The schema editors use is the one the detector embeds
+	first, _, _ := strings.Cut(string(data), "\n")
+	ref, ok := strings.CutPrefix(first, "# yaml-language-server: $schema=")
+	if !ok {
+		t.Fatalf("%s doesn't start with a $schema comment: %q", budgetsFile, first)
+	}
+	schema, err := os.ReadFile(filepath.Join(filepath.Dir(budgetsFile), ref))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(schema, PolicySchema) {
+		t.Errorf("%s refers to %s, not the embedded schema", budgetsFile, ref)
+	}
+
+	// The file as written, and as the detector reads it
+	docs, err := yaml.Documents(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(docs[0], &doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := policySchema.Validate("", doc); err != nil {
+		t.Errorf("schema rejects %s:\n%v", budgetsFile, err)
+	}
+	if _, err := ParsePolicy(data); err != nil {
+		t.Errorf("ParsePolicy rejects %s:\n%v", budgetsFile, err)
+	}
+}
+
+// The schema's patterns must accept exactly what the scheduler can parse
+func TestPolicySchemaAgrees(t *testing.T) {
+	windows := []string{"0", "0s", "5m", "+5m", "1h30m", "1.5h", ".5s", "1.s", "250ms", "10us", "10µs", "10μs",
+		"5", "-5m", "5M", "5 m", "five minutes", ".s", "1d", "m"}
+	for _, window := range windows {
+		d, err := time.ParseDuration(window)
+		parses := err == nil && d >= 0
+		accepted := acceptsRoute(Route{WebhookURL: "https://example.com", DigestWindow: window})
+		if accepted != parses {
+			t.Errorf("digestWindow %q: schema accepts it %v, time.ParseDuration %v", window, accepted, parses)
+		}
+	}
+
+	quietHours := []string{"22:00-07:00", "7:00-9:30", " 22:00 - 07:00 ", "00:00-23:59",
+		"24:00-07:00", "22:0-07:00", "22:00-07:00:00", "22-07", "22:00", "022:00-07:00", "22:60-07:00"}
+	for _, window := range quietHours {
+		from, to, ok := strings.Cut(strings.TrimSpace(window), "-")
+		_, fromErr := ParseTimeOfDay(from)
+		_, toErr := ParseTimeOfDay(to)
+		parses := ok && fromErr == nil && toErr == nil
+		accepted := acceptsRoute(Route{WebhookURL: "https://example.com", QuietHours: window})
+		if accepted != parses {
+			t.Errorf("quietHours %q: schema accepts it %v, ParseTimeOfDay %v", window, accepted, parses)
+		}
+	}
+}
+
+func acceptsRoute(route Route) bool {
+	return policySchema.Validate("", &Policy{Version: PolicyVersion, Routes: map[string]Route{"team": route}}) == nil
+}
+
+func TestPolicyValidate(t *testing.T) {
+	policy := &Policy{
+		Version:  PolicyVersion,
+		Defaults: Defaults{Route: "missing"},
+		Namespaces: map[string]Budget{
+			"empty":    {},
+			"inverted": {ThresholdPerHour: 10, Severities: &Severities{Warning: 2, Critical: 1}},
+		},
+		Exemptions: []Exemption{{Namespace: "load-test", Reason: "Load test", Expires: "30/11/2026"}},
+		Routes: map[string]Route{
+			"both":  {WebhookURL: "https://example.com", WebhookURLEnv: "TEAMS_WEBHOOK_URL"},
+			"quiet": {WebhookURL: "https://example.com", DigestWindow: "5 minutes", QuietHours: "22:00-22:00", Timezone: "Mars/Olympus"},
+		},
+	}
+	err := policy.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted an invalid policy")
+	}
+	for _, want := range []string{
+		"defaults.route: route \"missing\" is not defined",
+		"namespaces.empty: needs thresholdPerHour or monthlyBudget",
+		"namespaces.inverted.severities.critical: must be at least warning",
+		"exemptions[0].expires: \"30/11/2026\" is not a date",
+		"routes.both: needs exactly one of webhookUrl or webhookUrlEnv",
+		"routes.quiet.digestWindow: \"5 minutes\" is invalid",
+		"routes.quiet.quietHours: invalid quiet hours",
+		"routes.quiet.timezone: unknown time zone",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate didn't report %q, got:\n%v", want, err)
+		}
+	}
+}
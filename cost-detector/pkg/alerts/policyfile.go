@@ -0,0 +1,89 @@
+package alerts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// PolicyStatus reports which version of budgets.yaml is in effect and the
+// last edit that was rejected
+type PolicyStatus struct {
+	Path       string     `json:"path"`
+	Checksum   string     `json:"checksum"` // sha256 of the file in effect
+	LoadedAt   time.Time  `json:"loadedAt"`
+	Rejected   string     `json:"rejectedChecksum,omitempty"`
+	RejectedAt *time.Time `json:"rejectedAt,omitempty"`
+	Error      string     `json:"error,omitempty"` // Why the last edit was rejected
+}
+
+// PolicyFile keeps an Alerter's policy in sync with a budgets.yaml file,
+// e.g. a ConfigMap synced from Git
+type PolicyFile struct {
+	Path string
+
+	alerter *Alerter
+	mu      sync.Mutex
+	status  PolicyStatus
+}
+
+// NewPolicyFile creates a policy file feeding alerter
+func NewPolicyFile(path string, alerter *Alerter) *PolicyFile {
+	return &PolicyFile{Path: path, alerter: alerter, status: PolicyStatus{Path: path}}
+}
+
+// Reload applies the file when its content changed. An invalid edit is
+// rejected and the policy in effect stays; the error is returned once per
+// edit, so polling doesn't report the same mistake again.
+func (f *PolicyFile) Reload() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return false, f.reject("", err)
+	}
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	if checksum == f.status.Checksum {
+		// Back to the policy in effect, e.g. a bad edit was reverted
+		f.status.Rejected, f.status.RejectedAt, f.status.Error = "", nil, ""
+		return false, nil
+	}
+	if checksum == f.status.Rejected {
+		return false, nil
+	}
+
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return false, f.reject(checksum, err)
+	}
+	f.alerter.SetPolicy(policy)
+	f.status.Checksum = checksum
+	f.status.LoadedAt = time.Now()
+	f.status.Rejected, f.status.RejectedAt, f.status.Error = "", nil, ""
+	return true, nil
+}
+
+// reject records a failed load, returning the error unless it was already reported
+func (f *PolicyFile) reject(checksum string, err error) error {
+	err = fmt.Errorf("%s: %w", f.Path, err)
+	if checksum == f.status.Rejected && err.Error() == f.status.Error {
+		return nil
+	}
+	now := time.Now()
+	f.status.Rejected = checksum
+	f.status.RejectedAt = &now
+	f.status.Error = err.Error()
+	return err
+}
+
+// Status returns what the file last loaded and rejected
+func (f *PolicyFile) Status() PolicyStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status
+}
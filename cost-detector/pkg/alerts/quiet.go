@@ -0,0 +1,87 @@
+package alerts
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // Routes name time zones; the alpine image has no zoneinfo
+)
+
+// Summary periods a route can ask for
+const (
+	SummaryDaily  = "daily"
+	SummaryWeekly = "weekly"
+)
+
+// QuietHours is a daily window, in a route's time zone, when only critical
+// alerts are sent; the rest wait until it ends
+type QuietHours struct {
+	Start time.Duration // Since midnight
+	End   time.Duration // Since midnight; before Start when the window spans midnight
+}
+
+// ParseQuietHours reads a window such as "22:00-07:00"
+func ParseQuietHours(value string) (*QuietHours, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(value), "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid quiet hours %q: want a window like \"22:00-07:00\"", value)
+	}
+	start, err := ParseTimeOfDay(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := ParseTimeOfDay(to)
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, fmt.Errorf("invalid quiet hours %q: starts and ends at the same time", value)
+	}
+	return &QuietHours{Start: start, End: end}, nil
+}
+
+// ParseTimeOfDay reads a time such as "07:00" as the time since midnight
+func ParseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q: want HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t falls in the window, in t's location
+func (q *QuietHours) Contains(t time.Time) bool {
+	since := sinceMidnight(t)
+	if q.Start < q.End {
+		return since >= q.Start && since < q.End
+	}
+	return since >= q.Start || since < q.End
+}
+
+// Until returns when the window containing t ends
+func (q *QuietHours) Until(t time.Time) time.Time {
+	end := AtTimeOfDay(t, q.End)
+	if !end.After(t) {
+		end = AtTimeOfDay(t.AddDate(0, 0, 1), q.End)
+	}
+	return end
+}
+
+// String formats the window as it is written in budgets.yaml
+func (q *QuietHours) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return clock(q.Start) + "-" + clock(q.End)
+}
+
+// AtTimeOfDay returns the given time of day on t's day, in t's location
+func AtTimeOfDay(t time.Time, timeOfDay time.Duration) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, int(timeOfDay.Hours()), int(timeOfDay.Minutes())%60, 0, 0, t.Location())
+}
+
+// sinceMidnight returns the wall-clock time of day of t
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
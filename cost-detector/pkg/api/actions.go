@@ -0,0 +1,143 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"cost-detector/pkg/alerts"
+)
+
+// identityHeaders carry the signed-in user when the API sits behind an
+// authenticating proxy such as oauth2-proxy. Anyone can set them, so they're
+// only read from the proxies the detector is told to trust.
+var identityHeaders = []string{"X-Forwarded-Email", "X-Auth-Request-Email", "X-Forwarded-User", "X-Auth-Request-User"}
+
+// actionPage confirms an action before taking it, since chat clients open
+// links to preview them
+var actionPage = template.Must(template.New("action").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Cost alert</title></head>
+<body style="font-family: sans-serif; max-width: 40em; margin: 2em auto">
+{{if .Ack}}<p>{{.Ack.Service}} {{.Ack.String}}.</p>
+{{else}}<p><b>{{.Title}}</b> the {{.Request.Severity}} cost alert for <b>{{.Request.Service}}</b>?</p>
+<form method="post">
+<p>This will be recorded as {{.By}}.</p>
+<button type="submit">{{.Title}}</button>
+</form>{{end}}
+</body></html>
+`))
+
+// AddAlertActions serves the acknowledge and snooze links on alert cards,
+// and the acknowledgements in effect:
+//
+//	GET  /api/v1/alerts/action?service=...&sig=...  (confirmation page)
+//	POST /api/v1/alerts/action?service=...&sig=...
+//	GET  /api/v1/alerts/acks
+//
+// Actions are recorded as the user an authenticating proxy in proxies
+// signed in, or as an anonymous member of the channel the link went to.
+func (s *Server) AddAlertActions(alerter *alerts.Alerter, signer *alerts.Signer, proxies []netip.Prefix) {
+	s.mux.HandleFunc("GET /api/v1/alerts/action", func(w http.ResponseWriter, r *http.Request) {
+		request, err := signer.Verify(r.URL.Query(), time.Now())
+		if err != nil {
+			WriteError(w, http.StatusForbidden, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		actionPage.Execute(w, map[string]interface{}{"Request": request, "Title": actionTitle(request.Action), "By": identity(r, request, proxies)})
+	})
+
+	s.mux.HandleFunc("POST /api/v1/alerts/action", func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		request, err := signer.Verify(r.URL.Query(), now)
+		if err != nil {
+			WriteError(w, http.StatusForbidden, err)
+			return
+		}
+		ack, err := alerter.Acknowledge(request.Kind, request.Service, request.Route, request.Severity, request.Action, identity(r, request, proxies), now)
+		if errors.Is(err, alerts.ErrUnknownAction) {
+			WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			WriteJSON(w, http.StatusOK, ack)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		actionPage.Execute(w, map[string]interface{}{"Ack": ack})
+	})
+
+	s.mux.HandleFunc("GET /api/v1/alerts/acks", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, alerter.Acks(time.Now()))
+	})
+}
+
+// identity returns the user a trusted proxy signed in, or who the link was
+// sent to: anyone in its route's channel
+func identity(r *http.Request, request *alerts.ActionRequest, proxies []netip.Prefix) string {
+	if trusted(r, proxies) {
+		for _, header := range identityHeaders {
+			if user := strings.TrimSpace(r.Header.Get(header)); user != "" {
+				return user
+			}
+		}
+	}
+	if request.Route != "" {
+		return fmt.Sprintf("anonymous (%s)", request.Route)
+	}
+	return "anonymous"
+}
+
+// trusted reports whether a request came straight from one of the proxies
+func trusted(r *http.Request, proxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(addr.Addr().Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseProxies parses trusted proxy addresses, each a CIDR range or a single IP
+func ParseProxies(proxies []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", proxy, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// actionTitle names an action for the confirmation page
+func actionTitle(action string) string {
+	switch action {
+	case alerts.ActionSnooze4h:
+		return "Snooze for 4 hours"
+	case alerts.ActionSnooze24h:
+		return "Snooze for 24 hours"
+	}
+	return "Acknowledge"
+}
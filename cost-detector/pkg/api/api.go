@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/index"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/network"
+	"cost-detector/pkg/watcher"
+)
+
+// Server serves cost data over HTTP for dashboards and the kubectl-cost plugin
+type Server struct {
+	Addr       string
+	watcher    *watcher.Watcher
+	calculator *calculator.Calculator
+	network    *network.Tracker // Optional data transfer costs
+	index      *index.Index     // Optional incremental totals
+	mux        *http.ServeMux
+	server     *http.Server
+}
+
+// NewServer creates a new cost API server
+func NewServer(addr string, w *watcher.Watcher, calc *calculator.Calculator) *Server {
+	s := &Server{
+		Addr:       addr,
+		watcher:    w,
+		calculator: calc,
+		mux:        http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /api/v1/costs", s.handleCosts)
+	s.addContainerRoutes()
+	return s
+}
+
+// Handle registers an extra handler, so other packages can add endpoints
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// UseIndex answers cluster-wide totals from an incremental index instead of
+// re-pricing every pod, and enables grouping by team, node and indexed labels
+func (s *Server) UseIndex(idx *index.Index) {
+	s.index = idx
+}
+
+// Start listens on Addr and serves requests in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	// Requests share a context cancelled on Shutdown, so live streams end
+	// instead of holding shutdown up
+	base, cancel := context.WithCancel(context.Background())
+	s.server = &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+	s.server.RegisterOnShutdown(cancel)
+	go s.server.Serve(listener)
+	return nil
+}
+
+// Stop shuts the server down
+func (s *Server) Stop() {
+	if s.server != nil {
+		s.server.Close()
+	}
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+// until ctx is done. Open streams are closed when ctx ends.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		s.server.Close()
+	}
+	return err
+}
+
+// CostsResponse is returned by GET /api/v1/costs
+type CostsResponse struct {
+	GroupBy   string               `json:"groupBy"`
+	TotalCost float64              `json:"totalCostPerHr"`
+	TotalCO2e float64              `json:"totalCo2ePerHr,omitempty"` // Grams
+	Items     []models.CostSummary `json:"items"`
+}
+
+// handleCosts serves GET /api/v1/costs?groupBy=namespace|workload|pod&namespace=ns.
+// With an index, groupBy can also be team, node or label:<key>.
+func (s *Server) handleCosts(w http.ResponseWriter, r *http.Request) {
+	groupBy := r.URL.Query().Get("groupBy")
+	if groupBy == "" {
+		groupBy = calculator.GroupByNamespace
+	}
+	namespace := r.URL.Query().Get("namespace")
+
+	var items []models.CostSummary
+	var err error
+	if s.index != nil && namespace == "" && (s.index.Supports(groupBy) || strings.HasPrefix(groupBy, index.LabelPrefix)) {
+		items, err = s.index.Summaries(groupBy)
+	} else {
+		var pods []*models.Pod
+		for _, pod := range s.watcher.Pods() {
+			if namespace == "" || pod.Namespace == namespace {
+				pods = append(pods, pod)
+			}
+		}
+		items, err = s.calculator.Summarize(pods, groupBy)
+	}
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if s.network != nil && groupBy == calculator.GroupByNamespace {
+		networkCost := s.network.NamespaceCostPerHr()
+		for i := range items {
+			items[i].NetworkCostPerHr = networkCost[items[i].Name]
+		}
+	}
+
+	resp := CostsResponse{GroupBy: groupBy, Items: items}
+	for _, item := range items {
+		resp.TotalCost += item.CostPerHr + item.NetworkCostPerHr
+		resp.TotalCO2e += item.CO2ePerHr
+	}
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// WriteJSON writes v as a JSON response
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// WriteError writes an error as a JSON response
+func WriteError(w http.ResponseWriter, status int, err error) {
+	WriteJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"cost-detector/pkg/backstage"
+)
+
+// AddBackstage serves per-component cost for a Backstage plugin:
+//
+//	GET /api/v1/backstage/components
+//	GET /api/v1/backstage/entities/{kind}/{namespace}/{name}   (e.g. component/default/checkout)
+func (s *Server) AddBackstage(catalog *backstage.Catalog) {
+	s.mux.HandleFunc("GET /api/v1/backstage/components", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, catalog.Costs(s.watcher.Pods(), s.calculator))
+	})
+
+	s.mux.HandleFunc("GET /api/v1/backstage/entities/{kind}/{namespace}/{name}", func(w http.ResponseWriter, r *http.Request) {
+		ref := r.PathValue("kind") + ":" + r.PathValue("namespace") + "/" + r.PathValue("name")
+		cost, ok := catalog.Cost(ref, s.watcher.Pods(), s.calculator)
+		if !ok {
+			WriteError(w, http.StatusNotFound, fmt.Errorf("no entity %s with Kubernetes annotations in the catalog", ref))
+			return
+		}
+		WriteJSON(w, http.StatusOK, cost)
+	})
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"cost-detector/pkg/batch"
+)
+
+// AddBatch serves Job and CronJob run costs:
+//
+//	GET /api/v1/cronjobs                        (per CronJob, highest projected monthly cost first)
+//	GET /api/v1/cronjobs/{namespace}/{name}     (one CronJob with its daily cost)
+//	GET /api/v1/jobs/runs?namespace=&cronjob=   (runs, newest first)
+func (s *Server) AddBatch(tracker *batch.Tracker) {
+	s.mux.HandleFunc("GET /api/v1/cronjobs", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, tracker.CronJobs())
+	})
+
+	s.mux.HandleFunc("GET /api/v1/cronjobs/{namespace}/{name}", func(w http.ResponseWriter, r *http.Request) {
+		cronJob, ok := tracker.CronJob(r.PathValue("namespace"), r.PathValue("name"))
+		if !ok {
+			WriteError(w, http.StatusNotFound, fmt.Errorf("no runs or schedule for CronJob %s/%s", r.PathValue("namespace"), r.PathValue("name")))
+			return
+		}
+		WriteJSON(w, http.StatusOK, cronJob)
+	})
+
+	s.mux.HandleFunc("GET /api/v1/jobs/runs", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		WriteJSON(w, http.StatusOK, tracker.Runs(query.Get("namespace"), query.Get("cronjob")))
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"cost-detector/pkg/alerts"
+	"cost-detector/pkg/costpolicy"
+	"cost-detector/pkg/index"
+	"cost-detector/pkg/models"
+)
+
+// BudgetsResponse is returned by GET /api/v1/budgets
+type BudgetsResponse struct {
+	Status *alerts.PolicyStatus `json:"status,omitempty"` // Absent when no budgets file is configured
+	Policy *alerts.Policy       `json:"policy"`           // Webhook URLs redacted
+	Spend  []BudgetSpend        `json:"spend"`
+}
+
+// BudgetSpend compares a namespace, team or CostPolicy's current spend with its budget
+type BudgetSpend struct {
+	Scope            string  `json:"scope"` // "namespace", "team" or "costpolicy"
+	Name             string  `json:"name"`
+	CostPerHr        float64 `json:"costPerHr"`
+	ThresholdPerHr   float64 `json:"thresholdPerHr,omitempty"`
+	ProjectedMonthly float64 `json:"projectedMonthly"`
+	MonthlyBudget    float64 `json:"monthlyBudget,omitempty"`
+	Exempt           string  `json:"exempt,omitempty"` // Exemption reason
+}
+
+// AddBudgets serves the alerting policy in effect and spend against each budget:
+//
+//	GET /api/v1/budgets
+func (s *Server) AddBudgets(alerter *alerts.Alerter, file *alerts.PolicyFile) {
+	s.mux.HandleFunc("GET /api/v1/budgets", func(w http.ResponseWriter, r *http.Request) {
+		policy := alerter.Policy()
+		response := BudgetsResponse{Policy: policy.Redacted(), Spend: []BudgetSpend{}}
+		if file != nil {
+			status := file.Status()
+			response.Status = &status
+		}
+
+		now := time.Now()
+		for _, scope := range []struct {
+			name      string
+			dimension string
+			budgets   map[string]alerts.Budget
+		}{{"namespace", index.ByNamespace, policy.Namespaces}, {"team", index.ByTeam, policy.Teams}} {
+			for name, budget := range scope.budgets {
+				spend := BudgetSpend{Scope: scope.name, Name: name, ThresholdPerHr: budget.ThresholdPerHour, MonthlyBudget: budget.MonthlyBudget}
+				if s.index != nil {
+					spend.CostPerHr = s.index.Total(scope.dimension, name).CostPerHr
+					spend.ProjectedMonthly = spend.CostPerHr * models.HoursPerMonth
+				}
+				if scope.name == "namespace" {
+					spend.Exempt, _ = policy.Exempt(name, "", "", now)
+				} else {
+					spend.Exempt, _ = policy.Exempt("", name, "", now)
+				}
+				response.Spend = append(response.Spend, spend)
+			}
+		}
+		for _, guardrail := range alerter.Guardrails() {
+			spend := BudgetSpend{Scope: "costpolicy", Name: guardrail.Name, ThresholdPerHr: guardrail.Budget.ThresholdPerHour, MonthlyBudget: guardrail.Budget.MonthlyBudget}
+			if s.index != nil {
+				spend.CostPerHr = costpolicy.Spend(s.index, guardrail.Namespaces)
+				spend.ProjectedMonthly = spend.CostPerHr * models.HoursPerMonth
+			}
+			response.Spend = append(response.Spend, spend)
+		}
+		sort.Slice(response.Spend, func(i, j int) bool {
+			if response.Spend[i].Scope != response.Spend[j].Scope {
+				return response.Spend[i].Scope < response.Spend[j].Scope
+			}
+			return response.Spend[i].Name < response.Spend[j].Name
+		})
+		WriteJSON(w, http.StatusOK, response)
+	})
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+
+	"cost-detector/pkg/compliance"
+)
+
+// AddCompliance serves workloads missing chargeback labels, most expensive first:
+//
+//	GET /api/v1/compliance?namespace=payments
+func (s *Server) AddCompliance(checker *compliance.Checker) {
+	s.mux.HandleFunc("GET /api/v1/compliance", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, checker.Report(r.URL.Query().Get("namespace")))
+	})
+}
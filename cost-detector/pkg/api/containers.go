@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+
+	"cost-detector/pkg/models"
+)
+
+// addContainerRoutes serves the per-container breakdown and the platform
+// overhead report:
+//
+//	GET /api/v1/containers?namespace=payments
+//	GET /api/v1/overhead
+func (s *Server) addContainerRoutes() {
+	s.mux.HandleFunc("GET /api/v1/containers", func(w http.ResponseWriter, r *http.Request) {
+		namespace := r.URL.Query().Get("namespace")
+		costs := []models.ContainerCost{}
+		for _, pod := range s.watcher.Pods() {
+			if namespace == "" || pod.Namespace == namespace {
+				costs = append(costs, s.calculator.ContainerCosts(pod)...)
+			}
+		}
+		WriteJSON(w, http.StatusOK, costs)
+	})
+
+	s.mux.HandleFunc("GET /api/v1/overhead", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, s.calculator.Overhead(s.watcher.Pods()))
+	})
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"cost-detector/pkg/ledger"
+)
+
+// AddDiff serves how spend changed between two ledger snapshots:
+//
+//	GET /api/v1/diff?from=2024-05-01T09:00:00Z&to=now
+//	GET /api/v1/diff?from=24h&format=markdown
+//
+// from and to take anything ledger.ParseTime accepts; to defaults to now.
+func (s *Server) AddDiff(costLedger *ledger.Ledger) {
+	s.mux.HandleFunc("GET /api/v1/diff", func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		q := r.URL.Query()
+		if q.Get("from") == "" {
+			WriteError(w, http.StatusBadRequest, fmt.Errorf("from is required"))
+			return
+		}
+		from, err := ledger.ParseTime(q.Get("from"), now)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		to, err := ledger.ParseTime(q.Get("to"), now)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		diff, err := costLedger.Diff(from, to)
+		if err != nil {
+			WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		if q.Get("format") == "markdown" {
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			fmt.Fprint(w, diff.Markdown())
+			return
+		}
+		WriteJSON(w, http.StatusOK, diff)
+	})
+}
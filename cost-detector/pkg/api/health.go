@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Check reports why a component isn't ready, or nil when it is
+type Check func() error
+
+// HealthResponse is returned by GET /readyz
+type HealthResponse struct {
+	Status string            `json:"status"` // "ok" or "unavailable"
+	Checks map[string]string `json:"checks"` // Check name -> "ok" or why not
+}
+
+// AddHealth serves probes for the kubelet:
+//
+//	GET /healthz   (200 while the process is serving)
+//	GET /readyz    (200 once every check passes, 503 otherwise)
+func (s *Server) AddHealth(checks map[string]Check) {
+	s.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok\n"))
+	})
+
+	s.mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		names := make([]string, 0, len(checks))
+		for name := range checks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		resp := HealthResponse{Status: "ok", Checks: make(map[string]string, len(checks))}
+		status := http.StatusOK
+		for _, name := range names {
+			resp.Checks[name] = "ok"
+			if err := checks[name](); err != nil {
+				resp.Checks[name] = err.Error()
+				resp.Status, status = "unavailable", http.StatusServiceUnavailable
+			}
+		}
+		WriteJSON(w, status, resp)
+	})
+}
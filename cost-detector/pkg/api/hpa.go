@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+
+	"cost-detector/pkg/hpa"
+)
+
+// AddHPA serves autoscaled workloads' cost at min, current and max scale,
+// each namespace's max-scale exposure, and the cost of scale-ups:
+//
+//	GET /api/v1/hpa?namespace=
+//	GET /api/v1/hpa/exposure
+//	GET /api/v1/hpa/events?namespace=
+func (s *Server) AddHPA(tracker *hpa.Tracker) {
+	s.mux.HandleFunc("GET /api/v1/hpa", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, tracker.Workloads(r.URL.Query().Get("namespace")))
+	})
+
+	s.mux.HandleFunc("GET /api/v1/hpa/exposure", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, tracker.Exposures())
+	})
+
+	s.mux.HandleFunc("GET /api/v1/hpa/events", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, tracker.Events(r.URL.Query().Get("namespace")))
+	})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"cost-detector/pkg/index"
+	"cost-detector/pkg/models"
+)
+
+// metric is one gauge exported per namespace, per team and for the cluster
+type metric struct {
+	name  string
+	help  string
+	value func(t index.Totals) float64
+}
+
+var metrics = []metric{
+	{"cost_dollars_per_hour", "Estimated compute cost in dollars per hour.", func(t index.Totals) float64 { return t.CostPerHr }},
+	{"energy_kwh_per_hour", "Estimated energy use in kWh per hour, including data center overhead.", func(t index.Totals) float64 { return t.KWhPerHr }},
+	{"co2e_grams_per_hour", "Estimated emissions in grams of CO2e per hour.", func(t index.Totals) float64 { return t.CO2ePerHr }},
+	{"pods", "Pods counted.", func(t index.Totals) float64 { return float64(t.Pods) }},
+}
+
+// AddMetrics serves cost, energy and emissions by namespace, team and for
+// the cluster in the Prometheus text format. It needs UseIndex.
+//
+//	GET /metrics
+func (s *Server) AddMetrics() {
+	s.mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		if s.index == nil {
+			http.Error(w, "metrics need the cost index", http.StatusServiceUnavailable)
+			return
+		}
+		namespaces, cluster, _ := s.index.Snapshot(index.ByNamespace, nil)
+		teams, _ := s.index.Summaries(index.ByTeam)
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, m := range metrics {
+			writeMetric(w, "cost_detector_namespace_"+m.name, m.help, "namespace", namespaces, m.value)
+			writeMetric(w, "cost_detector_team_"+m.name, m.help, "team", teams, m.value)
+			fmt.Fprintf(w, "# HELP cost_detector_cluster_%s %s\n# TYPE cost_detector_cluster_%s gauge\n", m.name, m.help, m.name)
+			fmt.Fprintf(w, "cost_detector_cluster_%s %g\n", m.name, m.value(cluster))
+		}
+	})
+}
+
+// writeMetric writes a gauge with one series per group
+func writeMetric(w io.Writer, name string, help string, label string, groups []models.CostSummary, value func(index.Totals) float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for _, g := range groups {
+		t := index.Totals{Pods: g.Pods, CPU: g.CPU, Memory: g.Memory, CostPerHr: g.CostPerHr, KWhPerHr: g.KWhPerHr, CO2ePerHr: g.CO2ePerHr}
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %g\n", name, label, escapeLabel(g.Name), value(t))
+	}
+}
+
+// escapeLabel escapes a label value for the Prometheus text format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"cost-detector/pkg/network"
+)
+
+// maxFlowLogUpload caps one flow log upload; Firehose sends at most a few MiB per request
+const maxFlowLogUpload = 64 << 20
+
+// AddNetwork serves data transfer costs and accepts streamed flow logs:
+//
+//	GET  /api/v1/network
+//	POST /api/v1/network/flowlogs   (body: flow log lines, e.g. from Firehose)
+//
+// Uploads need "Authorization: Bearer <token>"; without a token they are
+// refused. Namespace cost summaries also get their hourly data transfer cost.
+func (s *Server) AddNetwork(tracker *network.Tracker, token string) {
+	s.network = tracker
+
+	s.mux.HandleFunc("GET /api/v1/network", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, tracker.Costs())
+	})
+
+	s.mux.HandleFunc("POST /api/v1/network/flowlogs", func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			WriteError(w, http.StatusForbidden, errors.New("flow log uploads are disabled; set FLOW_LOGS_TOKEN"))
+			return
+		}
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			WriteError(w, http.StatusUnauthorized, errors.New("invalid or missing bearer token"))
+			return
+		}
+
+		priced, err := tracker.Ingest(http.MaxBytesReader(w, r.Body, maxFlowLogUpload))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]int{"priced": priced})
+	})
+}
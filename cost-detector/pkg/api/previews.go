@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+
+	"cost-detector/pkg/preview"
+)
+
+// AddPreviews serves preview environments with their cost against their limits:
+//
+//	GET /api/v1/previews
+func (s *Server) AddPreviews(manager *preview.Manager) {
+	s.mux.HandleFunc("GET /api/v1/previews", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, manager.Environments())
+	})
+}
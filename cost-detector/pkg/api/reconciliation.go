@@ -0,0 +1,22 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"cost-detector/pkg/cur"
+)
+
+// AddReconciliation serves the latest comparison with the AWS Cost and Usage Report:
+//
+//	GET /api/v1/reconciliation
+func (s *Server) AddReconciliation(reconciler *cur.Reconciler) {
+	s.mux.HandleFunc("GET /api/v1/reconciliation", func(w http.ResponseWriter, r *http.Request) {
+		report := reconciler.Last()
+		if report == nil {
+			WriteError(w, http.StatusNotFound, errors.New("no Cost and Usage Report imported yet"))
+			return
+		}
+		WriteJSON(w, http.StatusOK, report)
+	})
+}
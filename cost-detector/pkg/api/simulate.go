@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"cost-detector/pkg/simulator"
+)
+
+// AddSimulator serves consolidation what-if simulations:
+//
+//	GET /api/v1/simulate?spotNamespaces=batch,dev&graviton=true&families=m6g,c6g
+func (s *Server) AddSimulator(sim *simulator.Simulator) {
+	s.mux.HandleFunc("GET /api/v1/simulate", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		scenario := simulator.Scenario{
+			SpotNamespaces: splitList(query["spotNamespaces"]),
+			Families:       splitList(query["families"]),
+		}
+		if graviton := query.Get("graviton"); graviton != "" {
+			b, err := strconv.ParseBool(graviton)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			scenario.Graviton = b
+		}
+
+		plan := sim.Run(s.watcher.Pods(), s.watcher.Nodes(), scenario)
+		WriteJSON(w, http.StatusOK, plan)
+	})
+}
+
+// splitList flattens repeated and comma-separated query values
+func splitList(values []string) []string {
+	var result []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cost-detector/pkg/stream"
+)
+
+// streamHeartbeat keeps idle connections open through proxies and load balancers
+const streamHeartbeat = 15 * time.Second
+
+// AddStream serves live cost changes as Server-Sent Events:
+//
+//	GET /api/v1/stream?namespace=ns
+//
+// A "snapshot" event with namespace totals comes first, then one "cost"
+// event per pod created, deleted, resized or repriced. Clients that fall too
+// far behind are disconnected; EventSource reconnects and gets a new snapshot.
+func (s *Server) AddStream(broker *stream.Broker) {
+	s.mux.HandleFunc("GET /api/v1/stream", func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		snapshot, sub := broker.Subscribe(r.URL.Query().Get("namespace"))
+		defer broker.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no") // Stop nginx buffering the stream
+		w.WriteHeader(http.StatusOK)
+		// Slow clients fail their writes; they never block the broker
+		rc.SetWriteDeadline(time.Now().Add(streamHeartbeat))
+		if err := writeEvent(w, "snapshot", snapshot.ID, snapshot); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				rc.SetWriteDeadline(time.Now().Add(streamHeartbeat))
+				fmt.Fprint(w, ": heartbeat\n\n")
+			case event, ok := <-sub.Events:
+				rc.SetWriteDeadline(time.Now().Add(streamHeartbeat))
+				if !ok {
+					if broker.Dropped(sub) {
+						fmt.Fprint(w, "event: dropped\ndata: {\"reason\":\"client too slow\"}\n\n")
+						rc.Flush()
+					}
+					return
+				}
+				if err := writeEvent(w, "cost", event.ID, event); err != nil {
+					return
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// writeEvent writes one Server-Sent Event with a JSON payload
+func writeEvent(w http.ResponseWriter, name string, id uint64, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, name, data)
+	return err
+}
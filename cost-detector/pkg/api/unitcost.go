@@ -0,0 +1,42 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"cost-detector/pkg/unitcost"
+)
+
+// AddUnitCost serves cost per business unit (e.g. per 1k requests):
+//
+//	GET /api/v1/unitcost                       (latest point per service)
+//	GET /api/v1/unitcost/{service}?since=6h    (time series, default the last hour)
+//	GET /api/v1/unitcost/regressions           (rises after deploys)
+func (s *Server) AddUnitCost(tracker *unitcost.Tracker) {
+	s.mux.HandleFunc("GET /api/v1/unitcost", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, tracker.Latest())
+	})
+
+	s.mux.HandleFunc("GET /api/v1/unitcost/regressions", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, tracker.Regressions())
+	})
+
+	s.mux.HandleFunc("GET /api/v1/unitcost/{service}", func(w http.ResponseWriter, r *http.Request) {
+		since := time.Hour
+		if v := r.URL.Query().Get("since"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid since %q: want a duration like 6h", v))
+				return
+			}
+			since = d
+		}
+		series, ok := tracker.Series(r.PathValue("service"), time.Now().Add(-since))
+		if !ok {
+			WriteError(w, http.StatusNotFound, fmt.Errorf("no unit metric configured for service %q", r.PathValue("service")))
+			return
+		}
+		WriteJSON(w, http.StatusOK, series)
+	})
+}
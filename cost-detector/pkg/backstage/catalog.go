@@ -0,0 +1,287 @@
+package backstage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"cost-detector/pkg/kube"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/yaml"
+)
+
+// Annotations the Backstage Kubernetes plugin uses to find an entity's workloads
+const (
+	KubernetesIDAnnotation            = "backstage.io/kubernetes-id"
+	KubernetesNamespaceAnnotation     = "backstage.io/kubernetes-namespace"
+	KubernetesLabelSelectorAnnotation = "backstage.io/kubernetes-label-selector"
+)
+
+// KubernetesIDLabel is the pod label the plugin matches against backstage.io/kubernetes-id
+const KubernetesIDLabel = "backstage.io/kubernetes-id"
+
+// Entity is the part of a Backstage catalog entity the cost detector reads
+type Entity struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Title       string            `json:"title"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		Type      string `json:"type"`
+		Owner     string `json:"owner"`
+		System    string `json:"system"`
+		Lifecycle string `json:"lifecycle"`
+	} `json:"spec"`
+}
+
+// Component is a catalog entity that owns Kubernetes workloads
+type Component struct {
+	Ref                 string `json:"entityRef"` // e.g. "component:default/checkout"
+	Kind                string `json:"kind"`
+	Name                string `json:"name"`
+	Namespace           string `json:"namespace"` // Backstage namespace, not Kubernetes
+	Title               string `json:"title,omitempty"`
+	Type                string `json:"type,omitempty"`
+	Owner               string `json:"owner"` // Owner entity ref, e.g. "group:default/team-payments"
+	Team                string `json:"team"`  // Owner's name, used as the alert team
+	System              string `json:"system,omitempty"`
+	Lifecycle           string `json:"lifecycle,omitempty"`
+	KubernetesID        string `json:"kubernetesId,omitempty"`
+	KubernetesNamespace string `json:"kubernetesNamespace,omitempty"`
+	LabelSelector       string `json:"labelSelector,omitempty"`
+	Source              string `json:"source"` // File the entity was read from
+
+	selector *kube.LabelSelector
+}
+
+// Catalog maps Kubernetes workloads to Backstage components and owners,
+// loaded from catalog-info.yaml files in a directory or Git checkout
+type Catalog struct {
+	Dir string
+
+	mu         sync.RWMutex
+	components []*Component
+	byID       map[string][]*Component
+	byRef      map[string]*Component // Keyed by lowercase entity ref
+}
+
+// NewCatalog creates a catalog reading entity files under dir
+func NewCatalog(dir string) *Catalog {
+	return &Catalog{Dir: dir, byID: make(map[string][]*Component), byRef: make(map[string]*Component)}
+}
+
+// Load reads every YAML file under Dir. Entities from files that fail to
+// parse are skipped and reported in the error; the rest are still loaded,
+// so one broken file doesn't drop everyone's ownership.
+func (c *Catalog) Load() error {
+	var components []*Component
+	var errs []error
+	err := filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); path != c.Dir && (strings.HasPrefix(name, ".") || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		found, err := readEntities(path)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		components = append(components, found...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string][]*Component)
+	byRef := make(map[string]*Component)
+	for _, comp := range components {
+		key := strings.ToLower(comp.Ref)
+		if other, dup := byRef[key]; dup {
+			errs = append(errs, fmt.Errorf("%s: %s is also defined in %s", comp.Source, comp.Ref, other.Source))
+			continue
+		}
+		byRef[key] = comp
+		if comp.KubernetesID != "" {
+			byID[comp.KubernetesID] = append(byID[comp.KubernetesID], comp)
+		}
+	}
+	sort.Slice(components, func(i, j int) bool { return components[i].Ref < components[j].Ref })
+
+	c.mu.Lock()
+	c.components = components
+	c.byID = byID
+	c.byRef = byRef
+	c.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// readEntities reads the entities with Kubernetes annotations from one file
+func readEntities(path string) ([]*Component, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := yaml.Documents(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var components []*Component
+	for _, doc := range docs {
+		var entity Entity
+		if err := json.Unmarshal(doc, &entity); err != nil {
+			// Not an entity (some other YAML in the repository)
+			continue
+		}
+		if !strings.HasPrefix(entity.APIVersion, "backstage.io/") || entity.Metadata.Name == "" {
+			continue
+		}
+		comp, err := newComponent(entity, path)
+		if err != nil {
+			return components, fmt.Errorf("%s: %w", path, err)
+		}
+		if comp != nil {
+			components = append(components, comp)
+		}
+	}
+	return components, nil
+}
+
+// newComponent builds a component from an entity, or returns nil when the
+// entity isn't linked to Kubernetes
+func newComponent(entity Entity, source string) (*Component, error) {
+	annotations := entity.Metadata.Annotations
+	id := annotations[KubernetesIDAnnotation]
+	selector := annotations[KubernetesLabelSelectorAnnotation]
+	if id == "" && selector == "" {
+		return nil, nil
+	}
+
+	namespace := entity.Metadata.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	kind := strings.ToLower(entity.Kind)
+	comp := &Component{
+		Ref:                 kind + ":" + namespace + "/" + entity.Metadata.Name,
+		Kind:                entity.Kind,
+		Name:                entity.Metadata.Name,
+		Namespace:           namespace,
+		Title:               entity.Metadata.Title,
+		Type:                entity.Spec.Type,
+		Owner:               ownerRef(entity.Spec.Owner, namespace),
+		Team:                refName(entity.Spec.Owner),
+		System:              entity.Spec.System,
+		Lifecycle:           entity.Spec.Lifecycle,
+		KubernetesID:        id,
+		KubernetesNamespace: annotations[KubernetesNamespaceAnnotation],
+		LabelSelector:       selector,
+		Source:              source,
+	}
+	if selector != "" {
+		parsed, err := kube.ParseSelector(selector)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", comp.Ref, KubernetesLabelSelectorAnnotation, err)
+		}
+		comp.selector = parsed
+	}
+	return comp, nil
+}
+
+// ownerRef expands a short owner reference ("team-a") to a full entity ref ("group:default/team-a")
+func ownerRef(owner string, namespace string) string {
+	if owner == "" {
+		return ""
+	}
+	kind, rest := "group", owner
+	if k, r, ok := strings.Cut(owner, ":"); ok {
+		kind, rest = k, r
+	}
+	if !strings.Contains(rest, "/") {
+		rest = namespace + "/" + rest
+	}
+	return kind + ":" + rest
+}
+
+// refName returns the name part of an entity ref ("group:default/team-a" -> "team-a")
+func refName(ref string) string {
+	if _, rest, ok := strings.Cut(ref, ":"); ok {
+		ref = rest
+	}
+	if i := strings.LastIndex(ref, "/"); i >= 0 {
+		ref = ref[i+1:]
+	}
+	return ref
+}
+
+// Match finds the component a pod belongs to: by its backstage.io/kubernetes-id
+// label, then by a component's label selector, then by a kubernetes-id equal
+// to the pod's workload name. Components pinned to a namespace only match there.
+func (c *Catalog) Match(pod *models.Pod) (*Component, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	inNamespace := func(comp *Component) bool {
+		return comp.KubernetesNamespace == "" || comp.KubernetesNamespace == pod.Namespace
+	}
+	if id := pod.Labels[KubernetesIDLabel]; id != "" {
+		for _, comp := range c.byID[id] {
+			if inNamespace(comp) {
+				return comp, true
+			}
+		}
+	}
+	for _, comp := range c.components {
+		if comp.selector != nil && inNamespace(comp) && comp.selector.Matches(pod.Labels) {
+			return comp, true
+		}
+	}
+	for _, comp := range c.byID[pod.Workload] {
+		if inNamespace(comp) {
+			return comp, true
+		}
+	}
+	return nil, false
+}
+
+// Owner returns the team that owns a pod: its component's owner, or its
+// team label when no component matches
+func (c *Catalog) Owner(pod *models.Pod) string {
+	if comp, ok := c.Match(pod); ok && comp.Team != "" {
+		return comp.Team
+	}
+	return pod.Team()
+}
+
+// Lookup finds a component by entity ref, e.g. "component:default/checkout"
+func (c *Catalog) Lookup(ref string) (*Component, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	comp, ok := c.byRef[strings.ToLower(ref)]
+	return comp, ok
+}
+
+// Components returns every component linked to Kubernetes, sorted by entity ref
+func (c *Catalog) Components() []*Component {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]*Component(nil), c.components...)
+}
@@ -0,0 +1,110 @@
+package backstage
+
+import (
+	"sort"
+
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/models"
+)
+
+// WorkloadCost is one Kubernetes workload of a component
+type WorkloadCost struct {
+	Namespace string  `json:"namespace"`
+	Name      string  `json:"name"`
+	Pods      int     `json:"pods"`
+	CostPerHr float64 `json:"costPerHr"`
+}
+
+// ComponentCost is a component's running cost, shaped for a Backstage
+// entity page card
+type ComponentCost struct {
+	EntityRef    string         `json:"entityRef"`
+	Name         string         `json:"name"`
+	Title        string         `json:"title,omitempty"`
+	Owner        string         `json:"owner"`
+	System       string         `json:"system,omitempty"`
+	Lifecycle    string         `json:"lifecycle,omitempty"`
+	Currency     string         `json:"currency"`
+	Pods         int            `json:"pods"`
+	CPU          float64        `json:"cpu"`
+	Memory       float64        `json:"memory"`
+	CostPerHr    float64        `json:"costPerHr"`
+	CostPerMonth float64        `json:"costPerMonth"`
+	Workloads    []WorkloadCost `json:"workloads"`
+}
+
+// Costs totals pod costs per component, most expensive first. Components
+// with no running pods are included at zero so every entity page has data.
+func (c *Catalog) Costs(pods []*models.Pod, calc *calculator.Calculator) []ComponentCost {
+	return c.tally(c.Components(), pods, calc)
+}
+
+// Cost totals pod costs for one component, looked up by entity ref
+func (c *Catalog) Cost(ref string, pods []*models.Pod, calc *calculator.Calculator) (ComponentCost, bool) {
+	comp, ok := c.Lookup(ref)
+	if !ok {
+		return ComponentCost{}, false
+	}
+	return c.tally([]*Component{comp}, pods, calc)[0], true
+}
+
+// tally totals the cost of the given components' pods
+func (c *Catalog) tally(components []*Component, pods []*models.Pod, calc *calculator.Calculator) []ComponentCost {
+	byRef := make(map[string]*ComponentCost)
+	workloads := make(map[string]map[string]*WorkloadCost)
+	for _, comp := range components {
+		byRef[comp.Ref] = &ComponentCost{
+			EntityRef: comp.Ref, Name: comp.Name, Title: comp.Title, Owner: comp.Owner,
+			System: comp.System, Lifecycle: comp.Lifecycle, Currency: "USD", Workloads: []WorkloadCost{},
+		}
+		workloads[comp.Ref] = make(map[string]*WorkloadCost)
+	}
+
+	for _, pod := range pods {
+		comp, ok := c.Match(pod)
+		if !ok {
+			continue
+		}
+		total, wanted := byRef[comp.Ref]
+		if !wanted {
+			continue
+		}
+		cost := calc.CalculatePodCost(pod)
+		total.Pods++
+		total.CPU += pod.CPU
+		total.Memory += pod.Memory
+		total.CostPerHr += cost
+
+		name := pod.Workload
+		if name == "" {
+			name = pod.Name
+		}
+		key := pod.Namespace + "/" + name
+		w, ok := workloads[comp.Ref][key]
+		if !ok {
+			w = &WorkloadCost{Namespace: pod.Namespace, Name: name}
+			workloads[comp.Ref][key] = w
+		}
+		w.Pods++
+		w.CostPerHr += cost
+	}
+
+	costs := make([]ComponentCost, 0, len(byRef))
+	for ref, total := range byRef {
+		total.CostPerMonth = total.CostPerHr * models.HoursPerMonth
+		for _, w := range workloads[ref] {
+			total.Workloads = append(total.Workloads, *w)
+		}
+		sort.Slice(total.Workloads, func(i, j int) bool {
+			return total.Workloads[i].CostPerHr > total.Workloads[j].CostPerHr
+		})
+		costs = append(costs, *total)
+	}
+	sort.Slice(costs, func(i, j int) bool {
+		if costs[i].CostPerHr != costs[j].CostPerHr {
+			return costs[i].CostPerHr > costs[j].CostPerHr
+		}
+		return costs[i].EntityRef < costs[j].EntityRef
+	})
+	return costs
+}
@@ -0,0 +1,478 @@
+// Package batch accounts for Job and CronJob runs: what each run cost from
+// its pods' lifetimes, what each CronJob costs per day, and what its schedule
+// will cost over a month. Runs are built from watcher events, so Jobs that
+// finish between periodic scans are still counted.
+package batch
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/kube"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/watcher"
+)
+
+// dayFormat keys daily totals
+const dayFormat = "2006-01-02"
+
+// scheduledSuffix is the scheduled-minute suffix the CronJob controller
+// adds to the Jobs it creates, e.g. "backup-28950120"
+var scheduledSuffix = regexp.MustCompile(`^(.+)-[0-9]{8,}$`)
+
+// Run is one execution of a Job
+type Run struct {
+	Namespace string    `json:"namespace"`
+	Job       string    `json:"job"`
+	CronJob   string    `json:"cronJob,omitempty"`
+	Team      string    `json:"team"`
+	Status    string    `json:"status"` // "running", "succeeded" or "failed"
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished,omitempty"`
+	Seconds   float64   `json:"seconds"` // Wall-clock time from first pod start to last pod end
+	Pods      int       `json:"pods"`
+	Failed    int       `json:"failedPods"`
+	CoreHours float64   `json:"coreHours"`
+	GBHours   float64   `json:"gbHours"`
+	Cost      float64   `json:"cost"`
+
+	pending int // Pods still going
+}
+
+// CostPerHr is the run's average hourly cost while it ran
+func (r Run) CostPerHr() float64 {
+	if r.Seconds <= 0 {
+		return 0
+	}
+	return r.Cost / (r.Seconds / 3600)
+}
+
+// DayCost is what a CronJob cost on one day (UTC)
+type DayCost struct {
+	Date string  `json:"date"`
+	Runs int     `json:"runs"`
+	Cost float64 `json:"cost"`
+}
+
+// CronJobCost summarizes a CronJob's runs and projects its schedule forward
+type CronJobCost struct {
+	Namespace        string    `json:"namespace"`
+	Name             string    `json:"name"`
+	Team             string    `json:"team"`
+	Schedule         string    `json:"schedule,omitempty"` // Empty until read from the API
+	Suspended        bool      `json:"suspended,omitempty"`
+	Runs             int       `json:"runs"` // Runs kept in history
+	MedianCostPerRun float64   `json:"medianCostPerRun"`
+	AvgCostPerRun    float64   `json:"avgCostPerRun"`
+	RunsPerMonth     int       `json:"runsPerMonth"`
+	ProjectedMonthly float64   `json:"projectedMonthly"`
+	LastRun          *Run      `json:"lastRun,omitempty"`
+	Daily            []DayCost `json:"daily"`
+}
+
+// Anomaly is a run that cost far more than its CronJob's usual run
+type Anomaly struct {
+	Run    Run     `json:"run"`
+	Median float64 `json:"median"` // Median cost of the CronJob's previous runs
+	Factor float64 `json:"factor"` // Run cost over the median
+}
+
+// Message describes the anomaly for an alert
+func (a Anomaly) Message() string {
+	return fmt.Sprintf("Run %s of CronJob %s/%s cost $%.2f, %.1fx its median of $%.2f (%d pods, %s)",
+		a.Run.Job, a.Run.Namespace, a.Run.CronJob, a.Run.Cost, a.Factor, a.Median, a.Run.Pods,
+		time.Duration(a.Run.Seconds*float64(time.Second)).Round(time.Second))
+}
+
+// AnomalyHandler is called for every anomalous run
+type AnomalyHandler func(Anomaly)
+
+// podState is a batch pod's part in a run
+type podState struct {
+	run       *Run
+	started   time.Time
+	costPerHr float64
+	cpu       float64
+	memory    float64
+	done      bool
+}
+
+// cronJob is a CronJob's schedule, run history and daily totals
+type cronJob struct {
+	namespace, name string
+	team            string
+	schedule        string
+	timeZone        string
+	suspended       bool
+	parsed          *Schedule
+	runs            []Run // Oldest first
+	days            map[string]*DayCost
+}
+
+// Tracker builds Job runs from pod events
+type Tracker struct {
+	AnomalyFactor float64       // A run costing this many times its CronJob's median is an anomaly
+	MinHistory    int           // Previous runs needed before a CronJob's runs are compared
+	History       int           // Runs kept per CronJob, and standalone Job runs kept in total
+	Retention     time.Duration // How long daily totals are kept
+
+	calc     *calculator.Calculator
+	now      func() time.Time
+	mu       sync.Mutex
+	pods     map[string]*podState // Batch pods by namespace/name
+	active   map[string]*Run      // Unfinished runs by namespace/job
+	jobs     []Run                // Finished runs of Jobs no CronJob owns, oldest first
+	cronJobs map[string]*cronJob  // By namespace/name
+	synced   bool                 // CronJobs were read from the API
+	handlers []AnomalyHandler
+}
+
+// NewTracker creates a tracker fed by the watcher's pod events
+func NewTracker(w *watcher.Watcher, calc *calculator.Calculator) *Tracker {
+	t := &Tracker{
+		AnomalyFactor: 3,
+		MinHistory:    5,
+		History:       100,
+		Retention:     30 * 24 * time.Hour,
+		calc:          calc,
+		now:           time.Now,
+		pods:          make(map[string]*podState),
+		active:        make(map[string]*Run),
+		cronJobs:      make(map[string]*cronJob),
+	}
+	for _, pod := range w.Pods() {
+		t.Handle(watcher.Event{Type: watcher.PodAdded, Pod: pod})
+	}
+	w.OnEvent(t.Handle)
+	return t
+}
+
+// OnAnomaly registers a handler called for every anomalous run
+func (t *Tracker) OnAnomaly(h AnomalyHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers = append(t.handlers, h)
+}
+
+// Handle applies a watcher event. A pod's cost is its hourly price times
+// the time from its start to its end, taken from the pod status when
+// known; a run ends when every pod seen for its Job has ended.
+func (t *Tracker) Handle(e watcher.Event) {
+	pod := e.Pod
+	if pod.Job == "" {
+		return
+	}
+	now := t.now()
+	cost := 0.0
+	if e.Type != watcher.PodDeleted {
+		cost = t.calc.CalculatePodCost(pod)
+	}
+
+	t.mu.Lock()
+	key := pod.Namespace + "/" + pod.Name
+	state, ok := t.pods[key]
+	if !ok {
+		if e.Type == watcher.PodDeleted {
+			t.mu.Unlock()
+			return
+		}
+		state = &podState{run: t.run(pod, now), started: pod.StartedAt}
+		if state.started.IsZero() {
+			state.started = now
+		}
+		state.run.Pods++
+		state.run.pending++
+		if state.started.Before(state.run.Started) {
+			state.run.Started = state.started
+		}
+		t.pods[key] = state
+	}
+	if e.Type != watcher.PodDeleted {
+		state.costPerHr, state.cpu, state.memory = cost, pod.CPU, pod.Memory
+		if !pod.StartedAt.IsZero() && pod.StartedAt.Before(state.started) {
+			state.started = pod.StartedAt
+		}
+	}
+
+	var anomalies []Anomaly
+	ended := pod.Phase == "Succeeded" || pod.Phase == "Failed" || e.Type == watcher.PodDeleted
+	if ended && !state.done {
+		finished := pod.FinishedAt
+		if finished.IsZero() {
+			finished = now
+		}
+		if a, ok := t.finishPod(state, finished, pod.Phase == "Failed"); ok {
+			anomalies = append(anomalies, a)
+		}
+	}
+	if e.Type == watcher.PodDeleted {
+		delete(t.pods, key)
+	}
+	handlers := t.handlers
+	t.mu.Unlock()
+
+	for _, a := range anomalies {
+		for _, h := range handlers {
+			h(a)
+		}
+	}
+}
+
+// run returns the unfinished run of a pod's Job, starting one if needed
+func (t *Tracker) run(pod *models.Pod, now time.Time) *Run {
+	key := pod.Namespace + "/" + pod.Job
+	if run, ok := t.active[key]; ok {
+		return run
+	}
+	run := &Run{Namespace: pod.Namespace, Job: pod.Job, CronJob: t.cronJobName(pod.Namespace, pod.Job),
+		Team: pod.Team(), Status: "running", Started: now}
+	t.active[key] = run
+	return run
+}
+
+// cronJobName returns the CronJob that created a Job, from the Job's name
+func (t *Tracker) cronJobName(namespace string, job string) string {
+	m := scheduledSuffix.FindStringSubmatch(job)
+	if m == nil {
+		return ""
+	}
+	if t.synced {
+		if _, ok := t.cronJobs[namespace+"/"+m[1]]; !ok {
+			return "" // CronJobs were read from the API and none matches
+		}
+	}
+	return m[1]
+}
+
+// finishPod charges a pod's lifetime to its run and completes the run when
+// it was the last pod still going
+func (t *Tracker) finishPod(state *podState, finished time.Time, failed bool) (Anomaly, bool) {
+	state.done = true
+	run := state.run
+	hours := finished.Sub(state.started).Hours()
+	if hours < 0 {
+		hours = 0
+	}
+	run.Cost += state.costPerHr * hours
+	run.CoreHours += state.cpu * hours
+	run.GBHours += state.memory * hours
+	if failed {
+		run.Failed++
+	}
+	if finished.After(run.Finished) {
+		run.Finished = finished
+	}
+
+	if run.pending--; run.pending > 0 {
+		return Anomaly{}, false
+	}
+	return t.complete(run)
+}
+
+// complete files a finished run, checking it against its CronJob's history
+func (t *Tracker) complete(run *Run) (Anomaly, bool) {
+	delete(t.active, run.Namespace+"/"+run.Job)
+	run.Status = "succeeded"
+	if run.Failed > 0 && run.Failed == run.Pods {
+		run.Status = "failed"
+	}
+	run.Seconds = run.Finished.Sub(run.Started).Seconds()
+
+	if run.CronJob == "" {
+		t.jobs = trim(append(t.jobs, *run), t.History)
+		return Anomaly{}, false
+	}
+
+	key := run.Namespace + "/" + run.CronJob
+	cj, ok := t.cronJobs[key]
+	if !ok {
+		cj = &cronJob{namespace: run.Namespace, name: run.CronJob}
+		t.cronJobs[key] = cj
+	}
+	cj.team = run.Team
+	if cj.days == nil {
+		cj.days = make(map[string]*DayCost)
+	}
+	date := run.Started.UTC().Format(dayFormat)
+	day, ok := cj.days[date]
+	if !ok {
+		day = &DayCost{Date: date}
+		cj.days[date] = day
+	}
+	day.Runs++
+	day.Cost += run.Cost
+	cutoff := run.Finished.Add(-t.Retention).UTC().Format(dayFormat)
+	for date := range cj.days {
+		if date < cutoff {
+			delete(cj.days, date)
+		}
+	}
+
+	var anomaly Anomaly
+	found := false
+	if len(cj.runs) >= t.MinHistory && t.AnomalyFactor > 0 {
+		if m := median(costs(cj.runs)); m > 0 && run.Cost > t.AnomalyFactor*m {
+			anomaly, found = Anomaly{Run: *run, Median: m, Factor: run.Cost / m}, true
+		}
+	}
+	cj.runs = trim(append(cj.runs, *run), t.History)
+	return anomaly, found
+}
+
+// SetCronJobs updates CronJob schedules from the API, so runs can be
+// projected forward. CronJobs that were deleted keep their history.
+func (t *Tracker) SetCronJobs(list []kube.CronJob) []error {
+	var errs []error
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.synced = true
+	for _, item := range list {
+		key := item.Metadata.Namespace + "/" + item.Metadata.Name
+		cj, ok := t.cronJobs[key]
+		if !ok {
+			cj = &cronJob{namespace: item.Metadata.Namespace, name: item.Metadata.Name}
+			t.cronJobs[key] = cj
+		}
+		if cj.team == "" {
+			cj.team = item.Metadata.Labels[models.TeamLabel]
+		}
+		cj.suspended = item.Spec.Suspend
+		if cj.schedule == item.Spec.Schedule && cj.timeZone == item.Spec.TimeZone && cj.parsed != nil {
+			continue
+		}
+		cj.schedule, cj.timeZone = item.Spec.Schedule, item.Spec.TimeZone
+		parsed, err := ParseSchedule(item.Spec.Schedule, item.Spec.TimeZone)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CronJob %s: %w", key, err))
+		}
+		cj.parsed = parsed
+	}
+	return errs
+}
+
+// CronJobs summarizes every CronJob, the highest projected monthly cost first
+func (t *Tracker) CronJobs() []CronJobCost {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	summaries := make([]CronJobCost, 0, len(t.cronJobs))
+	for _, cj := range t.cronJobs {
+		summaries = append(summaries, cj.summary(now))
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.ProjectedMonthly != b.ProjectedMonthly {
+			return a.ProjectedMonthly > b.ProjectedMonthly
+		}
+		return a.Namespace+"/"+a.Name < b.Namespace+"/"+b.Name
+	})
+	return summaries
+}
+
+// CronJob summarizes one CronJob
+func (t *Tracker) CronJob(namespace string, name string) (CronJobCost, bool) {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cj, ok := t.cronJobs[namespace+"/"+name]
+	if !ok {
+		return CronJobCost{}, false
+	}
+	return cj.summary(now), true
+}
+
+// Runs returns running and finished runs, newest first, optionally only a
+// namespace's or a CronJob's
+func (t *Tracker) Runs(namespace string, cronJobName string) []Run {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	runs := []Run{}
+	keep := func(run Run) {
+		if (namespace == "" || run.Namespace == namespace) && (cronJobName == "" || run.CronJob == cronJobName) {
+			runs = append(runs, run)
+		}
+	}
+	for _, run := range t.active {
+		keep(*run)
+	}
+	if cronJobName == "" {
+		for _, run := range t.jobs {
+			keep(run)
+		}
+	}
+	for _, cj := range t.cronJobs {
+		for _, run := range cj.runs {
+			keep(run)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Started.After(runs[j].Started) })
+	return runs
+}
+
+// summary totals a CronJob's history and projects its schedule over a month
+func (cj *cronJob) summary(now time.Time) CronJobCost {
+	summary := CronJobCost{
+		Namespace: cj.namespace,
+		Name:      cj.name,
+		Team:      cj.team,
+		Schedule:  cj.schedule,
+		Suspended: cj.suspended,
+		Runs:      len(cj.runs),
+		Daily:     []DayCost{},
+	}
+	if summary.Team == "" {
+		summary.Team = models.UnknownTeam
+	}
+	if len(cj.runs) > 0 {
+		last := cj.runs[len(cj.runs)-1]
+		summary.LastRun = &last
+		total := 0.0
+		for _, run := range cj.runs {
+			total += run.Cost
+		}
+		summary.AvgCostPerRun = total / float64(len(cj.runs))
+		summary.MedianCostPerRun = median(costs(cj.runs))
+	}
+	if cj.parsed != nil && !cj.suspended {
+		summary.RunsPerMonth = cj.parsed.Count(now, now.Add(models.HoursPerMonth*time.Hour))
+		summary.ProjectedMonthly = summary.AvgCostPerRun * float64(summary.RunsPerMonth)
+	}
+	for _, day := range cj.days {
+		summary.Daily = append(summary.Daily, *day)
+	}
+	sort.Slice(summary.Daily, func(i, j int) bool { return summary.Daily[i].Date < summary.Daily[j].Date })
+	return summary
+}
+
+// costs lists the cost of each run
+func costs(runs []Run) []float64 {
+	values := make([]float64, len(runs))
+	for i, run := range runs {
+		values[i] = run.Cost
+	}
+	return values
+}
+
+// trim keeps the last n runs
+func trim(runs []Run, n int) []Run {
+	if n > 0 && len(runs) > n {
+		return append([]Run(nil), runs[len(runs)-n:]...)
+	}
+	return runs
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
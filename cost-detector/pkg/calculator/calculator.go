@@ -1,12 +1,36 @@
 package calculator
 
-import "cost-detector/pkg/models"
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"cost-detector/pkg/carbon"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/pricing"
+)
+
+// NodeLookup finds the node a pod is scheduled on
+type NodeLookup interface {
+	Node(name string) (*models.Node, bool)
+}
 
 // Calculator does the cost calculations
 type Calculator struct {
 	NodePrices map[string]float64 // Map of instance type to cost per hour
+	Nodes      NodeLookup         // Where pods run; nil prices every pod at the flat rate
+	Strategies []pricing.Strategy // Tried in order; the first that applies prices the pod
+	Energy     *carbon.Model      // Energy and emissions model; nil leaves them out
+
+	ExtraSidecars map[string]string // Sidecar container names to kinds, on top of KnownSidecars
+
+	mu               sync.RWMutex
+	correctionFactor float64 // Billed / estimated, from reconciling with the bill; 0 means none
 }
 
+// FlatRate is the price model used when no strategy applies to a pod
+const FlatRate = "flat-rate"
+
 // NewCalculator creates a new cost calculator
 func NewCalculator() *Calculator {
 	return &Calculator{
@@ -14,17 +38,68 @@ func NewCalculator() *Calculator {
 	}
 }
 
+// SetCorrectionFactor scales every estimate by billed / estimated cost, so
+// estimates track the invoice. 0 or 1 turns correction off.
+func (c *Calculator) SetCorrectionFactor(factor float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.correctionFactor = factor
+}
+
+// CorrectionFactor returns the factor estimates are scaled by (1 when off)
+func (c *Calculator) CorrectionFactor() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.correctionFactor <= 0 {
+		return 1
+	}
+	return c.correctionFactor
+}
+
 // CalculatePodCost calculates hourly cost of a pod
 func (c *Calculator) CalculatePodCost(pod *models.Pod) float64 {
-	// This is simplified. In reality:
-	// Cost = (Pod CPU Request / Node CPU) * Node Price Per Hour
-	//      + (Pod Memory Request / Node Memory) * Node Price Per Hour
-	
-	// For now, rough estimate: $0.05 per CPU per hour, $0.01 per GB per hour
+	cost, _ := c.price(pod)
+	return cost
+}
+
+// PriceModel returns the name of the strategy that prices a pod
+func (c *Calculator) PriceModel(pod *models.Pod) string {
+	_, model := c.price(pod)
+	return model
+}
+
+// price picks the pricing strategy for a pod based on the node it runs on
+func (c *Calculator) price(pod *models.Pod) (float64, string) {
+	var node *models.Node
+	if c.Nodes != nil && pod.NodeName != "" {
+		node, _ = c.Nodes.Node(pod.NodeName)
+	}
+	factor := c.CorrectionFactor()
+	for _, strategy := range c.Strategies {
+		if cost, ok := strategy.PodCost(pod, node); ok {
+			return cost * factor, strategy.Name()
+		}
+	}
+
+	// Unknown node or instance type: rough estimate of
+	// $0.05 per CPU per hour, $0.01 per GB per hour
 	cpuCost := pod.CPU * 0.05
 	memoryCost := pod.Memory * 0.01
-	
-	return cpuCost + memoryCost
+
+	return (cpuCost + memoryCost) * factor, FlatRate
+}
+
+// CalculatePodFootprint estimates a pod's energy use and emissions per hour,
+// zero without an energy model
+func (c *Calculator) CalculatePodFootprint(pod *models.Pod) carbon.Footprint {
+	if c.Energy == nil {
+		return carbon.Footprint{}
+	}
+	var node *models.Node
+	if c.Nodes != nil && pod.NodeName != "" {
+		node, _ = c.Nodes.Node(pod.NodeName)
+	}
+	return c.Energy.PodFootprint(pod, node)
 }
 
 // CalculateHourlyCost calculates cost for multiple pods
@@ -35,3 +110,62 @@ func (c *Calculator) CalculateHourlyCost(pods []*models.Pod) float64 {
 	}
 	return totalCost
 }
+
+// Summary groupings supported by Summarize
+const (
+	GroupByNamespace = "namespace"
+	GroupByWorkload  = "workload"
+	GroupByPod       = "pod"
+)
+
+// Summarize groups pods by namespace, workload or pod and totals their cost,
+// most expensive first
+func (c *Calculator) Summarize(pods []*models.Pod, groupBy string) ([]models.CostSummary, error) {
+	groups := make(map[string]*models.CostSummary)
+	var order []string
+
+	for _, pod := range pods {
+		var name, namespace string
+		switch groupBy {
+		case GroupByNamespace:
+			name = pod.Namespace
+		case GroupByWorkload:
+			name, namespace = pod.Workload, pod.Namespace
+			if name == "" {
+				name = pod.Name
+			}
+		case GroupByPod:
+			name, namespace = pod.Name, pod.Namespace
+		default:
+			return nil, fmt.Errorf("unknown grouping %q", groupBy)
+		}
+
+		key := namespace + "/" + name
+		group, ok := groups[key]
+		if !ok {
+			group = &models.CostSummary{Name: name, Namespace: namespace}
+			groups[key] = group
+			order = append(order, key)
+		}
+		group.Pods++
+		group.CPU += pod.CPU
+		group.Memory += pod.Memory
+		cost, model := c.price(pod)
+		group.CostPerHr += cost
+		footprint := c.CalculatePodFootprint(pod)
+		group.KWhPerHr += footprint.KWhPerHr
+		group.CO2ePerHr += footprint.CO2ePerHr
+		if groupBy == GroupByPod {
+			group.Model = model
+		}
+	}
+
+	summaries := make([]models.CostSummary, 0, len(order))
+	for _, key := range order {
+		summaries = append(summaries, *groups[key])
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].CostPerHr > summaries[j].CostPerHr
+	})
+	return summaries, nil
+}
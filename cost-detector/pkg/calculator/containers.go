@@ -0,0 +1,182 @@
+package calculator
+
+import (
+	"sort"
+	"strings"
+
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/pricing"
+)
+
+// PodOverhead is the container name used for reservations no container
+// asked for, such as RuntimeClass pod overhead
+const PodOverhead = "pod-overhead"
+
+// KnownSidecars maps well-known sidecar container names to their kind
+var KnownSidecars = map[string]string{
+	"istio-proxy":             "istio-proxy",
+	"istio-init":              "istio-proxy",
+	"istio-validation":        "istio-proxy",
+	"linkerd-proxy":           "linkerd-proxy",
+	"linkerd-init":            "linkerd-proxy",
+	"envoy":                   "envoy",
+	"fluent-bit":              "fluent-bit",
+	"fluentbit":               "fluent-bit",
+	"fluentd":                 "fluentd",
+	"datadog-agent":           "datadog-agent",
+	"datadog-init":            "datadog-agent",
+	"otel-collector":          "otel-collector",
+	"aws-otel-collector":      "otel-collector",
+	"aws-xray-daemon":         "xray-daemon",
+	"xray-daemon":             "xray-daemon",
+	"vault-agent":             "vault-agent",
+	"vault-agent-init":        "vault-agent",
+	"cloudwatch-agent":        "cloudwatch-agent",
+	"aws-for-fluent-bit":      "fluent-bit",
+	"appmesh-envoy":           "envoy",
+	"proxy-init":              "linkerd-proxy",
+	"dd-lib-java-init":        "datadog-agent",
+	"datadog-lib-java-init":   "datadog-agent",
+	"datadog-lib-python-init": "datadog-agent",
+}
+
+// knownSidecarImages maps image name fragments to sidecar kinds, for sidecars
+// injected under a custom container name
+var knownSidecarImages = map[string]string{
+	"istio/proxyv2":           "istio-proxy",
+	"linkerd/proxy":           "linkerd-proxy",
+	"envoyproxy/envoy":        "envoy",
+	"fluent/fluent-bit":       "fluent-bit",
+	"aws-for-fluent-bit":      "fluent-bit",
+	"datadog/agent":           "datadog-agent",
+	"opentelemetry-collector": "otel-collector",
+	"hashicorp/vault":         "vault-agent",
+}
+
+// SidecarKind returns the sidecar kind of a container, or "" for application containers
+func (c *Calculator) SidecarKind(container models.Container) string {
+	if kind, ok := KnownSidecars[container.Name]; ok {
+		return kind
+	}
+	if kind, ok := c.ExtraSidecars[container.Name]; ok {
+		return kind
+	}
+	for fragment, kind := range knownSidecarImages {
+		if strings.Contains(container.Image, fragment) {
+			return kind
+		}
+	}
+	return ""
+}
+
+// ContainerCosts splits a pod's hourly cost across its containers, weighting
+// CPU and memory the way AWS prices them. Reservations no app container asked
+// for go to the init container that caused them, or to pod overhead.
+func (c *Calculator) ContainerCosts(pod *models.Pod) []models.ContainerCost {
+	podCost := c.CalculatePodCost(pod)
+	if len(pod.Containers) == 0 {
+		return []models.ContainerCost{{
+			Namespace: pod.Namespace, Pod: pod.Name, Container: pod.Name,
+			CPU: pod.CPU, Memory: pod.Memory, CostPerHr: podCost,
+		}}
+	}
+
+	value := func(cpu float64, memory float64) float64 {
+		return cpu*pricing.DefaultFargateVCPUPrice + memory*pricing.DefaultFargateGBPrice
+	}
+	total := value(pod.CPU, pod.Memory)
+	share := func(cpu float64, memory float64) float64 {
+		if total <= 0 {
+			return 0
+		}
+		return podCost * value(cpu, memory) / total
+	}
+
+	var costs []models.ContainerCost
+	var appCPU, appMemory float64
+	var largestInit *models.Container
+	var largestInitValue float64
+	for i := range pod.Containers {
+		container := pod.Containers[i]
+		requests := container.Resources.EffectiveRequests()
+		cpu, memory := requests.CPU().AsFloat64(), requests.Memory().GiB()
+		if container.Init {
+			if v := value(cpu, memory); largestInit == nil || v > largestInitValue {
+				largestInit, largestInitValue = &pod.Containers[i], v
+			}
+			continue
+		}
+		appCPU += cpu
+		appMemory += memory
+
+		sidecar := c.SidecarKind(container)
+		costs = append(costs, models.ContainerCost{
+			Namespace: pod.Namespace, Pod: pod.Name, Container: container.Name,
+			Sidecar: sidecar, Overhead: sidecar != "",
+			CPU: cpu, Memory: memory, CostPerHr: share(cpu, memory),
+		})
+	}
+
+	// Whatever the pod reserves beyond its app containers
+	extraCPU, extraMemory := positive(pod.CPU-appCPU), positive(pod.Memory-appMemory)
+	if extraCPU > 0 || extraMemory > 0 {
+		extra := models.ContainerCost{
+			Namespace: pod.Namespace, Pod: pod.Name, Container: PodOverhead, Overhead: true,
+			CPU: extraCPU, Memory: extraMemory, CostPerHr: share(extraCPU, extraMemory),
+		}
+		if largestInit != nil {
+			extra.Container, extra.Init = largestInit.Name, true
+			extra.Sidecar = c.SidecarKind(*largestInit)
+			extra.Overhead = extra.Sidecar != ""
+		}
+		costs = append(costs, extra)
+	}
+	return costs
+}
+
+// Overhead totals application and platform overhead cost per namespace,
+// namespaces with the most overhead first
+func (c *Calculator) Overhead(pods []*models.Pod) []models.OverheadSummary {
+	byNamespace := make(map[string]*models.OverheadSummary)
+	for _, pod := range pods {
+		summary, ok := byNamespace[pod.Namespace]
+		if !ok {
+			summary = &models.OverheadSummary{Namespace: pod.Namespace, BySidecar: make(map[string]float64)}
+			byNamespace[pod.Namespace] = summary
+		}
+		for _, cost := range c.ContainerCosts(pod) {
+			if !cost.Overhead {
+				summary.ApplicationCost += cost.CostPerHr
+				continue
+			}
+			summary.OverheadCost += cost.CostPerHr
+			kind := cost.Sidecar
+			if kind == "" {
+				kind = PodOverhead
+			}
+			summary.BySidecar[kind] += cost.CostPerHr
+		}
+	}
+
+	summaries := make([]models.OverheadSummary, 0, len(byNamespace))
+	for _, summary := range byNamespace {
+		if total := summary.ApplicationCost + summary.OverheadCost; total > 0 {
+			summary.OverheadPercent = summary.OverheadCost / total * 100
+		}
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].OverheadCost != summaries[j].OverheadCost {
+			return summaries[i].OverheadCost > summaries[j].OverheadCost
+		}
+		return summaries[i].Namespace < summaries[j].Namespace
+	})
+	return summaries
+}
+
+func positive(v float64) float64 {
+	if v < 1e-9 {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,177 @@
+// Package carbon estimates the energy pods use and the CO2e it emits, from
+// per-instance-type power coefficients and the carbon intensity of each
+// region's grid.
+package carbon
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/pricing"
+)
+
+// RegionLabel is the well-known node label carrying the cloud region
+const RegionLabel = "topology.kubernetes.io/region"
+
+// Default assumptions, as used by Cloud Carbon Footprint for AWS
+const (
+	DefaultPUE         = 1.135 // Data center power usage effectiveness
+	DefaultUtilization = 0.5   // Average CPU utilization between idle and max watts
+)
+
+//go:embed coefficients.json
+var bundled []byte
+
+// Power is how much an instance type draws, idle and at full CPU
+type Power struct {
+	VCPUs     float64 `json:"vcpus"`
+	IdleWatts float64 `json:"idleWatts"`
+	MaxWatts  float64 `json:"maxWatts"`
+}
+
+// Coefficients are the power figures energy is estimated from
+type Coefficients struct {
+	MemoryWattsPerGB float64          `json:"memoryWattsPerGB"`
+	DefaultVCPU      Power            `json:"defaultVCPU"` // For instance types not listed, and Fargate
+	InstanceTypes    map[string]Power `json:"instanceTypes"`
+}
+
+// DefaultIntensity is each AWS region's grid carbon intensity in gCO2e per kWh
+// (Cloud Carbon Footprint, from EPA eGRID, EEA and carbonfootprint.com figures)
+func DefaultIntensity() map[string]float64 {
+	return map[string]float64{
+		"us-east-1":      379.1,
+		"us-east-2":      410.6,
+		"us-west-1":      322.2,
+		"us-west-2":      322.2,
+		"us-gov-east-1":  379.1,
+		"us-gov-west-1":  322.2,
+		"ca-central-1":   13.0,
+		"sa-east-1":      74.0,
+		"eu-west-1":      278.6,
+		"eu-west-2":      225.0,
+		"eu-west-3":      51.1,
+		"eu-central-1":   311.0,
+		"eu-north-1":     8.8,
+		"eu-south-1":     233.0,
+		"ap-east-1":      710.0,
+		"ap-south-1":     708.2,
+		"ap-southeast-1": 408.0,
+		"ap-southeast-2": 790.0,
+		"ap-northeast-1": 465.8,
+		"ap-northeast-2": 415.6,
+		"ap-northeast-3": 465.8,
+		"me-south-1":     732.0,
+		"af-south-1":     900.6,
+	}
+}
+
+// Footprint is a pod's estimated power draw and emissions
+type Footprint struct {
+	Watts     float64 `json:"watts"`     // Including data center overhead (PUE)
+	KWhPerHr  float64 `json:"kWhPerHr"`  // Energy used per hour
+	CO2ePerHr float64 `json:"co2ePerHr"` // Grams of CO2e per hour
+	Region    string  `json:"region"`
+}
+
+// Model estimates pod energy and emissions. A pod draws its share of its
+// node's CPU power at Utilization, plus power for the memory it requests.
+type Model struct {
+	PUE         float64
+	Utilization float64
+	Region      string             // Region of nodes without a region label or zone
+	Intensity   map[string]float64 // Region to gCO2e per kWh
+
+	coefficients Coefficients
+}
+
+// NewModel creates a model from the bundled coefficients and default regional intensities
+func NewModel(region string) *Model {
+	var c Coefficients
+	if err := json.Unmarshal(bundled, &c); err != nil {
+		panic(fmt.Sprintf("carbon: bundled coefficients: %v", err))
+	}
+	return &Model{
+		PUE:          DefaultPUE,
+		Utilization:  DefaultUtilization,
+		Region:       region,
+		Intensity:    DefaultIntensity(),
+		coefficients: c,
+	}
+}
+
+// LoadCoefficients adds or replaces instance types (and the memory and
+// default figures, when set) from a JSON file in the bundled format
+func (m *Model) LoadCoefficients(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var c Coefficients
+	if err := json.Unmarshal(data, &c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if c.MemoryWattsPerGB > 0 {
+		m.coefficients.MemoryWattsPerGB = c.MemoryWattsPerGB
+	}
+	if c.DefaultVCPU.VCPUs > 0 {
+		m.coefficients.DefaultVCPU = c.DefaultVCPU
+	}
+	for name, power := range c.InstanceTypes {
+		if power.VCPUs <= 0 {
+			return fmt.Errorf("%s: instance type %s: vcpus must be positive", path, name)
+		}
+		m.coefficients.InstanceTypes[name] = power
+	}
+	return nil
+}
+
+// PodFootprint estimates a pod's power and emissions on its node; a nil
+// node uses the default per-vCPU figures and the default region
+func (m *Model) PodFootprint(pod *models.Pod, node *models.Node) Footprint {
+	power := m.coefficients.DefaultVCPU
+	if node != nil && !pricing.IsFargate(node) {
+		if p, ok := m.coefficients.InstanceTypes[pricing.NodeInstanceType(node)]; ok {
+			power = p
+		}
+	}
+	perVCPU := (power.IdleWatts + m.Utilization*(power.MaxWatts-power.IdleWatts)) / power.VCPUs
+	watts := (pod.CPU*perVCPU + pod.Memory*m.coefficients.MemoryWattsPerGB) * m.PUE
+
+	region := m.NodeRegion(node)
+	kwh := watts / 1000
+	return Footprint{
+		Watts:     watts,
+		KWhPerHr:  kwh,
+		CO2ePerHr: kwh * m.RegionIntensity(region),
+		Region:    region,
+	}
+}
+
+// RegionIntensity returns a region's grid intensity. A region missing from
+// Intensity, such as a new one, gets Region's rather than counting as
+// emission-free.
+func (m *Model) RegionIntensity(region string) float64 {
+	if intensity, ok := m.Intensity[region]; ok {
+		return intensity
+	}
+	return m.Intensity[m.Region]
+}
+
+// NodeRegion reads a node's region from its label or zone, falling back to Region
+func (m *Model) NodeRegion(node *models.Node) string {
+	if node == nil {
+		return m.Region
+	}
+	if region := node.Labels[RegionLabel]; region != "" {
+		return region
+	}
+	if zone := node.Zone; len(zone) > 1 && strings.Count(zone, "-") == 2 {
+		return strings.TrimRight(zone, "abcdefghijklmnopqrstuvwxyz") // "us-east-1a" -> "us-east-1"
+	}
+	return m.Region
+}
@@ -0,0 +1,55 @@
+// Package clock lets time-dependent checks run against real time or a
+// fake clock, e.g. when replaying a recorded day.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is the system clock
+type Real struct{}
+
+// Now returns the current time
+func (Real) Now() time.Time { return time.Now() }
+
+// Fake is a clock that only moves when told to
+type Fake struct {
+	mu  sync.RWMutex
+	now time.Time
+}
+
+// NewFake creates a fake clock set to t
+func NewFake(t time.Time) *Fake {
+	return &Fake{now: t}
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.now
+}
+
+// Set moves the clock to t; it never goes backwards
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t.After(f.now) {
+		f.now = t
+	}
+}
+
+// Advance moves the clock forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if d > 0 {
+		f.now = f.now.Add(d)
+	}
+}
@@ -0,0 +1,203 @@
+// Package compliance finds workloads whose cost can't be charged back
+// because they lack ownership labels, and fills the labels in from their
+// namespace on admission.
+package compliance
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/models"
+)
+
+// DefaultLabels are the labels chargeback needs on every pod
+var DefaultLabels = []string{models.TeamLabel, "cost-center"}
+
+// PodSource provides the pods to check
+type PodSource interface {
+	Pods() []*models.Pod
+}
+
+// Workload is a workload with pods missing required labels
+type Workload struct {
+	Namespace    string   `json:"namespace"`
+	Name         string   `json:"name"`
+	Pods         int      `json:"pods"`
+	Missing      []string `json:"missing"` // Required labels at least one pod lacks
+	CostPerHr    float64  `json:"costPerHr"`
+	CostPerMonth float64  `json:"costPerMonth"`
+}
+
+// NamespaceSummary totals a namespace's unattributable workloads
+type NamespaceSummary struct {
+	Namespace string  `json:"namespace"`
+	Owner     string  `json:"owner"` // Who gets notified
+	Workloads int     `json:"workloads"`
+	CostPerHr float64 `json:"costPerHr"`
+}
+
+// Report lists unlabeled workloads, most expensive first
+type Report struct {
+	GeneratedAt       time.Time          `json:"generatedAt"`
+	Labels            []string           `json:"labels"`
+	TotalCostPerHr    float64            `json:"totalCostPerHr"`
+	UnattributedPerHr float64            `json:"unattributedCostPerHr"`
+	AttributedPercent float64            `json:"attributedPercent"` // Share of cost on fully labeled pods
+	Workloads         []Workload         `json:"workloads"`
+	Namespaces        []NamespaceSummary `json:"namespaces"`
+}
+
+// Checker builds label compliance reports
+type Checker struct {
+	Labels []string
+	// NamespaceLabels optionally returns a namespace's labels, so its "team"
+	// label can name the owner to notify
+	NamespaceLabels func(namespace string) map[string]string
+
+	pods PodSource
+	calc *calculator.Calculator
+}
+
+// NewChecker creates a checker requiring labels on every pod
+func NewChecker(pods PodSource, calc *calculator.Calculator, labels []string) *Checker {
+	return &Checker{Labels: labels, pods: pods, calc: calc}
+}
+
+// Report checks every pod, or only one namespace's when namespace is set
+func (c *Checker) Report(namespace string) Report {
+	report := Report{GeneratedAt: time.Now(), Labels: c.Labels, Workloads: []Workload{}, Namespaces: []NamespaceSummary{}}
+	workloads := make(map[string]*Workload)
+	missingSets := make(map[string]map[string]bool)
+	teamCost := make(map[string]map[string]float64) // Namespace -> team -> cost of labeled pods
+
+	for _, pod := range c.pods.Pods() {
+		if namespace != "" && pod.Namespace != namespace {
+			continue
+		}
+		cost := c.calc.CalculatePodCost(pod)
+		report.TotalCostPerHr += cost
+		if team := pod.Labels[models.TeamLabel]; team != "" {
+			if teamCost[pod.Namespace] == nil {
+				teamCost[pod.Namespace] = make(map[string]float64)
+			}
+			teamCost[pod.Namespace][team] += cost
+		}
+
+		var missing []string
+		for _, label := range c.Labels {
+			if pod.Labels[label] == "" {
+				missing = append(missing, label)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		report.UnattributedPerHr += cost
+
+		name := pod.Workload
+		if name == "" {
+			name = pod.Name
+		}
+		key := pod.Namespace + "/" + name
+		w, ok := workloads[key]
+		if !ok {
+			w = &Workload{Namespace: pod.Namespace, Name: name}
+			workloads[key] = w
+			missingSets[key] = make(map[string]bool)
+		}
+		w.Pods++
+		w.CostPerHr += cost
+		for _, label := range missing {
+			missingSets[key][label] = true
+		}
+	}
+
+	byNamespace := make(map[string]*NamespaceSummary)
+	for key, w := range workloads {
+		for _, label := range c.Labels {
+			if missingSets[key][label] {
+				w.Missing = append(w.Missing, label)
+			}
+		}
+		w.CostPerMonth = w.CostPerHr * models.HoursPerMonth
+		report.Workloads = append(report.Workloads, *w)
+
+		ns, ok := byNamespace[w.Namespace]
+		if !ok {
+			ns = &NamespaceSummary{Namespace: w.Namespace, Owner: c.owner(w.Namespace, teamCost[w.Namespace])}
+			byNamespace[w.Namespace] = ns
+		}
+		ns.Workloads++
+		ns.CostPerHr += w.CostPerHr
+	}
+	for _, ns := range byNamespace {
+		report.Namespaces = append(report.Namespaces, *ns)
+	}
+
+	sort.Slice(report.Workloads, func(i, j int) bool {
+		if report.Workloads[i].CostPerHr != report.Workloads[j].CostPerHr {
+			return report.Workloads[i].CostPerHr > report.Workloads[j].CostPerHr
+		}
+		return report.Workloads[i].Namespace+"/"+report.Workloads[i].Name < report.Workloads[j].Namespace+"/"+report.Workloads[j].Name
+	})
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		if report.Namespaces[i].CostPerHr != report.Namespaces[j].CostPerHr {
+			return report.Namespaces[i].CostPerHr > report.Namespaces[j].CostPerHr
+		}
+		return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace
+	})
+	report.AttributedPercent = 100
+	if report.TotalCostPerHr > 0 {
+		report.AttributedPercent = 100 * (report.TotalCostPerHr - report.UnattributedPerHr) / report.TotalCostPerHr
+	}
+	return report
+}
+
+// owner picks who to notify about a namespace: its team label, else the
+// team whose labeled pods cost the most there
+func (c *Checker) owner(namespace string, teams map[string]float64) string {
+	if c.NamespaceLabels != nil {
+		if team := c.NamespaceLabels(namespace)[models.TeamLabel]; team != "" {
+			return team
+		}
+	}
+	owner, most := models.UnknownTeam, 0.0
+	for team, cost := range teams {
+		if cost > most || (cost == most && team < owner) {
+			owner, most = team, cost
+		}
+	}
+	return owner
+}
+
+// Alerts builds one notification per namespace for its owner, listing up to
+// top of its most expensive unlabeled workloads
+func (r *Report) Alerts(top int) []*models.CostAlert {
+	var alerts []*models.CostAlert
+	for _, ns := range r.Namespaces {
+		var lines []string
+		for _, w := range r.Workloads {
+			if w.Namespace != ns.Namespace {
+				continue
+			}
+			if len(lines) == top {
+				lines = append(lines, "...")
+				break
+			}
+			lines = append(lines, fmt.Sprintf("- %s ($%.2f/hr) is missing %s", w.Name, w.CostPerHr, strings.Join(w.Missing, ", ")))
+		}
+		alerts = append(alerts, &models.CostAlert{
+			Team:      ns.Owner,
+			Service:   "namespace/" + ns.Namespace,
+			Kind:      models.AlertCompliance,
+			CostPerHr: ns.CostPerHr,
+			Severity:  "warning",
+			Message: fmt.Sprintf("%d workloads can't be charged back without labels %s:\n%s",
+				ns.Workloads, strings.Join(r.Labels, ", "), strings.Join(lines, "\n")),
+		})
+	}
+	return alerts
+}
@@ -0,0 +1,84 @@
+package compliance
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// WebhookServer serves the label webhook over TLS, as the API server requires.
+// The certificate is re-read when its file changes, so cert-manager renewals
+// apply without a restart.
+type WebhookServer struct {
+	Addr     string
+	CertFile string
+	KeyFile  string
+
+	webhook *Webhook
+	server  *http.Server
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	certTime time.Time
+}
+
+// NewWebhookServer creates a TLS server for the webhook
+func NewWebhookServer(addr string, certFile string, keyFile string, webhook *Webhook) *WebhookServer {
+	return &WebhookServer{Addr: addr, CertFile: certFile, KeyFile: keyFile, webhook: webhook}
+}
+
+// Start loads the certificate, listens on Addr and serves in the background
+func (s *WebhookServer) Start() error {
+	if _, err := s.certificate(nil); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("POST /mutate/pods", s.webhook)
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         &tls.Config{GetCertificate: s.certificate, MinVersion: tls.VersionTLS12},
+	}
+	go s.server.ServeTLS(listener, "", "")
+	return nil
+}
+
+// Stop shuts the server down
+func (s *WebhookServer) Stop() {
+	if s.server != nil {
+		s.server.Close()
+	}
+}
+
+// certificate returns the key pair, reloading it when the certificate file changed
+func (s *WebhookServer) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.CertFile)
+	if err != nil {
+		if s.cert != nil {
+			return s.cert, nil
+		}
+		return nil, err
+	}
+	if s.cert != nil && info.ModTime().Equal(s.certTime) {
+		return s.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+	if err != nil {
+		if s.cert != nil {
+			return s.cert, nil // Mid-rotation; keep serving the old pair
+		}
+		return nil, err
+	}
+	s.cert, s.certTime = &cert, info.ModTime()
+	return s.cert, nil
+}
@@ -0,0 +1,183 @@
+package compliance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"cost-detector/pkg/kube"
+)
+
+// CopiedAnnotation lists the labels the webhook copied onto a pod from its namespace
+const CopiedAnnotation = "cost-detector.io/labels-from-namespace"
+
+// NamespaceCache reads namespace labels from the API, caching them briefly
+// so admission requests don't each cost an API call
+type NamespaceCache struct {
+	TTL time.Duration
+
+	client  *kube.Client
+	mu      sync.Mutex
+	entries map[string]cachedNamespace
+}
+
+// cachedNamespace is a namespace's labels and when they were read
+type cachedNamespace struct {
+	labels map[string]string
+	read   time.Time
+}
+
+// NewNamespaceCache creates a cache reading through client
+func NewNamespaceCache(client *kube.Client, ttl time.Duration) *NamespaceCache {
+	return &NamespaceCache{TTL: ttl, client: client, entries: make(map[string]cachedNamespace)}
+}
+
+// Labels returns a namespace's labels
+func (c *NamespaceCache) Labels(ctx context.Context, name string) (map[string]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && time.Since(entry.read) < c.TTL {
+		return entry.labels, nil
+	}
+
+	var ns kube.Namespace
+	if err := c.client.Get(ctx, kube.NamespacePath(name), &ns); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[name] = cachedNamespace{labels: ns.Metadata.Labels, read: time.Now()}
+	c.mu.Unlock()
+	return ns.Metadata.Labels, nil
+}
+
+// AdmissionReview is the admission.k8s.io/v1 request and response envelope
+type AdmissionReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    *AdmissionRequest  `json:"request,omitempty"`
+	Response   *AdmissionResponse `json:"response,omitempty"`
+}
+
+// AdmissionRequest is the object being admitted
+type AdmissionRequest struct {
+	UID       string          `json:"uid"`
+	Namespace string          `json:"namespace"`
+	Operation string          `json:"operation"`
+	Object    json.RawMessage `json:"object"`
+}
+
+// AdmissionResponse allows the object, optionally with a JSON patch
+type AdmissionResponse struct {
+	UID       string   `json:"uid"`
+	Allowed   bool     `json:"allowed"`
+	PatchType string   `json:"patchType,omitempty"`
+	Patch     []byte   `json:"patch,omitempty"` // Base64-encoded by encoding/json
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// patchOp is one JSON patch operation
+type patchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// Webhook is a mutating admission webhook that copies required labels from
+// a namespace onto new pods that don't set them. It never rejects a pod.
+type Webhook struct {
+	Labels     []string
+	Namespaces *NamespaceCache
+}
+
+// NewWebhook creates a webhook copying labels from namespaces
+func NewWebhook(namespaces *NamespaceCache, labels []string) *Webhook {
+	return &Webhook{Labels: labels, Namespaces: namespaces}
+}
+
+// ServeHTTP handles POST /mutate/pods
+func (h *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var review AdmissionReview
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<20)).Decode(&review); err != nil || review.Request == nil {
+		http.Error(w, "expected an AdmissionReview", http.StatusBadRequest)
+		return
+	}
+	review.Response = h.Mutate(r.Context(), review.Request)
+	review.Request = nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+// Mutate builds the response for one admission request
+func (h *Webhook) Mutate(ctx context.Context, req *AdmissionRequest) *AdmissionResponse {
+	response := &AdmissionResponse{UID: req.UID, Allowed: true}
+
+	var pod kube.Pod
+	if err := json.Unmarshal(req.Object, &pod); err != nil {
+		response.Warnings = append(response.Warnings, fmt.Sprintf("cost-detector: can't read pod: %v", err))
+		return response
+	}
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = pod.Metadata.Namespace
+	}
+	nsLabels, err := h.Namespaces.Labels(ctx, namespace)
+	if err != nil {
+		response.Warnings = append(response.Warnings, fmt.Sprintf("cost-detector: can't read namespace %s labels: %v", namespace, err))
+		return response
+	}
+
+	copied := make(map[string]string)
+	var names, missing []string
+	for _, label := range h.Labels {
+		if pod.Metadata.Labels[label] != "" {
+			continue
+		}
+		if value := nsLabels[label]; value != "" {
+			copied[label] = value
+			names = append(names, label)
+		} else {
+			missing = append(missing, label)
+		}
+	}
+	if len(missing) > 0 {
+		response.Warnings = append(response.Warnings, fmt.Sprintf(
+			"pod has no %s label and namespace %s doesn't set one to copy; its cost can't be charged back",
+			strings.Join(missing, ", "), namespace))
+	}
+	if len(copied) == 0 {
+		return response
+	}
+
+	var ops []patchOp
+	if pod.Metadata.Labels == nil {
+		ops = append(ops, patchOp{Op: "add", Path: "/metadata/labels", Value: copied})
+	} else {
+		for _, label := range names {
+			ops = append(ops, patchOp{Op: "add", Path: "/metadata/labels/" + escapePointer(label), Value: copied[label]})
+		}
+	}
+	annotation := strings.Join(names, ",")
+	if pod.Metadata.Annotations == nil {
+		ops = append(ops, patchOp{Op: "add", Path: "/metadata/annotations", Value: map[string]string{CopiedAnnotation: annotation}})
+	} else {
+		ops = append(ops, patchOp{Op: "add", Path: "/metadata/annotations/" + escapePointer(CopiedAnnotation), Value: annotation})
+	}
+
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return response
+	}
+	response.PatchType = "JSONPatch"
+	response.Patch = patch
+	return response
+}
+
+// escapePointer escapes a map key for a JSON pointer (RFC 6901)
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
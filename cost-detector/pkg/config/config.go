@@ -1,22 +1,233 @@
 package config
 
-import "os"
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"cost-detector/pkg/carbon"
+	"cost-detector/pkg/network"
+	"cost-detector/pkg/pricing"
+)
 
 // Config holds all configuration for the app
 type Config struct {
 	TeamsWebhookURL string
 	ClusterName     string
 	CostThreshold   float64 // Alert threshold in dollars per hour
-	LogLevel        string
+	LogLevel        string  // debug, info, warning or error
+	LogFormat       string  // text or json
+
+	// Lifecycle
+	ShutdownTimeout       int    // Seconds to drain alerts and the ledger after SIGTERM
+	LeaderElection        bool   // Only the replica holding the Lease sends alerts
+	LeaderElectionLease   string // Lease name
+	LeaderElectionNS      string // Lease namespace
+	LeaderElectionID      string // This replica's identity, the pod name by default
+	LeaderElectionSeconds int    // Lease duration; it is renewed every third of it
+
+	// Budgets and alert routing
+	BudgetsFile           string // budgets.yaml with per-namespace and per-team budgets, empty for CostThreshold only
+	BudgetsReloadInterval int    // Seconds between checks of BudgetsFile for changes
+	BudgetCheckInterval   int    // Seconds between checks of namespace and team spend against budgets
+	CostPoliciesEnabled   bool   // Load CostPolicy resources as guardrails (needs the CRD installed)
+	CostPolicyInterval    int    // Seconds between CostPolicy reconciles
+
+	// Notification scheduling, for the default channel and routes that don't set their own
+	DigestWindow   int      // Seconds alerts are collected into one digest per channel, 0 to send each
+	QuietHours     string   // Window non-critical alerts are held through, e.g. "22:00-07:00"
+	NotifyTimezone string   // Time zone of QuietHours and SummaryTime, e.g. "Europe/Berlin"
+	Summaries      []string // Summary digests for the default channel: daily, weekly
+	SummaryTime    string   // Time of day summaries are sent; weekly ones on Mondays
+
+	// Alert delivery
+	OutboxDir         string // Directory alerts are kept in until delivered, empty to keep them in memory
+	OutboxMaxAttempts int    // Failed deliveries before an alert is moved to the dead-letter queue
+	OutboxBackoff     int    // Seconds before the first retry; it doubles with each failure
+
+	// Acknowledge and snooze links on alert cards
+	AlertActionsURL    string   // Where people reach the cost API, e.g. "https://cost.example.com", empty to disable
+	AlertActionsSecret string   // Key the links are signed with
+	AcksFile           string   // JSONL file acks are kept in across restarts, empty to keep them in memory
+	TrustedProxies     []string // Authenticating proxies whose identity headers are believed, as CIDRs or IPs
+
+	// Cost API
+	APIAddr string // Listen address for the cost API, e.g. ":8080"
+
+	// Label compliance
+	ComplianceLabels     []string // Pod labels chargeback needs, e.g. team and cost-center
+	ComplianceNotify     bool     // Notify namespace owners about unlabeled workloads
+	ComplianceInterval   int      // Seconds between compliance notifications
+	LabelWebhookEnabled  bool     // Serve the mutating webhook copying namespace labels onto pods
+	LabelWebhookAddr     string   // TLS listen address for the webhook
+	LabelWebhookCertFile string   // Serving certificate, e.g. from cert-manager
+	LabelWebhookKeyFile  string   // Serving certificate key
+
+	// Batch jobs
+	BatchAnomalyFactor  float64 // A CronJob run costing this many times its median alerts
+	BatchMinHistory     int     // Runs of a CronJob needed before its runs are compared
+	BatchHistory        int     // Runs kept per CronJob
+	CronJobSyncInterval int     // Seconds between reads of CronJob schedules from the API
+
+	// Autoscaling
+	HPASyncInterval int // Seconds between reads of HPAs from the API
+	HPAHistory      int // Finished scale events kept
+
+	// Event recording
+	RecordFile string // File to record pod and node events to for "cost-detector replay", empty to disable
+
+	// Cost ledger
+	LedgerDir           string // Directory for cost snapshots, empty to keep them in memory only
+	LedgerInterval      int    // Seconds between snapshots
+	LedgerRetentionDays int    // Days of snapshots kept
+
+	// Preview environments
+	PreviewEnabled     bool    // Track namespaces labeled cost-detector.io/ephemeral=true
+	PreviewInterval    int     // Seconds between preview checks
+	PreviewCostCap     float64 // Default dollar cap per preview environment
+	PreviewMaxAgeHours int     // Default maximum age of a preview environment
+	PreviewGrace       int     // Seconds between warning the owner and tearing down
+	PreviewTeardown    bool    // Delete previews over their limits; false only warns
+
+	// Ownership
+	BackstageCatalogDir     string // Directory or Git checkout of catalog-info.yaml files, empty to disable
+	BackstageReloadInterval int    // Seconds between catalog reloads
+
+	// Annotation write-back
+	WritebackEnabled     bool    // Patch hourly cost onto pods and namespaces
+	WritebackInterval    int     // Seconds between write-back passes
+	WritebackMinInterval int     // Minimum seconds between patches of the same object
+	WritebackQPS         float64 // Maximum patches per second
+
+	// Pricing
+	FargateVCPUPrice    float64           // Fargate price per vCPU per hour
+	FargateGBPrice      float64           // Fargate price per GB per hour
+	SavingsPlanDiscount float64           // Savings Plan discount off on-demand, e.g. 0.28
+	SavingsPlanCoverage float64           // Share of on-demand usage the Savings Plan covers, 0 to 1
+	SidecarContainers   map[string]string // Extra sidecar container names mapped to their kind
+	IndexLabels         []string          // Pod label keys to keep cost totals for
+	RepriceInterval     int               // Seconds between re-pricing every pod (node and price changes)
+
+	// Carbon
+	CarbonEnabled          bool               // Estimate energy and CO2e next to cost
+	CarbonRegion           string             // Region of nodes without a region label or zone
+	CarbonPUE              float64            // Data center power usage effectiveness
+	CarbonUtilization      float64            // Average CPU utilization, 0 to 1
+	CarbonIntensity        map[string]float64 // gCO2e per kWh by region, on top of the built-in table
+	CarbonCoefficientsFile string             // JSON of extra instance type watts, empty for the bundled ones
+
+	// Data transfer
+	FlowLogsDir         string  // Directory of VPC flow log files to ingest, empty to disable
+	FlowLogsInterval    int     // Seconds between scans of FlowLogsDir
+	FlowLogsToken       string  // Bearer token for POST /api/v1/network/flowlogs, empty to disable it
+	InternetEgressPrice float64 // Price per GB sent to the internet
+	CrossAZPrice        float64 // Price per GB between availability zones, per direction
+
+	// Reconciliation with the AWS Cost and Usage Report
+	CURPath        string  // CUR report file (CSV or Parquet) or export directory, empty to disable
+	CURInterval    int     // Seconds between imports of CURPath
+	CURCalibration string  // "factor", "catalog" or "off"
+	CURMinHours    float64 // Billed hours needed before calibrating a price
+
+	// Unit economics
+	PrometheusURL      string  // Prometheus-compatible API, e.g. "http://prometheus-server.monitoring"
+	PrometheusToken    string  // Bearer token for PrometheusURL, if it needs one
+	UnitMetricsFile    string  // JSON list of per-service throughput metrics, empty to disable
+	UnitCostInterval   int     // Seconds between unit cost samples
+	UnitCostWindow     int     // Seconds before and after a deploy to compare
+	UnitCostRegression float64 // Rise in cost per unit after a deploy that alerts, e.g. 0.25 for 25%
 }
 
 // LoadConfig loads config from environment variables
 func LoadConfig() *Config {
 	return &Config{
-		TeamsWebhookURL: os.Getenv("TEAMS_WEBHOOK_URL"),
-		ClusterName:     os.Getenv("CLUSTER_NAME"),
-		CostThreshold:   50.0, // Default: alert if >$50/hr
-		LogLevel:        getEnv("LOG_LEVEL", "info"),
+		TeamsWebhookURL:         os.Getenv("TEAMS_WEBHOOK_URL"),
+		ClusterName:             os.Getenv("CLUSTER_NAME"),
+		CostThreshold:           getEnvFloat("COST_THRESHOLD", 50.0), // Default: alert if >$50/hr
+		BudgetsFile:             os.Getenv("BUDGETS_FILE"),
+		BudgetsReloadInterval:   getEnvSeconds("BUDGETS_RELOAD_INTERVAL", 15),
+		BudgetCheckInterval:     getEnvSeconds("BUDGET_CHECK_INTERVAL", 60),
+		CostPoliciesEnabled:     getEnvBool("COST_POLICIES_ENABLED", false),
+		CostPolicyInterval:      getEnvSeconds("COST_POLICY_INTERVAL", 60),
+		DigestWindow:            getEnvInt("DIGEST_WINDOW", 60),
+		QuietHours:              os.Getenv("QUIET_HOURS"),
+		NotifyTimezone:          getEnv("NOTIFY_TIMEZONE", "UTC"),
+		Summaries:               getEnvList("SUMMARIES", ""),
+		SummaryTime:             getEnv("SUMMARY_TIME", "09:00"),
+		OutboxDir:               os.Getenv("OUTBOX_DIR"),
+		OutboxMaxAttempts:       getEnvInt("OUTBOX_MAX_ATTEMPTS", 10),
+		OutboxBackoff:           getEnvSeconds("OUTBOX_BACKOFF", 10),
+		AlertActionsURL:         os.Getenv("ALERT_ACTIONS_URL"),
+		AlertActionsSecret:      os.Getenv("ALERT_ACTIONS_SECRET"),
+		AcksFile:                getEnv("ACKS_FILE", inDir(os.Getenv("OUTBOX_DIR"), "acks.jsonl")),
+		TrustedProxies:          getEnvList("TRUSTED_PROXIES", ""), // e.g. "10.0.0.0/8,127.0.0.1"
+		LogLevel:                getEnv("LOG_LEVEL", "info"),
+		LogFormat:               getEnv("LOG_FORMAT", "text"),
+		ShutdownTimeout:         getEnvSeconds("SHUTDOWN_TIMEOUT", 25),
+		LeaderElection:          getEnvBool("LEADER_ELECTION", false),
+		LeaderElectionLease:     getEnv("LEADER_ELECTION_LEASE", "cost-detector"),
+		LeaderElectionNS:        getEnv("LEADER_ELECTION_NAMESPACE", getEnv("POD_NAMESPACE", "cost-detector")),
+		LeaderElectionID:        getEnv("LEADER_ELECTION_ID", getEnv("POD_NAME", hostname())),
+		LeaderElectionSeconds:   getEnvSeconds("LEADER_ELECTION_LEASE_SECONDS", 15),
+		APIAddr:                 getEnv("COST_API_ADDR", ":8080"),
+		ComplianceLabels:        getEnvList("COMPLIANCE_LABELS", "team,cost-center"),
+		ComplianceNotify:        getEnvBool("COMPLIANCE_NOTIFY", false),
+		ComplianceInterval:      getEnvSeconds("COMPLIANCE_INTERVAL", 86400),
+		LabelWebhookEnabled:     getEnvBool("LABEL_WEBHOOK_ENABLED", false),
+		LabelWebhookAddr:        getEnv("LABEL_WEBHOOK_ADDR", ":8443"),
+		LabelWebhookCertFile:    getEnv("LABEL_WEBHOOK_CERT_FILE", "/etc/webhook/certs/tls.crt"),
+		LabelWebhookKeyFile:     getEnv("LABEL_WEBHOOK_KEY_FILE", "/etc/webhook/certs/tls.key"),
+		BatchAnomalyFactor:      getEnvFloat("BATCH_ANOMALY_FACTOR", 3),
+		BatchMinHistory:         getEnvInt("BATCH_MIN_HISTORY", 5),
+		BatchHistory:            getEnvInt("BATCH_HISTORY", 100),
+		CronJobSyncInterval:     getEnvSeconds("CRONJOB_SYNC_INTERVAL", 300),
+		HPASyncInterval:         getEnvSeconds("HPA_SYNC_INTERVAL", 60),
+		HPAHistory:              getEnvInt("HPA_HISTORY", 200),
+		LedgerDir:               os.Getenv("LEDGER_DIR"),
+		RecordFile:              os.Getenv("RECORD_FILE"),
+		LedgerInterval:          getEnvSeconds("LEDGER_INTERVAL", 300),
+		LedgerRetentionDays:     getEnvInt("LEDGER_RETENTION_DAYS", 30),
+		PreviewEnabled:          getEnvBool("PREVIEW_ENABLED", false),
+		PreviewInterval:         getEnvSeconds("PREVIEW_INTERVAL", 60),
+		PreviewCostCap:          getEnvFloat("PREVIEW_COST_CAP", 25),
+		PreviewMaxAgeHours:      getEnvInt("PREVIEW_MAX_AGE_HOURS", 72),
+		PreviewGrace:            getEnvSeconds("PREVIEW_GRACE", 3600),
+		PreviewTeardown:         getEnvBool("PREVIEW_TEARDOWN", true),
+		BackstageCatalogDir:     os.Getenv("BACKSTAGE_CATALOG_DIR"),
+		BackstageReloadInterval: getEnvSeconds("BACKSTAGE_RELOAD_INTERVAL", 300),
+		WritebackEnabled:        getEnvBool("WRITEBACK_ENABLED", false),
+		WritebackInterval:       getEnvSeconds("WRITEBACK_INTERVAL", 60),
+		WritebackMinInterval:    getEnvSeconds("WRITEBACK_MIN_INTERVAL", 300),
+		WritebackQPS:            getEnvFloat("WRITEBACK_QPS", 5),
+		FargateVCPUPrice:        getEnvFloat("FARGATE_VCPU_PRICE", pricing.DefaultFargateVCPUPrice),
+		FargateGBPrice:          getEnvFloat("FARGATE_GB_PRICE", pricing.DefaultFargateGBPrice),
+		SavingsPlanDiscount:     getEnvFloat("SAVINGS_PLAN_DISCOUNT", 0),
+		SavingsPlanCoverage:     getEnvFloat("SAVINGS_PLAN_COVERAGE", 0),
+		SidecarContainers:       getEnvMap("SIDECAR_CONTAINERS"), // e.g. "envoy-sidecar=envoy,log-shipper"
+		IndexLabels:             getEnvList("COST_INDEX_LABELS", "environment"),
+		RepriceInterval:         getEnvSeconds("REPRICE_INTERVAL", 300),
+		CarbonEnabled:           getEnvBool("CARBON_ENABLED", true),
+		CarbonRegion:            getEnv("CARBON_REGION", getEnv("AWS_REGION", "us-east-1")),
+		CarbonPUE:               getEnvFloat("CARBON_PUE", carbon.DefaultPUE),
+		CarbonUtilization:       getEnvFloat("CARBON_UTILIZATION", carbon.DefaultUtilization),
+		CarbonIntensity:         getEnvFloatMap("CARBON_INTENSITY"), // e.g. "eu-west-1=250,us-east-1=350"
+		CarbonCoefficientsFile:  os.Getenv("CARBON_COEFFICIENTS_FILE"),
+		FlowLogsDir:             os.Getenv("FLOW_LOGS_DIR"),
+		FlowLogsInterval:        getEnvSeconds("FLOW_LOGS_INTERVAL", 60),
+		FlowLogsToken:           os.Getenv("FLOW_LOGS_TOKEN"),
+		InternetEgressPrice:     getEnvFloat("INTERNET_EGRESS_PRICE_PER_GB", network.DefaultInternetEgressPerGB),
+		CrossAZPrice:            getEnvFloat("CROSS_AZ_PRICE_PER_GB", network.DefaultCrossAZPerGB),
+		CURPath:                 os.Getenv("CUR_PATH"),
+		CURInterval:             getEnvSeconds("CUR_INTERVAL", 21600),
+		CURCalibration:          getEnv("CUR_CALIBRATION", "factor"),
+		CURMinHours:             getEnvFloat("CUR_MIN_HOURS", 24),
+		PrometheusURL:           os.Getenv("PROMETHEUS_URL"),
+		PrometheusToken:         os.Getenv("PROMETHEUS_TOKEN"),
+		UnitMetricsFile:         os.Getenv("UNIT_METRICS_FILE"),
+		UnitCostInterval:        getEnvSeconds("UNIT_COST_INTERVAL", 60),
+		UnitCostWindow:          getEnvSeconds("UNIT_COST_WINDOW", 900),
+		UnitCostRegression:      getEnvFloat("UNIT_COST_REGRESSION", 0.25),
 	}
 }
 
@@ -27,3 +238,93 @@ func getEnv(key string, defaultVal string) string {
 	}
 	return defaultVal
 }
+
+// hostname returns the host name, which is the pod name in Kubernetes
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+// getEnvBool gets a boolean env var with a default
+func getEnvBool(key string, defaultVal bool) bool {
+	b, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultVal
+	}
+	return b
+}
+
+// getEnvSeconds gets an interval or timeout in seconds with a default. Zero
+// and negative values would panic tickers, so they get the default too.
+func getEnvSeconds(key string, defaultVal int) int {
+	if i := getEnvInt(key, defaultVal); i > 0 {
+		return i
+	}
+	return defaultVal
+}
+
+// getEnvInt gets an integer env var with a default
+func getEnvInt(key string, defaultVal int) int {
+	i, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultVal
+	}
+	return i
+}
+
+// getEnvFloat gets a float env var with a default
+func getEnvFloat(key string, defaultVal float64) float64 {
+	f, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return defaultVal
+	}
+	return f
+}
+
+// inDir joins a file name onto a directory, or returns "" without a directory
+func inDir(dir string, name string) string {
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
+
+// getEnvList reads a comma-separated list, with a default
+func getEnvList(key string, defaultVal string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, defaultVal), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvFloatMap reads a comma-separated list of "key=number" entries,
+// skipping entries that aren't numbers
+func getEnvFloatMap(key string) map[string]float64 {
+	result := make(map[string]float64)
+	for k, v := range getEnvMap(key) {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			result[k] = f
+		}
+	}
+	return result
+}
+
+// getEnvMap reads a comma-separated list of "key=value" or "key" entries;
+// a bare key maps to itself
+func getEnvMap(key string) map[string]string {
+	result := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		k, v, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if k == "" {
+			continue
+		}
+		if !found || v == "" {
+			v = k
+		}
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,245 @@
+package costpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"cost-detector/pkg/alerts"
+	"cost-detector/pkg/index"
+	"cost-detector/pkg/kube"
+	"cost-detector/pkg/models"
+)
+
+// Reconciler loads CostPolicy resources into the alerter as guardrails and
+// reports each policy's spend against its budget in its status
+type Reconciler struct {
+	client  *kube.Client
+	alerter *alerts.Alerter
+	index   *index.Index
+}
+
+// NewReconciler creates a reconciler
+func NewReconciler(client *kube.Client, alerter *alerts.Alerter, idx *index.Index) *Reconciler {
+	return &Reconciler{client: client, alerter: alerter, index: idx}
+}
+
+// Reconcile lists every CostPolicy, loads the valid ones into the alerter,
+// updates their status and labels namespaces for LabelNamespaces policies.
+// It returns how many policies were loaded.
+func (r *Reconciler) Reconcile(ctx context.Context) (int, error) {
+	var list List
+	if err := r.client.Get(ctx, ListPath, &list); err != nil {
+		return 0, fmt.Errorf("listing CostPolicies: %w", err)
+	}
+	var namespaces kube.NamespaceList
+	if err := r.client.Get(ctx, kube.NamespacesPath, &namespaces); err != nil {
+		return 0, fmt.Errorf("listing namespaces: %w", err)
+	}
+
+	policy := r.alerter.Policy()
+	now := time.Now().UTC().Format(time.RFC3339)
+	var guardrails []alerts.Guardrail
+	var errs []error
+	overBudget := make(map[string]bool) // Namespaces that should carry OverBudgetLabel
+
+	for i := range list.Items {
+		cp := &list.Items[i]
+		status := Status{ObservedGeneration: cp.Metadata.Generation, Conditions: append([]kube.Condition(nil), cp.Status.Conditions...)}
+		condition := func(conditionType string, ok bool, reason string, message string) {
+			value := "False"
+			if ok {
+				value = "True"
+			}
+			status.Conditions = kube.SetCondition(status.Conditions, kube.Condition{
+				Type: conditionType, Status: value, ObservedGeneration: cp.Metadata.Generation,
+				LastTransitionTime: now, Reason: reason, Message: message,
+			})
+		}
+
+		guardrail, err := r.guardrail(ctx, cp, namespaces.Items, policy)
+		if err != nil {
+			condition(ConditionReady, false, "InvalidSpec", err.Error())
+			condition(ConditionOverBudget, false, "InvalidSpec", "Not evaluated")
+		} else {
+			condition(ConditionReady, true, "Loaded", "Loaded into the alerter")
+			cost := Spend(r.index, guardrail.Namespaces)
+			status.Namespaces = guardrail.Namespaces
+			status.CostPerHr = roundCents(cost)
+			status.ProjectedMonthly = roundCents(cost * models.HoursPerMonth)
+
+			alert := policy.Evaluate(guardrail.Budget, guardrail.Name, cost)
+			switch {
+			case alert != nil:
+				condition(ConditionOverBudget, true, "OverBudget", fmt.Sprintf("%s (%s)", alert.Message, alert.Severity))
+			case len(guardrail.Namespaces) == 0:
+				condition(ConditionOverBudget, false, "NoNamespaces", "The namespace selector matches no namespaces")
+			default:
+				condition(ConditionOverBudget, false, "WithinBudget", withinBudget(guardrail.Budget, cost))
+			}
+
+			if cp.Spec.has(ActionAlert) {
+				guardrails = append(guardrails, guardrail)
+			}
+			if cp.Spec.has(ActionLabelNamespaces) && alert != nil {
+				for _, ns := range guardrail.Namespaces {
+					overBudget[ns] = true
+				}
+			}
+		}
+
+		if !reflect.DeepEqual(status, cp.Status) {
+			patch := map[string]interface{}{"status": status}
+			if err := r.client.MergePatch(ctx, StatusPath(cp.Metadata.Namespace, cp.Metadata.Name), patch); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	r.alerter.SetGuardrails(guardrails)
+
+	// The label is ours, so it comes off every namespace no longer over budget
+	for _, ns := range namespaces.Items {
+		_, labelled := ns.Metadata.Labels[OverBudgetLabel]
+		if overBudget[ns.Metadata.Name] == labelled {
+			continue
+		}
+		var value interface{} // nil removes the label
+		if overBudget[ns.Metadata.Name] {
+			value = "true"
+		}
+		patch := map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": map[string]interface{}{OverBudgetLabel: value}},
+		}
+		if err := r.client.MergePatch(ctx, kube.NamespacePath(ns.Metadata.Name), patch); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(guardrails), errors.Join(errs...)
+}
+
+// guardrail validates a policy and resolves its namespaces and notification targets
+func (r *Reconciler) guardrail(ctx context.Context, cp *CostPolicy, namespaces []kube.Namespace, policy *alerts.Policy) (alerts.Guardrail, error) {
+	spec := cp.Spec
+	guardrail := alerts.Guardrail{
+		Name: fmt.Sprintf("costpolicy/%s/%s", cp.Metadata.Namespace, cp.Metadata.Name),
+		Budget: alerts.Budget{
+			ThresholdPerHour: spec.ThresholdPerHour,
+			MonthlyBudget:    spec.MonthlyBudget,
+			Severities:       spec.Severities,
+		},
+	}
+	if err := policy.ValidateBudget(guardrail.Budget); err != nil {
+		return guardrail, err
+	}
+	for _, action := range spec.Actions {
+		if action != ActionAlert && action != ActionLabelNamespaces {
+			return guardrail, fmt.Errorf("spec.actions: unknown action %q, want %s or %s", action, ActionAlert, ActionLabelNamespaces)
+		}
+	}
+
+	if spec.NamespaceSelector == nil {
+		guardrail.Namespaces = []string{cp.Metadata.Namespace}
+	} else {
+		if err := spec.NamespaceSelector.Validate(); err != nil {
+			return guardrail, fmt.Errorf("spec.namespaceSelector: %w", err)
+		}
+		// Anyone who can edit a namespace can write its policies, so a
+		// selector only reaches namespaces of the same team
+		team := namespaceTeam(namespaces, cp.Metadata.Namespace)
+		for _, ns := range namespaces {
+			sameTeam := ns.Metadata.Name == cp.Metadata.Namespace || (team != "" && ns.Metadata.Labels[models.TeamLabel] == team)
+			if sameTeam && spec.NamespaceSelector.Matches(ns.Metadata.Labels) {
+				guardrail.Namespaces = append(guardrail.Namespaces, ns.Metadata.Name)
+			}
+		}
+		sort.Strings(guardrail.Namespaces)
+	}
+
+	for i, target := range spec.Notify {
+		path := fmt.Sprintf("spec.notify[%d]", i)
+		switch {
+		case target.Route != "" && target.TeamsWebhookSecretRef != nil:
+			return guardrail, fmt.Errorf("%s: set route or teamsWebhookSecretRef, not both", path)
+		case target.Route != "":
+			if _, ok := policy.Routes[target.Route]; !ok {
+				return guardrail, fmt.Errorf("%s.route: %q is not a route in budgets.yaml", path, target.Route)
+			}
+			guardrail.Routes = append(guardrail.Routes, target.Route)
+		case target.TeamsWebhookSecretRef != nil:
+			webhook, err := r.secretValue(ctx, cp.Metadata.Namespace, *target.TeamsWebhookSecretRef)
+			if err != nil {
+				return guardrail, fmt.Errorf("%s.teamsWebhookSecretRef: %w", path, err)
+			}
+			guardrail.Webhooks = append(guardrail.Webhooks, webhook)
+		default:
+			return guardrail, fmt.Errorf("%s: needs route or teamsWebhookSecretRef", path)
+		}
+	}
+	return guardrail, nil
+}
+
+// namespaceTeam returns the team label of the named namespace, "" without one
+func namespaceTeam(namespaces []kube.Namespace, name string) string {
+	for _, ns := range namespaces {
+		if ns.Metadata.Name == name {
+			return ns.Metadata.Labels[models.TeamLabel]
+		}
+	}
+	return ""
+}
+
+// secretValue reads one key of a secret in the policy's namespace
+func (r *Reconciler) secretValue(ctx context.Context, namespace string, ref SecretKeyRef) (string, error) {
+	var secret kube.Secret
+	if err := r.client.Get(ctx, kube.SecretPath(namespace, ref.Name), &secret); err != nil {
+		if kube.IsNotFound(err) {
+			return "", fmt.Errorf("secret %s/%s not found", namespace, ref.Name)
+		}
+		return "", err
+	}
+	value := strings.TrimSpace(string(secret.Data[ref.Key]))
+	if value == "" {
+		return "", fmt.Errorf("secret %s/%s has no key %q", namespace, ref.Name, ref.Key)
+	}
+	return value, nil
+}
+
+// Spend is what a set of namespaces costs per hour together
+func Spend(idx *index.Index, namespaces []string) float64 {
+	var total float64
+	for _, ns := range namespaces {
+		total += idx.Total(index.ByNamespace, ns).CostPerHr
+	}
+	return total
+}
+
+// CheckBudgets checks the index's namespace and team totals against their
+// budgets, and every guardrail against its namespaces' spend
+func CheckBudgets(alerter *alerts.Alerter, idx *index.Index, now time.Time) []*models.CostAlert {
+	namespaces, _ := idx.Summaries(index.ByNamespace)
+	teams, _ := idx.Summaries(index.ByTeam)
+	spend := func(namespaces []string) float64 { return Spend(idx, namespaces) }
+	return alerter.CheckBudgets(namespaces, teams, spend, now)
+}
+
+// withinBudget describes spend against the parts of a budget that are set
+func withinBudget(budget alerts.Budget, cost float64) string {
+	var parts []string
+	if budget.ThresholdPerHour > 0 {
+		parts = append(parts, fmt.Sprintf("$%.2f/hr of a $%.2f/hr threshold", cost, budget.ThresholdPerHour))
+	}
+	if budget.MonthlyBudget > 0 {
+		parts = append(parts, fmt.Sprintf("on track for $%.0f of a $%.0f monthly budget", cost*models.HoursPerMonth, budget.MonthlyBudget))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// roundCents rounds a dollar amount for status, so it doesn't change on every pass
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,105 @@
+// Package costpolicy reconciles CostPolicy resources, which let teams set
+// their own cost guardrails with kubectl, into the alerter.
+package costpolicy
+
+import (
+	"fmt"
+
+	"cost-detector/pkg/alerts"
+	"cost-detector/pkg/kube"
+)
+
+// API group and version of the CostPolicy resource (k8s/crds/costpolicy.yaml)
+const (
+	Group      = "cost-detector.io"
+	Version    = "v1alpha1"
+	APIVersion = Group + "/" + Version
+	Kind       = "CostPolicy"
+)
+
+// Actions a CostPolicy can take when its namespaces go over budget
+const (
+	ActionAlert           = "Alert"           // Notify the policy's targets
+	ActionLabelNamespaces = "LabelNamespaces" // Set OverBudgetLabel, e.g. for admission policies to act on
+)
+
+// OverBudgetLabel marks namespaces over a LabelNamespaces policy's budget
+const OverBudgetLabel = "cost-detector.io/over-budget"
+
+// Condition types set on every CostPolicy
+const (
+	ConditionReady      = "Ready"      // The spec is valid and loaded into the alerter
+	ConditionOverBudget = "OverBudget" // The selected namespaces cost more than the budget allows
+)
+
+// CostPolicy is a team's cost guardrail over one or more namespaces
+type CostPolicy struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Metadata   kube.ObjectMeta `json:"metadata"`
+	Spec       Spec            `json:"spec"`
+	Status     Status          `json:"status,omitempty"`
+}
+
+// Spec is the desired guardrail
+type Spec struct {
+	NamespaceSelector *kube.LabelSelector `json:"namespaceSelector,omitempty"` // Default: the policy's own namespace
+	ThresholdPerHour  float64             `json:"thresholdPerHour,omitempty"`
+	MonthlyBudget     float64             `json:"monthlyBudget,omitempty"`
+	Severities        *alerts.Severities  `json:"severities,omitempty"`
+	Actions           []string            `json:"actions,omitempty"` // Default: Alert
+	Notify            []Target            `json:"notify,omitempty"`  // Default: the budgets.yaml default route
+}
+
+// Target is where a policy's alerts go: a budgets.yaml route or a Teams
+// webhook kept in a secret in the policy's namespace
+type Target struct {
+	Route                 string        `json:"route,omitempty"`
+	TeamsWebhookSecretRef *SecretKeyRef `json:"teamsWebhookSecretRef,omitempty"`
+}
+
+// SecretKeyRef selects a key of a secret
+type SecretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// Status reports what the policy covers and its spend
+type Status struct {
+	ObservedGeneration int64            `json:"observedGeneration,omitempty"`
+	Namespaces         []string         `json:"namespaces,omitempty"`
+	CostPerHr          float64          `json:"costPerHr"`
+	ProjectedMonthly   float64          `json:"projectedMonthly"`
+	Conditions         []kube.Condition `json:"conditions,omitempty"`
+}
+
+// List is the response to listing CostPolicies
+type List struct {
+	Items []CostPolicy `json:"items"`
+}
+
+// ListPath is the API path listing CostPolicies in every namespace
+const ListPath = "/apis/" + APIVersion + "/costpolicies"
+
+// StatusPath is the API path of a CostPolicy's status subresource
+func StatusPath(namespace string, name string) string {
+	return fmt.Sprintf("/apis/%s/namespaces/%s/costpolicies/%s/status", APIVersion, namespace, name)
+}
+
+// actions returns the spec's actions, Alert when none are set
+func (s *Spec) actions() []string {
+	if len(s.Actions) == 0 {
+		return []string{ActionAlert}
+	}
+	return s.Actions
+}
+
+// has reports whether the spec asks for an action
+func (s *Spec) has(action string) bool {
+	for _, a := range s.actions() {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package cur
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Line item types that carry usage cost; fees, credits, taxes and the
+// negation of Savings Plan covered usage are skipped
+const (
+	Usage                   = "Usage"
+	DiscountedUsage         = "DiscountedUsage"         // Covered by a Reserved Instance
+	SavingsPlanCoveredUsage = "SavingsPlanCoveredUsage" // Covered by a Savings Plan
+)
+
+// LineItem is one usage line of a Cost and Usage Report
+type LineItem struct {
+	ResourceID   string            // e.g. "i-0abc123" for EC2 instances
+	Type         string            // Usage, DiscountedUsage or SavingsPlanCoveredUsage
+	UsageType    string            // e.g. "USE1-BoxUsage:m5.xlarge" or "SpotUsage:c5.2xlarge"
+	InstanceType string            // e.g. "m5.xlarge"
+	Start        time.Time         // Start of the usage period
+	End          time.Time         // End of the usage period
+	Hours        float64           // Usage amount (hours for instance usage)
+	Cost         float64           // What was actually paid, after RI and Savings Plan discounts
+	Tags         map[string]string // Resource tags, keys as written in the report
+}
+
+// IsInstanceUsage reports whether the line is EC2 instance running time
+func (l *LineItem) IsInstanceUsage() bool {
+	return strings.HasPrefix(l.ResourceID, "i-") &&
+		(strings.Contains(l.UsageType, "BoxUsage") || strings.Contains(l.UsageType, "SpotUsage"))
+}
+
+// IsSpot reports whether the line is spot usage
+func (l *LineItem) IsSpot() bool {
+	return strings.Contains(l.UsageType, "SpotUsage")
+}
+
+// Tag returns a resource tag. Keys are compared ignoring case and
+// punctuation, since legacy reports write "user:team" and CUR 2.0 "user_team".
+func (l *LineItem) Tag(key string) string {
+	want := columnKey(key)
+	for k, v := range l.Tags {
+		if columnKey(k) == want {
+			return v
+		}
+	}
+	return ""
+}
+
+// Columns read from the report, named as normalized by columnKey so legacy
+// ("lineItem/ResourceId") and CUR 2.0 ("line_item_resource_id") headers match
+const (
+	colResourceID      = "lineitemresourceid"
+	colLineItemType    = "lineitemlineitemtype"
+	colUsageType       = "lineitemusagetype"
+	colUsageStart      = "lineitemusagestartdate"
+	colUsageEnd        = "lineitemusageenddate"
+	colUsageAmount     = "lineitemusageamount"
+	colUnblendedCost   = "lineitemunblendedcost"
+	colInstanceType    = "productinstancetype"
+	colSavingsPlanCost = "savingsplansavingsplaneffectivecost"
+	colReservationCost = "reservationeffectivecost"
+	colResourceTags    = "resourcetags"  // CUR 2.0: one column holding a JSON map
+	legacyTagPrefix    = "resourceTags/" // Legacy: one "resourceTags/<key>" column per tag
+)
+
+// Reader reads line items from a Cost and Usage Report CSV file
+type Reader struct {
+	csv     *csv.Reader
+	columns map[string]int
+	tags    map[int]string // Legacy tag columns by index
+	line    int
+}
+
+// NewReader creates a reader and reads the header row
+func NewReader(r io.Reader) (*Reader, error) {
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = -1
+	c.ReuseRecord = true
+	header, err := c.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CUR header: %w", err)
+	}
+
+	reader := &Reader{csv: c, columns: make(map[string]int), tags: make(map[int]string), line: 1}
+	for i, name := range header {
+		if strings.HasPrefix(name, legacyTagPrefix) {
+			reader.tags[i] = strings.TrimPrefix(name, legacyTagPrefix)
+			continue
+		}
+		reader.columns[columnKey(name)] = i
+	}
+	for _, required := range []string{colResourceID, colLineItemType, colUsageType, colUnblendedCost} {
+		if _, ok := reader.columns[required]; !ok {
+			return nil, fmt.Errorf("not a Cost and Usage Report: no %s column", required)
+		}
+	}
+	return reader, nil
+}
+
+// Next returns the next usage line item, or io.EOF when the report ends
+func (r *Reader) Next() (*LineItem, error) {
+	for {
+		row, err := r.csv.Read()
+		if err != nil {
+			return nil, err
+		}
+		r.line++
+
+		get := func(column string) string {
+			if i, ok := r.columns[column]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+		tags := make(map[string]string)
+		for i, key := range r.tags {
+			if i < len(row) && row[i] != "" {
+				tags[key] = row[i]
+			}
+		}
+		item, err := lineItem(get, tags)
+		if err != nil {
+			return nil, fmt.Errorf("CUR line %d: %w", r.line, err)
+		}
+		if item != nil {
+			return item, nil
+		}
+	}
+}
+
+// lineItem builds a line item from a row's columns, read through get, and
+// the tags of its tag columns. It returns nil for line item types that
+// don't carry usage cost.
+func lineItem(get func(column string) string, tags map[string]string) (*LineItem, error) {
+	item := &LineItem{
+		ResourceID:   get(colResourceID),
+		Type:         get(colLineItemType),
+		UsageType:    get(colUsageType),
+		InstanceType: get(colInstanceType),
+		Tags:         tags,
+	}
+
+	var cost string
+	switch item.Type {
+	case Usage:
+		cost = get(colUnblendedCost)
+	case DiscountedUsage:
+		cost = get(colReservationCost)
+	case SavingsPlanCoveredUsage:
+		cost = get(colSavingsPlanCost)
+	default:
+		return nil, nil
+	}
+	var err error
+	if item.Cost, err = parseFloat(cost); err != nil {
+		return nil, fmt.Errorf("cost: %w", err)
+	}
+	if item.Hours, err = parseFloat(get(colUsageAmount)); err != nil {
+		return nil, fmt.Errorf("usage amount: %w", err)
+	}
+	if item.Start, err = parseTime(get(colUsageStart)); err != nil {
+		return nil, fmt.Errorf("usage start: %w", err)
+	}
+	if item.End, err = parseTime(get(colUsageEnd)); err != nil {
+		return nil, fmt.Errorf("usage end: %w", err)
+	}
+	if item.InstanceType == "" {
+		if _, t, ok := strings.Cut(item.UsageType, ":"); ok {
+			item.InstanceType = t
+		}
+	}
+	if raw := get(colResourceTags); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &item.Tags); err != nil {
+			return nil, fmt.Errorf("resource tags: %w", err)
+		}
+	}
+	return item, nil
+}
+
+// ReadFile reads every usage line item from a CSV, gzipped CSV or Parquet report
+func ReadFile(path string) ([]*LineItem, error) {
+	if strings.HasSuffix(path, ".parquet") {
+		return readParquet(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	reader, err := NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var items []*LineItem
+	for {
+		item, err := reader.Next()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return items, fmt.Errorf("%s: %w", path, err)
+		}
+		items = append(items, item)
+	}
+}
+
+// Files lists the report files under path (a file, or a directory searched
+// recursively the way CUR exports are laid out in S3), in name order
+func Files(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if !d.IsDir() && (strings.HasSuffix(name, ".csv") || strings.HasSuffix(name, ".csv.gz") || strings.HasSuffix(name, ".parquet")) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// columnKey normalizes a column or tag name: lowercase letters and digits only
+func columnKey(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func parseFloat(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseTime reads CUR timestamps: "2024-05-01T00:00:00Z" in legacy reports,
+// "2024-05-01 00:00:00.000" in CUR 2.0
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05.000", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown time format %q", s)
+}
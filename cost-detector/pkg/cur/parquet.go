@@ -0,0 +1,242 @@
+package cur
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cost-detector/pkg/parquet"
+)
+
+// parquetTagPrefix starts legacy tag columns in Parquet reports, where
+// "resourceTags/user:team" is written "resource_tags_user_team"
+const parquetTagPrefix = "resource_tags_"
+
+// reportColumns are the flat columns a line item is built from
+var reportColumns = []string{
+	colResourceID, colLineItemType, colUsageType, colUsageStart, colUsageEnd, colUsageAmount,
+	colUnblendedCost, colInstanceType, colSavingsPlanCost, colReservationCost, colResourceTags,
+}
+
+// mapColumn is a map<string,string> column, e.g. CUR 2.0's resource_tags
+// and product, stored as repeated key and value leaves
+type mapColumn struct {
+	key, value *parquet.Column
+}
+
+// readParquet reads every usage line item from a Parquet report. Flat
+// columns are read like CSV columns; map columns are read as tags
+// (resource_tags) or as one column per key (product's instance_type is
+// product_instance_type).
+func readParquet(path string) ([]*LineItem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	file, err := parquet.Open(f, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	wanted := make(map[string]bool)
+	for _, c := range reportColumns {
+		wanted[c] = true
+	}
+	flat := make(map[string]*parquet.Column)
+	tagColumns := make(map[string]*parquet.Column)
+	maps := make(map[string]*mapColumn)
+	for _, c := range file.Columns() {
+		name := c.Path[0]
+		switch {
+		case len(c.Path) == 1 && strings.HasPrefix(name, parquetTagPrefix):
+			tagColumns[strings.TrimPrefix(name, parquetTagPrefix)] = c
+		case len(c.Path) == 1 && wanted[columnKey(name)]:
+			flat[columnKey(name)] = c
+		case len(c.Path) == 3 && c.MaxRepetition == 1 && usesMap(columnKey(name)):
+			m := maps[name]
+			if m == nil {
+				m = &mapColumn{}
+				maps[name] = m
+			}
+			switch c.Path[2] {
+			case "key":
+				m.key = c
+			case "value":
+				m.value = c
+			}
+		}
+	}
+	for _, required := range []string{colResourceID, colLineItemType, colUsageType, colUnblendedCost} {
+		if flat[required] == nil {
+			return nil, fmt.Errorf("%s: not a Cost and Usage Report: no %s column", path, required)
+		}
+	}
+
+	var items []*LineItem
+	row := 0
+	for g := 0; g < file.RowGroups(); g++ {
+		values := make(map[string][]interface{})
+		rows := -1
+		for key, c := range flat {
+			v, err := readFlat(file, g, c, &rows)
+			if err != nil {
+				return items, fmt.Errorf("%s: %w", path, err)
+			}
+			values[key] = v
+		}
+		tags := make([]map[string]string, rows)
+		for i := range tags {
+			tags[i] = make(map[string]string)
+		}
+		for key, c := range tagColumns {
+			v, err := readFlat(file, g, c, &rows)
+			if err != nil {
+				return items, fmt.Errorf("%s: %w", path, err)
+			}
+			for i, value := range v {
+				if s := formatValue(value); s != "" {
+					tags[i][key] = s
+				}
+			}
+		}
+		extra := make([]map[string]string, rows)
+		for name, m := range maps {
+			entries, err := readMap(file, g, name, m, rows)
+			if err != nil {
+				return items, fmt.Errorf("%s: %w", path, err)
+			}
+			for i, entry := range entries {
+				if columnKey(name) == colResourceTags {
+					for k, v := range entry {
+						tags[i][k] = v
+					}
+					continue
+				}
+				for k, v := range entry {
+					if key := columnKey(name + k); wanted[key] {
+						if extra[i] == nil {
+							extra[i] = make(map[string]string)
+						}
+						extra[i][key] = v
+					}
+				}
+			}
+		}
+
+		for i := 0; i < rows; i++ {
+			row++
+			get := func(column string) string {
+				if v, ok := values[column]; ok {
+					return formatValue(v[i])
+				}
+				return extra[i][column]
+			}
+			item, err := lineItem(get, tags[i])
+			if err != nil {
+				return items, fmt.Errorf("%s: row %d: %w", path, row, err)
+			}
+			if item != nil {
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+// usesMap reports whether a map column holds tags or wanted columns
+func usesMap(key string) bool {
+	for _, c := range reportColumns {
+		if key != "" && strings.HasPrefix(c, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// readFlat reads a flat column of a row group, checking it has *rows
+// values (set from the first column read)
+func readFlat(file *parquet.File, group int, c *parquet.Column, rows *int) ([]interface{}, error) {
+	if c.MaxRepetition > 0 {
+		return nil, fmt.Errorf("%s: repeated column where a single value was expected", c.Name())
+	}
+	v, err := file.ReadColumn(group, c)
+	if err != nil {
+		return nil, err
+	}
+	if *rows < 0 {
+		*rows = len(v.Values)
+	}
+	if len(v.Values) != *rows {
+		return nil, fmt.Errorf("%s: %d values in a row group of %d rows", c.Name(), len(v.Values), *rows)
+	}
+	return v.Values, nil
+}
+
+// readMap reads a map column of a row group into a map per row, nil for
+// a null or empty map
+func readMap(file *parquet.File, group int, name string, m *mapColumn, rows int) ([]map[string]string, error) {
+	if m.key == nil || m.value == nil {
+		return nil, fmt.Errorf("%s: map column without keys and values", name)
+	}
+	keys, err := file.ReadColumn(group, m.key)
+	if err != nil {
+		return nil, err
+	}
+	values, err := file.ReadColumn(group, m.value)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys.Values) != len(values.Values) {
+		return nil, fmt.Errorf("%s: %d keys and %d values", name, len(keys.Values), len(values.Values))
+	}
+
+	entries := make([]map[string]string, 0, rows)
+	for i, key := range keys.Values {
+		if keys.Repetition[i] == 0 {
+			if len(entries) == rows {
+				return nil, fmt.Errorf("%s: more than %d rows in the row group", name, rows)
+			}
+			entries = append(entries, nil)
+		} else if len(entries) == 0 {
+			return nil, fmt.Errorf("%s: first entry continues a row", name)
+		}
+		if key == nil {
+			continue
+		}
+		last := len(entries) - 1
+		if entries[last] == nil {
+			entries[last] = make(map[string]string)
+		}
+		entries[last][formatValue(key)] = formatValue(values.Values[i])
+	}
+	if len(entries) != rows {
+		return nil, fmt.Errorf("%s: %d rows in a row group of %d rows", name, len(entries), rows)
+	}
+	return entries, nil
+}
+
+// formatValue writes a Parquet value the way the CSV report writes it
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
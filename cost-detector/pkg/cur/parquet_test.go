@@ -0,0 +1,143 @@
+package cur
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cost-detector/pkg/parquet/parquettest"
+)
+
+// CUR 2.0: flat line item columns, product and resource_tags as maps
+const cur2CSV = `line_item_resource_id,line_item_line_item_type,line_item_usage_type,line_item_usage_start_date,line_item_usage_end_date,line_item_usage_amount,line_item_unblended_cost,reservation_effective_cost,savings_plan_savings_plan_effective_cost,product_instance_type,resource_tags
+i-0abc,Usage,USE1-BoxUsage:m5.xlarge,2024-05-01 00:00:00.000,2024-05-01 01:00:00.000,1,0.192,,,m5.xlarge,"{""user_team"":""payments""}"
+i-0def,SavingsPlanCoveredUsage,USE1-SpotUsage:c5.2xlarge,2024-05-01 00:00:00.000,2024-05-01 01:00:00.000,1,0.34,,0.2125,,
+,Tax,,2024-05-01 00:00:00.000,2024-05-01 01:00:00.000,,12.5,,,,
+i-0ghi,DiscountedUsage,USE1-BoxUsage:r5.large,2024-05-01 01:00:00.000,2024-05-01 01:30:00.000,0.5,0,0.05,,r5.large,"{""user_team"":""search"",""aws_eks_cluster_name"":""prod""}"
+`
+
+func TestReadParquet(t *testing.T) {
+	hour := func(h float64) time.Time {
+		return time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(h * float64(time.Hour)))
+	}
+	cur2 := []parquettest.Column{
+		{Name: "line_item_resource_id", Type: "string", Values: []interface{}{"i-0abc", "i-0def", nil, "i-0ghi"}},
+		{Name: "line_item_line_item_type", Type: "string", Values: []interface{}{"Usage", "SavingsPlanCoveredUsage", "Tax", "DiscountedUsage"}},
+		{Name: "line_item_usage_type", Type: "string", Values: []interface{}{"USE1-BoxUsage:m5.xlarge", "USE1-SpotUsage:c5.2xlarge", nil, "USE1-BoxUsage:r5.large"}},
+		{Name: "line_item_usage_start_date", Type: "timestamp", Values: []interface{}{hour(0), hour(0), hour(0), hour(1)}},
+		{Name: "line_item_usage_end_date", Type: "timestamp", Values: []interface{}{hour(1), hour(1), hour(1), hour(1.5)}},
+		{Name: "line_item_usage_amount", Type: "double", Values: []interface{}{1.0, 1.0, nil, 0.5}},
+		{Name: "line_item_unblended_cost", Type: "decimal", Values: []interface{}{0.192, 0.34, 12.5, 0.0}},
+		{Name: "reservation_effective_cost", Type: "double", Values: []interface{}{nil, nil, nil, 0.05}},
+		{Name: "savings_plan_savings_plan_effective_cost", Type: "double", Values: []interface{}{nil, 0.2125, nil, nil}},
+		{Name: "line_item_operation", Type: "string", Values: []interface{}{"RunInstances", "RunInstances:SV001", nil, "RunInstances"}},
+	}
+	cur2Maps := []parquettest.Map{
+		{Name: "product", Values: []map[string]string{
+			{"instance_type": "m5.xlarge", "region": "us-east-1"}, {}, nil, {"instance_type": "r5.large"},
+		}},
+		{Name: "resource_tags", Values: []map[string]string{
+			{"user_team": "payments"}, nil, nil, {"user_team": "search", "aws_eks_cluster_name": "prod"},
+		}},
+	}
+
+	// Legacy reports exported as Parquet: one column per product field and tag
+	legacyCSV := `identity/LineItemId,lineItem/ResourceId,lineItem/LineItemType,lineItem/UsageType,lineItem/UsageStartDate,lineItem/UsageEndDate,lineItem/UsageAmount,lineItem/UnblendedCost,product/instanceType,resourceTags/user:team
+x,i-0abc,Usage,USE1-BoxUsage:m5.xlarge,2024-05-01T00:00:00Z,2024-05-01T01:00:00Z,1,0.192,m5.xlarge,payments
+x,i-0def,Usage,USE1-SpotUsage:c5.2xlarge,2024-05-01T00:00:00Z,2024-05-01T01:00:00Z,1,0.12,,
+`
+	legacy := []parquettest.Column{
+		{Name: "identity_line_item_id", Type: "string", Values: []interface{}{"x", "x"}},
+		{Name: "line_item_resource_id", Type: "string", Values: []interface{}{"i-0abc", "i-0def"}},
+		{Name: "line_item_line_item_type", Type: "string", Values: []interface{}{"Usage", "Usage"}},
+		{Name: "line_item_usage_type", Type: "string", Values: []interface{}{"USE1-BoxUsage:m5.xlarge", "USE1-SpotUsage:c5.2xlarge"}},
+		{Name: "line_item_usage_start_date", Type: "int96", Values: []interface{}{hour(0), hour(0)}},
+		{Name: "line_item_usage_end_date", Type: "int96", Values: []interface{}{hour(1), hour(1)}},
+		{Name: "line_item_usage_amount", Type: "double", Values: []interface{}{1.0, 1.0}},
+		{Name: "line_item_unblended_cost", Type: "double", Values: []interface{}{0.192, 0.12}},
+		{Name: "product_instance_type", Type: "string", Values: []interface{}{"m5.xlarge", nil}},
+		{Name: "resource_tags_user_team", Type: "string", Values: []interface{}{"payments", nil}},
+	}
+
+	dir := t.TempDir()
+	write := func(name string, columns []parquettest.Column, maps []parquettest.Map, opts parquettest.Options) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := parquettest.Write(f, len(columns[0].Values), columns, maps, opts); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	read := func(path string) []*LineItem {
+		items, err := ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile(%s): %v", filepath.Base(path), err)
+		}
+		return items
+	}
+	writeCSV := func(name string, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	want := read(writeCSV("cur2.csv", cur2CSV))
+	if len(want) != 3 {
+		t.Fatalf("CSV report has %d usage lines, want 3", len(want))
+	}
+	for i, opts := range []parquettest.Options{
+		{Codec: "snappy", Dictionary: true},
+		{Codec: "gzip", PageV2: true, RowGroupRows: 2},
+		{},
+	} {
+		got := read(write(fmt.Sprintf("cur2-%d.snappy.parquet", i), cur2, cur2Maps, opts))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%+v: Parquet report = %s, want %s", opts, describe(got), describe(want))
+		}
+	}
+
+	want = read(writeCSV("legacy.csv", legacyCSV))
+	got := read(write("legacy.parquet", legacy, nil, parquettest.Options{Codec: "snappy"}))
+	if got[0].Tag("user:team") != "payments" {
+		t.Errorf("legacy Parquet user:team tag = %q, want payments", got[0].Tag("user:team"))
+	}
+	for _, items := range [][]*LineItem{got, want} {
+		for _, item := range items {
+			item.Tags = nil // Tag keys differ: "user:team" in CSV, "user_team" in Parquet
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("legacy Parquet report = %s, want %s", describe(got), describe(want))
+	}
+
+	files, err := Files(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 6 {
+		t.Errorf("Files(dir) = %v, want the CSV and Parquet reports", files)
+	}
+
+	notCUR := write("other.parquet", []parquettest.Column{{Name: "id", Type: "string", Values: []interface{}{"a"}}}, nil, parquettest.Options{})
+	if _, err := ReadFile(notCUR); err == nil || !strings.Contains(err.Error(), "not a Cost and Usage Report") {
+		t.Errorf("ReadFile(other.parquet) error = %v, want not a Cost and Usage Report", err)
+	}
+}
+
+func describe(items []*LineItem) string {
+	var lines []string
+	for _, item := range items {
+		lines = append(lines, fmt.Sprintf("%+v", *item))
+	}
+	return strings.Join(lines, "\n")
+}
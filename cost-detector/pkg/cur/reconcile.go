@@ -0,0 +1,294 @@
+package cur
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/pricing"
+)
+
+// Calibration modes
+const (
+	CalibrateOff     = "off"     // Only report drift
+	CalibrateFactor  = "factor"  // Scale every estimate by billed / estimated
+	CalibrateCatalog = "catalog" // Replace catalog prices with the effective prices paid
+)
+
+// ClusterTags are the resource tags EKS, Karpenter and eksctl put the
+// cluster name in, so instances that have since gone away still match
+var ClusterTags = []string{"aws:eks:cluster-name", "eks:cluster-name", "karpenter.sh/discovery", "alpha.eksctl.io/cluster-name"}
+
+// NodeSource provides the cluster's current nodes
+type NodeSource interface {
+	Nodes() []*models.Node
+}
+
+// InstanceDrift compares what one instance, or one instance type, cost on the bill with our estimate
+type InstanceDrift struct {
+	InstanceID     string  `json:"instanceId,omitempty"`
+	Node           string  `json:"node,omitempty"`
+	InstanceType   string  `json:"instanceType"`
+	CapacityType   string  `json:"capacityType"`
+	Hours          float64 `json:"hours"`
+	BilledCost     float64 `json:"billedCost"`
+	EstimatedCost  float64 `json:"estimatedCost"`
+	BilledPrice    float64 `json:"billedPricePerHr"`    // Effective price per hour paid
+	EstimatedPrice float64 `json:"estimatedPricePerHr"` // Price per hour we estimate with
+	DriftPercent   float64 `json:"driftPercent"`        // Positive when we overestimate
+}
+
+// Report is the result of reconciling a Cost and Usage Report with our estimates
+type Report struct {
+	ClusterName      string          `json:"clusterName"`
+	GeneratedAt      time.Time       `json:"generatedAt"`
+	PeriodStart      time.Time       `json:"periodStart"`
+	PeriodEnd        time.Time       `json:"periodEnd"`
+	Files            []string        `json:"files"`
+	Instances        int             `json:"instances"`
+	BilledCost       float64         `json:"billedCost"`
+	EstimatedCost    float64         `json:"estimatedCost"`
+	DriftPercent     float64         `json:"driftPercent"`
+	CorrectionFactor float64         `json:"correctionFactor"` // Billed / estimated, applied in factor mode
+	Calibration      string          `json:"calibration"`
+	Calibrated       []string        `json:"calibrated,omitempty"`   // What calibration changed
+	UnknownTypes     []string        `json:"unknownTypes,omitempty"` // Billed instance types missing from the catalog
+	Errors           []string        `json:"errors,omitempty"`       // Files that couldn't be read
+	ByInstanceType   []InstanceDrift `json:"byInstanceType"`
+	ByInstance       []InstanceDrift `json:"byInstance"`
+}
+
+// Reconciler joins CUR line items to the cluster's nodes, reports how far
+// estimates drift from the bill and calibrates pricing to close the gap
+type Reconciler struct {
+	ClusterName string
+	Calibration string  // CalibrateOff, CalibrateFactor or CalibrateCatalog
+	MinHours    float64 // Billed hours needed before a price is calibrated
+
+	nodes      NodeSource
+	catalog    *pricing.Catalog
+	calculator *calculator.Calculator
+
+	mu   sync.RWMutex
+	last *Report
+}
+
+// NewReconciler creates a reconciler for a cluster
+func NewReconciler(clusterName string, nodes NodeSource, catalog *pricing.Catalog, calc *calculator.Calculator, calibration string) *Reconciler {
+	return &Reconciler{
+		ClusterName: clusterName,
+		Calibration: calibration,
+		MinHours:    24,
+		nodes:       nodes,
+		catalog:     catalog,
+		calculator:  calc,
+	}
+}
+
+// Import reads every report under path, reconciles it and calibrates.
+// Unreadable files are listed in the report rather than failing the import.
+func (r *Reconciler) Import(path string) (*Report, error) {
+	files, err := Files(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*LineItem
+	var read, failed []string
+	for _, file := range files {
+		fileItems, err := ReadFile(file)
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		items = append(items, fileItems...)
+		read = append(read, file)
+	}
+	if len(read) == 0 {
+		if len(failed) > 0 {
+			return nil, fmt.Errorf("no readable Cost and Usage Report under %s: %s", path, failed[0])
+		}
+		return nil, fmt.Errorf("no Cost and Usage Report under %s", path)
+	}
+
+	report := r.Reconcile(items)
+	report.Files = read
+	report.Errors = failed
+	r.Calibrate(report)
+
+	r.mu.Lock()
+	r.last = report
+	r.mu.Unlock()
+	return report, nil
+}
+
+// Last returns the most recent report, or nil before the first import
+func (r *Reconciler) Last() *Report {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.last
+}
+
+// Reconcile compares billed instance usage with what the catalog says the
+// same hours should have cost. Line items join to nodes by instance ID;
+// instances no longer in the cluster join by their cluster name tag.
+func (r *Reconciler) Reconcile(items []*LineItem) *Report {
+	nodeNames := make(map[string]string)
+	for _, node := range r.nodes.Nodes() {
+		if node.InstanceID != "" {
+			nodeNames[node.InstanceID] = node.Name
+		}
+	}
+	factor := 1.0
+	if r.Calibration == CalibrateFactor {
+		factor = r.calculator.CorrectionFactor()
+	}
+
+	report := &Report{ClusterName: r.ClusterName, GeneratedAt: time.Now().UTC(), Calibration: r.Calibration}
+	instances := make(map[string]*InstanceDrift)
+	types := make(map[string]*InstanceDrift)
+	unknown := make(map[string]bool)
+	for _, item := range items {
+		if !item.IsInstanceUsage() {
+			continue
+		}
+		node, inCluster := nodeNames[item.ResourceID]
+		if !inCluster && !r.hasClusterTag(item) {
+			continue
+		}
+
+		capacityType := pricing.OnDemand
+		if item.IsSpot() {
+			capacityType = pricing.Spot
+		}
+		estimated := 0.0
+		if t, ok := r.catalog.Lookup(item.InstanceType); ok {
+			estimated = t.Price(capacityType) * factor * item.Hours
+		} else {
+			unknown[item.InstanceType] = true
+		}
+
+		instance, ok := instances[item.ResourceID]
+		if !ok {
+			instance = &InstanceDrift{InstanceID: item.ResourceID, Node: node, InstanceType: item.InstanceType, CapacityType: capacityType}
+			instances[item.ResourceID] = instance
+		}
+		key := item.InstanceType + "|" + capacityType
+		byType, ok := types[key]
+		if !ok {
+			byType = &InstanceDrift{InstanceType: item.InstanceType, CapacityType: capacityType}
+			types[key] = byType
+		}
+		for _, drift := range []*InstanceDrift{instance, byType} {
+			drift.Hours += item.Hours
+			drift.BilledCost += item.Cost
+			drift.EstimatedCost += estimated
+		}
+
+		if report.PeriodStart.IsZero() || item.Start.Before(report.PeriodStart) {
+			report.PeriodStart = item.Start
+		}
+		if item.End.After(report.PeriodEnd) {
+			report.PeriodEnd = item.End
+		}
+	}
+
+	for _, drift := range instances {
+		if drift.EstimatedCost > 0 {
+			report.BilledCost += drift.BilledCost
+			report.EstimatedCost += drift.EstimatedCost
+		}
+		report.ByInstance = append(report.ByInstance, finish(drift))
+	}
+	for _, drift := range types {
+		report.ByInstanceType = append(report.ByInstanceType, finish(drift))
+	}
+	for t := range unknown {
+		report.UnknownTypes = append(report.UnknownTypes, t)
+	}
+	sort.Strings(report.UnknownTypes)
+	sortDrift(report.ByInstance)
+	sortDrift(report.ByInstanceType)
+
+	report.Instances = len(instances)
+	report.CorrectionFactor = factor
+	if report.BilledCost > 0 && report.EstimatedCost > 0 {
+		report.DriftPercent = (report.EstimatedCost - report.BilledCost) / report.BilledCost * 100
+		report.CorrectionFactor = factor * report.BilledCost / report.EstimatedCost
+	}
+	return report
+}
+
+// Calibrate applies the report to pricing so future estimates track the bill
+func (r *Reconciler) Calibrate(report *Report) {
+	switch r.Calibration {
+	case CalibrateFactor:
+		hours := 0.0
+		for _, drift := range report.ByInstanceType {
+			if drift.EstimatedCost > 0 {
+				hours += drift.Hours
+			}
+		}
+		if hours < r.MinHours || report.EstimatedCost <= 0 {
+			return
+		}
+		r.calculator.SetCorrectionFactor(report.CorrectionFactor)
+		report.Calibrated = append(report.Calibrated, fmt.Sprintf("correction factor %.3f", report.CorrectionFactor))
+
+	case CalibrateCatalog:
+		for _, drift := range report.ByInstanceType {
+			if drift.Hours < r.MinHours || drift.BilledPrice <= 0 {
+				continue
+			}
+			t, ok := r.catalog.Lookup(drift.InstanceType)
+			if !ok {
+				continue
+			}
+			if drift.CapacityType == pricing.Spot {
+				t.Spot = drift.BilledPrice
+			} else {
+				t.OnDemand = drift.BilledPrice
+			}
+			r.catalog.Set(t)
+			report.Calibrated = append(report.Calibrated, fmt.Sprintf("%s %s $%.4f/hr", drift.InstanceType, drift.CapacityType, drift.BilledPrice))
+		}
+	}
+}
+
+// hasClusterTag reports whether a line item is tagged with this cluster's name
+func (r *Reconciler) hasClusterTag(item *LineItem) bool {
+	if r.ClusterName == "" {
+		return false
+	}
+	for _, key := range ClusterTags {
+		if item.Tag(key) == r.ClusterName {
+			return true
+		}
+	}
+	return item.Tag("kubernetes.io/cluster/"+r.ClusterName) != ""
+}
+
+// finish fills in prices and drift from the accumulated totals
+func finish(drift *InstanceDrift) InstanceDrift {
+	if drift.Hours > 0 {
+		drift.BilledPrice = drift.BilledCost / drift.Hours
+		drift.EstimatedPrice = drift.EstimatedCost / drift.Hours
+	}
+	if drift.BilledCost > 0 && drift.EstimatedCost > 0 {
+		drift.DriftPercent = (drift.EstimatedCost - drift.BilledCost) / drift.BilledCost * 100
+	}
+	return *drift
+}
+
+// sortDrift orders by billed cost, most expensive first
+func sortDrift(drifts []InstanceDrift) {
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].BilledCost != drifts[j].BilledCost {
+			return drifts[i].BilledCost > drifts[j].BilledCost
+		}
+		return drifts[i].InstanceID+drifts[i].InstanceType < drifts[j].InstanceID+drifts[j].InstanceType
+	})
+}
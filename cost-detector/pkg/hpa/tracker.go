@@ -0,0 +1,413 @@
+// Package hpa projects what autoscaled workloads cost at their minimum,
+// current and maximum scale, and charges the cost of each scale-up to the
+// HPA scaling event that caused it. Pod costs come from watcher events;
+// HPAs are read from the API periodically.
+package hpa
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/kube"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/watcher"
+)
+
+// Workload is an autoscaled workload's cost at its HPA's bounds
+type Workload struct {
+	Namespace        string    `json:"namespace"`
+	HPA              string    `json:"hpa"`
+	Kind             string    `json:"kind"`
+	Workload         string    `json:"workload"`
+	Team             string    `json:"team"`
+	MinReplicas      int       `json:"minReplicas"`
+	CurrentReplicas  int       `json:"currentReplicas"`
+	DesiredReplicas  int       `json:"desiredReplicas"`
+	MaxReplicas      int       `json:"maxReplicas"`
+	Pods             int       `json:"pods"`       // Pods seen for the workload
+	CostPerPod       float64   `json:"costPerPod"` // Average hourly cost of its pods, the last one seen when it has none
+	MinCostPerHr     float64   `json:"minCostPerHr"`
+	CurrentCostPerHr float64   `json:"currentCostPerHr"`
+	MaxCostPerHr     float64   `json:"maxCostPerHr"`
+	MaxMonthly       float64   `json:"maxMonthly"`  // Max-scale cost over a month
+	ScaleUpCost      float64   `json:"scaleUpCost"` // Cost of the replicas its recorded scale-ups added
+	LastScaleTime    time.Time `json:"lastScaleTime,omitempty"`
+}
+
+// Exposure is a namespace's cost with its HPAs at their minimum, where they
+// are now, and at their maximum. Pods without an HPA count at their current cost.
+type Exposure struct {
+	Namespace        string  `json:"namespace"`
+	Autoscaled       int     `json:"autoscaled"` // Workloads with an HPA
+	MinCostPerHr     float64 `json:"minCostPerHr"`
+	CurrentCostPerHr float64 `json:"currentCostPerHr"`
+	MaxCostPerHr     float64 `json:"maxCostPerHr"`
+	MaxMonthly       float64 `json:"maxMonthly"`
+}
+
+// ScaleEvent is an HPA scale-up and what the replicas it added cost until
+// they were scaled away again. Scale-downs remove the newest replicas first.
+type ScaleEvent struct {
+	Namespace string    `json:"namespace"`
+	HPA       string    `json:"hpa"`
+	Workload  string    `json:"workload"`
+	Team      string    `json:"team"`
+	From      int       `json:"from"`
+	To        int       `json:"to"`
+	Started   time.Time `json:"started"`
+	Ended     time.Time `json:"ended,omitempty"` // Zero while added replicas still run
+	Replicas  int       `json:"replicas"`        // Added replicas still running
+	Cost      float64   `json:"cost"`
+
+	accrued time.Time // Cost counted up to here
+}
+
+// Message describes the event for the log
+func (e ScaleEvent) Message() string {
+	if e.Ended.IsZero() {
+		return fmt.Sprintf("HPA %s/%s scaled %s from %d to %d replicas", e.Namespace, e.HPA, e.Workload, e.From, e.To)
+	}
+	return fmt.Sprintf("Scale-up of %s/%s from %d to %d replicas ended after %s, costing $%.2f", e.Namespace, e.Workload,
+		e.From, e.To, e.Ended.Sub(e.Started).Round(time.Second), e.Cost)
+}
+
+// podCost is what the tracker keeps of a pod
+type podCost struct {
+	namespace, workload, team string
+	costPerHr                 float64
+}
+
+// autoscaler is an HPA and its unfinished scale-ups
+type autoscaler struct {
+	item       kube.HorizontalPodAutoscaler
+	replicas   int
+	costPerPod float64
+	synced     time.Time     // When it was last read
+	open       []*ScaleEvent // Oldest first
+	cost       float64       // Cost of its finished scale-ups still in history
+}
+
+// usage totals a workload's pods
+type usage struct {
+	pods      int
+	costPerHr float64
+	team      string
+}
+
+// Tracker keeps HPAs and the pod costs of the workloads they scale
+type Tracker struct {
+	History int // Finished scale events kept
+
+	calc   *calculator.Calculator
+	now    func() time.Time
+	mu     sync.Mutex
+	pods   map[string]podCost     // By namespace/name
+	hpas   map[string]*autoscaler // By namespace/name
+	events []ScaleEvent           // Finished, oldest first
+}
+
+// NewTracker creates a tracker fed by the watcher's pod events
+func NewTracker(w *watcher.Watcher, calc *calculator.Calculator) *Tracker {
+	t := &Tracker{
+		History: 200,
+		calc:    calc,
+		now:     time.Now,
+		pods:    make(map[string]podCost),
+		hpas:    make(map[string]*autoscaler),
+	}
+	for _, pod := range w.Pods() {
+		t.Handle(watcher.Event{Type: watcher.PodAdded, Pod: pod})
+	}
+	w.OnEvent(t.Handle)
+	return t
+}
+
+// Handle applies a watcher event. Pods that have ended no longer count.
+func (t *Tracker) Handle(e watcher.Event) {
+	pod := e.Pod
+	key := pod.Namespace + "/" + pod.Name
+	if e.Type == watcher.PodDeleted || pod.Phase == "Succeeded" || pod.Phase == "Failed" {
+		t.mu.Lock()
+		delete(t.pods, key)
+		t.mu.Unlock()
+		return
+	}
+	cost := t.calc.CalculatePodCost(pod)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pods[key] = podCost{namespace: pod.Namespace, workload: pod.Workload, team: pod.Team(), costPerHr: cost}
+}
+
+// SetHPAs updates HPAs from the API. A replica count above the last one
+// read starts a scale event; one below ends the newest events first. HPAs
+// that were deleted end their events. It returns the events that started
+// or ended.
+func (t *Tracker) SetHPAs(list []kube.HorizontalPodAutoscaler) []ScaleEvent {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	workloads := t.usage()
+	var changed []ScaleEvent
+	seen := make(map[string]bool, len(list))
+	for _, item := range list {
+		key := item.Metadata.Namespace + "/" + item.Metadata.Name
+		seen[key] = true
+		a, ok := t.hpas[key]
+		if !ok {
+			// Replicas it had before it was first read aren't a scale-up
+			a = &autoscaler{replicas: item.Status.CurrentReplicas}
+			t.hpas[key] = a
+		}
+		a.item = item
+		if u := workloads[targetKey(item)]; u.pods > 0 {
+			a.costPerPod = u.costPerHr / float64(u.pods)
+		}
+
+		current := item.Status.CurrentReplicas
+		if current != a.replicas {
+			at := scaledAt(item, a.synced, now)
+			a.accrue(at)
+			if current > a.replicas {
+				event := &ScaleEvent{Namespace: item.Metadata.Namespace, HPA: item.Metadata.Name, Workload: item.Spec.ScaleTargetRef.Name,
+					Team: t.team(item, workloads), From: a.replicas, To: current, Started: at, Replicas: current - a.replicas, accrued: at}
+				a.open = append(a.open, event)
+				changed = append(changed, *event)
+			} else {
+				changed = append(changed, t.scaleDown(a, a.replicas-current, at)...)
+			}
+			a.replicas = current
+		}
+		a.accrue(now)
+		a.synced = now
+	}
+	for key, a := range t.hpas {
+		if !seen[key] {
+			a.accrue(now)
+			changed = append(changed, t.scaleDown(a, a.replicas, now)...)
+			delete(t.hpas, key)
+		}
+	}
+	return changed
+}
+
+// scaleDown removes replicas from an HPA's newest scale events, finishing
+// the ones left with none
+func (t *Tracker) scaleDown(a *autoscaler, removed int, at time.Time) []ScaleEvent {
+	var ended []ScaleEvent
+	for removed > 0 && len(a.open) > 0 {
+		event := a.open[len(a.open)-1]
+		n := min(removed, event.Replicas)
+		event.Replicas -= n
+		removed -= n
+		if event.Replicas > 0 {
+			break
+		}
+		event.Ended = at
+		a.open = a.open[:len(a.open)-1]
+		ended = append(ended, *event)
+		t.finish(*event)
+	}
+	return ended
+}
+
+// finish files a finished scale event, dropping the oldest beyond History
+func (t *Tracker) finish(event ScaleEvent) {
+	if a, ok := t.hpas[event.Namespace+"/"+event.HPA]; ok {
+		a.cost += event.Cost
+	}
+	t.events = append(t.events, event)
+	if t.History > 0 && len(t.events) > t.History {
+		dropped := t.events[0]
+		if a, ok := t.hpas[dropped.Namespace+"/"+dropped.HPA]; ok {
+			a.cost -= dropped.Cost
+		}
+		t.events = append([]ScaleEvent(nil), t.events[len(t.events)-t.History:]...)
+	}
+}
+
+// accrue charges an HPA's unfinished scale-ups up to at
+func (a *autoscaler) accrue(at time.Time) {
+	for _, event := range a.open {
+		if at.After(event.accrued) {
+			event.Cost += float64(event.Replicas) * a.costPerPod * at.Sub(event.accrued).Hours()
+			event.accrued = at
+		}
+	}
+}
+
+// Workloads returns every autoscaled workload, optionally only a
+// namespace's, the highest max-scale cost first
+func (t *Tracker) Workloads(namespace string) []Workload {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	workloads := t.usage()
+	list := []Workload{}
+	for _, a := range t.hpas {
+		if namespace == "" || a.item.Metadata.Namespace == namespace {
+			list = append(list, t.workload(a, workloads))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].MaxCostPerHr != list[j].MaxCostPerHr {
+			return list[i].MaxCostPerHr > list[j].MaxCostPerHr
+		}
+		return list[i].Namespace+"/"+list[i].HPA < list[j].Namespace+"/"+list[j].HPA
+	})
+	return list
+}
+
+// Exposures returns each namespace with an HPA, the highest max-scale cost first
+func (t *Tracker) Exposures() []Exposure {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	byNamespace := make(map[string]*Exposure)
+	workloads := t.usage()
+	for _, a := range t.hpas {
+		w := t.workload(a, workloads)
+		e, ok := byNamespace[w.Namespace]
+		if !ok {
+			e = &Exposure{Namespace: w.Namespace}
+			byNamespace[w.Namespace] = e
+		}
+		e.Autoscaled++
+		// Swap the workload's current cost for its cost at each bound
+		e.MinCostPerHr += w.MinCostPerHr - w.CurrentCostPerHr
+		e.MaxCostPerHr += w.MaxCostPerHr - w.CurrentCostPerHr
+	}
+	for _, pod := range t.pods {
+		if e, ok := byNamespace[pod.namespace]; ok {
+			e.CurrentCostPerHr += pod.costPerHr
+		}
+	}
+
+	exposures := make([]Exposure, 0, len(byNamespace))
+	for _, e := range byNamespace {
+		e.MinCostPerHr += e.CurrentCostPerHr
+		e.MaxCostPerHr += e.CurrentCostPerHr
+		e.MaxMonthly = e.MaxCostPerHr * models.HoursPerMonth
+		exposures = append(exposures, *e)
+	}
+	sort.Slice(exposures, func(i, j int) bool {
+		if exposures[i].MaxCostPerHr != exposures[j].MaxCostPerHr {
+			return exposures[i].MaxCostPerHr > exposures[j].MaxCostPerHr
+		}
+		return exposures[i].Namespace < exposures[j].Namespace
+	})
+	return exposures
+}
+
+// Events returns scale events, unfinished ones included, newest first,
+// optionally only a namespace's
+func (t *Tracker) Events(namespace string) []ScaleEvent {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	events := []ScaleEvent{}
+	for _, a := range t.hpas {
+		a.accrue(now)
+		for _, event := range a.open {
+			if namespace == "" || event.Namespace == namespace {
+				events = append(events, *event)
+			}
+		}
+	}
+	for _, event := range t.events {
+		if namespace == "" || event.Namespace == namespace {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Started.After(events[j].Started) })
+	return events
+}
+
+// workload prices an HPA's target at its minimum, current and maximum scale
+func (t *Tracker) workload(a *autoscaler, workloads map[string]usage) Workload {
+	item := a.item
+	u := workloads[targetKey(item)]
+	w := Workload{
+		Namespace:       item.Metadata.Namespace,
+		HPA:             item.Metadata.Name,
+		Kind:            item.Spec.ScaleTargetRef.Kind,
+		Workload:        item.Spec.ScaleTargetRef.Name,
+		Team:            t.team(item, workloads),
+		MinReplicas:     minReplicas(item),
+		CurrentReplicas: item.Status.CurrentReplicas,
+		DesiredReplicas: item.Status.DesiredReplicas,
+		MaxReplicas:     item.Spec.MaxReplicas,
+		Pods:            u.pods,
+		CostPerPod:      a.costPerPod,
+		ScaleUpCost:     a.cost,
+	}
+	w.MinCostPerHr = a.costPerPod * float64(w.MinReplicas)
+	w.CurrentCostPerHr = u.costPerHr
+	if u.pods == 0 {
+		w.CurrentCostPerHr = a.costPerPod * float64(w.CurrentReplicas)
+	}
+	w.MaxCostPerHr = a.costPerPod * float64(w.MaxReplicas)
+	w.MaxMonthly = w.MaxCostPerHr * models.HoursPerMonth
+	for _, event := range a.open {
+		w.ScaleUpCost += event.Cost
+	}
+	if scaled, err := time.Parse(time.RFC3339, item.Status.LastScaleTime); err == nil {
+		w.LastScaleTime = scaled
+	}
+	return w
+}
+
+// usage totals pod costs by namespace/workload
+func (t *Tracker) usage() map[string]usage {
+	workloads := make(map[string]usage)
+	for _, pod := range t.pods {
+		key := pod.namespace + "/" + pod.workload
+		u := workloads[key]
+		u.pods++
+		u.costPerHr += pod.costPerHr
+		if u.team == "" || u.team == models.UnknownTeam {
+			u.team = pod.team
+		}
+		workloads[key] = u
+	}
+	return workloads
+}
+
+// team returns the team of an HPA's pods, else the HPA's team label
+func (t *Tracker) team(item kube.HorizontalPodAutoscaler, workloads map[string]usage) string {
+	if team := workloads[targetKey(item)].team; team != "" && team != models.UnknownTeam {
+		return team
+	}
+	if team := item.Metadata.Labels[models.TeamLabel]; team != "" {
+		return team
+	}
+	return models.UnknownTeam
+}
+
+// targetKey is the namespace/name of the workload an HPA scales
+func targetKey(item kube.HorizontalPodAutoscaler) string {
+	return item.Metadata.Namespace + "/" + item.Spec.ScaleTargetRef.Name
+}
+
+// minReplicas is an HPA's lower bound, 1 when unset
+func minReplicas(item kube.HorizontalPodAutoscaler) int {
+	if item.Spec.MinReplicas != nil {
+		return *item.Spec.MinReplicas
+	}
+	return 1
+}
+
+// scaledAt is when an HPA last scaled, from its status when that falls
+// since the previous read, else now
+func scaledAt(item kube.HorizontalPodAutoscaler, since time.Time, now time.Time) time.Time {
+	scaled, err := time.Parse(time.RFC3339, item.Status.LastScaleTime)
+	if err != nil || scaled.After(now) || (!since.IsZero() && scaled.Before(since)) {
+		return now
+	}
+	return scaled
+}
@@ -0,0 +1,321 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/carbon"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/watcher"
+)
+
+// Dimensions totals are kept for. Labels are "label:<key>", e.g. "label:environment".
+const (
+	ByNamespace = "namespace"
+	ByTeam      = "team"
+	ByNode      = "node"
+	LabelPrefix = "label:"
+)
+
+// Unlabeled is the label value reported for pods without the label
+const Unlabeled = "(none)"
+
+// Totals is the running total of a group of pods
+type Totals struct {
+	Pods      int     `json:"pods"`
+	CPU       float64 `json:"cpu"`
+	Memory    float64 `json:"memory"`
+	CostPerHr float64 `json:"costPerHr"`
+	KWhPerHr  float64 `json:"kWhPerHr,omitempty"`
+	CO2ePerHr float64 `json:"co2ePerHr,omitempty"` // Grams
+}
+
+func (t *Totals) add(sign int, e *entry) {
+	t.Pods += sign
+	t.CPU = roundOff(t.CPU + float64(sign)*e.cpu)
+	t.Memory = roundOff(t.Memory + float64(sign)*e.memory)
+	t.CostPerHr = roundOff(t.CostPerHr + float64(sign)*e.cost)
+	t.KWhPerHr = roundOff(t.KWhPerHr + float64(sign)*e.footprint.KWhPerHr)
+	t.CO2ePerHr = roundOff(t.CO2ePerHr + float64(sign)*e.footprint.CO2ePerHr)
+}
+
+// Change is a pod's effect on the totals, passed to change handlers
+type Change struct {
+	Type      watcher.EventType
+	Pod       *models.Pod // Pod after the change (the removed pod for PodDeleted)
+	Old       *models.Pod // Pod before the change, nil for new pods
+	OldCost   float64     // Hourly cost before the change, 0 for new pods
+	Cost      float64     // Hourly cost after the change, 0 for deleted pods
+	Namespace Totals      // Namespace totals after the change
+	Cluster   Totals      // Cluster totals after the change
+}
+
+// ChangeHandler is called for every change, under the index lock: it must be
+// quick and must not call back into the index
+type ChangeHandler func(Change)
+
+// entry is what one pod contributes to the totals
+type entry struct {
+	pod       *models.Pod
+	cost      float64
+	footprint carbon.Footprint
+	cpu       float64
+	memory    float64
+	keys      []groupKey // Every group the pod is counted in
+}
+
+type groupKey struct {
+	dimension string
+	value     string
+}
+
+// Index keeps cost totals by namespace, team, node and selected labels,
+// updated on every pod event so reading a total is a map lookup instead of
+// re-pricing every pod
+type Index struct {
+	calculator *calculator.Calculator
+	labels     []string
+
+	mu       sync.RWMutex
+	pods     map[string]*entry             // Keyed by namespace/name
+	groups   map[string]map[string]*Totals // Dimension -> value -> totals
+	cluster  Totals
+	handlers []ChangeHandler
+}
+
+// NewIndex creates an index over the watcher's pods, totalling the given label keys too
+func NewIndex(w *watcher.Watcher, calc *calculator.Calculator, labels []string) *Index {
+	idx := &Index{
+		calculator: calc,
+		labels:     labels,
+		pods:       make(map[string]*entry),
+		groups:     make(map[string]map[string]*Totals),
+	}
+	w.OnEvent(idx.Handle)
+
+	// Seed with pods the watcher already has; events that raced with
+	// registration already set their pod
+	for _, pod := range w.Pods() {
+		cost, footprint := calc.CalculatePodCost(pod), calc.CalculatePodFootprint(pod)
+		idx.mu.Lock()
+		if _, ok := idx.pods[podKey(pod)]; !ok {
+			idx.put(pod, cost, footprint)
+		}
+		idx.mu.Unlock()
+	}
+	return idx
+}
+
+// OnChange registers a handler called for every change to the totals
+func (idx *Index) OnChange(h ChangeHandler) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.handlers = append(idx.handlers, h)
+}
+
+// Handle applies a watcher event. Pricing happens before the lock is taken.
+func (idx *Index) Handle(e watcher.Event) {
+	cost := 0.0
+	var footprint carbon.Footprint
+	if e.Type != watcher.PodDeleted {
+		cost = idx.calculator.CalculatePodCost(e.Pod)
+		footprint = idx.calculator.CalculatePodFootprint(e.Pod)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	key := podKey(e.Pod)
+	old, known := idx.pods[key]
+	change := Change{Type: e.Type, Pod: e.Pod, Cost: cost}
+	if known {
+		change.Old, change.OldCost = old.pod, old.cost
+		idx.remove(key, old)
+	} else if e.Type == watcher.PodDeleted {
+		return
+	}
+	if e.Type == watcher.PodDeleted {
+		change.Pod, change.Old = old.pod, nil
+	} else {
+		idx.put(e.Pod, cost, footprint)
+	}
+	change.Namespace = idx.total(groupKey{ByNamespace, e.Pod.Namespace})
+	change.Cluster = idx.cluster
+	for _, h := range idx.handlers {
+		h(change)
+	}
+}
+
+// Reprice prices every pod again, for when nodes, node prices, pricing
+// strategies or the correction factor changed. Energy and emissions are
+// estimated again too, since they depend on the node's type and region. Pods
+// whose cost or footprint moved produce changes.
+func (idx *Index) Reprice() int {
+	idx.mu.RLock()
+	pods := make([]*models.Pod, 0, len(idx.pods))
+	for _, e := range idx.pods {
+		pods = append(pods, e.pod)
+	}
+	idx.mu.RUnlock()
+
+	repriced := 0
+	for _, pod := range pods {
+		cost, footprint := idx.calculator.CalculatePodCost(pod), idx.calculator.CalculatePodFootprint(pod)
+
+		idx.mu.Lock()
+		key := podKey(pod)
+		old, ok := idx.pods[key]
+		if !ok || old.pod != pod || (old.cost == cost && old.footprint == footprint) {
+			// Gone, replaced by a newer event, or unchanged
+			idx.mu.Unlock()
+			continue
+		}
+		idx.remove(key, old)
+		idx.put(pod, cost, footprint)
+		change := Change{Type: watcher.PodUpdated, Pod: pod, Old: pod, OldCost: old.cost, Cost: cost,
+			Namespace: idx.total(groupKey{ByNamespace, pod.Namespace}), Cluster: idx.cluster}
+		for _, h := range idx.handlers {
+			h(change)
+		}
+		idx.mu.Unlock()
+		repriced++
+	}
+	return repriced
+}
+
+// put counts a pod in every group it belongs to; callers hold idx.mu
+func (idx *Index) put(pod *models.Pod, cost float64, footprint carbon.Footprint) {
+	e := &entry{pod: pod, cost: cost, footprint: footprint, cpu: pod.CPU, memory: pod.Memory}
+	e.keys = append(e.keys,
+		groupKey{ByNamespace, pod.Namespace},
+		groupKey{ByTeam, pod.Team()},
+		groupKey{ByNode, pod.NodeName},
+	)
+	for _, label := range idx.labels {
+		value := pod.Labels[label]
+		if value == "" {
+			value = Unlabeled
+		}
+		e.keys = append(e.keys, groupKey{LabelPrefix + label, value})
+	}
+
+	for _, k := range e.keys {
+		values, ok := idx.groups[k.dimension]
+		if !ok {
+			values = make(map[string]*Totals)
+			idx.groups[k.dimension] = values
+		}
+		t, ok := values[k.value]
+		if !ok {
+			t = &Totals{}
+			values[k.value] = t
+		}
+		t.add(1, e)
+	}
+	idx.cluster.add(1, e)
+	idx.pods[podKey(pod)] = e
+}
+
+// remove takes a pod out of its groups; callers hold idx.mu
+func (idx *Index) remove(key string, e *entry) {
+	for _, k := range e.keys {
+		t := idx.groups[k.dimension][k.value]
+		t.add(-1, e)
+		if t.Pods == 0 {
+			delete(idx.groups[k.dimension], k.value)
+		}
+	}
+	idx.cluster.add(-1, e)
+	delete(idx.pods, key)
+}
+
+// total returns a group's totals; callers hold idx.mu
+func (idx *Index) total(k groupKey) Totals {
+	if t, ok := idx.groups[k.dimension][k.value]; ok {
+		return *t
+	}
+	return Totals{}
+}
+
+// Total returns the totals of one group, e.g. Total(ByTeam, "payments")
+func (idx *Index) Total(dimension string, value string) Totals {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.total(groupKey{dimension, value})
+}
+
+// Cluster returns totals for the whole cluster
+func (idx *Index) Cluster() Totals {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.cluster
+}
+
+// Supports reports whether the index keeps totals for a dimension
+func (idx *Index) Supports(dimension string) bool {
+	switch dimension {
+	case ByNamespace, ByTeam, ByNode:
+		return true
+	}
+	for _, label := range idx.labels {
+		if dimension == LabelPrefix+label {
+			return true
+		}
+	}
+	return false
+}
+
+// Summaries returns every group of a dimension as cost summaries, most
+// expensive first. It walks the dimension's groups, never the pods.
+func (idx *Index) Summaries(dimension string) ([]models.CostSummary, error) {
+	summaries, _, err := idx.Snapshot(dimension, nil)
+	return summaries, err
+}
+
+// Snapshot returns a dimension's summaries and the cluster totals at one
+// instant. then, if set, runs before the index is unlocked, so a consumer
+// can start following changes from exactly this point.
+func (idx *Index) Snapshot(dimension string, then func()) ([]models.CostSummary, Totals, error) {
+	if !idx.Supports(dimension) {
+		if strings.HasPrefix(dimension, LabelPrefix) {
+			return nil, Totals{}, fmt.Errorf("label %q is not indexed", strings.TrimPrefix(dimension, LabelPrefix))
+		}
+		return nil, Totals{}, fmt.Errorf("unknown grouping %q", dimension)
+	}
+
+	idx.mu.RLock()
+	summaries := make([]models.CostSummary, 0, len(idx.groups[dimension]))
+	for value, t := range idx.groups[dimension] {
+		summary := models.CostSummary{Name: value, Pods: t.Pods, CPU: t.CPU, Memory: t.Memory, CostPerHr: t.CostPerHr,
+			KWhPerHr: t.KWhPerHr, CO2ePerHr: t.CO2ePerHr}
+		summaries = append(summaries, summary)
+	}
+	cluster := idx.cluster
+	if then != nil {
+		then()
+	}
+	idx.mu.RUnlock()
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].CostPerHr != summaries[j].CostPerHr {
+			return summaries[i].CostPerHr > summaries[j].CostPerHr
+		}
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries, cluster, nil
+}
+
+func podKey(pod *models.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
+
+// roundOff clears the float residue left when pods are added and removed
+func roundOff(total float64) float64 {
+	if total < 1e-9 && total > -1e-9 {
+		return 0
+	}
+	return total
+}
@@ -0,0 +1,274 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/carbon"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/pricing"
+	"cost-detector/pkg/watcher"
+)
+
+var testLabels = []string{"environment"}
+
+// newTestIndex creates an index over a watcher whose pods are priced by
+// node capacity, with energy and emissions estimated
+func newTestIndex() (*Index, *watcher.Watcher, *calculator.Calculator) {
+	w := watcher.NewWatcher("test")
+	calc := calculator.NewCalculator()
+	calc.Nodes = w
+	calc.Strategies = []pricing.Strategy{pricing.NewNodeCapacityPricing(pricing.DefaultCatalog())}
+	calc.Energy = carbon.NewModel("us-east-1")
+	return NewIndex(w, calc, testLabels), w, calc
+}
+
+// testPod makes the i-th pod, spread over namespaces, teams, nodes and labels
+func testPod(i int, cpu float64) *models.Pod {
+	labels := map[string]string{models.TeamLabel: fmt.Sprintf("team-%d", i%7)}
+	if i%3 != 0 {
+		labels["environment"] = []string{"prod", "staging"}[i%2]
+	}
+	return &models.Pod{
+		Name:      fmt.Sprintf("pod-%d", i),
+		Namespace: fmt.Sprintf("ns-%d", i%11),
+		NodeName:  fmt.Sprintf("node-%d", i%5),
+		Labels:    labels,
+		CPU:       cpu,
+		Memory:    cpu * 2,
+	}
+}
+
+func testNode(i int, instanceType string, zone string) *models.Node {
+	return &models.Node{Name: fmt.Sprintf("node-%d", i), InstanceType: instanceType, Zone: zone, CPU: 4, Memory: 16}
+}
+
+// recompute totals every dimension from scratch by pricing the watcher's pods
+func recompute(w *watcher.Watcher, calc *calculator.Calculator) (map[string]map[string]Totals, Totals) {
+	groups := make(map[string]map[string]Totals)
+	var cluster Totals
+	add := func(t *Totals, pod *models.Pod, cost float64, footprint carbon.Footprint) {
+		t.Pods++
+		t.CPU += pod.CPU
+		t.Memory += pod.Memory
+		t.CostPerHr += cost
+		t.KWhPerHr += footprint.KWhPerHr
+		t.CO2ePerHr += footprint.CO2ePerHr
+	}
+	for _, pod := range w.Pods() {
+		cost, footprint := calc.CalculatePodCost(pod), calc.CalculatePodFootprint(pod)
+		keys := map[string]string{ByNamespace: pod.Namespace, ByTeam: pod.Team(), ByNode: pod.NodeName}
+		for _, label := range testLabels {
+			value := pod.Labels[label]
+			if value == "" {
+				value = Unlabeled
+			}
+			keys[LabelPrefix+label] = value
+		}
+		for dimension, value := range keys {
+			if groups[dimension] == nil {
+				groups[dimension] = make(map[string]Totals)
+			}
+			t := groups[dimension][value]
+			add(&t, pod, cost, footprint)
+			groups[dimension][value] = t
+		}
+		add(&cluster, pod, cost, footprint)
+	}
+	return groups, cluster
+}
+
+// checkMatchesRecompute fails when any indexed total differs from a full recompute
+func checkMatchesRecompute(t *testing.T, step string, idx *Index, w *watcher.Watcher, calc *calculator.Calculator) {
+	t.Helper()
+	groups, cluster := recompute(w, calc)
+	compareTotals(t, step+": cluster", idx.Cluster(), cluster)
+
+	for _, dimension := range []string{ByNamespace, ByTeam, ByNode, LabelPrefix + "environment"} {
+		summaries, err := idx.Summaries(dimension)
+		if err != nil {
+			t.Fatalf("%s: Summaries(%s): %v", step, dimension, err)
+		}
+		if len(summaries) != len(groups[dimension]) {
+			t.Errorf("%s: %s has %d groups, want %d", step, dimension, len(summaries), len(groups[dimension]))
+		}
+		for _, s := range summaries {
+			want, ok := groups[dimension][s.Name]
+			if !ok {
+				t.Errorf("%s: %s %q is indexed but has no pods", step, dimension, s.Name)
+				continue
+			}
+			got := Totals{Pods: s.Pods, CPU: s.CPU, Memory: s.Memory, CostPerHr: s.CostPerHr, KWhPerHr: s.KWhPerHr, CO2ePerHr: s.CO2ePerHr}
+			compareTotals(t, fmt.Sprintf("%s: %s %q", step, dimension, s.Name), got, want)
+			compareTotals(t, fmt.Sprintf("%s: Total(%s, %q)", step, dimension, s.Name), idx.Total(dimension, s.Name), want)
+		}
+	}
+}
+
+func compareTotals(t *testing.T, what string, got Totals, want Totals) {
+	t.Helper()
+	close := func(a, b float64) bool { return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b)) }
+	if got.Pods != want.Pods || !close(got.CPU, want.CPU) || !close(got.Memory, want.Memory) ||
+		!close(got.CostPerHr, want.CostPerHr) || !close(got.KWhPerHr, want.KWhPerHr) || !close(got.CO2ePerHr, want.CO2ePerHr) {
+		t.Errorf("%s = %+v, want %+v", what, got, want)
+	}
+}
+
+func TestIncrementalTotalsMatchRecompute(t *testing.T) {
+	idx, w, calc := newTestIndex()
+	// Nodes 0-2 are known; pods on 3 and 4 are priced at the flat rate until their nodes arrive
+	w.AddNode(testNode(0, "m5.xlarge", "us-east-1a"))
+	w.AddNode(testNode(1, "c5.2xlarge", "us-east-1b"))
+	w.AddNode(testNode(2, "r5.large", "eu-west-1a"))
+
+	for i := 0; i < 300; i++ {
+		w.Add(testPod(i, 0.25+float64(i%8)*0.125))
+	}
+	checkMatchesRecompute(t, "add", idx, w, calc)
+
+	// Resize some pods and move others to another team and label value
+	for i := 0; i < 300; i += 4 {
+		pod := testPod(i, 1.5)
+		if i%8 == 0 {
+			pod.Labels[models.TeamLabel] = "moved"
+			pod.Labels["environment"] = "prod"
+		}
+		w.Add(pod)
+	}
+	checkMatchesRecompute(t, "update", idx, w, calc)
+
+	for i := 0; i < 300; i += 3 {
+		w.Delete(fmt.Sprintf("ns-%d", i%11), fmt.Sprintf("pod-%d", i))
+	}
+	w.Delete("ns-0", "no-such-pod")
+	checkMatchesRecompute(t, "delete", idx, w, calc)
+
+	// Nodes arriving and changing type and region reach the totals on Reprice
+	w.AddNode(testNode(3, "m5.2xlarge", "us-west-2a"))
+	w.AddNode(testNode(4, "m6g.xlarge", "eu-central-1a"))
+	w.AddNode(testNode(0, "r5.xlarge", "ap-southeast-2a"))
+	if repriced := idx.Reprice(); repriced == 0 {
+		t.Error("Reprice repriced no pods after nodes changed")
+	}
+	checkMatchesRecompute(t, "reprice after node changes", idx, w, calc)
+
+	calc.SetCorrectionFactor(1.2)
+	idx.Reprice()
+	checkMatchesRecompute(t, "reprice after correction", idx, w, calc)
+	if repriced := idx.Reprice(); repriced != 0 {
+		t.Errorf("Reprice with nothing changed repriced %d pods, want 0", repriced)
+	}
+
+	for _, pod := range w.Pods() {
+		w.Delete(pod.Namespace, pod.Name)
+	}
+	checkMatchesRecompute(t, "delete all", idx, w, calc)
+	if cluster := idx.Cluster(); cluster != (Totals{}) {
+		t.Errorf("empty index has cluster totals %+v, want zero", cluster)
+	}
+}
+
+func TestSeedFromWatcher(t *testing.T) {
+	w := watcher.NewWatcher("test")
+	for i := 0; i < 50; i++ {
+		w.Add(testPod(i, 0.5))
+	}
+	calc := calculator.NewCalculator()
+	idx := NewIndex(w, calc, testLabels)
+	checkMatchesRecompute(t, "seed", idx, w, calc)
+}
+
+func TestChanges(t *testing.T) {
+	idx, w, _ := newTestIndex()
+	var changes []Change
+	idx.OnChange(func(c Change) { changes = append(changes, c) })
+
+	w.Add(testPod(1, 1))
+	w.Add(testPod(1, 2))
+	w.Delete("ns-1", "pod-1")
+	if len(changes) != 3 {
+		t.Fatalf("got %d changes, want 3", len(changes))
+	}
+	if c := changes[0]; c.Type != watcher.PodAdded || c.Old != nil || c.OldCost != 0 || c.Namespace.Pods != 1 {
+		t.Errorf("add change = %+v", c)
+	}
+	if c := changes[1]; c.Type != watcher.PodUpdated || c.Old == nil || c.OldCost != changes[0].Cost || c.Cost <= c.OldCost {
+		t.Errorf("update change = %+v", c)
+	}
+	if c := changes[2]; c.Type != watcher.PodDeleted || c.Cost != 0 || c.Namespace.Pods != 0 || c.Cluster.Pods != 0 {
+		t.Errorf("delete change = %+v", c)
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	idx, _, _ := newTestIndex()
+	if _, err := idx.Summaries("label:missing"); err == nil {
+		t.Error("Summaries of an unindexed label succeeded")
+	}
+	if _, err := idx.Summaries("region"); err == nil {
+		t.Error("Summaries of an unknown grouping succeeded")
+	}
+}
+
+// BenchmarkIndexHandle applies a mix of pod events to an index of 10,000
+// pods: half updates, a quarter adds and a quarter deletes
+func BenchmarkIndexHandle(b *testing.B) {
+	idx, w, _ := newTestIndex()
+	for i := 0; i < 5; i++ {
+		w.AddNode(testNode(i, "m5.xlarge", "us-east-1a"))
+	}
+	const pods = 10000
+	for i := 0; i < pods; i++ {
+		w.Add(testPod(i, 0.5))
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	events := make([]watcher.Event, 4096)
+	for i := range events {
+		pod := testPod(rng.Intn(pods), 0.25+float64(rng.Intn(8))*0.125)
+		switch i % 4 {
+		case 0:
+			events[i] = watcher.Event{Type: watcher.PodDeleted, Pod: pod}
+		case 1:
+			events[i] = watcher.Event{Type: watcher.PodAdded, Pod: pod}
+		default:
+			events[i] = watcher.Event{Type: watcher.PodUpdated, Pod: pod}
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.Handle(events[i%len(events)])
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "events/s")
+}
+
+// BenchmarkIndexQuery reads the totals the API serves from an index of 10,000 pods
+func BenchmarkIndexQuery(b *testing.B) {
+	idx, w, _ := newTestIndex()
+	for i := 0; i < 10000; i++ {
+		w.Add(testPod(i, 0.5))
+	}
+
+	b.Run("Total", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			idx.Total(ByNamespace, "ns-3")
+		}
+	})
+	b.Run("Cluster", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			idx.Cluster()
+		}
+	})
+	b.Run("Summaries", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := idx.Summaries(ByTeam); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
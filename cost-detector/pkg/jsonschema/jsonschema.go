@@ -0,0 +1,343 @@
+// Package jsonschema validates values against the subset of JSON Schema
+// used by the detector's configuration schemas: type, const, enum,
+// properties, required, additionalProperties, items, uniqueItems, anyOf,
+// oneOf, pattern, minLength, minimum, exclusiveMinimum, format "date" and
+// $ref to "#/$defs/...". Other keywords are ignored.
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema is a parsed JSON schema, or one of its definitions
+type Schema struct {
+	root map[string]interface{}
+	node map[string]interface{}
+}
+
+// Parse reads a schema, compiling its patterns so bad ones are found early
+func Parse(data []byte) (*Schema, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	var bad error
+	walk(root, func(node map[string]interface{}) {
+		if pattern, ok := node["pattern"].(string); ok && bad == nil {
+			if _, err := regexp.Compile(pattern); err != nil {
+				bad = fmt.Errorf("schema: pattern %q: %w", pattern, err)
+			}
+		}
+	})
+	if bad != nil {
+		return nil, bad
+	}
+	return &Schema{root: root, node: root}, nil
+}
+
+// Def returns the definition under $defs, e.g. to validate part of a document
+func (s *Schema) Def(name string) (*Schema, error) {
+	node, err := s.resolve("#/$defs/" + name)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{root: s.root, node: node}, nil
+}
+
+// Validate checks a value, e.g. a struct with json tags, and reports every
+// problem with the path of the field at fault, such as "routes.payments.timezone".
+// path names the value itself, "" for a whole document.
+func (s *Schema) Validate(path string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	v := &validator{schema: s}
+	v.check(path, s.node, doc)
+	return errors.Join(v.errs...)
+}
+
+// validator collects the problems found in one value
+type validator struct {
+	schema *Schema
+	errs   []error
+}
+
+func (v *validator) fail(path string, format string, args ...interface{}) {
+	if path == "" {
+		path = "(root)"
+	}
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+// check validates value at path against node, adding what's wrong
+func (v *validator) check(path string, node map[string]interface{}, value interface{}) {
+	if ref, ok := node["$ref"].(string); ok {
+		resolved, err := v.schema.resolve(ref)
+		if err != nil {
+			v.fail(path, "%v", err)
+			return
+		}
+		node = resolved
+	}
+	if want, ok := node["type"].(string); ok && !isType(value, want) {
+		v.fail(path, "must be %s, got %s", article(want), article(typeOf(value)))
+		return
+	}
+	if want, ok := node["const"]; ok && !equal(value, want) {
+		v.fail(path, "must be %s, got %s", show(want), show(value))
+	}
+	if enum, ok := node["enum"].([]interface{}); ok && !contains(enum, value) {
+		v.fail(path, "must be %s, got %s", list(enum, "or"), show(value))
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		v.object(path, node, value)
+	case []interface{}:
+		v.array(path, node, value)
+	case string:
+		v.string(path, node, value)
+	case float64:
+		if min, ok := node["minimum"].(float64); ok && value < min {
+			if min == 0 {
+				v.fail(path, "must not be negative")
+			} else {
+				v.fail(path, "must be at least %g", min)
+			}
+		}
+		if min, ok := node["exclusiveMinimum"].(float64); ok && value <= min {
+			if min == 0 {
+				v.fail(path, "must be positive")
+			} else {
+				v.fail(path, "must be more than %g", min)
+			}
+		}
+	}
+
+	if branches, ok := node["anyOf"].([]interface{}); ok && v.matching(path, branches, value) == 0 {
+		v.fail(path, "needs %s", alternatives(branches, "or"))
+	}
+	if branches, ok := node["oneOf"].([]interface{}); ok {
+		if matched := v.matching(path, branches, value); matched != 1 {
+			v.fail(path, "needs exactly one of %s", alternatives(branches, "or"))
+		}
+	}
+}
+
+func (v *validator) object(path string, node map[string]interface{}, value map[string]interface{}) {
+	properties, _ := node["properties"].(map[string]interface{})
+	if required, ok := node["required"].([]interface{}); ok {
+		for _, key := range required {
+			if _, ok := value[key.(string)]; !ok {
+				v.fail(join(path, key.(string)), "required")
+			}
+		}
+	}
+	for _, key := range sortedKeys(value) {
+		if property, ok := properties[key].(map[string]interface{}); ok {
+			v.check(join(path, key), property, value[key])
+			continue
+		}
+		switch additional := node["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(join(path, key), "unknown field")
+			}
+		case map[string]interface{}:
+			v.check(join(path, key), additional, value[key])
+		}
+	}
+}
+
+func (v *validator) array(path string, node map[string]interface{}, value []interface{}) {
+	items, _ := node["items"].(map[string]interface{})
+	for i, item := range value {
+		if items != nil {
+			v.check(fmt.Sprintf("%s[%d]", path, i), items, item)
+		}
+		if unique, _ := node["uniqueItems"].(bool); unique && contains(value[:i], item) {
+			v.fail(fmt.Sprintf("%s[%d]", path, i), "%s is listed twice", show(item))
+		}
+	}
+}
+
+func (v *validator) string(path string, node map[string]interface{}, value string) {
+	if min, ok := node["minLength"].(float64); ok && float64(len([]rune(value))) < min {
+		if min == 1 {
+			v.fail(path, "must not be empty")
+		} else {
+			v.fail(path, "must be at least %g characters", min)
+		}
+	}
+	if pattern, ok := node["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(value) {
+		if description, ok := node["description"].(string); ok {
+			v.fail(path, "%q is invalid: %s", value, description)
+		} else {
+			v.fail(path, "%q does not match %s", value, pattern)
+		}
+	}
+	if format, _ := node["format"].(string); format == "date" {
+		if _, err := time.Parse(time.DateOnly, value); err != nil {
+			v.fail(path, "%q is not a date like 2026-11-30", value)
+		}
+	}
+}
+
+// matching counts the branches value satisfies
+func (v *validator) matching(path string, branches []interface{}, value interface{}) int {
+	matched := 0
+	for _, branch := range branches {
+		if node, ok := branch.(map[string]interface{}); ok {
+			inner := &validator{schema: v.schema}
+			inner.check(path, node, value)
+			if len(inner.errs) == 0 {
+				matched++
+			}
+		}
+	}
+	return matched
+}
+
+// resolve finds a "#/$defs/name" reference
+func (s *Schema) resolve(ref string) (map[string]interface{}, error) {
+	name, ok := strings.CutPrefix(ref, "#/$defs/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	defs, _ := s.root["$defs"].(map[string]interface{})
+	node, ok := defs[name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("$ref %q not found", ref)
+	}
+	return node, nil
+}
+
+// walk calls fn for every schema object in a schema
+func walk(value interface{}, fn func(map[string]interface{})) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		fn(value)
+		for _, child := range value {
+			walk(child, fn)
+		}
+	case []interface{}:
+		for _, child := range value {
+			walk(child, fn)
+		}
+	}
+}
+
+func isType(value interface{}, want string) bool {
+	switch want {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	default:
+		return typeOf(value) == want
+	}
+}
+
+// typeOf names a decoded JSON value's type as JSON Schema does
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func article(name string) string {
+	if strings.ContainsAny(name[:1], "aeiou") {
+		return "an " + name
+	}
+	return "a " + name
+}
+
+func equal(a interface{}, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+func contains(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// show formats a value for an error message
+func show(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// list joins values as "a, b or c"
+func list(values []interface{}, conjunction string) string {
+	words := make([]string, len(values))
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			words[i] = s
+		} else {
+			words[i] = show(value)
+		}
+	}
+	if len(words) < 2 {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " " + conjunction + " " + words[len(words)-1]
+}
+
+// alternatives describes anyOf/oneOf branches, naming the fields when each
+// branch only requires some
+func alternatives(branches []interface{}, conjunction string) string {
+	var fields []interface{}
+	for _, branch := range branches {
+		node, _ := branch.(map[string]interface{})
+		required, _ := node["required"].([]interface{})
+		if len(node) != 1 || len(required) != 1 {
+			return fmt.Sprintf("%d alternatives of the schema", len(branches))
+		}
+		fields = append(fields, required[0])
+	}
+	return list(fields, conjunction)
+}
+
+func join(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,271 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Paths mounted into every pod by the service account admission controller
+const (
+	serviceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCA    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// Client is a minimal Kubernetes API client that talks REST over HTTPS
+type Client struct {
+	BaseURL string // e.g. "https://10.100.0.1:443"
+	Token   string // Bearer token, empty for unauthenticated proxies
+	HTTP    *http.Client
+}
+
+// NewClient creates a client for an API server URL (for example "kubectl proxy")
+func NewClient(baseURL string, token string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Token:   token,
+		HTTP:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// NewInClusterClient creates a client from the pod's service account
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a cluster: KUBERNETES_SERVICE_HOST/PORT not set")
+	}
+
+	token, err := os.ReadFile(serviceAccountToken)
+	if err != nil {
+		return nil, fmt.Errorf("reading service account token: %w", err)
+	}
+	caPEM, err := os.ReadFile(serviceAccountCA)
+	if err != nil {
+		return nil, fmt.Errorf("reading service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", serviceAccountCA)
+	}
+
+	client := NewClient("https://"+net.JoinHostPort(host, port), strings.TrimSpace(string(token)))
+	client.HTTP.Transport = &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+	}
+	return client, nil
+}
+
+// Get reads an object and decodes it into out
+func (c *Client) Get(ctx context.Context, path string, out interface{}) error {
+	return c.do(ctx, http.MethodGet, path, "", nil, out)
+}
+
+// MergePatch applies a JSON merge patch to an object
+func (c *Client) MergePatch(ctx context.Context, path string, patch interface{}) error {
+	return c.do(ctx, http.MethodPatch, path, "application/merge-patch+json", patch, nil)
+}
+
+// Create creates an object in a collection, decoding the result into out
+func (c *Client) Create(ctx context.Context, path string, obj interface{}, out interface{}) error {
+	return c.do(ctx, http.MethodPost, path, "application/json", obj, out)
+}
+
+// Update replaces an object, decoding the result into out. The API server
+// answers 409 Conflict when the object's resourceVersion is stale.
+func (c *Client) Update(ctx context.Context, path string, obj interface{}, out interface{}) error {
+	return c.do(ctx, http.MethodPut, path, "application/json", obj, out)
+}
+
+// Delete deletes an object
+func (c *Client) Delete(ctx context.Context, path string) error {
+	return c.do(ctx, http.MethodDelete, path, "", nil, nil)
+}
+
+// PatchAnnotations sets annotations on an object, leaving others untouched
+func (c *Client) PatchAnnotations(ctx context.Context, path string, annotations map[string]string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	}
+	return c.MergePatch(ctx, path, patch)
+}
+
+// PodPath is the API path of a pod
+func PodPath(namespace string, name string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", namespace, name)
+}
+
+// NamespacePath is the API path of a namespace
+func NamespacePath(name string) string {
+	return "/api/v1/namespaces/" + name
+}
+
+// PodsPath is the API path listing every pod
+const PodsPath = "/api/v1/pods"
+
+// NodesPath is the API path listing every node
+const NodesPath = "/api/v1/nodes"
+
+// LeasePath is the API path of a coordination.k8s.io Lease, or of the
+// namespace's Leases with an empty name
+func LeasePath(namespace string, name string) string {
+	path := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", namespace)
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+// NamespacesPath is the API path listing every namespace
+const NamespacesPath = "/api/v1/namespaces"
+
+// CronJobsPath is the API path listing every CronJob
+const CronJobsPath = "/apis/batch/v1/cronjobs"
+
+// HPAsPath is the API path listing every HorizontalPodAutoscaler
+const HPAsPath = "/apis/autoscaling/v2/horizontalpodautoscalers"
+
+// SecretPath is the API path of a secret
+func SecretPath(namespace string, name string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", namespace, name)
+}
+
+// Watch streams changes to a collection from resourceVersion on, calling
+// handle for each event until the server ends the watch (after roughly
+// timeout), handle fails or ctx is cancelled. A nil error means the watch
+// ended normally and should be restarted from the last resourceVersion seen.
+func (c *Client) Watch(ctx context.Context, path string, resourceVersion string, timeout time.Duration, handle func(WatchEvent) error) error {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	path += fmt.Sprintf("%swatch=1&allowWatchBookmarks=true&resourceVersion=%s&timeoutSeconds=%d",
+		sep, url.QueryEscape(resourceVersion), int(timeout.Seconds()))
+	req, err := c.request(ctx, http.MethodGet, path, "", nil)
+	if err != nil {
+		return err
+	}
+
+	// The client timeout would cut every watch short; the server-side
+	// timeoutSeconds bounds it instead
+	httpClient := *c.HTTP
+	httpClient.Timeout = 0
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("GET %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &StatusError{Code: resp.StatusCode, Method: http.MethodGet, Path: path, Body: strings.TrimSpace(string(msg))}
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event WatchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("decoding watch of %s: %w", path, err)
+		}
+		if event.Type == WatchError {
+			var status Status
+			json.Unmarshal(event.Object, &status)
+			return &StatusError{Code: status.Code, Method: http.MethodGet, Path: path, Body: status.Message}
+		}
+		if err := handle(event); err != nil {
+			return err
+		}
+	}
+}
+
+// request builds an authenticated API request
+func (c *Client) request(ctx context.Context, method string, path string, contentType string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encoding request body: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return req, nil
+}
+
+// do sends a request and decodes a JSON response
+func (c *Client) do(ctx context.Context, method string, path string, contentType string, body interface{}, out interface{}) error {
+	req, err := c.request(ctx, method, path, contentType, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &StatusError{Code: resp.StatusCode, Method: method, Path: path, Body: strings.TrimSpace(string(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+// StatusError is returned when the API server answers with a non-2xx status
+type StatusError struct {
+	Code   int
+	Method string
+	Path   string
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: status %d: %s", e.Method, e.Path, e.Code, e.Body)
+}
+
+// IsConflict reports whether err is a 409, e.g. an update with a stale resourceVersion
+func IsConflict(err error) bool {
+	statusErr, ok := err.(*StatusError)
+	return ok && statusErr.Code == http.StatusConflict
+}
+
+// IsGone reports whether err is a 410: the watch's resourceVersion is too old and the collection must be listed again
+func IsGone(err error) bool {
+	statusErr, ok := err.(*StatusError)
+	return ok && statusErr.Code == http.StatusGone
+}
+
+// IsNotFound reports whether err is a 404 from the API server
+func IsNotFound(err error) bool {
+	statusErr, ok := err.(*StatusError)
+	return ok && statusErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,179 @@
+package kube
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Label selector operators
+const (
+	SelectorOpIn           = "In"
+	SelectorOpNotIn        = "NotIn"
+	SelectorOpExists       = "Exists"
+	SelectorOpDoesNotExist = "DoesNotExist"
+)
+
+// LabelSelector selects objects by their labels, as in metav1.LabelSelector.
+// An empty selector matches everything.
+type LabelSelector struct {
+	MatchLabels      map[string]string          `json:"matchLabels,omitempty"`
+	MatchExpressions []LabelSelectorRequirement `json:"matchExpressions,omitempty"`
+}
+
+// LabelSelectorRequirement is one expression of a label selector
+type LabelSelectorRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+}
+
+// Validate checks operators and their values the way the API server does
+func (s *LabelSelector) Validate() error {
+	for i, req := range s.MatchExpressions {
+		switch req.Operator {
+		case SelectorOpIn, SelectorOpNotIn:
+			if len(req.Values) == 0 {
+				return fmt.Errorf("matchExpressions[%d]: %s needs values", i, req.Operator)
+			}
+		case SelectorOpExists, SelectorOpDoesNotExist:
+			if len(req.Values) > 0 {
+				return fmt.Errorf("matchExpressions[%d]: %s takes no values", i, req.Operator)
+			}
+		default:
+			return fmt.Errorf("matchExpressions[%d]: unknown operator %q", i, req.Operator)
+		}
+		if req.Key == "" {
+			return fmt.Errorf("matchExpressions[%d]: empty key", i)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether labels satisfy every part of the selector
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+	for key, value := range s.MatchLabels {
+		if v, ok := labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	for _, req := range s.MatchExpressions {
+		value, ok := labels[req.Key]
+		switch req.Operator {
+		case SelectorOpIn:
+			if !ok || !slices.Contains(req.Values, value) {
+				return false
+			}
+		case SelectorOpNotIn:
+			if ok && slices.Contains(req.Values, value) {
+				return false
+			}
+		case SelectorOpExists:
+			if !ok {
+				return false
+			}
+		case SelectorOpDoesNotExist:
+			if ok {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSelector parses the string form of a label selector, such as
+// "app=checkout,tier in (web,api),!canary"
+func ParseSelector(s string) (*LabelSelector, error) {
+	sel := &LabelSelector{}
+	for _, clause := range splitClauses(s) {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+		if err := sel.parseRequirement(clause); err != nil {
+			return nil, err
+		}
+	}
+	if len(sel.MatchLabels) == 0 && len(sel.MatchExpressions) == 0 {
+		return nil, fmt.Errorf("empty label selector")
+	}
+	return sel, sel.Validate()
+}
+
+// splitClauses splits on commas outside parentheses
+func splitClauses(s string) []string {
+	var clauses []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				clauses = append(clauses, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(clauses, s[start:])
+}
+
+// parseRequirement adds one clause: key=value, key!=value, key in (...),
+// key notin (...), key or !key
+func (s *LabelSelector) parseRequirement(clause string) error {
+	expression := func(key string, op string, values ...string) {
+		s.MatchExpressions = append(s.MatchExpressions, LabelSelectorRequirement{Key: key, Operator: op, Values: values})
+	}
+	if strings.HasPrefix(clause, "!") {
+		expression(strings.TrimSpace(clause[1:]), SelectorOpDoesNotExist)
+		return nil
+	}
+	for _, op := range []string{"!=", "==", "="} {
+		key, value, ok := strings.Cut(clause, op)
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch existing, set := s.MatchLabels[key]; {
+		case op == "!=":
+			expression(key, SelectorOpNotIn, value)
+		case set && existing != value:
+			// Can't match, as in the API server
+			expression(key, SelectorOpIn, value)
+		default:
+			if s.MatchLabels == nil {
+				s.MatchLabels = make(map[string]string)
+			}
+			s.MatchLabels[key] = value
+		}
+		return nil
+	}
+	fields := strings.Fields(clause)
+	if len(fields) == 1 {
+		expression(fields[0], SelectorOpExists)
+		return nil
+	}
+	if len(fields) >= 2 && (fields[1] == "in" || fields[1] == "notin" || strings.HasPrefix(fields[1], "in(") || strings.HasPrefix(fields[1], "notin(")) {
+		open, end := strings.Index(clause, "("), strings.LastIndex(clause, ")")
+		if open < 0 || end < open {
+			return fmt.Errorf("bad set in %q", clause)
+		}
+		op := SelectorOpIn
+		if strings.TrimSpace(clause[len(fields[0]):open]) == "notin" {
+			op = SelectorOpNotIn
+		}
+		var values []string
+		for _, v := range strings.Split(clause[open+1:end], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		expression(fields[0], op, values...)
+		return nil
+	}
+	return fmt.Errorf("cannot parse %q", clause)
+}
@@ -0,0 +1,347 @@
+package kube
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"cost-detector/pkg/models"
+	"quantity"
+)
+
+// ObjectMeta is the metadata every Kubernetes object has
+type ObjectMeta struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace,omitempty"`
+	UID               string            `json:"uid,omitempty"`
+	ResourceVersion   string            `json:"resourceVersion,omitempty"`
+	Generation        int64             `json:"generation,omitempty"`
+	CreationTimestamp string            `json:"creationTimestamp,omitempty"`
+	DeletionTimestamp string            `json:"deletionTimestamp,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	OwnerReferences   []OwnerReference  `json:"ownerReferences,omitempty"`
+}
+
+// ListMeta is the metadata of a list; its resourceVersion is where a watch starts
+type ListMeta struct {
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// OwnerReference points at the object that owns another (a ReplicaSet owns its pods)
+type OwnerReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Controller bool   `json:"controller,omitempty"`
+}
+
+// Pod is the part of a Kubernetes pod the cost detector reads
+type Pod struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     PodSpec    `json:"spec"`
+	Status   PodStatus  `json:"status"`
+}
+
+// PodList is the response to listing pods
+type PodList struct {
+	Metadata ListMeta `json:"metadata"`
+	Items    []Pod    `json:"items"`
+}
+
+// PodSpec lists the pod's containers and where it runs
+type PodSpec struct {
+	NodeName       string                `json:"nodeName,omitempty"`
+	Containers     []Container           `json:"containers"`
+	InitContainers []Container           `json:"initContainers,omitempty"`
+	Overhead       quantity.ResourceList `json:"overhead,omitempty"`
+}
+
+// Container is a container in a pod spec
+type Container struct {
+	Name      string                        `json:"name"`
+	Image     string                        `json:"image"`
+	Resources quantity.ResourceRequirements `json:"resources"`
+}
+
+// PodStatus is the observed state of a pod
+type PodStatus struct {
+	Phase             string            `json:"phase,omitempty"`
+	PodIP             string            `json:"podIP,omitempty"`
+	StartTime         string            `json:"startTime,omitempty"`
+	ContainerStatuses []ContainerStatus `json:"containerStatuses,omitempty"`
+}
+
+// ContainerStatus is the observed state of one container
+type ContainerStatus struct {
+	Name  string         `json:"name"`
+	State ContainerState `json:"state"`
+}
+
+// ContainerState is set once a container has terminated
+type ContainerState struct {
+	Terminated *ContainerTerminated `json:"terminated,omitempty"`
+}
+
+// ContainerTerminated is how and when a container ended
+type ContainerTerminated struct {
+	ExitCode   int    `json:"exitCode"`
+	FinishedAt string `json:"finishedAt,omitempty"`
+}
+
+// CronJob is the part of a batch/v1 CronJob the cost detector reads
+type CronJob struct {
+	Metadata ObjectMeta  `json:"metadata"`
+	Spec     CronJobSpec `json:"spec"`
+}
+
+// CronJobSpec is when a CronJob runs
+type CronJobSpec struct {
+	Schedule string `json:"schedule"`
+	TimeZone string `json:"timeZone,omitempty"`
+	Suspend  bool   `json:"suspend,omitempty"`
+}
+
+// CronJobList is the response to listing CronJobs
+type CronJobList struct {
+	Items []CronJob `json:"items"`
+}
+
+// HorizontalPodAutoscaler is the part of an autoscaling/v2 HPA the cost
+// detector reads
+type HorizontalPodAutoscaler struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     HPASpec    `json:"spec"`
+	Status   HPAStatus  `json:"status"`
+}
+
+// HPASpec is what an HPA scales and between which bounds
+type HPASpec struct {
+	ScaleTargetRef CrossVersionObjectReference `json:"scaleTargetRef"`
+	MinReplicas    *int                        `json:"minReplicas,omitempty"` // Defaults to 1
+	MaxReplicas    int                         `json:"maxReplicas"`
+}
+
+// CrossVersionObjectReference names the workload an HPA scales
+type CrossVersionObjectReference struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// HPAStatus is an HPA's current scale
+type HPAStatus struct {
+	CurrentReplicas int    `json:"currentReplicas"`
+	DesiredReplicas int    `json:"desiredReplicas"`
+	LastScaleTime   string `json:"lastScaleTime,omitempty"`
+}
+
+// HPAList is the response to listing HPAs
+type HPAList struct {
+	Items []HorizontalPodAutoscaler `json:"items"`
+}
+
+// Node is the part of a Kubernetes node the cost detector reads
+type Node struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     NodeSpec   `json:"spec"`
+	Status   NodeStatus `json:"status"`
+}
+
+// NodeList is the response to listing nodes
+type NodeList struct {
+	Metadata ListMeta `json:"metadata"`
+	Items    []Node   `json:"items"`
+}
+
+// NodeSpec holds the cloud provider ID, e.g. "aws:///us-east-1a/i-0abc..."
+type NodeSpec struct {
+	ProviderID string `json:"providerID,omitempty"`
+}
+
+// NodeStatus holds what the node can run and its addresses
+type NodeStatus struct {
+	Capacity    quantity.ResourceList `json:"capacity,omitempty"`
+	Allocatable quantity.ResourceList `json:"allocatable,omitempty"`
+	Addresses   []NodeAddress         `json:"addresses,omitempty"`
+}
+
+// NodeAddress is one of a node's addresses
+type NodeAddress struct {
+	Type    string `json:"type"` // "InternalIP", "ExternalIP", "Hostname", ...
+	Address string `json:"address"`
+}
+
+// Namespace is the part of a Kubernetes namespace the cost detector reads
+type Namespace struct {
+	Metadata ObjectMeta `json:"metadata"`
+}
+
+// NamespaceList is the response to listing namespaces
+type NamespaceList struct {
+	Items []Namespace `json:"items"`
+}
+
+// Secret holds sensitive values, base64-decoded by encoding/json
+type Secret struct {
+	Metadata ObjectMeta        `json:"metadata"`
+	Data     map[string][]byte `json:"data,omitempty"`
+}
+
+// Watch event types
+const (
+	WatchAdded    = "ADDED"
+	WatchModified = "MODIFIED"
+	WatchDeleted  = "DELETED"
+	WatchBookmark = "BOOKMARK" // Only advances the resourceVersion
+	WatchError    = "ERROR"    // Object is a Status
+)
+
+// WatchEvent is one change streamed by a watch
+type WatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// Status is the API server's error response, also sent as an ERROR watch event
+type Status struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// Lease is a coordination.k8s.io/v1 Lease, used for leader election
+type Lease struct {
+	APIVersion string     `json:"apiVersion,omitempty"`
+	Kind       string     `json:"kind,omitempty"`
+	Metadata   ObjectMeta `json:"metadata"`
+	Spec       LeaseSpec  `json:"spec"`
+}
+
+// LeaseSpec says who holds a lease and until when
+type LeaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"` // RFC 3339 with microseconds
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// Condition is a status condition, as in metav1.Condition
+type Condition struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"` // "True", "False" or "Unknown"
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime"`
+	Reason             string `json:"reason"`
+	Message            string `json:"message"`
+}
+
+// SetCondition adds or updates a condition, keeping its transition time
+// when the status didn't change
+func SetCondition(conditions []Condition, condition Condition) []Condition {
+	for i, existing := range conditions {
+		if existing.Type != condition.Type {
+			continue
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		conditions[i] = condition
+		return conditions
+	}
+	return append(conditions, condition)
+}
+
+// ToModel converts a pod from the API into the cost detector's pod model
+func (p *Pod) ToModel() *models.Pod {
+	pod := &models.Pod{
+		Name:      p.Metadata.Name,
+		Namespace: p.Metadata.Namespace,
+		Workload:  WorkloadName(p.Metadata),
+		Job:       JobName(p.Metadata),
+		Phase:     p.Status.Phase,
+		NodeName:  p.Spec.NodeName,
+		IP:        p.Status.PodIP,
+		Labels:    p.Metadata.Labels,
+	}
+	pod.StartedAt, _ = time.Parse(time.RFC3339, p.Status.StartTime)
+	if p.Status.Phase == "Succeeded" || p.Status.Phase == "Failed" {
+		for _, status := range p.Status.ContainerStatuses {
+			if status.State.Terminated == nil {
+				continue
+			}
+			if finished, err := time.Parse(time.RFC3339, status.State.Terminated.FinishedAt); err == nil && finished.After(pod.FinishedAt) {
+				pod.FinishedAt = finished
+			}
+		}
+	}
+
+	var containers []models.Container
+	for _, c := range p.Spec.InitContainers {
+		containers = append(containers, models.Container{Name: c.Name, Image: c.Image, Init: true, Resources: c.Resources})
+	}
+	for _, c := range p.Spec.Containers {
+		containers = append(containers, models.Container{Name: c.Name, Image: c.Image, Resources: c.Resources})
+	}
+	pod.SetContainers(containers, p.Spec.Overhead)
+	return pod
+}
+
+// ToModel converts a node from the API into the cost detector's node model
+func (n *Node) ToModel() *models.Node {
+	node := &models.Node{
+		Name:         n.Metadata.Name,
+		InstanceType: n.Metadata.Labels["node.kubernetes.io/instance-type"],
+		InstanceID:   InstanceID(n.Spec.ProviderID),
+		Labels:       n.Metadata.Labels,
+		Zone:         n.Metadata.Labels["topology.kubernetes.io/zone"],
+		CPU:          n.Status.Allocatable.CPU().AsFloat64(),
+		Memory:       n.Status.Allocatable.Memory().GiB(),
+	}
+	for _, addr := range n.Status.Addresses {
+		if addr.Type == "InternalIP" {
+			node.IPs = append(node.IPs, addr.Address)
+		}
+	}
+	return node
+}
+
+// InstanceID extracts the EC2 instance ID from a provider ID such as
+// "aws:///us-east-1a/i-0abc123"; Fargate and non-AWS nodes return ""
+func InstanceID(providerID string) string {
+	if !strings.HasPrefix(providerID, "aws://") {
+		return ""
+	}
+	id := providerID[strings.LastIndex(providerID, "/")+1:]
+	if !strings.HasPrefix(id, "i-") {
+		return ""
+	}
+	return id
+}
+
+// WorkloadName returns the workload that owns a pod: the Deployment behind a
+// ReplicaSet, the StatefulSet, DaemonSet or Job, or the pod itself
+func WorkloadName(meta ObjectMeta) string {
+	for _, owner := range meta.OwnerReferences {
+		if !owner.Controller {
+			continue
+		}
+		if owner.Kind == "ReplicaSet" {
+			if hash := meta.Labels["pod-template-hash"]; hash != "" {
+				return strings.TrimSuffix(owner.Name, "-"+hash)
+			}
+		}
+		return owner.Name
+	}
+	return meta.Name
+}
+
+// JobName returns the Job that owns a pod, or "" when a Job doesn't
+func JobName(meta ObjectMeta) string {
+	for _, owner := range meta.OwnerReferences {
+		if owner.Controller && owner.Kind == "Job" {
+			return owner.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,207 @@
+// Package leader elects one replica to send alerts, using a
+// coordination.k8s.io Lease the way client-go's leader election does.
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cost-detector/pkg/kube"
+	"cost-detector/pkg/logger"
+)
+
+// microTime is the Lease's timestamp format
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// Elector holds or waits for a Lease. Only the holder is leader; it renews
+// the lease every RenewPeriod, and another replica takes over once the lease
+// goes LeaseDuration without a renewal.
+type Elector struct {
+	Namespace     string
+	Name          string
+	Identity      string // This replica, e.g. the pod name
+	LeaseDuration time.Duration
+	RenewPeriod   time.Duration
+
+	client     *kube.Client
+	log        *logger.Logger
+	mu         sync.RWMutex
+	leader     bool
+	observed   string    // Current holder, as last read
+	observedAt time.Time // When the lease last changed, by this replica's clock
+	renewTime  string    // The lease's renewTime when last read
+	renewed    time.Time // When this replica last wrote the lease
+	handlers   []func(leader bool)
+}
+
+// NewElector creates an elector for the Lease namespace/name
+func NewElector(client *kube.Client, namespace string, name string, identity string, leaseDuration time.Duration, log *logger.Logger) *Elector {
+	return &Elector{
+		Namespace:     namespace,
+		Name:          name,
+		Identity:      identity,
+		LeaseDuration: leaseDuration,
+		RenewPeriod:   leaseDuration / 3,
+		client:        client,
+		log:           log,
+	}
+}
+
+// OnChange registers a handler called when this replica gains or loses leadership
+func (e *Elector) OnChange(h func(leader bool)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers = append(e.handlers, h)
+}
+
+// IsLeader reports whether this replica holds the lease
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader
+}
+
+// Holder returns the identity holding the lease when it was last read
+func (e *Elector) Holder() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.observed
+}
+
+// Run tries to acquire or renew the lease every RenewPeriod until ctx is
+// done. It doesn't release the lease; call Release once pending work is flushed.
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.RenewPeriod)
+	defer ticker.Stop()
+	for {
+		leader, err := e.tryAcquire(ctx, time.Now())
+		if err != nil {
+			e.log.Error("Leader election failed", "lease", e.Name, "error", err)
+		}
+		e.set(leader)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Release gives the lease up, so another replica takes over without waiting
+// for it to expire
+func (e *Elector) Release(ctx context.Context) error {
+	if !e.IsLeader() {
+		return nil
+	}
+	var lease kube.Lease
+	if err := e.client.Get(ctx, kube.LeasePath(e.Namespace, e.Name), &lease); err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity != e.Identity {
+		e.set(false)
+		return nil
+	}
+	lease.Spec.HolderIdentity = ""
+	lease.Spec.LeaseDurationSeconds = 1
+	lease.Spec.RenewTime = time.Now().UTC().Format(microTime)
+	err := e.client.Update(ctx, kube.LeasePath(e.Namespace, e.Name), &lease, nil)
+	e.set(false)
+	return err
+}
+
+// tryAcquire creates the lease, renews it when held, or takes it over once
+// it expired. A conflict means another replica wrote it first.
+func (e *Elector) tryAcquire(ctx context.Context, now time.Time) (bool, error) {
+	path := kube.LeasePath(e.Namespace, e.Name)
+	stamp := now.UTC().Format(microTime)
+	seconds := int(e.LeaseDuration.Seconds())
+
+	var lease kube.Lease
+	if err := e.client.Get(ctx, path, &lease); kube.IsNotFound(err) {
+		lease = kube.Lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   kube.ObjectMeta{Name: e.Name, Namespace: e.Namespace},
+			Spec:       kube.LeaseSpec{HolderIdentity: e.Identity, LeaseDurationSeconds: seconds, AcquireTime: stamp, RenewTime: stamp},
+		}
+		if err := e.client.Create(ctx, kube.LeasePath(e.Namespace, ""), &lease, nil); err != nil {
+			if kube.IsConflict(err) { // Another replica created it first
+				return false, nil
+			}
+			return false, err
+		}
+		e.renew(now)
+		return true, nil
+	} else if err != nil {
+		// Keep leading until the lease would have expired anyway
+		return e.IsLeader() && e.stillValid(now), err
+	}
+
+	holder := lease.Spec.HolderIdentity
+	changed := e.observe(lease, now)
+	if holder != e.Identity && holder != "" && !expired(lease, changed, now) {
+		return false, nil
+	}
+	if holder != e.Identity {
+		lease.Spec.AcquireTime = stamp
+		lease.Spec.LeaseTransitions++
+	}
+	lease.Spec.HolderIdentity = e.Identity
+	lease.Spec.LeaseDurationSeconds = seconds
+	lease.Spec.RenewTime = stamp
+	if err := e.client.Update(ctx, path, &lease, nil); err != nil {
+		if kube.IsConflict(err) {
+			return false, nil
+		}
+		return e.IsLeader() && e.stillValid(now), err
+	}
+	e.renew(now)
+	return true, nil
+}
+
+// stillValid reports whether this replica's last renewal hasn't expired
+func (e *Elector) stillValid(now time.Time) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return now.Sub(e.renewed) < e.LeaseDuration
+}
+
+// set records leadership, notifying handlers when it changed
+func (e *Elector) set(leader bool) {
+	e.mu.Lock()
+	changed := e.leader != leader
+	e.leader = leader
+	handlers := e.handlers
+	e.mu.Unlock()
+	if changed {
+		for _, h := range handlers {
+			h(leader)
+		}
+	}
+}
+
+// renew records that this replica wrote the lease
+func (e *Elector) renew(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.observed, e.observedAt = e.Identity, now
+	e.renewed = now
+}
+
+// observe records the lease as read, returning when it last changed. Expiry
+// is judged by this replica's clock, so clock skew between replicas doesn't matter.
+func (e *Elector) observe(lease kube.Lease, now time.Time) time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if lease.Spec.HolderIdentity != e.observed || lease.Spec.RenewTime != e.renewTime || e.observedAt.IsZero() {
+		e.observed, e.renewTime, e.observedAt = lease.Spec.HolderIdentity, lease.Spec.RenewTime, now
+	}
+	return e.observedAt
+}
+
+// expired reports whether a lease went its duration without a renewal
+func expired(lease kube.Lease, changed time.Time, now time.Time) bool {
+	return now.Sub(changed) > time.Duration(lease.Spec.LeaseDurationSeconds)*time.Second
+}
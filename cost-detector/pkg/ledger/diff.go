@@ -0,0 +1,182 @@
+package ledger
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"cost-detector/pkg/models"
+)
+
+// Kinds of change between two snapshots
+const (
+	Appeared    = "appeared"
+	Disappeared = "disappeared"
+	Resized     = "resized"  // Pods, CPU or memory changed
+	Repriced    = "repriced" // Same resources at a different rate, e.g. a new node price
+)
+
+// Change is how one workload differs between two snapshots
+type Change struct {
+	Namespace     string  `json:"namespace"`
+	Name          string  `json:"name"`
+	Change        string  `json:"change"`
+	FromPods      int     `json:"fromPods"`
+	ToPods        int     `json:"toPods"`
+	FromCPU       float64 `json:"fromCpu"`
+	ToCPU         float64 `json:"toCpu"`
+	FromMemory    float64 `json:"fromMemory"`
+	ToMemory      float64 `json:"toMemory"`
+	FromCostPerHr float64 `json:"fromCostPerHr"`
+	ToCostPerHr   float64 `json:"toCostPerHr"`
+	DeltaPerHr    float64 `json:"deltaPerHr"`
+	DeltaPerMonth float64 `json:"deltaPerMonth"`
+}
+
+// Diff compares the snapshots nearest two points in time
+type Diff struct {
+	From          time.Time `json:"from"` // When the earlier snapshot was taken
+	To            time.Time `json:"to"`
+	FromCostPerHr float64   `json:"fromCostPerHr"`
+	ToCostPerHr   float64   `json:"toCostPerHr"`
+	DeltaPerHr    float64   `json:"deltaPerHr"`
+	DeltaPerMonth float64   `json:"deltaPerMonth"`
+	Changes       []Change  `json:"changes"` // Largest cost delta first
+	Unchanged     int       `json:"unchanged"`
+}
+
+// Diff compares the last snapshots taken at or before from and to
+func (l *Ledger) Diff(from time.Time, to time.Time) (*Diff, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("%s is before %s", to.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+	before, err := l.At(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := l.At(to)
+	if err != nil {
+		return nil, err
+	}
+	return Compare(before, after), nil
+}
+
+// Compare lists the workloads that appeared, disappeared, resized or were
+// repriced between two snapshots, largest cost delta first
+func Compare(before *Snapshot, after *Snapshot) *Diff {
+	d := &Diff{From: before.Time, To: after.Time, Changes: []Change{}}
+	workloads := make(map[string]*Change)
+	key := func(w Workload) string { return w.Namespace + "/" + w.Name }
+	for _, w := range before.Workloads {
+		workloads[key(w)] = &Change{Namespace: w.Namespace, Name: w.Name, Change: Disappeared,
+			FromPods: w.Pods, FromCPU: w.CPU, FromMemory: w.Memory, FromCostPerHr: w.CostPerHr}
+		d.FromCostPerHr += w.CostPerHr
+	}
+	for _, w := range after.Workloads {
+		c, ok := workloads[key(w)]
+		if !ok {
+			c = &Change{Namespace: w.Namespace, Name: w.Name, Change: Appeared}
+			workloads[key(w)] = c
+		}
+		c.ToPods, c.ToCPU, c.ToMemory, c.ToCostPerHr = w.Pods, w.CPU, w.Memory, w.CostPerHr
+		if ok {
+			switch {
+			case c.FromPods != c.ToPods || !same(c.FromCPU, c.ToCPU) || !same(c.FromMemory, c.ToMemory):
+				c.Change = Resized
+			case !same(c.FromCostPerHr, c.ToCostPerHr):
+				c.Change = Repriced
+			default:
+				c.Change = ""
+			}
+		}
+		d.ToCostPerHr += w.CostPerHr
+	}
+
+	for _, c := range workloads {
+		if c.Change == "" {
+			d.Unchanged++
+			continue
+		}
+		c.DeltaPerHr = c.ToCostPerHr - c.FromCostPerHr
+		c.DeltaPerMonth = c.DeltaPerHr * models.HoursPerMonth
+		d.Changes = append(d.Changes, *c)
+	}
+	sort.Slice(d.Changes, func(i, j int) bool {
+		a, b := d.Changes[i], d.Changes[j]
+		if math.Abs(a.DeltaPerHr) != math.Abs(b.DeltaPerHr) {
+			return math.Abs(a.DeltaPerHr) > math.Abs(b.DeltaPerHr)
+		}
+		return a.Namespace < b.Namespace || (a.Namespace == b.Namespace && a.Name < b.Name)
+	})
+	d.DeltaPerHr = d.ToCostPerHr - d.FromCostPerHr
+	d.DeltaPerMonth = d.DeltaPerHr * models.HoursPerMonth
+	return d
+}
+
+// same compares resources and rates, ignoring float noise
+func same(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+// Markdown renders the diff as a table for pasting into a postmortem
+func (d *Diff) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Cost changes %s → %s (UTC)\n\n", d.From.UTC().Format("2006-01-02 15:04"), d.To.UTC().Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, "Total: $%.2f/hr → $%.2f/hr (%s/hr, %s/month) across %d changed workloads; %d unchanged.\n\n",
+		d.FromCostPerHr, d.ToCostPerHr, Signed(d.DeltaPerHr, 2), Signed(d.DeltaPerMonth, 2), len(d.Changes), d.Unchanged)
+	if len(d.Changes) == 0 {
+		return b.String()
+	}
+	b.WriteString("| Namespace | Workload | Change | Pods | CPU | Memory (GiB) | $/hr | Δ $/hr | Δ $/month |\n")
+	b.WriteString("|---|---|---|---|---|---|---|---|---|\n")
+	for _, c := range d.Changes {
+		fmt.Fprintf(&b, "| %s | %s | %s | %d → %d | %.2f → %.2f | %.1f → %.1f | %.2f → %.2f | %s | %s |\n",
+			escape(c.Namespace), escape(c.Name), c.Change, c.FromPods, c.ToPods, c.FromCPU, c.ToCPU,
+			c.FromMemory, c.ToMemory, c.FromCostPerHr, c.ToCostPerHr, Signed(c.DeltaPerHr, 2), Signed(c.DeltaPerMonth, 2))
+	}
+	return b.String()
+}
+
+// Signed prints a dollar delta with its sign and the given decimals, e.g.
+// "+$1.20" or "-$15"
+func Signed(v float64, decimals int) string {
+	if v < 0 {
+		return fmt.Sprintf("-$%.*f", decimals, -v)
+	}
+	return fmt.Sprintf("+$%.*f", decimals, v)
+}
+
+// escape keeps a name from breaking a Markdown table
+func escape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// ParseTime reads a point in time: RFC 3339, "2006-01-02 15:04" or
+// "2006-01-02" in UTC, "yesterday 09:00" or "today 09:00" in UTC, "now",
+// or a duration ago such as "24h" or "90m"
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "now" {
+		return now, nil
+	}
+	if day, clock, ok := strings.Cut(value, " "); ok && (day == "today" || day == "yesterday") {
+		if t, err := time.Parse("15:04", clock); err == nil {
+			y, m, d := now.UTC().Date()
+			if day == "yesterday" {
+				d--
+			}
+			return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, time.UTC), nil
+		}
+	}
+	if ago, err := time.ParseDuration(strings.TrimPrefix(value, "-")); err == nil {
+		return now.Add(-ago), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: want RFC 3339, \"2006-01-02 15:04\", \"yesterday 09:00\", \"now\" or a duration ago like \"24h\"", value)
+}
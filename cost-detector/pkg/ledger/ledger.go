@@ -0,0 +1,296 @@
+// Package ledger records what every workload cost over time: periodic
+// snapshots of per-workload rates and the cost each namespace has accrued,
+// kept on disk so history survives restarts.
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/models"
+)
+
+// dayFormat names the file holding a day's snapshots
+const dayFormat = "2006-01-02"
+
+// PodSource provides the pods to record
+type PodSource interface {
+	Pods() []*models.Pod
+}
+
+// Workload is one workload's resources and cost rate at a point in time
+type Workload struct {
+	Namespace string  `json:"namespace"`
+	Name      string  `json:"name"`
+	Pods      int     `json:"pods"`
+	CPU       float64 `json:"cpu"`
+	Memory    float64 `json:"memory"`
+	CostPerHr float64 `json:"costPerHr"`
+}
+
+// Namespace is a namespace's cost rate and the cost it accrued since the ledger first saw it
+type Namespace struct {
+	CostPerHr float64   `json:"costPerHr"`
+	Accrued   float64   `json:"accrued"`
+	Since     time.Time `json:"since"`
+}
+
+// Snapshot is the ledger at one point in time
+type Snapshot struct {
+	Time       time.Time            `json:"time"`
+	Workloads  []Workload           `json:"workloads"`
+	Namespaces map[string]Namespace `json:"namespaces"`
+}
+
+// Ledger takes snapshots and answers what things cost at a point in time.
+// With an empty Dir, history is kept in memory only.
+type Ledger struct {
+	Dir       string
+	Retention time.Duration // How long snapshots are kept
+
+	pods    PodSource
+	calc    *calculator.Calculator
+	mu      sync.RWMutex
+	last    *Snapshot
+	history []*Snapshot // In-memory history, when Dir is empty
+}
+
+// Open creates a ledger, resuming accrual from the last snapshot in dir
+func Open(dir string, retention time.Duration, pods PodSource, calc *calculator.Calculator) (*Ledger, error) {
+	l := &Ledger{Dir: dir, Retention: retention, pods: pods, calc: calc}
+	if dir == "" {
+		return l, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	days, err := l.days()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(days) - 1; i >= 0 && l.last == nil; i-- {
+		snapshots, err := l.readDay(days[i])
+		if err != nil {
+			return nil, err
+		}
+		if len(snapshots) > 0 {
+			l.last = snapshots[len(snapshots)-1]
+		}
+	}
+	return l, nil
+}
+
+// Record takes a snapshot of every workload, accruing each namespace's cost
+// at the rate of the previous snapshot, and appends it to the ledger
+func (l *Ledger) Record(now time.Time) (*Snapshot, error) {
+	snapshot := &Snapshot{Time: now.UTC(), Namespaces: make(map[string]Namespace)}
+	workloads := make(map[string]*Workload)
+	for _, pod := range l.pods.Pods() {
+		name := pod.Workload
+		if name == "" {
+			name = pod.Name
+		}
+		key := pod.Namespace + "/" + name
+		w, ok := workloads[key]
+		if !ok {
+			w = &Workload{Namespace: pod.Namespace, Name: name}
+			workloads[key] = w
+		}
+		cost := l.calc.CalculatePodCost(pod)
+		w.Pods++
+		w.CPU += pod.CPU
+		w.Memory += pod.Memory
+		w.CostPerHr += cost
+
+		ns := snapshot.Namespaces[pod.Namespace]
+		ns.CostPerHr += cost
+		snapshot.Namespaces[pod.Namespace] = ns
+	}
+	for _, w := range workloads {
+		snapshot.Workloads = append(snapshot.Workloads, *w)
+	}
+	sort.Slice(snapshot.Workloads, func(i, j int) bool {
+		a, b := snapshot.Workloads[i], snapshot.Workloads[j]
+		return a.Namespace < b.Namespace || (a.Namespace == b.Namespace && a.Name < b.Name)
+	})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name, ns := range snapshot.Namespaces {
+		ns.Since = snapshot.Time
+		if prev, ok := l.lastNamespace(name); ok {
+			ns.Since = prev.Since
+			ns.Accrued = prev.Accrued + prev.CostPerHr*snapshot.Time.Sub(l.last.Time).Hours()
+		}
+		snapshot.Namespaces[name] = ns
+	}
+	l.last = snapshot
+
+	if l.Dir == "" {
+		l.history = append(l.history, snapshot)
+		cutoff := now.Add(-l.Retention)
+		for len(l.history) > 0 && l.Retention > 0 && l.history[0].Time.Before(cutoff) {
+			l.history = l.history[1:]
+		}
+		return snapshot, nil
+	}
+	if err := l.append(snapshot); err != nil {
+		return snapshot, err
+	}
+	return snapshot, l.prune(now)
+}
+
+// lastNamespace returns a namespace from the previous snapshot
+func (l *Ledger) lastNamespace(name string) (Namespace, bool) {
+	if l.last == nil {
+		return Namespace{}, false
+	}
+	ns, ok := l.last.Namespaces[name]
+	return ns, ok
+}
+
+// Accrued returns what a namespace has cost since the ledger first saw it,
+// up to now at its last recorded rate, and when that was
+func (l *Ledger) Accrued(namespace string, now time.Time) (float64, time.Time, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	ns, ok := l.lastNamespace(namespace)
+	if !ok {
+		return 0, time.Time{}, false
+	}
+	elapsed := now.Sub(l.last.Time).Hours()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return ns.Accrued + ns.CostPerHr*elapsed, ns.Since, true
+}
+
+// Last returns the latest snapshot, or nil before the first one
+func (l *Ledger) Last() *Snapshot {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.last
+}
+
+// At returns the last snapshot taken at or before t
+func (l *Ledger) At(t time.Time) (*Snapshot, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.Dir == "" {
+		i := sort.Search(len(l.history), func(i int) bool { return l.history[i].Time.After(t) })
+		if i == 0 {
+			return nil, fmt.Errorf("no ledger snapshot at or before %s", t.Format(time.RFC3339))
+		}
+		return l.history[i-1], nil
+	}
+
+	days, err := l.days()
+	if err != nil {
+		return nil, err
+	}
+	day := t.UTC().Format(dayFormat)
+	for i := len(days) - 1; i >= 0; i-- {
+		if days[i] > day {
+			continue
+		}
+		snapshots, err := l.readDay(days[i])
+		if err != nil {
+			return nil, err
+		}
+		for j := len(snapshots) - 1; j >= 0; j-- {
+			if !snapshots[j].Time.After(t) {
+				return snapshots[j], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no ledger snapshot at or before %s", t.Format(time.RFC3339))
+}
+
+// append writes a snapshot to its day's file
+func (l *Ledger) append(snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(l.Dir, snapshot.Time.Format(dayFormat)+".jsonl")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// prune deletes day files older than Retention
+func (l *Ledger) prune(now time.Time) error {
+	if l.Retention <= 0 {
+		return nil
+	}
+	days, err := l.days()
+	if err != nil {
+		return err
+	}
+	cutoff := now.Add(-l.Retention).UTC().Format(dayFormat)
+	var errs []error
+	for _, day := range days {
+		if day < cutoff {
+			errs = append(errs, os.Remove(filepath.Join(l.Dir, day+".jsonl")))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// days lists the days with snapshots, oldest first
+func (l *Ledger) days() ([]string, error) {
+	entries, err := os.ReadDir(l.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var days []string
+	for _, entry := range entries {
+		day, ok := strings.CutSuffix(entry.Name(), ".jsonl")
+		if _, err := time.Parse(dayFormat, day); ok && err == nil {
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+// readDay reads a day's snapshots. A torn last line (a crash mid-write) is skipped.
+func (l *Ledger) readDay(day string) ([]*Snapshot, error) {
+	f, err := os.Open(filepath.Join(l.Dir, day+".jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var snapshots []*Snapshot
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1<<20), 64<<20)
+	for scanner.Scan() {
+		var snapshot Snapshot
+		if err := json.Unmarshal(scanner.Bytes(), &snapshot); err != nil {
+			continue
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+	return snapshots, scanner.Err()
+}
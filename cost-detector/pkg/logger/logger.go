@@ -1,35 +1,196 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-// Logger is a simple logger
+// Levels, least to most severe
+const (
+	LevelDebug   = "debug"
+	LevelInfo    = "info"
+	LevelWarning = "warning"
+	LevelError   = "error"
+)
+
+// Formats
+const (
+	FormatText = "text" // [15:04:05] INFO: message key=value
+	FormatJSON = "json" // One object per line, e.g. for CloudWatch Logs Insights
+)
+
+var severity = map[string]int{LevelDebug: 0, LevelInfo: 1, LevelWarning: 2, LevelError: 3}
+
+// Logger is a leveled logger writing messages with key-value fields
 type Logger struct {
-	Level string // "debug", "info", "warning", "error"
+	Level  string // "debug", "info", "warning", "error"
+	Format string // "text" or "json"
+
+	out    io.Writer
+	mu     *sync.Mutex // Shared with child loggers, so lines don't interleave
+	fields []interface{}
 }
 
-// NewLogger creates a new logger
-func NewLogger(level string) *Logger {
+// NewLogger creates a logger writing to stdout. An unknown level logs info
+// and above; an unknown format writes text.
+func NewLogger(level string, format string) *Logger {
+	level = strings.ToLower(level)
+	if level == "warn" {
+		level = LevelWarning
+	}
+	if _, ok := severity[level]; !ok {
+		level = LevelInfo
+	}
+	if format = strings.ToLower(format); format != FormatJSON {
+		format = FormatText
+	}
 	return &Logger{
-		Level: level,
+		Level:  level,
+		Format: format,
+		out:    os.Stdout,
+		mu:     &sync.Mutex{},
 	}
 }
 
+// SetOutput redirects the logger and its children created afterwards
+func (l *Logger) SetOutput(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out = w
+}
+
+// With returns a child logger adding keyvals, e.g. "namespace", ns, to
+// every message
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	child := *l
+	child.fields = append(append([]interface{}{}, l.fields...), keyvals...)
+	return &child
+}
+
+// Debug logs debug message
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
 // Info logs info message
-func (l *Logger) Info(msg string) {
-	fmt.Printf("[%s] INFO: %s\n", time.Now().Format("15:04:05"), msg)
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+// Warning logs warning message
+func (l *Logger) Warning(msg string, keyvals ...interface{}) {
+	l.log(LevelWarning, msg, keyvals)
 }
 
 // Error logs error message
-func (l *Logger) Error(msg string) {
-	fmt.Printf("[%s] ERROR: %s\n", time.Now().Format("15:04:05"), msg)
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
 }
 
-// Debug logs debug message
-func (l *Logger) Debug(msg string) {
-	if l.Level == "debug" {
-		fmt.Printf("[%s] DEBUG: %s\n", time.Now().Format("15:04:05"), msg)
+// Enabled reports whether messages at level are written
+func (l *Logger) Enabled(level string) bool {
+	return severity[level] >= severity[l.Level]
+}
+
+// log writes one line if level is enabled
+func (l *Logger) log(level string, msg string, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	fields := pairs(append(append([]interface{}{}, l.fields...), keyvals...))
+	now := time.Now()
+
+	var line []byte
+	if l.Format == FormatJSON {
+		line = encodeJSON(now, level, msg, fields)
+	} else {
+		line = encodeText(now, level, msg, fields)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line)
+}
+
+// field is one key-value pair
+type field struct {
+	key   string
+	value interface{}
+}
+
+// pairs turns alternating keys and values into fields. A value without a
+// key is kept under "extra"; a later field overrides an earlier one.
+func pairs(keyvals []interface{}) []field {
+	var fields []field
+	index := make(map[string]int)
+	for i := 0; i < len(keyvals); i += 2 {
+		key, value := "extra", keyvals[i]
+		if i+1 < len(keyvals) {
+			key, value = fmt.Sprint(keyvals[i]), keyvals[i+1]
+		}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		if j, ok := index[key]; ok {
+			fields[j].value = value
+			continue
+		}
+		index[key] = len(fields)
+		fields = append(fields, field{key, value})
+	}
+	return fields
+}
+
+// encodeJSON writes {"time":...,"level":...,"msg":...,fields...}
+func encodeJSON(now time.Time, level string, msg string, fields []field) []byte {
+	var b strings.Builder
+	b.WriteString(`{"time":`)
+	writeJSON(&b, now.UTC().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJSON(&b, level)
+	b.WriteString(`,"msg":`)
+	writeJSON(&b, msg)
+	for _, f := range fields {
+		if f.key == "time" || f.key == "level" || f.key == "msg" {
+			f.key = "field." + f.key
+		}
+		b.WriteByte(',')
+		writeJSON(&b, f.key)
+		b.WriteByte(':')
+		writeJSON(&b, f.value)
+	}
+	b.WriteString("}\n")
+	return []byte(b.String())
+}
+
+// writeJSON encodes a value, falling back to its string form
+func writeJSON(b *strings.Builder, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	b.Write(data)
+}
+
+// encodeText writes [15:04:05] LEVEL: msg key=value
+func encodeText(now time.Time, level string, msg string, fields []field) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s: %s", now.Format("15:04:05"), strings.ToUpper(level), msg)
+	for _, f := range fields {
+		value := fmt.Sprint(f.value)
+		if v, ok := f.value.(float64); ok {
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", f.key, value)
 	}
+	b.WriteByte('\n')
+	return []byte(b.String())
 }
@@ -1,21 +1,112 @@
 package models
 
+import (
+	"time"
+
+	"quantity"
+)
+
 // Pod represents a Kubernetes pod
 type Pod struct {
-	Name       string  // Pod name
-	Namespace  string  // Namespace it's in
-	CPU        float64 // CPU requested (cores)
-	Memory     float64 // Memory requested (GB)
-	CostPerHr  float64 // Calculated hourly cost
+	Name       string            // Pod name
+	Namespace  string            // Namespace it's in
+	Workload   string            // Owning workload (Deployment, StatefulSet, ...)
+	Job        string            // Owning Job, for batch pods
+	Phase      string            // "Pending", "Running", "Succeeded" or "Failed"
+	StartedAt  time.Time         // When the kubelet started the pod, zero if unknown
+	FinishedAt time.Time         // When its last container terminated, zero until it has
+	NodeName   string            // Node it's scheduled on
+	IP         string            // Pod IP
+	Labels     map[string]string // Pod labels
+	Containers []Container       // Containers and init containers, when read from a pod spec
+	CPU        float64           // CPU requested (cores)
+	Memory     float64           // Memory requested (GiB)
+	CostPerHr  float64           // Calculated hourly cost
+}
+
+// TeamLabel is the pod label that names the owning team
+const TeamLabel = "team"
+
+// UnknownTeam is reported for pods without a team label
+const UnknownTeam = "unassigned"
+
+// Team returns the team that owns a pod, from its "team" label
+func (p *Pod) Team() string {
+	if team := p.Labels[TeamLabel]; team != "" {
+		return team
+	}
+	return UnknownTeam
+}
+
+// Container is one container of a pod with its requests and limits
+type Container struct {
+	Name      string
+	Image     string
+	Init      bool // Init container, only runs before the app containers
+	Resources quantity.ResourceRequirements
+}
+
+// SetContainers stores a pod's containers and sets CPU and Memory to what
+// the scheduler reserves for them. Memory is in GiB, the unit EC2 and
+// Fargate sell memory in.
+func (p *Pod) SetContainers(containers []Container, overhead quantity.ResourceList) {
+	var app, init []quantity.ResourceRequirements
+	for _, c := range containers {
+		if c.Init {
+			init = append(init, c.Resources)
+		} else {
+			app = append(app, c.Resources)
+		}
+	}
+	requests := quantity.PodRequests(app, init, overhead)
+
+	p.Containers = containers
+	p.CPU = requests.CPU().AsFloat64()
+	p.Memory = requests.Memory().GiB()
 }
 
+// HoursPerMonth is the average number of hours in a month (8760 / 12),
+// used to project monthly spend from hourly cost
+const HoursPerMonth = 730
+
+// Alert kinds: what made an alert fire. Acknowledgements hold for one kind
+// of alert on a service, so acknowledging a namespace's budget alert doesn't
+// silence its compliance or preview alerts.
+const (
+	AlertPod        = "pod"        // A pod over the per-pod threshold
+	AlertBudget     = "budget"     // A namespace or team over its budget
+	AlertGuardrail  = "guardrail"  // A set of namespaces over a CostPolicy budget
+	AlertMaxScale   = "max-scale"  // A namespace over budget with its HPAs at their maximum
+	AlertCronJob    = "cronjob"    // A CronJob run costing far more than usual
+	AlertUnitCost   = "unit-cost"  // A service's cost per unit regressing
+	AlertCompliance = "compliance" // Workloads missing chargeback labels
+	AlertPreview    = "preview"    // A preview environment's cost or teardown
+	AlertPolicy     = "policy"     // A rejected budgets file
+	AlertSummary    = "summary"    // A daily or weekly summary
+)
+
 // CostAlert represents a cost alert to send to Teams
 type CostAlert struct {
 	Team       string
 	Service    string
+	Kind       string // What fired, e.g. AlertBudget
 	CostPerHr  float64
 	Message    string
-	Severity   string // "info", "warning", "critical"
+	Severity   string   // "info", "warning", "critical"
+	Route      string   // Policy route the alert goes to, empty for the default channel
+	WebhookURL string   // Route's Teams webhook, overrides the default
+	Actions    []Action // Buttons on the alert card, e.g. acknowledge and snooze
+}
+
+// Key identifies what an alert is about: its kind and service
+func (a *CostAlert) Key() string {
+	return a.Kind + "|" + a.Service
+}
+
+// Action is a link button on an alert card
+type Action struct {
+	Title string
+	URL   string
 }
 
 // NodePrice holds pricing info for a node type
@@ -23,3 +114,64 @@ type NodePrice struct {
 	InstanceType string  // e.g., "t3.large"
 	CostPerHour  float64 // Cost per hour in dollars
 }
+
+// CostSummary is the hourly cost of a group of pods (a namespace, a workload, ...)
+type CostSummary struct {
+	Name      string  `json:"name"`                 // Group name
+	Namespace string  `json:"namespace,omitempty"`  // Namespace, for workload and pod groups
+	Pods      int     `json:"pods"`                 // Number of pods in the group
+	CPU       float64 `json:"cpu"`                  // Total CPU requested (cores)
+	Memory    float64 `json:"memory"`               // Total memory requested (GiB)
+	CostPerHr float64 `json:"costPerHr"`            // Total hourly cost
+	Model     string  `json:"priceModel,omitempty"` // Pricing strategy, for pod groups
+	KWhPerHr  float64 `json:"kWhPerHr,omitempty"`   // Estimated energy per hour
+	CO2ePerHr float64 `json:"co2ePerHr,omitempty"`  // Estimated grams of CO2e per hour
+
+	NetworkCostPerHr float64 `json:"networkCostPerHr,omitempty"` // Data transfer cost, for namespace groups
+}
+
+// Node represents a Kubernetes worker node
+type Node struct {
+	Name         string            // Node name
+	InstanceType string            // EC2 instance type, e.g. "m5.xlarge"
+	InstanceID   string            // EC2 instance ID, e.g. "i-0abc123..."
+	Labels       map[string]string // Node labels (capacity type, zone, ...)
+	IPs          []string          // Internal IPs
+	Zone         string            // Availability zone, e.g. "us-east-1a"
+	CPU          float64           // Allocatable CPU (cores)
+	Memory       float64           // Allocatable memory (GiB)
+}
+
+// ContainerCost is one container's share of its pod's hourly cost
+type ContainerCost struct {
+	Namespace string  `json:"namespace"`
+	Pod       string  `json:"pod"`
+	Container string  `json:"container"`
+	Init      bool    `json:"init,omitempty"`
+	Sidecar   string  `json:"sidecar,omitempty"` // Well-known sidecar kind, e.g. "istio-proxy"
+	Overhead  bool    `json:"overhead"`          // Platform overhead rather than application cost
+	CPU       float64 `json:"cpu"`               // CPU requested (cores)
+	Memory    float64 `json:"memory"`            // Memory requested (GiB)
+	CostPerHr float64 `json:"costPerHr"`
+}
+
+// OverheadSummary splits a namespace's hourly cost into application and platform overhead
+type OverheadSummary struct {
+	Namespace       string             `json:"namespace"`
+	ApplicationCost float64            `json:"applicationCostPerHr"`
+	OverheadCost    float64            `json:"overheadCostPerHr"`
+	OverheadPercent float64            `json:"overheadPercent"`
+	BySidecar       map[string]float64 `json:"bySidecar,omitempty"` // Overhead cost per sidecar kind
+}
+
+// NetworkCost is the data transfer cost attributed to a namespace and team
+type NetworkCost struct {
+	Namespace    string  `json:"namespace"`
+	Team         string  `json:"team"`
+	EgressBytes  int64   `json:"internetEgressBytes"`
+	CrossAZBytes int64   `json:"crossAZBytes"`
+	EgressCost   float64 `json:"internetEgressCost"` // Dollars over the observed window
+	CrossAZCost  float64 `json:"crossAZCost"`        // Dollars over the observed window
+	TotalCost    float64 `json:"totalCost"`
+	CostPerHr    float64 `json:"costPerHr"` // TotalCost spread over the observed window
+}
@@ -0,0 +1,144 @@
+package network
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultFields is the VPC flow log version 2 default format
+var defaultFields = []string{
+	"version", "account-id", "interface-id", "srcaddr", "dstaddr", "srcport", "dstport",
+	"protocol", "packets", "bytes", "start", "end", "action", "log-status",
+}
+
+// Record is one VPC flow log record
+type Record struct {
+	InterfaceID string
+	SrcAddr     string
+	DstAddr     string
+	SrcPort     string
+	DstPort     string
+	Protocol    string
+	Bytes       int64
+	Start       int64  // Unix seconds
+	End         int64  // Unix seconds
+	Action      string // "ACCEPT" or "REJECT"
+}
+
+// Parser reads space-separated VPC flow log records. Files delivered to S3
+// start with a header naming the fields, which switches the parser to that
+// (custom) format; otherwise the default version 2 format is assumed.
+type Parser struct {
+	scanner *bufio.Scanner
+	fields  map[string]int
+	line    int
+}
+
+// NewParser creates a parser reading from r
+func NewParser(r io.Reader) *Parser {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &Parser{scanner: scanner, fields: fieldIndex(defaultFields)}
+}
+
+// Next returns the next record with traffic, or io.EOF when the input ends.
+// NODATA and SKIPDATA records are skipped.
+func (p *Parser) Next() (*Record, error) {
+	for p.scanner.Scan() {
+		p.line++
+		parts := strings.Fields(p.scanner.Text())
+		if len(parts) == 0 {
+			continue
+		}
+		if parts[0] == "version" || parts[0] == "account-id" || parts[0] == "interface-id" {
+			p.fields = fieldIndex(parts)
+			continue
+		}
+		if len(parts) < len(p.fields) {
+			return nil, fmt.Errorf("flow log line %d: want %d fields, got %d", p.line, len(p.fields), len(parts))
+		}
+
+		get := func(name string) string {
+			if i, ok := p.fields[name]; ok && parts[i] != "-" {
+				return parts[i]
+			}
+			return ""
+		}
+		if status := get("log-status"); status == "NODATA" || status == "SKIPDATA" {
+			continue
+		}
+
+		record := &Record{
+			InterfaceID: get("interface-id"),
+			SrcAddr:     get("srcaddr"),
+			DstAddr:     get("dstaddr"),
+			SrcPort:     get("srcport"),
+			DstPort:     get("dstport"),
+			Protocol:    get("protocol"),
+			Action:      get("action"),
+		}
+		var err error
+		if record.Bytes, err = parseInt(get("bytes")); err != nil {
+			return nil, fmt.Errorf("flow log line %d: bytes: %w", p.line, err)
+		}
+		if record.Start, err = parseInt(get("start")); err != nil {
+			return nil, fmt.Errorf("flow log line %d: start: %w", p.line, err)
+		}
+		if record.End, err = parseInt(get("end")); err != nil {
+			return nil, fmt.Errorf("flow log line %d: end: %w", p.line, err)
+		}
+		return record, nil
+	}
+	if err := p.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// OpenFile opens a flow log file, decompressing .gz files
+func OpenFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return &gzipFile{Reader: gz, file: f}, nil
+}
+
+// gzipFile closes both the gzip reader and the file under it
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+func fieldIndex(names []string) map[string]int {
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+	return index
+}
+
+func parseInt(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,306 @@
+package network
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"cost-detector/pkg/models"
+)
+
+// Data transfer prices in us-east-1
+const (
+	DefaultInternetEgressPerGB = 0.09 // First 10 TB/month to the internet
+	DefaultCrossAZPerGB        = 0.01 // Charged on each side, so 0.02 per GB moved
+)
+
+// HostNetwork is the namespace reported for traffic from node IPs (host-network pods, kubelet, ...)
+const HostNetwork = "(host-network)"
+
+// dedupeWindow is how long, in seconds, a flow is remembered so the copy
+// logged by the receiving interface isn't counted twice
+const dedupeWindow = 3600
+
+// Inventory provides the pods and nodes used to map IPs to namespaces
+type Inventory interface {
+	Pods() []*models.Pod
+	Nodes() []*models.Node
+}
+
+// endpoint is what an IP in the cluster belongs to
+type endpoint struct {
+	namespace string
+	team      string
+	zone      string
+}
+
+// costKey groups data transfer cost
+type costKey struct {
+	namespace string
+	team      string
+}
+
+// Tracker prices data transfer from VPC flow logs and attributes it to the
+// namespace and team of the pod that sent it
+type Tracker struct {
+	inventory    Inventory
+	EgressPerGB  float64      // Internet egress price per GB
+	CrossAZPerGB float64      // Cross-AZ price per GB, per direction
+	PrivateNets  []*net.IPNet // Ranges inside the VPC; anything else is the internet
+
+	mu    sync.Mutex
+	costs map[costKey]*models.NetworkCost
+	first int64            // Earliest record start (Unix seconds)
+	last  int64            // Latest record end (Unix seconds)
+	seen  map[string]int64 // Recent flows, to skip the receiver's copy
+	files map[string]int64 // Files already ingested, with their size
+}
+
+// NewTracker creates a data transfer cost tracker
+func NewTracker(inventory Inventory, egressPerGB float64, crossAZPerGB float64) *Tracker {
+	var private []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10"} {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		private = append(private, ipNet)
+	}
+	return &Tracker{
+		inventory:    inventory,
+		EgressPerGB:  egressPerGB,
+		CrossAZPerGB: crossAZPerGB,
+		PrivateNets:  private,
+		costs:        make(map[costKey]*models.NetworkCost),
+		seen:         make(map[string]int64),
+		files:        make(map[string]int64),
+	}
+}
+
+// Ingest prices every record read from r and returns how many were priced.
+// Records before a malformed line are still priced.
+func (t *Tracker) Ingest(r io.Reader) (int, error) {
+	// Read without the lock, so a slow upload doesn't hold up cost queries.
+	// Both interfaces on an internal flow log it; keeping one copy per flow
+	// counts it once.
+	flows := make(map[string]*Record)
+	parser := NewParser(r)
+	var parseErr error
+	for {
+		record, err := parser.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			parseErr = err
+			break
+		}
+		if record.Action == "ACCEPT" && record.Bytes > 0 {
+			flows[flowKey(record)] = record
+		}
+	}
+
+	endpoints := t.endpoints()
+	priced := 0
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for flow, record := range flows {
+		if t.price(flow, record, endpoints) {
+			priced++
+		}
+	}
+	return priced, parseErr
+}
+
+// IngestDir ingests flow log files in dir that are new or have grown since
+// the last call. Files that grew are read again from the start; the flow
+// dedupe window keeps their earlier records from being counted twice. A file
+// that fails is reported and skipped until it changes again.
+func (t *Tracker) IngestDir(dir string) (int, []error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, []error{err}
+	}
+
+	priced := 0
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+
+		t.mu.Lock()
+		size, done := t.files[path]
+		t.mu.Unlock()
+		if done && size == info.Size() {
+			continue
+		}
+
+		f, err := OpenFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		n, err := t.Ingest(f)
+		f.Close()
+		priced += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+
+		t.mu.Lock()
+		t.files[path] = info.Size()
+		t.mu.Unlock()
+	}
+	return priced, errs
+}
+
+// flowKey identifies a flow across the copies logged by each interface
+func flowKey(record *Record) string {
+	return record.SrcAddr + "|" + record.DstAddr + "|" + record.SrcPort + "|" + record.DstPort + "|" + record.Protocol + "|" + fmt.Sprint(record.Start)
+}
+
+// price attributes one record's cost to its source; callers hold t.mu
+func (t *Tracker) price(flow string, record *Record, endpoints map[string]endpoint) bool {
+	if record.Action != "ACCEPT" || record.Bytes <= 0 {
+		return false
+	}
+	src, ok := endpoints[record.SrcAddr]
+	if !ok {
+		// Traffic into the cluster is free
+		return false
+	}
+
+	// Count a flow once, even when its copies arrive in different files
+	if _, dup := t.seen[flow]; dup {
+		return false
+	}
+	t.seen[flow] = record.Start
+	t.pruneSeen(record.Start)
+
+	gb := float64(record.Bytes) / 1e9
+	var cost *models.NetworkCost
+	if dst, internal := endpoints[record.DstAddr]; internal {
+		if src.zone == "" || dst.zone == "" || src.zone == dst.zone {
+			return false
+		}
+		cost = t.costFor(src)
+		cost.CrossAZBytes += record.Bytes
+		cost.CrossAZCost += gb * t.CrossAZPerGB * 2
+	} else if t.isPrivate(record.DstAddr) {
+		// Somewhere else in the VPC (RDS, another cluster, ...): zone unknown, not priced
+		return false
+	} else {
+		cost = t.costFor(src)
+		cost.EgressBytes += record.Bytes
+		cost.EgressCost += gb * t.EgressPerGB
+	}
+	cost.TotalCost = cost.EgressCost + cost.CrossAZCost
+
+	if t.first == 0 || record.Start < t.first {
+		t.first = record.Start
+	}
+	if record.End > t.last {
+		t.last = record.End
+	}
+	return true
+}
+
+// costFor returns the running total for an endpoint's namespace and team
+func (t *Tracker) costFor(src endpoint) *models.NetworkCost {
+	key := costKey{namespace: src.namespace, team: src.team}
+	cost, ok := t.costs[key]
+	if !ok {
+		cost = &models.NetworkCost{Namespace: src.namespace, Team: src.team}
+		t.costs[key] = cost
+	}
+	return cost
+}
+
+// pruneSeen forgets flows that started well before now
+func (t *Tracker) pruneSeen(now int64) {
+	if len(t.seen) < 100000 {
+		return
+	}
+	for flow, start := range t.seen {
+		if now-start > dedupeWindow {
+			delete(t.seen, flow)
+		}
+	}
+}
+
+// isPrivate reports whether an IP is inside the VPC
+func (t *Tracker) isPrivate(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range t.PrivateNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// endpoints maps pod and node IPs to what they belong to. Host-network pods
+// share their node's IP, so node IPs always map to the node.
+func (t *Tracker) endpoints() map[string]endpoint {
+	endpoints := make(map[string]endpoint)
+	zones := make(map[string]string)
+	for _, node := range t.inventory.Nodes() {
+		zones[node.Name] = node.Zone
+		for _, ip := range node.IPs {
+			endpoints[ip] = endpoint{namespace: HostNetwork, team: models.UnknownTeam, zone: node.Zone}
+		}
+	}
+	for _, pod := range t.inventory.Pods() {
+		if pod.IP == "" {
+			continue
+		}
+		if _, isNode := endpoints[pod.IP]; isNode {
+			continue
+		}
+		endpoints[pod.IP] = endpoint{namespace: pod.Namespace, team: pod.Team(), zone: zones[pod.NodeName]}
+	}
+	return endpoints
+}
+
+// Costs returns data transfer cost per namespace and team, most expensive first
+func (t *Tracker) Costs() []models.NetworkCost {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	hours := float64(t.last-t.first) / 3600
+	costs := make([]models.NetworkCost, 0, len(t.costs))
+	for _, cost := range t.costs {
+		c := *cost
+		if hours > 0 {
+			c.CostPerHr = c.TotalCost / hours
+		}
+		costs = append(costs, c)
+	}
+	sort.Slice(costs, func(i, j int) bool {
+		if costs[i].TotalCost != costs[j].TotalCost {
+			return costs[i].TotalCost > costs[j].TotalCost
+		}
+		return costs[i].Namespace+costs[i].Team < costs[j].Namespace+costs[j].Team
+	})
+	return costs
+}
+
+// NamespaceCostPerHr returns the hourly data transfer cost of each namespace
+func (t *Tracker) NamespaceCostPerHr() map[string]float64 {
+	byNamespace := make(map[string]float64)
+	for _, cost := range t.Costs() {
+		byNamespace[cost.Namespace] += cost.CostPerHr
+	}
+	return byNamespace
+}
@@ -0,0 +1,277 @@
+// Package notify sits between the loops that raise alerts and Teams: it
+// batches alerts into one digest per channel, holds non-critical alerts
+// through each channel's quiet hours, and sends daily and weekly summaries.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cost-detector/pkg/alerts"
+	"cost-detector/pkg/clock"
+	"cost-detector/pkg/logger"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/teams"
+)
+
+// Preferences are how one channel wants to be notified
+type Preferences struct {
+	Window    time.Duration      // Alerts raised within this long go out as one digest; 0 sends each
+	Quiet     *alerts.QuietHours // Non-critical alerts wait until these end, nil for none
+	Location  *time.Location     // Time zone of Quiet and the summaries
+	Summaries []string           // Summary periods, alerts.SummaryDaily and alerts.SummaryWeekly
+}
+
+// Scheduler batches alerts per channel and sends them as digests to a
+// sender, usually the alert outbox. A channel is a policy route, or the
+// default channel for unrouted alerts.
+type Scheduler struct {
+	Defaults   Preferences    // For the default channel, and routes that don't set their own
+	SummaryAt  time.Duration  // Time of day summaries go out; weekly ones on Mondays
+	Summarizer *Summarizer    // Writes the summaries, nil for none
+	Signer     *alerts.Signer // Adds acknowledge and snooze links to alerts, nil for none
+
+	sender  teams.Sender
+	alerter *alerts.Alerter
+	clock   clock.Clock
+	log     *logger.Logger
+
+	mu         sync.Mutex
+	batches    map[string]*batch
+	summarized map[string]time.Time // Channel and period -> last summary due
+}
+
+// batch is alerts waiting to go to one channel
+type batch struct {
+	route   string
+	webhook string
+	due     time.Time
+	alerts  []*models.CostAlert
+}
+
+// NewScheduler creates a scheduler sending to sender, reading route
+// preferences from the alerter's policy and logging digests it can't hand over
+func NewScheduler(sender teams.Sender, alerter *alerts.Alerter, c clock.Clock, log *logger.Logger) *Scheduler {
+	return &Scheduler{
+		Defaults:   Preferences{Window: time.Minute, Location: time.UTC},
+		SummaryAt:  9 * time.Hour,
+		sender:     sender,
+		alerter:    alerter,
+		clock:      c,
+		log:        log,
+		batches:    make(map[string]*batch),
+		summarized: make(map[string]time.Time),
+	}
+}
+
+// SendAlert adds an alert to its channel's digest. Alerts for a channel
+// without a digest window go straight out, unless its quiet hours hold them.
+func (s *Scheduler) SendAlert(alert *models.CostAlert) error {
+	now := s.clock.Now()
+	ack, silenced := s.alerter.Silenced(alert, now)
+	if silenced {
+		return nil
+	}
+	copied := *alert
+	alert = &copied
+	if ack != nil {
+		// Acknowledged at a lower severity, and got worse
+		alert.Message = strings.TrimSpace(fmt.Sprintf("%s (%s as %s)", alert.Message, ack, ack.Severity))
+	}
+	if s.Signer != nil {
+		alert.Actions = s.Signer.Links(alert, now)
+	}
+
+	prefs := s.Preferences(alert.Route)
+	channel := alert.Route + "|" + alert.WebhookURL
+	due := now.Add(prefs.Window)
+	if prefs.Quiet != nil && alert.Severity != alerts.SeverityCritical && prefs.Quiet.Contains(now.In(prefs.Location)) {
+		// Held batches are kept apart, so a critical alert in the night
+		// doesn't take the held ones with it
+		channel += "|quiet"
+		due = prefs.Quiet.Until(now.In(prefs.Location))
+	} else if prefs.Window <= 0 {
+		return s.sender.SendAlert(alert)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.batches[channel]
+	if !ok {
+		b = &batch{route: alert.Route, webhook: alert.WebhookURL, due: due}
+		s.batches[channel] = b
+	}
+	b.alerts = append(b.alerts, alert)
+	return nil
+}
+
+// Preferences returns a route's preferences, "" for the default channel
+func (s *Scheduler) Preferences(route string) Preferences {
+	prefs := s.Defaults
+	if prefs.Location == nil {
+		prefs.Location = time.UTC
+	}
+	r, ok := s.alerter.Policy().Routes[route]
+	if route == "" || !ok {
+		return prefs
+	}
+	// Validated when the policy was loaded
+	prefs.Summaries = r.Summaries
+	if window, err := time.ParseDuration(r.DigestWindow); err == nil {
+		prefs.Window = window
+	}
+	if quiet, err := alerts.ParseQuietHours(r.QuietHours); err == nil {
+		prefs.Quiet = quiet
+	}
+	if location, err := time.LoadLocation(r.Timezone); err == nil && r.Timezone != "" {
+		prefs.Location = location
+	}
+	return prefs
+}
+
+// Pending returns how many alerts are waiting for their digest
+func (s *Scheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := 0
+	for _, b := range s.batches {
+		pending += len(b.alerts)
+	}
+	return pending
+}
+
+// Run sends digests and summaries as they fall due until ctx is done
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.Tick()
+	}
+}
+
+// Tick sends the digests and summaries due by now and returns how many
+// messages went out
+func (s *Scheduler) Tick() int {
+	now := s.clock.Now()
+	sent := s.flush(func(b *batch) bool { return !b.due.After(now) })
+	for _, alert := range s.summaries(now) {
+		s.send(alert)
+		sent++
+	}
+	return sent
+}
+
+// Flush sends every waiting alert now, quiet hours or not, e.g. on
+// shutdown, and returns how many messages went out
+func (s *Scheduler) Flush() int {
+	return s.flush(func(*batch) bool { return true })
+}
+
+// flush sends the batches that are ready, one digest per channel
+func (s *Scheduler) flush(ready func(*batch) bool) int {
+	s.mu.Lock()
+	channels := make(map[string]*batch)
+	for key, b := range s.batches {
+		if !ready(b) {
+			continue
+		}
+		delete(s.batches, key)
+		channel := b.route + "|" + b.webhook
+		if merged, ok := channels[channel]; ok {
+			merged.alerts = append(merged.alerts, b.alerts...)
+		} else {
+			channels[channel] = b
+		}
+	}
+	s.mu.Unlock()
+
+	keys := make([]string, 0, len(channels))
+	for key := range channels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.send(Digest(channels[key].alerts))
+	}
+	return len(keys)
+}
+
+// send hands a digest or summary to the sender, logging failures since no
+// loop is waiting on them
+func (s *Scheduler) send(alert *models.CostAlert) {
+	if err := s.sender.SendAlert(alert); err != nil {
+		s.log.Error("Sending alert failed", "route", alert.Route, "service", alert.Service, "error", err)
+	}
+}
+
+// Digest combines a channel's alerts into one, most severe and expensive
+// first, with each alert's action links on its line. A single alert is
+// returned as it is.
+func Digest(batch []*models.CostAlert) *models.CostAlert {
+	if len(batch) == 1 {
+		return batch[0]
+	}
+	sorted := append([]*models.CostAlert{}, batch...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if rank(a.Severity) != rank(b.Severity) {
+			return rank(a.Severity) > rank(b.Severity)
+		}
+		return a.CostPerHr > b.CostPerHr
+	})
+
+	digest := &models.CostAlert{
+		Team:       sorted[0].Team,
+		Service:    fmt.Sprintf("%d alerts", len(sorted)),
+		Severity:   sorted[0].Severity,
+		Route:      sorted[0].Route,
+		WebhookURL: sorted[0].WebhookURL,
+	}
+	lines := make([]string, 0, len(sorted))
+	for _, alert := range sorted {
+		if alert.Team != digest.Team {
+			digest.Team = ""
+		}
+		digest.CostPerHr = math.Max(digest.CostPerHr, alert.CostPerHr) // Alerts overlap, e.g. a pod and its namespace
+		line := fmt.Sprintf("- [%s] %s $%.2f/hr", alert.Severity, alert.Service, alert.CostPerHr)
+		if alert.Team != "" {
+			line += " (" + alert.Team + ")"
+		}
+		if alert.Message != "" {
+			line += ": " + alert.Message
+		}
+		for i, action := range alert.Actions {
+			separator := " · "
+			if i == 0 {
+				separator = " "
+			}
+			line += separator + "[" + action.Title + "](" + action.URL + ")"
+		}
+		lines = append(lines, line)
+	}
+	digest.Message = strings.Join(lines, "\n")
+	return digest
+}
+
+// rank orders severities for digests, unknown ones lowest
+func rank(severity string) int {
+	switch severity {
+	case alerts.SeverityCritical:
+		return 3
+	case alerts.SeverityWarning:
+		return 2
+	case alerts.SeverityInfo:
+		return 1
+	}
+	return 0
+}
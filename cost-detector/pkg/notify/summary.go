@@ -0,0 +1,226 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cost-detector/pkg/alerts"
+	"cost-detector/pkg/index"
+	"cost-detector/pkg/ledger"
+	"cost-detector/pkg/models"
+)
+
+// Scope limits a summary to the namespaces and teams whose budgets route
+// to a channel; an empty scope is the whole cluster
+type Scope struct {
+	Namespaces map[string]bool
+	Teams      map[string]bool
+}
+
+// Empty reports whether the scope covers the whole cluster
+func (s Scope) Empty() bool {
+	return len(s.Namespaces) == 0 && len(s.Teams) == 0
+}
+
+// RouteScope returns the namespaces and teams a policy routes to route.
+// The default channel and the default route cover the whole cluster.
+func RouteScope(policy *alerts.Policy, route string) Scope {
+	scope := Scope{Namespaces: make(map[string]bool), Teams: make(map[string]bool)}
+	if route == "" || route == policy.Defaults.Route {
+		return scope
+	}
+	for name, budget := range policy.Namespaces {
+		if budget.Route == route {
+			scope.Namespaces[name] = true
+		}
+	}
+	for name, budget := range policy.Teams {
+		if budget.Route == route {
+			scope.Teams[name] = true
+		}
+	}
+	return scope
+}
+
+// Summarizer writes summary digests: current top spenders from the cost
+// index, and what changed over the period from the cost ledger
+type Summarizer struct {
+	Top int // Spenders and changes listed
+
+	index  *index.Index
+	ledger *ledger.Ledger
+}
+
+// NewSummarizer creates a summarizer reading idx and costLedger
+func NewSummarizer(idx *index.Index, costLedger *ledger.Ledger) *Summarizer {
+	return &Summarizer{Top: 5, index: idx, ledger: costLedger}
+}
+
+// Summary writes a period's summary for a scope, comparing the ledger
+// at from and to
+func (s *Summarizer) Summary(period string, scope Scope, from time.Time, to time.Time) *models.CostAlert {
+	namespaces, _ := s.index.Summaries(index.ByNamespace)
+	teams, _ := s.index.Summaries(index.ByTeam)
+	total := s.index.Cluster().CostPerHr
+	if !scope.Empty() {
+		namespaces = filter(namespaces, scope.Namespaces)
+		teams = filter(teams, scope.Teams)
+		// Namespaces, or teams when only teams route here, so nothing is counted twice
+		total = 0
+		scoped := namespaces
+		if len(scope.Namespaces) == 0 {
+			scoped = teams
+		}
+		for _, summary := range scoped {
+			total += summary.CostPerHr
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s cost summary, %s to %s\n", strings.ToUpper(period[:1])+period[1:],
+		from.Format("Mon Jan 2 15:04"), to.Format("Mon Jan 2 15:04 MST"))
+	fmt.Fprintf(&b, "Now: $%.2f/hr ($%.0f/month)\n", total, total*models.HoursPerMonth)
+	s.writeTop(&b, "Top namespaces", namespaces)
+	s.writeTop(&b, "Top teams", teams)
+
+	diff, err := s.ledger.Diff(from, to)
+	if err != nil {
+		fmt.Fprintf(&b, "No changes to report: %v\n", err)
+	} else {
+		var changes []ledger.Change
+		for _, c := range diff.Changes {
+			if len(scope.Namespaces) == 0 && len(scope.Teams) > 0 {
+				break // The ledger keeps workloads by namespace, not team
+			}
+			if len(scope.Namespaces) == 0 || scope.Namespaces[c.Namespace] {
+				changes = append(changes, c)
+			}
+		}
+		if len(changes) > 0 {
+			b.WriteString("Biggest changes:\n")
+		}
+		for i, c := range changes {
+			if i == s.Top {
+				fmt.Fprintf(&b, "  ...and %d more\n", len(changes)-s.Top)
+				break
+			}
+			fmt.Fprintf(&b, "  %s/%s %s: $%.2f → $%.2f/hr (%s/month)\n", c.Namespace, c.Name, c.Change,
+				c.FromCostPerHr, c.ToCostPerHr, ledger.Signed(c.DeltaPerMonth, 0))
+		}
+	}
+
+	return &models.CostAlert{
+		Service:   period + " summary",
+		Kind:      models.AlertSummary,
+		CostPerHr: total,
+		Message:   strings.TrimSuffix(b.String(), "\n"),
+		Severity:  alerts.SeverityInfo,
+	}
+}
+
+// writeTop lists the most expensive groups
+func (s *Summarizer) writeTop(b *strings.Builder, title string, summaries []models.CostSummary) {
+	if len(summaries) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s:\n", title)
+	for i, summary := range summaries {
+		if i == s.Top {
+			break
+		}
+		fmt.Fprintf(b, "  %d. %s $%.2f/hr (%d pods)\n", i+1, summary.Name, summary.CostPerHr, summary.Pods)
+	}
+}
+
+// summaries returns the summaries due by now, once per channel and period.
+// A period's first occurrence after startup is only noted, so a restart
+// doesn't repeat the last summary.
+func (s *Scheduler) summaries(now time.Time) []*models.CostAlert {
+	if s.Summarizer == nil {
+		return nil
+	}
+	policy := s.alerter.Policy()
+	routes := []string{""}
+	for _, name := range sortedRoutes(policy) {
+		routes = append(routes, name)
+	}
+
+	var due []*models.CostAlert
+	for _, route := range routes {
+		prefs := s.Preferences(route)
+		for _, period := range prefs.Summaries {
+			at, previous := occurrence(period, now.In(prefs.Location), s.SummaryAt)
+			key := route + "|" + period
+			s.mu.Lock()
+			last, seen := s.summarized[key]
+			s.summarized[key] = at
+			s.mu.Unlock()
+			if !seen || !at.After(last) {
+				continue
+			}
+			summary := s.Summarizer.Summary(period, RouteScope(policy, route), previous, at)
+			summary.Message += acknowledged(s.alerter.Acks(now), route, policy)
+			if r, ok := policy.Routes[route]; ok {
+				summary.Route = route
+				summary.WebhookURL = r.Webhook()
+			}
+			due = append(due, summary)
+		}
+	}
+	return due
+}
+
+// acknowledged lists the acks of a channel's alerts for a summary; the
+// default channel and route list them all
+func acknowledged(acks []alerts.Ack, route string, policy *alerts.Policy) string {
+	var b strings.Builder
+	for _, ack := range acks {
+		if route != "" && route != policy.Defaults.Route && ack.Route != route {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("\nAcknowledged and snoozed:")
+		}
+		fmt.Fprintf(&b, "\n  %s %s", ack.Service, ack)
+	}
+	return b.String()
+}
+
+// occurrence returns the latest time a period's summary was due at or
+// before now, and the one before it
+func occurrence(period string, now time.Time, at time.Duration) (time.Time, time.Time) {
+	t := alerts.AtTimeOfDay(now, at)
+	if t.After(now) {
+		t = alerts.AtTimeOfDay(now.AddDate(0, 0, -1), at)
+	}
+	if period == alerts.SummaryWeekly {
+		for t.Weekday() != time.Monday {
+			t = alerts.AtTimeOfDay(t.AddDate(0, 0, -1), at)
+		}
+		return t, alerts.AtTimeOfDay(t.AddDate(0, 0, -7), at)
+	}
+	return t, alerts.AtTimeOfDay(t.AddDate(0, 0, -1), at)
+}
+
+// filter keeps the summaries named in names
+func filter(summaries []models.CostSummary, names map[string]bool) []models.CostSummary {
+	var kept []models.CostSummary
+	for _, summary := range summaries {
+		if names[summary.Name] {
+			kept = append(kept, summary)
+		}
+	}
+	return kept
+}
+
+// sortedRoutes returns a policy's route names in order
+func sortedRoutes(policy *alerts.Policy) []string {
+	names := make([]string, 0, len(policy.Routes))
+	for name := range policy.Routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
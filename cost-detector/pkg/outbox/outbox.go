@@ -0,0 +1,385 @@
+// Package outbox keeps alerts on disk until Teams has taken them. Alerts
+// are written before delivery, retried with backoff (across restarts), and
+// moved to a dead-letter directory after too many failures.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cost-detector/pkg/logger"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/teams"
+)
+
+// Directories under the outbox directory
+const (
+	PendingDir = "pending"
+	DeadDir    = "dead"
+)
+
+// ErrClosed is returned for alerts sent after Drain
+var ErrClosed = errors.New("outbox is draining")
+
+// Entry is one alert in the outbox
+type Entry struct {
+	ID          string            `json:"id"`
+	Alert       *models.CostAlert `json:"alert"`
+	Created     time.Time         `json:"created"`
+	Attempts    int               `json:"attempts"`
+	NextAttempt time.Time         `json:"nextAttempt"`
+	LastError   string            `json:"lastError,omitempty"`
+}
+
+// channel names the route an entry's alert goes to, for logs
+func (e *Entry) channel() string {
+	if e.Alert == nil || e.Alert.Route == "" {
+		return "default"
+	}
+	return e.Alert.Route
+}
+
+// Outbox delivers alerts to a sender in the background, in the order they
+// were sent, retrying failures without holding up later alerts. With a
+// directory, undelivered alerts survive restarts; without one they are kept
+// in memory.
+type Outbox struct {
+	Dir         string
+	MaxAttempts int           // Failures before an alert is dead-lettered
+	Backoff     time.Duration // Wait after the first failure; it doubles with each one
+	MaxBackoff  time.Duration
+
+	// Gate, when set, decides whether alerts are accepted at all; with
+	// leader election only the leader's alerts go out
+	Gate func() bool
+
+	sender  teams.Sender
+	log     *logger.Logger
+	mu      sync.Mutex
+	pending []*Entry // Oldest first
+	left    int      // Failed while draining, kept for the next run
+	seq     int
+	closed  bool
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+// Open creates an outbox delivering to sender, picking up the alerts a
+// previous run left in dir. An empty dir keeps the outbox in memory.
+// Failed deliveries and dead-lettered alerts are logged to log.
+func Open(dir string, sender teams.Sender, log *logger.Logger) (*Outbox, error) {
+	o := &Outbox{
+		Dir:         dir,
+		MaxAttempts: 10,
+		Backoff:     10 * time.Second,
+		MaxBackoff:  30 * time.Minute,
+		sender:      sender,
+		log:         log,
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	if dir != "" {
+		for _, sub := range []string{PendingDir, DeadDir} {
+			if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+				return nil, err
+			}
+		}
+		pending, err := List(dir, PendingDir)
+		if err != nil {
+			return nil, err
+		}
+		for i := range pending {
+			o.pending = append(o.pending, &pending[i])
+		}
+	}
+	return o, nil
+}
+
+// Start delivers alerts in the background until Drain
+func (o *Outbox) Start() {
+	go o.run()
+}
+
+// SendAlert writes an alert to the outbox for delivery. It fails only when
+// the alert can't be written or the outbox is draining.
+func (o *Outbox) SendAlert(alert *models.CostAlert) error {
+	if o.Gate != nil && !o.Gate() {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return ErrClosed
+	}
+	now := time.Now()
+	o.seq++
+	entry := &Entry{
+		ID:          fmt.Sprintf("%s-%06d", now.UTC().Format("20060102T150405.000000000"), o.seq),
+		Alert:       alert,
+		Created:     now,
+		NextAttempt: now,
+	}
+	if err := o.save(PendingDir, entry); err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	o.pending = append(o.pending, entry)
+	o.signal()
+	return nil
+}
+
+// Pending returns how many alerts are waiting to be delivered
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.pending)
+}
+
+// Drain stops accepting alerts and keeps delivering until the outbox is
+// empty or ctx is done; the outbox must have been started. It returns how
+// many alerts were left, which stay on disk for the next run when the
+// outbox has a directory.
+func (o *Outbox) Drain(ctx context.Context) (int, error) {
+	o.mu.Lock()
+	o.closed = true
+	o.signal()
+	o.mu.Unlock()
+
+	select {
+	case <-o.done:
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if o.left > 0 {
+			return o.left, errors.New("delivery failed")
+		}
+		return 0, nil
+	case <-ctx.Done():
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		return len(o.pending) + o.left, ctx.Err()
+	}
+}
+
+// signal wakes the delivery loop; o.mu is held
+func (o *Outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers alerts as they come due, until drained and empty
+func (o *Outbox) run() {
+	defer close(o.done)
+	for {
+		o.mu.Lock()
+		if o.closed && len(o.pending) == 0 {
+			o.mu.Unlock()
+			return
+		}
+		// The alert due first; one waiting out a retry doesn't hold up the rest
+		var next *Entry
+		for _, entry := range o.pending {
+			if next == nil || entry.NextAttempt.Before(next.NextAttempt) {
+				next = entry
+			}
+		}
+		closed := o.closed
+		o.mu.Unlock()
+
+		if next == nil {
+			<-o.wake
+			continue
+		}
+		// While draining, retries don't wait out their backoff
+		if wait := time.Until(next.NextAttempt); wait > 0 && !closed {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-o.wake:
+			}
+			timer.Stop()
+			continue
+		}
+		o.deliver(next, closed)
+	}
+}
+
+// deliver sends an alert once, then removes it, schedules a retry or
+// dead-letters it
+func (o *Outbox) deliver(entry *Entry, draining bool) {
+	err := o.sender.SendAlert(entry.Alert)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err == nil {
+		o.remove(PendingDir, entry)
+		o.drop(entry)
+		return
+	}
+	entry.Attempts++
+	entry.LastError = err.Error()
+	log := o.log.With("channel", entry.channel(), "id", entry.ID, "service", entry.Alert.Service, "attempt", entry.Attempts)
+	if entry.Attempts >= o.MaxAttempts {
+		o.drop(entry)
+		if err := o.save(DeadDir, entry); err != nil {
+			// Still pending on disk, so the next run tries again
+			log.Error("Moving alert to the dead-letter queue failed", "error", err, "lastError", entry.LastError)
+		} else {
+			o.remove(PendingDir, entry)
+			log.Error("Alert moved to the dead-letter queue", "error", entry.LastError)
+		}
+		return
+	}
+	if draining {
+		// Leave it for the next run rather than retrying in a loop
+		log.Warning("Alert delivery failed, leaving it for the next run", "error", entry.LastError)
+		o.drop(entry)
+		o.left++
+		o.saveLogged(log, entry)
+		return
+	}
+	backoff := o.Backoff << (entry.Attempts - 1)
+	if backoff > o.MaxBackoff || backoff <= 0 {
+		backoff = o.MaxBackoff
+	}
+	entry.NextAttempt = time.Now().Add(backoff)
+	log.Warning("Alert delivery failed, retrying", "error", entry.LastError, "retryIn", backoff.String())
+	o.saveLogged(log, entry)
+}
+
+// saveLogged saves a pending entry, logging a failure: it's still retried
+// from memory, only not after a restart
+func (o *Outbox) saveLogged(log *logger.Logger, entry *Entry) {
+	if err := o.save(PendingDir, entry); err != nil {
+		log.Error("Saving alert to the outbox failed", "error", err)
+	}
+}
+
+// drop takes an entry off the pending list; o.mu is held
+func (o *Outbox) drop(entry *Entry) {
+	for i, e := range o.pending {
+		if e == entry {
+			o.pending = append(o.pending[:i], o.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// save writes an entry to a subdirectory, replacing it atomically
+func (o *Outbox) save(sub string, entry *Entry) error {
+	if o.Dir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(o.Dir, sub, entry.ID+".json")
+	// Private: routed alerts carry their webhook URL
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// remove deletes an entry's file from a subdirectory
+func (o *Outbox) remove(sub string, entry *Entry) {
+	if o.Dir == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(o.Dir, sub, entry.ID+".json")); err != nil && !os.IsNotExist(err) {
+		o.log.Error("Removing alert from the outbox failed", "channel", entry.channel(), "id", entry.ID, "dir", sub, "error", err)
+	}
+}
+
+// List reads the entries in an outbox subdirectory, oldest first
+func List(dir string, sub string) ([]Entry, error) {
+	files, err := os.ReadDir(filepath.Join(dir, sub))
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, sub, file.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil || entry.Alert == nil {
+			return nil, fmt.Errorf("%s: not an outbox entry: %v", path, err)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+// Redeliver sends dead-lettered alerts again, removing each one that is
+// delivered. ids limits it to those entries; none means all of them.
+func Redeliver(dir string, ids []string, sender teams.Sender) (delivered []Entry, failed []Entry, err error) {
+	entries, err := Select(dir, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		if err := sender.SendAlert(entry.Alert); err != nil {
+			entry.Attempts++
+			entry.LastError = err.Error()
+			failed = append(failed, entry)
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, DeadDir, entry.ID+".json")); err != nil {
+			return delivered, failed, err
+		}
+		delivered = append(delivered, entry)
+	}
+	return delivered, failed, nil
+}
+
+// Discard deletes dead-lettered alerts. ids limits it to those entries;
+// none means all of them.
+func Discard(dir string, ids []string) ([]Entry, error) {
+	entries, err := Select(dir, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		if err := os.Remove(filepath.Join(dir, DeadDir, entry.ID+".json")); err != nil {
+			return entries[:i], err
+		}
+	}
+	return entries, nil
+}
+
+// Select returns the dead-lettered entries with the given IDs, or all of them
+func Select(dir string, ids []string) ([]Entry, error) {
+	entries, err := List(dir, DeadDir)
+	if err != nil || len(ids) == 0 {
+		return entries, err
+	}
+	byID := make(map[string]Entry, len(entries))
+	for _, entry := range entries {
+		byID[entry.ID] = entry
+	}
+	selected := make([]Entry, 0, len(ids))
+	for _, id := range ids {
+		entry, ok := byID[strings.TrimSuffix(id, ".json")]
+		if !ok {
+			return nil, fmt.Errorf("no dead-lettered alert %s in %s", id, filepath.Join(dir, DeadDir))
+		}
+		selected = append(selected, entry)
+	}
+	return selected, nil
+}
@@ -0,0 +1,158 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+var errCorrupt = errors.New("parquet: corrupt page")
+
+// bitWidth is the bits needed for values up to max
+func bitWidth(max int) int {
+	return bits.Len(uint(max))
+}
+
+// decodeHybrid reads count values of the RLE/bit-packing hybrid encoding
+// used for levels and dictionary indices
+func decodeHybrid(buf []byte, width int, count int) ([]int, error) {
+	if width > 32 {
+		return nil, errCorrupt
+	}
+	values := make([]int, 0, count)
+	pos := 0
+	for len(values) < count {
+		header, n := binary.Uvarint(buf[pos:])
+		if n <= 0 {
+			return nil, errCorrupt
+		}
+		pos += n
+		if header&1 == 0 {
+			// RLE run: one value, little endian in the fewest whole bytes
+			run := int(header >> 1)
+			size := (width + 7) / 8
+			if pos+size > len(buf) || run > count-len(values) {
+				return nil, errCorrupt
+			}
+			v := 0
+			for i := size - 1; i >= 0; i-- {
+				v = v<<8 | int(buf[pos+i])
+			}
+			pos += size
+			for i := 0; i < run; i++ {
+				values = append(values, v)
+			}
+			continue
+		}
+		// Bit-packed groups of eight values, least significant bit first
+		groups := int(header >> 1)
+		size := groups * width
+		if groups > count || pos+size > len(buf) {
+			return nil, errCorrupt
+		}
+		packed := buf[pos : pos+size]
+		pos += size
+		for i := 0; i < groups*8 && len(values) < count; i++ {
+			v := 0
+			for b := 0; b < width; b++ {
+				bit := i*width + b
+				v |= int(packed[bit/8]>>(bit%8)&1) << b
+			}
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// decodeLevels reads repetition or definition levels of a v1 data page,
+// prefixed by their length, and returns them with the rest of the page
+func decodeLevels(buf []byte, max int, count int) ([]int, []byte, error) {
+	if max == 0 {
+		return make([]int, count), buf, nil
+	}
+	if len(buf) < 4 {
+		return nil, nil, errCorrupt
+	}
+	size := int(binary.LittleEndian.Uint32(buf))
+	if size < 0 || 4+size > len(buf) {
+		return nil, nil, errCorrupt
+	}
+	levels, err := decodeHybrid(buf[4:4+size], bitWidth(max), count)
+	return levels, buf[4+size:], err
+}
+
+// decodePlain reads count PLAIN encoded values of a physical type
+func decodePlain(buf []byte, typ int, typeLength int, count int) ([]interface{}, error) {
+	values := make([]interface{}, count)
+	pos := 0
+	need := func(n int) error {
+		if n < 0 || pos+n > len(buf) {
+			return errCorrupt
+		}
+		return nil
+	}
+	for i := range values {
+		switch typ {
+		case typeBoolean:
+			if i/8 >= len(buf) {
+				return nil, errCorrupt
+			}
+			values[i] = buf[i/8]>>(i%8)&1 == 1
+		case typeInt32:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			values[i] = int64(int32(binary.LittleEndian.Uint32(buf[pos:])))
+			pos += 4
+		case typeInt64:
+			if err := need(8); err != nil {
+				return nil, err
+			}
+			values[i] = int64(binary.LittleEndian.Uint64(buf[pos:]))
+			pos += 8
+		case typeInt96:
+			if err := need(12); err != nil {
+				return nil, err
+			}
+			values[i] = int96(buf[pos : pos+12])
+			pos += 12
+		case typeFloat:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[pos:])))
+			pos += 4
+		case typeDouble:
+			if err := need(8); err != nil {
+				return nil, err
+			}
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(buf[pos:]))
+			pos += 8
+		case typeByteArray:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			n := int(binary.LittleEndian.Uint32(buf[pos:]))
+			pos += 4
+			if err := need(n); err != nil {
+				return nil, err
+			}
+			values[i] = buf[pos : pos+n]
+			pos += n
+		case typeFixedLenByteArray:
+			if err := need(typeLength); err != nil {
+				return nil, err
+			}
+			values[i] = buf[pos : pos+typeLength]
+			pos += typeLength
+		default:
+			return nil, fmt.Errorf("parquet: unknown physical type %d", typ)
+		}
+	}
+	return values, nil
+}
+
+// int96 is a legacy timestamp: nanoseconds into the day, then the Julian day
+type int96 []byte
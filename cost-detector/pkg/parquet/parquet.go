@@ -0,0 +1,458 @@
+// Package parquet reads the columns of Apache Parquet files, enough for
+// Cost and Usage Report exports: flat and nested schemas, v1 and v2 data
+// pages, PLAIN and dictionary encodings, and uncompressed, Snappy or gzip
+// pages. Values come out as string, int64, float64, bool or time.Time.
+// Other encodings and codecs (ZSTD, LZ4, Brotli, DELTA_*) are reported as
+// unsupported rather than read wrong.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Physical types
+const (
+	typeBoolean = iota
+	typeInt32
+	typeInt64
+	typeInt96
+	typeFloat
+	typeDouble
+	typeByteArray
+	typeFixedLenByteArray
+)
+
+// Repetition of a schema field
+const (
+	fieldRequired = 0
+	fieldOptional = 1
+	fieldRepeated = 2
+)
+
+// Page types
+const (
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+// Encodings
+const (
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingRLE             = 3
+	encodingRLEDictionary   = 8
+)
+
+// Compression codecs
+var codecs = []string{"UNCOMPRESSED", "SNAPPY", "GZIP", "LZO", "BROTLI", "LZ4", "ZSTD", "LZ4_RAW"}
+
+const magic = "PAR1"
+
+// Column is a leaf column of the schema
+type Column struct {
+	Path          []string // Field names from the top level down, e.g. ["resource_tags", "key_value", "key"]
+	MaxRepetition int      // Repeated fields on the path; 0 for a flat column
+	MaxDefinition int      // Optional and repeated fields on the path
+
+	index      int
+	typ        int
+	typeLength int
+	convert    func(interface{}) interface{}
+}
+
+// Name is the column's path joined with dots
+func (c *Column) Name() string {
+	return strings.Join(c.Path, ".")
+}
+
+// Values are one column of a row group: a repetition and definition level
+// per entry, and the value, nil where the definition level is below the
+// column's maximum (a null, or an empty list or map)
+type Values struct {
+	Repetition []int // 0 starts a new row
+	Definition []int
+	Values     []interface{}
+}
+
+// File is an open Parquet file
+type File struct {
+	r       io.ReaderAt
+	size    int64
+	columns []*Column
+	groups  []tstruct
+	rows    int64
+}
+
+// Open reads a Parquet file's footer: its schema and row groups
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	if size < int64(2*len(magic)+4) {
+		return nil, errors.New("parquet: file too small")
+	}
+	tail := make([]byte, 4+len(magic))
+	if _, err := r.ReadAt(tail, size-int64(len(tail))); err != nil {
+		return nil, err
+	}
+	head := make([]byte, len(magic))
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	if string(head) != magic || string(tail[4:]) != magic {
+		return nil, errors.New("parquet: not a Parquet file")
+	}
+	footer := int64(binary.LittleEndian.Uint32(tail))
+	if footer > size-int64(len(magic)+len(tail)) {
+		return nil, errors.New("parquet: footer length past the start of the file")
+	}
+	buf := make([]byte, footer)
+	if _, err := r.ReadAt(buf, size-int64(len(tail))-footer); err != nil {
+		return nil, err
+	}
+	meta, err := (&thriftReader{buf: buf}).readStruct()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{r: r, size: size, rows: meta.int(3)}
+	var elements []tstruct
+	for _, e := range meta.list(2) {
+		element, ok := e.(tstruct)
+		if !ok {
+			return nil, errors.New("parquet: bad schema")
+		}
+		elements = append(elements, element)
+	}
+	if len(elements) == 0 {
+		return nil, errors.New("parquet: empty schema")
+	}
+	next := 1
+	if err := f.addColumns(elements, &next, int(elements[0].int(5)), nil, 0, 0); err != nil {
+		return nil, err
+	}
+	for _, g := range meta.list(4) {
+		group, ok := g.(tstruct)
+		if !ok || len(group.list(1)) != len(f.columns) {
+			return nil, errors.New("parquet: row group doesn't match the schema")
+		}
+		f.groups = append(f.groups, group)
+	}
+	return f, nil
+}
+
+// addColumns walks count schema elements from *next, which lists the
+// schema tree depth first, adding the leaves as columns
+func (f *File) addColumns(elements []tstruct, next *int, count int, path []string, rep int, def int) error {
+	if len(path) > maxDepth {
+		return errors.New("parquet: schema nested too deeply")
+	}
+	for i := 0; i < count; i++ {
+		if *next >= len(elements) {
+			return errors.New("parquet: schema ends early")
+		}
+		element := elements[*next]
+		*next++
+		r, d := rep, def
+		switch element.int(3) {
+		case fieldOptional:
+			d++
+		case fieldRepeated:
+			r, d = r+1, d+1
+		}
+		fieldPath := append(append([]string(nil), path...), element.string(4))
+		if children := int(element.int(5)); children > 0 {
+			if err := f.addColumns(elements, next, children, fieldPath, r, d); err != nil {
+				return err
+			}
+			continue
+		}
+		f.columns = append(f.columns, &Column{
+			Path: fieldPath, MaxRepetition: r, MaxDefinition: d,
+			index: len(f.columns), typ: int(element.int(1)), typeLength: int(element.int(2)), convert: converter(element),
+		})
+	}
+	return nil
+}
+
+// Columns returns the leaf columns in file order
+func (f *File) Columns() []*Column {
+	return f.columns
+}
+
+// RowGroups returns how many row groups the file has
+func (f *File) RowGroups() int {
+	return len(f.groups)
+}
+
+// NumRows returns how many rows the file has
+func (f *File) NumRows() int64 {
+	return f.rows
+}
+
+// ReadColumn reads one column of a row group
+func (f *File) ReadColumn(group int, c *Column) (*Values, error) {
+	chunk, _ := f.groups[group].list(1)[c.index].(tstruct)
+	if chunk.string(1) != "" {
+		return nil, fmt.Errorf("parquet: %s: columns in other files are not supported", c.Name())
+	}
+	meta := chunk.strct(3)
+	codec, count, size := meta.int(4), meta.int(5), meta.int(7)
+	start := meta.int(9)
+	if dict := meta.int(11); meta.has(11) && dict > 0 && dict < start {
+		start = dict
+	}
+	if start < 0 || size < 0 || start+size > f.size {
+		return nil, fmt.Errorf("parquet: %s: column chunk outside the file", c.Name())
+	}
+	buf := make([]byte, size)
+	if _, err := f.r.ReadAt(buf, start); err != nil {
+		return nil, err
+	}
+
+	values := &Values{}
+	var dictionary []interface{}
+	for pos := 0; int64(len(values.Definition)) < count && pos < len(buf); {
+		tr := &thriftReader{buf: buf, pos: pos}
+		header, err := tr.readStruct()
+		if err != nil {
+			return nil, fmt.Errorf("parquet: %s: %w", c.Name(), err)
+		}
+		pos = tr.pos
+		compressed, uncompressed := int(header.int(3)), int(header.int(2))
+		if compressed < 0 || pos+compressed > len(buf) {
+			return nil, fmt.Errorf("parquet: %s: page past the end of the column", c.Name())
+		}
+		page := buf[pos : pos+compressed]
+		pos += compressed
+
+		switch header.int(1) {
+		case pageDictionary:
+			data, err := decompress(codec, page, uncompressed)
+			if err != nil {
+				return nil, fmt.Errorf("parquet: %s: %w", c.Name(), err)
+			}
+			if dictionary, err = decodePlain(data, c.typ, c.typeLength, int(header.strct(7).int(1))); err != nil {
+				return nil, fmt.Errorf("parquet: %s: dictionary: %w", c.Name(), err)
+			}
+		case pageData:
+			if err := c.readPage(values, header.strct(5), page, codec, uncompressed, dictionary); err != nil {
+				return nil, fmt.Errorf("parquet: %s: %w", c.Name(), err)
+			}
+		case pageDataV2:
+			if err := c.readPageV2(values, header.strct(8), page, codec, uncompressed, dictionary); err != nil {
+				return nil, fmt.Errorf("parquet: %s: %w", c.Name(), err)
+			}
+		}
+	}
+	return values, nil
+}
+
+// readPage reads a v1 data page: levels and values, all compressed together
+func (c *Column) readPage(values *Values, header tstruct, page []byte, codec int64, size int, dictionary []interface{}) error {
+	count := int(header.int(1))
+	data, err := decompress(codec, page, size)
+	if err != nil {
+		return err
+	}
+	for _, level := range []struct {
+		max      int
+		encoding int64
+	}{{c.MaxRepetition, header.int(4)}, {c.MaxDefinition, header.int(3)}} {
+		if level.max > 0 && level.encoding != encodingRLE {
+			return fmt.Errorf("level encoding %d is not supported", level.encoding)
+		}
+	}
+	rep, data, err := decodeLevels(data, c.MaxRepetition, count)
+	if err != nil {
+		return err
+	}
+	def, data, err := decodeLevels(data, c.MaxDefinition, count)
+	if err != nil {
+		return err
+	}
+	return c.addValues(values, rep, def, data, header.int(2), dictionary)
+}
+
+// readPageV2 reads a v2 data page, whose levels are never compressed
+func (c *Column) readPageV2(values *Values, header tstruct, page []byte, codec int64, size int, dictionary []interface{}) error {
+	count := int(header.int(1))
+	repSize, defSize := int(header.int(6)), int(header.int(5))
+	if repSize < 0 || defSize < 0 || repSize+defSize > len(page) {
+		return errCorrupt
+	}
+	levels := func(buf []byte, max int) ([]int, error) {
+		if max == 0 {
+			return make([]int, count), nil
+		}
+		return decodeHybrid(buf, bitWidth(max), count)
+	}
+	rep, err := levels(page[:repSize], c.MaxRepetition)
+	if err != nil {
+		return err
+	}
+	def, err := levels(page[repSize:repSize+defSize], c.MaxDefinition)
+	if err != nil {
+		return err
+	}
+	data := page[repSize+defSize:]
+	if header.bool(7, true) {
+		if data, err = decompress(codec, data, size-repSize-defSize); err != nil {
+			return err
+		}
+	}
+	return c.addValues(values, rep, def, data, header.int(4), dictionary)
+}
+
+// addValues decodes a page's values and adds them with their levels
+func (c *Column) addValues(values *Values, rep []int, def []int, data []byte, encoding int64, dictionary []interface{}) error {
+	present := 0
+	for _, d := range def {
+		if d == c.MaxDefinition {
+			present++
+		}
+	}
+	decoded, err := c.decode(data, encoding, present, dictionary)
+	if err != nil {
+		return err
+	}
+	values.Repetition = append(values.Repetition, rep...)
+	values.Definition = append(values.Definition, def...)
+	next := 0
+	for _, d := range def {
+		var value interface{}
+		if d == c.MaxDefinition {
+			value = c.convert(decoded[next])
+			next++
+		}
+		values.Values = append(values.Values, value)
+	}
+	return nil
+}
+
+// decode reads count values in an encoding
+func (c *Column) decode(data []byte, encoding int64, count int, dictionary []interface{}) ([]interface{}, error) {
+	switch encoding {
+	case encodingPlain:
+		return decodePlain(data, c.typ, c.typeLength, count)
+	case encodingPlainDictionary, encodingRLEDictionary:
+		if count == 0 {
+			return nil, nil
+		}
+		if dictionary == nil {
+			return nil, errors.New("dictionary encoded page without a dictionary")
+		}
+		if len(data) == 0 {
+			return nil, errCorrupt
+		}
+		indices, err := decodeHybrid(data[1:], int(data[0]), count)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, count)
+		for i, index := range indices {
+			if index >= len(dictionary) {
+				return nil, errCorrupt
+			}
+			values[i] = dictionary[index]
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("encoding %d is not supported", encoding)
+	}
+}
+
+// decompress expands a page compressed with a codec to its size
+func decompress(codec int64, data []byte, size int) ([]byte, error) {
+	switch codec {
+	case 0:
+		return data, nil
+	case 1:
+		return snappyDecode(data)
+	case 2:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		return io.ReadAll(io.LimitReader(gz, int64(size)))
+	default:
+		name := fmt.Sprint(codec)
+		if codec > 0 && codec < int64(len(codecs)) {
+			name = codecs[codec]
+		}
+		return nil, fmt.Errorf("%s compression is not supported", name)
+	}
+}
+
+// converter turns decoded values into what their logical type means:
+// strings, timestamps, dates and decimals
+func converter(element tstruct) func(interface{}) interface{} {
+	logical, converted := element.strct(10), element.int(6)
+	hasConverted := element.has(6)
+	switch {
+	case logical.has(5) || (hasConverted && converted == 5): // DECIMAL
+		scale := element.int(7)
+		if logical.has(5) {
+			scale = logical.strct(5).int(1)
+		}
+		divisor := math.Pow10(int(scale))
+		return func(v interface{}) interface{} {
+			switch v := v.(type) {
+			case int64:
+				return float64(v) / divisor
+			case []byte:
+				n := new(big.Int).SetBytes(v)
+				if len(v) > 0 && v[0]&0x80 != 0 { // Two's complement
+					n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(v)*8)))
+				}
+				f, _ := new(big.Float).SetInt(n).Float64()
+				return f / divisor
+			}
+			return v
+		}
+	case logical.has(8) || (hasConverted && (converted == 9 || converted == 10)): // TIMESTAMP
+		unit := time.Millisecond
+		if timestamp := logical.strct(8); timestamp != nil {
+			switch u := timestamp.strct(2); {
+			case u.has(2):
+				unit = time.Microsecond
+			case u.has(3):
+				unit = time.Nanosecond
+			}
+		} else if converted == 10 {
+			unit = time.Microsecond
+		}
+		return func(v interface{}) interface{} {
+			if n, ok := v.(int64); ok {
+				return time.Unix(0, 0).Add(time.Duration(n) * unit).UTC()
+			}
+			return v
+		}
+	case logical.has(6) || (hasConverted && converted == 6): // DATE
+		return func(v interface{}) interface{} {
+			if days, ok := v.(int64); ok {
+				return time.Unix(days*86400, 0).UTC()
+			}
+			return v
+		}
+	}
+	return func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case []byte:
+			return string(v)
+		case int96:
+			nanos := int64(binary.LittleEndian.Uint64(v))
+			day := int64(binary.LittleEndian.Uint32(v[8:]))
+			return time.Unix((day-2440588)*86400, nanos).UTC() // Julian day of 1970-01-01
+		}
+		return v
+	}
+}
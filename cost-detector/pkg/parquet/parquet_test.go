@@ -0,0 +1,214 @@
+package parquet
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cost-detector/pkg/parquet/parquettest"
+)
+
+func TestSnappyDecode(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"\x00", ""},
+		{"\x03\x08abc", "abc"},
+		// A literal, then a copy of 9 bytes from 3 back, overlapping itself
+		{"\x0c\x08abc\x15\x03", "abcabcabcabc"},
+		// 2-byte offset copy
+		{"\x06\x04ab\x0e\x02\x00", "ababab"},
+		// 4-byte offset copy
+		{"\x05\x08abc\x07\x03\x00\x00\x00", "abcab"},
+		// Literal length in the byte after the tag
+		{"\x3d\xf0\x3c" + strings.Repeat("x", 61), strings.Repeat("x", 61)},
+	}
+	for _, tt := range tests {
+		got, err := snappyDecode([]byte(tt.in))
+		if err != nil || string(got) != tt.want {
+			t.Errorf("snappyDecode(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"\x03\x08ab",          // Literal past the end
+		"\x04\x08abc",         // Shorter than its length
+		"\x08\x08abc\x05\x04", // Copy from before the start
+		"\x02\x08abc",         // Longer than its length
+	} {
+		if got, err := snappyDecode([]byte(in)); err == nil {
+			t.Errorf("snappyDecode(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestDecodeHybrid(t *testing.T) {
+	tests := []struct {
+		buf   []byte
+		width int
+		count int
+		want  []int
+	}{
+		// RLE run of five 3s
+		{[]byte{5 << 1, 3}, 2, 5, []int{3, 3, 3, 3, 3}},
+		// One bit-packed group: 0..7 in 3 bits
+		{[]byte{1<<1 | 1, 0x88, 0xc6, 0xfa}, 3, 8, []int{0, 1, 2, 3, 4, 5, 6, 7}},
+		// A run, then a group cut short by count
+		{[]byte{2 << 1, 1, 1<<1 | 1, 0x05}, 1, 4, []int{1, 1, 1, 0}},
+		// Two-byte RLE value
+		{[]byte{1 << 1, 0x2c, 0x01}, 9, 1, []int{300}},
+	}
+	for _, tt := range tests {
+		got, err := decodeHybrid(tt.buf, tt.width, tt.count)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeHybrid(%x, %d, %d) = %v, %v, want %v", tt.buf, tt.width, tt.count, got, err, tt.want)
+		}
+	}
+	if _, err := decodeHybrid([]byte{10 << 1, 1}, 1, 5); err == nil {
+		t.Error("decodeHybrid with a run longer than count: want an error")
+	}
+}
+
+func TestReadColumn(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	hour := day.Add(13*time.Hour + 250*time.Millisecond)
+	columns := []parquettest.Column{
+		{Name: "id", Type: "string", Values: []interface{}{"i-1", "i-2", nil, "i-1", "i-3"}},
+		{Name: "cost", Type: "double", Values: []interface{}{0.192, nil, 1.5, 0.192, -0.25}},
+		{Name: "count", Type: "int64", Values: []interface{}{int64(1), int64(-2), int64(3), nil, int64(1 << 40)}},
+		{Name: "spot", Type: "bool", Values: []interface{}{true, false, nil, true, true}},
+		{Name: "start", Type: "timestamp", Values: []interface{}{day, hour, nil, day, hour}},
+		{Name: "end", Type: "timestamp-micros", Values: []interface{}{hour, nil, day, hour, day}},
+		{Name: "legacy", Type: "int96", Values: []interface{}{hour, day, nil, nil, hour}},
+		{Name: "billed", Type: "date", Values: []interface{}{day, day, day, nil, day}},
+		{Name: "amount", Type: "decimal", Values: []interface{}{12.3456, -0.5, 0.0, nil, -12345.6789}},
+	}
+	maps := []parquettest.Map{{Name: "tags", Values: []map[string]string{
+		{"team": "payments", "env": "prod"}, nil, {}, {"team": "search"}, {"a": "1", "b": "2", "c": "3"},
+	}}}
+	wantMaps := []map[string]string{{"team": "payments", "env": "prod"}, nil, nil, {"team": "search"}, {"a": "1", "b": "2", "c": "3"}}
+
+	for _, opts := range []parquettest.Options{
+		{},
+		{Codec: "snappy"},
+		{Codec: "gzip", Dictionary: true},
+		{PageV2: true},
+		{PageV2: true, Codec: "snappy", Dictionary: true},
+		{PageV2: true, Codec: "gzip", RowGroupRows: 2},
+		{Dictionary: true, RowGroupRows: 3},
+	} {
+		var buf bytes.Buffer
+		if err := parquettest.Write(&buf, 5, columns, maps, opts); err != nil {
+			t.Fatal(err)
+		}
+		f, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("%+v: Open: %v", opts, err)
+		}
+		if f.NumRows() != 5 {
+			t.Errorf("%+v: NumRows() = %d, want 5", opts, f.NumRows())
+		}
+
+		got := make(map[string][]interface{})
+		var keys, values []*Values
+		for g := 0; g < f.RowGroups(); g++ {
+			for _, c := range f.Columns() {
+				v, err := f.ReadColumn(g, c)
+				if err != nil {
+					t.Fatalf("%+v: ReadColumn(%d, %s): %v", opts, g, c.Name(), err)
+				}
+				switch c.Name() {
+				case "tags.key_value.key":
+					keys = append(keys, v)
+				case "tags.key_value.value":
+					values = append(values, v)
+				default:
+					got[c.Name()] = append(got[c.Name()], v.Values...)
+				}
+			}
+		}
+		for _, c := range columns {
+			want := c.Values
+			if c.Type == "int96" || c.Type == "date" {
+				want = nil
+				for _, v := range c.Values {
+					if v != nil && c.Type == "date" {
+						v = v.(time.Time).Truncate(24 * time.Hour)
+					}
+					want = append(want, v)
+				}
+			}
+			if !reflect.DeepEqual(got[c.Name], want) {
+				t.Errorf("%+v: %s = %v, want %v", opts, c.Name, got[c.Name], want)
+			}
+		}
+
+		var gotMaps []map[string]string
+		for i := range keys {
+			for j, key := range keys[i].Values {
+				if keys[i].Repetition[j] == 0 {
+					gotMaps = append(gotMaps, nil)
+				}
+				if key == nil {
+					continue
+				}
+				if gotMaps[len(gotMaps)-1] == nil {
+					gotMaps[len(gotMaps)-1] = make(map[string]string)
+				}
+				gotMaps[len(gotMaps)-1][key.(string)] = values[i].Values[j].(string)
+			}
+		}
+		if !reflect.DeepEqual(gotMaps, wantMaps) {
+			t.Errorf("%+v: tags = %v, want %v", opts, gotMaps, wantMaps)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	var buf bytes.Buffer
+	err := parquettest.Write(&buf, 1,
+		[]parquettest.Column{{Name: "id", Type: "string", Values: []interface{}{"a"}}},
+		[]parquettest.Map{{Name: "tags", Values: []map[string]string{nil}}}, parquettest.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name     string
+		rep, def int
+	}{{"id", 0, 1}, {"tags.key_value.key", 1, 2}, {"tags.key_value.value", 1, 3}}
+	if len(f.Columns()) != len(want) {
+		t.Fatalf("got %d columns, want %d", len(f.Columns()), len(want))
+	}
+	for i, c := range f.Columns() {
+		if c.Name() != want[i].name || c.MaxRepetition != want[i].rep || c.MaxDefinition != want[i].def {
+			t.Errorf("column %d = %s (%d, %d), want %s (%d, %d)", i, c.Name(), c.MaxRepetition, c.MaxDefinition,
+				want[i].name, want[i].rep, want[i].def)
+		}
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	var buf bytes.Buffer
+	err := parquettest.Write(&buf, 1, []parquettest.Column{{Name: "id", Type: "string", Values: []interface{}{"a"}}}, nil, parquettest.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+	for name, data := range map[string][]byte{
+		"empty":          nil,
+		"not parquet":    []byte("lineItem/ResourceId,lineItem/LineItemType\n"),
+		"truncated":      append([]byte("PAR1"), file[len(file)-12:]...),
+		"corrupt footer": append(append([]byte(nil), file[:len(file)-8]...), 0xff, 0xff, 0xff, 0x7f, 'P', 'A', 'R', '1'),
+	} {
+		if _, err := Open(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("%s: Open succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,517 @@
+// Package parquettest writes small Parquet files for tests, covering what
+// the reader supports: flat optional columns of common logical types,
+// string maps, v1 and v2 data pages, dictionaries and the codecs.
+package parquettest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"time"
+)
+
+// Column is a top-level optional column. Type is one of "string",
+// "double", "int64", "bool", "timestamp" (INT64 millis, logical type),
+// "timestamp-micros" (INT64, converted type), "int96", "date" and
+// "decimal" (BYTE_ARRAY, scale 4). Values has one entry per row, nil for null.
+type Column struct {
+	Name   string
+	Type   string
+	Values []interface{}
+}
+
+// Map is a top-level optional map<string,string> column, one map per row,
+// nil for null
+type Map struct {
+	Name   string
+	Values []map[string]string
+}
+
+// Options picks how the file is laid out
+type Options struct {
+	Codec        string // "", "snappy" or "gzip"
+	PageV2       bool   // Write v2 data pages
+	Dictionary   bool   // Dictionary encode every column
+	RowGroupRows int    // Rows per row group, 0 for one row group
+}
+
+// Write writes rows of columns and maps to w
+func Write(w io.Writer, rows int, columns []Column, maps []Map, opts Options) error {
+	var leaves []*leaf
+	schema := []interface{}{fields{{4, "schema"}, {5, int32(len(columns) + len(maps))}}}
+	for _, c := range columns {
+		if len(c.Values) != rows {
+			return fmt.Errorf("column %s has %d values for %d rows", c.Name, len(c.Values), rows)
+		}
+		element, l, err := flatColumn(c)
+		if err != nil {
+			return err
+		}
+		schema = append(schema, element)
+		leaves = append(leaves, l)
+	}
+	for _, m := range maps {
+		if len(m.Values) != rows {
+			return fmt.Errorf("map %s has %d values for %d rows", m.Name, len(m.Values), rows)
+		}
+		elements, key, value := mapColumn(m)
+		schema = append(schema, elements...)
+		leaves = append(leaves, key, value)
+	}
+
+	out := &bytes.Buffer{}
+	out.WriteString("PAR1")
+	groupRows := opts.RowGroupRows
+	if groupRows <= 0 {
+		groupRows = rows
+	}
+	var groups []interface{}
+	for start := 0; start < rows || (rows == 0 && start == 0); start += groupRows {
+		end := min(start+groupRows, rows)
+		var chunks []interface{}
+		for _, l := range leaves {
+			chunk, err := l.write(out, start, end, opts)
+			if err != nil {
+				return err
+			}
+			chunks = append(chunks, chunk)
+		}
+		groups = append(groups, fields{{1, chunks}, {2, int64(0)}, {3, int64(end - start)}})
+		if rows == 0 {
+			break
+		}
+	}
+
+	meta := encode(fields{{1, int32(1)}, {2, schema}, {3, int64(rows)}, {4, groups}})
+	out.Write(meta)
+	binary.Write(out, binary.LittleEndian, uint32(len(meta)))
+	out.WriteString("PAR1")
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// leaf is a column as written: per row, its levels and values
+type leaf struct {
+	path       []string
+	typ        int32
+	typeLength int32
+	maxRep     int
+	maxDef     int
+	rows       [][]entry
+}
+
+type entry struct {
+	rep, def int
+	value    []byte // PLAIN encoded, nil below maxDef
+}
+
+// Physical types
+const (
+	typeBoolean   = 0
+	typeInt32     = 1
+	typeInt64     = 2
+	typeInt96     = 3
+	typeDouble    = 5
+	typeByteArray = 6
+)
+
+func flatColumn(c Column) (fields, *leaf, error) {
+	element := fields{{3, int32(1)}, {4, c.Name}}
+	l := &leaf{path: []string{c.Name}, maxDef: 1}
+	var plain func(interface{}) []byte
+	switch c.Type {
+	case "string":
+		l.typ = typeByteArray
+		element = append(element, field{6, int32(0)}, field{10, fields{{1, fields{}}}})
+		plain = func(v interface{}) []byte { return byteArray([]byte(v.(string))) }
+	case "double":
+		l.typ = typeDouble
+		plain = func(v interface{}) []byte {
+			return binary.LittleEndian.AppendUint64(nil, math.Float64bits(v.(float64)))
+		}
+	case "int64":
+		l.typ = typeInt64
+		plain = func(v interface{}) []byte { return binary.LittleEndian.AppendUint64(nil, uint64(v.(int64))) }
+	case "bool":
+		l.typ = typeBoolean
+		plain = func(v interface{}) []byte { return []byte{boolByte(v.(bool))} }
+	case "timestamp":
+		l.typ = typeInt64
+		element = append(element, field{10, fields{{8, fields{{1, true}, {2, fields{{1, fields{}}}}}}}})
+		plain = func(v interface{}) []byte {
+			return binary.LittleEndian.AppendUint64(nil, uint64(v.(time.Time).UnixMilli()))
+		}
+	case "timestamp-micros":
+		l.typ = typeInt64
+		element = append(element, field{6, int32(10)})
+		plain = func(v interface{}) []byte {
+			return binary.LittleEndian.AppendUint64(nil, uint64(v.(time.Time).UnixMicro()))
+		}
+	case "int96":
+		l.typ = typeInt96
+		plain = func(v interface{}) []byte {
+			t := v.(time.Time).UTC()
+			day := t.Unix()/86400 + 2440588
+			nanos := t.Sub(time.Unix(t.Unix()/86400*86400, 0))
+			return binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint64(nil, uint64(nanos)), uint32(day))
+		}
+	case "date":
+		l.typ = typeInt32
+		element = append(element, field{10, fields{{6, fields{}}}})
+		plain = func(v interface{}) []byte {
+			return binary.LittleEndian.AppendUint32(nil, uint32(v.(time.Time).Unix()/86400))
+		}
+	case "decimal":
+		l.typ = typeByteArray
+		element = append(element, field{6, int32(5)}, field{7, int32(4)}, field{8, int32(18)})
+		plain = func(v interface{}) []byte { return byteArray(twosComplement(int64(math.Round(v.(float64) * 1e4)))) }
+	default:
+		return nil, nil, fmt.Errorf("column %s: unknown type %q", c.Name, c.Type)
+	}
+	element = append(fields{{1, l.typ}}, element...)
+	for _, v := range c.Values {
+		if v == nil {
+			l.rows = append(l.rows, []entry{{0, 0, nil}})
+		} else {
+			l.rows = append(l.rows, []entry{{0, 1, plain(v)}})
+		}
+	}
+	return element, l, nil
+}
+
+func mapColumn(m Map) ([]interface{}, *leaf, *leaf) {
+	elements := []interface{}{
+		fields{{3, int32(1)}, {4, m.Name}, {5, int32(1)}, {6, int32(1)}, {10, fields{{2, fields{}}}}},
+		fields{{3, int32(2)}, {4, "key_value"}, {5, int32(2)}},
+		fields{{1, int32(typeByteArray)}, {3, int32(0)}, {4, "key"}, {6, int32(0)}},
+		fields{{1, int32(typeByteArray)}, {3, int32(1)}, {4, "value"}, {6, int32(0)}},
+	}
+	key := &leaf{path: []string{m.Name, "key_value", "key"}, typ: typeByteArray, maxRep: 1, maxDef: 2}
+	value := &leaf{path: []string{m.Name, "key_value", "value"}, typ: typeByteArray, maxRep: 1, maxDef: 3}
+	for _, row := range m.Values {
+		switch {
+		case row == nil:
+			key.rows = append(key.rows, []entry{{0, 0, nil}})
+			value.rows = append(value.rows, []entry{{0, 0, nil}})
+		case len(row) == 0:
+			key.rows = append(key.rows, []entry{{0, 1, nil}})
+			value.rows = append(value.rows, []entry{{0, 1, nil}})
+		default:
+			var keys, values []entry
+			for _, k := range sortedKeys(row) {
+				rep := 1
+				if len(keys) == 0 {
+					rep = 0
+				}
+				keys = append(keys, entry{rep, 2, byteArray([]byte(k))})
+				values = append(values, entry{rep, 3, byteArray([]byte(row[k]))})
+			}
+			key.rows = append(key.rows, keys)
+			value.rows = append(value.rows, values)
+		}
+	}
+	return elements, key, value
+}
+
+// write writes the rows of a row group as a column chunk: a dictionary page
+// if asked for, then one data page
+func (l *leaf) write(out *bytes.Buffer, start int, end int, opts Options) (fields, error) {
+	var entries []entry
+	for _, row := range l.rows[start:end] {
+		entries = append(entries, row...)
+	}
+	var reps, defs []int
+	var values [][]byte
+	for _, e := range entries {
+		reps = append(reps, e.rep)
+		defs = append(defs, e.def)
+		if e.def == l.maxDef {
+			values = append(values, e.value)
+		}
+	}
+
+	codec, compress := int32(0), func(b []byte) []byte { return b }
+	switch opts.Codec {
+	case "snappy":
+		codec, compress = 1, snappyLiterals
+	case "gzip":
+		codec, compress = 2, gzipped
+	case "":
+	default:
+		return nil, fmt.Errorf("unknown codec %q", opts.Codec)
+	}
+
+	chunkStart := int64(out.Len())
+	var dictionaryOffset int64 = -1
+	encoding := int32(0)
+	data := plainValues(l.typ, values)
+	if opts.Dictionary {
+		dictionary, indices := dictionaryEncode(values)
+		dictionaryOffset = chunkStart
+		page := plainValues(l.typ, dictionary)
+		compressed := compress(page)
+		out.Write(encode(fields{{1, int32(2)}, {2, int32(len(page))}, {3, int32(len(compressed))},
+			{7, fields{{1, int32(len(dictionary))}, {2, int32(0)}}}}))
+		out.Write(compressed)
+		width := bitWidth(len(dictionary) - 1)
+		data = append([]byte{byte(width)}, bitPacked(indices, width)...)
+		encoding = 8
+	}
+
+	dataOffset := int64(out.Len())
+	nulls := int32(len(entries) - len(values))
+	repLevels, defLevels := levelRuns(reps, l.maxRep), levelBitPacked(defs, l.maxDef)
+	if opts.PageV2 {
+		compressed := compress(data)
+		out.Write(encode(fields{{1, int32(3)}, {2, int32(len(repLevels) + len(defLevels) + len(data))},
+			{3, int32(len(repLevels) + len(defLevels) + len(compressed))},
+			{8, fields{{1, int32(len(entries))}, {2, nulls}, {3, int32(end - start)}, {4, encoding},
+				{5, int32(len(defLevels))}, {6, int32(len(repLevels))}, {7, codec != 0}}}}))
+		out.Write(repLevels)
+		out.Write(defLevels)
+		out.Write(compressed)
+	} else {
+		var page []byte
+		if l.maxRep > 0 {
+			page = append(binary.LittleEndian.AppendUint32(page, uint32(len(repLevels))), repLevels...)
+		}
+		if l.maxDef > 0 {
+			page = append(binary.LittleEndian.AppendUint32(page, uint32(len(defLevels))), defLevels...)
+		}
+		page = append(page, data...)
+		compressed := compress(page)
+		out.Write(encode(fields{{1, int32(0)}, {2, int32(len(page))}, {3, int32(len(compressed))},
+			{5, fields{{1, int32(len(entries))}, {2, encoding}, {3, int32(3)}, {4, int32(3)}}}}))
+		out.Write(compressed)
+	}
+
+	size := int64(out.Len()) - chunkStart
+	var path []interface{}
+	for _, p := range l.path {
+		path = append(path, p)
+	}
+	meta := fields{{1, l.typ}, {2, []interface{}{encoding, int32(3)}}, {3, path}, {4, codec},
+		{5, int64(len(entries))}, {6, size}, {7, size}, {9, dataOffset}}
+	if dictionaryOffset >= 0 {
+		meta = append(meta, field{11, dictionaryOffset})
+	}
+	return fields{{2, chunkStart}, {3, meta}}, nil
+}
+
+func plainValues(typ int32, values [][]byte) []byte {
+	if typ == typeBoolean {
+		packed := make([]byte, (len(values)+7)/8)
+		for i, v := range values {
+			packed[i/8] |= v[0] << (i % 8)
+		}
+		return packed
+	}
+	return bytes.Join(values, nil)
+}
+
+func dictionaryEncode(values [][]byte) ([][]byte, []int) {
+	var dictionary [][]byte
+	seen := make(map[string]int)
+	indices := make([]int, len(values))
+	for i, v := range values {
+		index, ok := seen[string(v)]
+		if !ok {
+			index = len(dictionary)
+			seen[string(v)] = index
+			dictionary = append(dictionary, v)
+		}
+		indices[i] = index
+	}
+	return dictionary, indices
+}
+
+// levelRuns encodes levels as RLE runs of the hybrid encoding
+func levelRuns(levels []int, max int) []byte {
+	if max == 0 {
+		return nil
+	}
+	width := (bitWidth(max) + 7) / 8
+	var out []byte
+	for i := 0; i < len(levels); {
+		run := 1
+		for i+run < len(levels) && levels[i+run] == levels[i] {
+			run++
+		}
+		out = binary.AppendUvarint(out, uint64(run)<<1)
+		for b := 0; b < width; b++ {
+			out = append(out, byte(levels[i]>>(8*b)))
+		}
+		i += run
+	}
+	return out
+}
+
+// levelBitPacked encodes levels as bit-packed groups of the hybrid encoding
+func levelBitPacked(levels []int, max int) []byte {
+	if max == 0 {
+		return nil
+	}
+	return bitPacked(levels, bitWidth(max))
+}
+
+func bitPacked(values []int, width int) []byte {
+	groups := (len(values) + 7) / 8
+	out := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	packed := make([]byte, groups*width)
+	for i, v := range values {
+		for b := 0; b < width; b++ {
+			bit := i*width + b
+			packed[bit/8] |= byte(v>>b&1) << (bit % 8)
+		}
+	}
+	return append(out, packed...)
+}
+
+func bitWidth(max int) int {
+	width := 0
+	for ; max > 0; max >>= 1 {
+		width++
+	}
+	return width
+}
+
+// snappyLiterals writes a valid Snappy block of literals only
+func snappyLiterals(b []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(len(b)))
+	for len(b) > 0 {
+		n := min(len(b), 60)
+		out = append(out, byte(n-1)<<2)
+		out = append(out, b[:n]...)
+		b = b[n:]
+	}
+	return out
+}
+
+func gzipped(b []byte) []byte {
+	var out bytes.Buffer
+	gz := gzip.NewWriter(&out)
+	gz.Write(b)
+	gz.Close()
+	return out.Bytes()
+}
+
+func byteArray(b []byte) []byte {
+	return append(binary.LittleEndian.AppendUint32(nil, uint32(len(b))), b...)
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// twosComplement is v big endian in as few bytes as hold its sign
+func twosComplement(v int64) []byte {
+	n := big.NewInt(v)
+	size := (n.BitLen() + 8) / 8
+	if v < 0 {
+		n.Add(n, new(big.Int).Lsh(big.NewInt(1), uint(size*8)))
+	}
+	return n.FillBytes(make([]byte, size))
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	for i := 1; i < len(keys); i++ {
+		for j := i; j > 0 && keys[j] < keys[j-1]; j-- {
+			keys[j], keys[j-1] = keys[j-1], keys[j]
+		}
+	}
+	return keys
+}
+
+// Thrift compact protocol encoding of metadata
+type field struct {
+	id    int16
+	value interface{}
+}
+
+type fields []field
+
+func encode(s fields) []byte {
+	return appendStruct(nil, s)
+}
+
+func appendStruct(b []byte, s fields) []byte {
+	var last int16
+	for _, f := range s {
+		typ := thriftType(f.value)
+		if v, ok := f.value.(bool); ok {
+			typ = 2
+			if v {
+				typ = 1
+			}
+		}
+		if delta := f.id - last; delta > 0 && delta <= 15 {
+			b = append(b, byte(delta)<<4|typ)
+		} else {
+			b = append(b, typ)
+			b = binary.AppendUvarint(b, uint64(int64(f.id)<<1^int64(f.id)>>63))
+		}
+		last = f.id
+		if _, ok := f.value.(bool); !ok {
+			b = appendValue(b, f.value)
+		}
+	}
+	return append(b, 0)
+}
+
+func thriftType(v interface{}) byte {
+	switch v.(type) {
+	case bool:
+		return 1
+	case int32:
+		return 5
+	case int64:
+		return 6
+	case string:
+		return 8
+	case []interface{}:
+		return 9
+	default:
+		return 12
+	}
+}
+
+func appendValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case bool:
+		return append(b, map[bool]byte{true: 1, false: 2}[v])
+	case int32:
+		return binary.AppendUvarint(b, uint64(int64(v)<<1^int64(v)>>63))
+	case int64:
+		return binary.AppendUvarint(b, uint64(v<<1^v>>63))
+	case string:
+		return append(binary.AppendUvarint(b, uint64(len(v))), v...)
+	case []interface{}:
+		elem := byte(12)
+		if len(v) > 0 {
+			elem = thriftType(v[0])
+		}
+		if len(v) < 15 {
+			b = append(b, byte(len(v))<<4|elem)
+		} else {
+			b = binary.AppendUvarint(append(b, 0xf0|elem), uint64(len(v)))
+		}
+		for _, e := range v {
+			b = appendValue(b, e)
+		}
+		return b
+	case fields:
+		return appendStruct(b, v)
+	}
+	panic(fmt.Sprintf("parquettest: can't encode %T", v))
+}
@@ -0,0 +1,79 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errSnappy = errors.New("parquet: corrupt snappy page")
+
+// snappyDecode decompresses a Snappy block (not the framed stream format):
+// the uncompressed length, then literals and back-references
+func snappyDecode(src []byte) ([]byte, error) {
+	n, read := binary.Uvarint(src)
+	if read <= 0 || n > 1<<31 {
+		return nil, errSnappy
+	}
+	src = src[read:]
+	dst := make([]byte, 0, n)
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+		switch tag & 3 {
+		case 0: // Literal, its length in the tag or the 1-4 bytes after it
+			length = int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				size := length - 59
+				if len(src) < size {
+					return nil, errSnappy
+				}
+				length = 0
+				for i := size - 1; i >= 0; i-- {
+					length = length<<8 | int(src[i])
+				}
+				src = src[size:]
+			}
+			length++
+			if length > len(src) || len(dst)+length > int(n) {
+				return nil, errSnappy
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 1: // Copy, 4-11 bytes from an 11-bit offset
+			if len(src) < 2 {
+				return nil, errSnappy
+			}
+			length = 4 + int(tag>>2&7)
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case 2: // Copy with a 2-byte offset
+			if len(src) < 3 {
+				return nil, errSnappy
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3: // Copy with a 4-byte offset
+			if len(src) < 5 {
+				return nil, errSnappy
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) || len(dst)+length > int(n) {
+			return nil, errSnappy
+		}
+		// Byte by byte, since a copy may overlap what it writes
+		start := len(dst) - offset
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+	if len(dst) != int(n) {
+		return nil, errSnappy
+	}
+	return dst, nil
+}
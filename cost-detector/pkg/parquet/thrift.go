@@ -0,0 +1,215 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Parquet metadata is Thrift structs in the compact protocol. Rather than
+// generated code, structs are decoded generically into field ID -> value,
+// with values int64, float64, bool, []byte, []interface{} or tstruct, and
+// read through the accessors below.
+type tstruct map[int16]interface{}
+
+// Compact protocol types
+const (
+	tStop         = 0
+	tBooleanTrue  = 1
+	tBooleanFalse = 2
+	tByte         = 3
+	tI16          = 4
+	tI32          = 5
+	tI64          = 6
+	tDouble       = 7
+	tBinary       = 8
+	tList         = 9
+	tSet          = 10
+	tMap          = 11
+	tStruct       = 12
+)
+
+// maxDepth bounds nesting, so a corrupt file can't recurse without end
+const maxDepth = 32
+
+var errShort = errors.New("parquet: metadata truncated")
+
+// thriftReader decodes compact protocol values from a buffer
+type thriftReader struct {
+	buf   []byte
+	pos   int
+	depth int
+}
+
+// readStruct decodes a struct up to its stop field
+func (r *thriftReader) readStruct() (tstruct, error) {
+	if r.depth++; r.depth > maxDepth {
+		return nil, errors.New("parquet: metadata nested too deeply")
+	}
+	defer func() { r.depth-- }()
+
+	s := make(tstruct)
+	var id int16
+	for {
+		header, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		typ := header & 0x0f
+		if typ == tStop {
+			return s, nil
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(zigzag(v))
+		}
+		switch typ {
+		case tBooleanTrue:
+			s[id] = true
+		case tBooleanFalse:
+			s[id] = false
+		default:
+			if s[id], err = r.value(typ); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// value decodes one value of a type; booleans here are list elements
+func (r *thriftReader) value(typ byte) (interface{}, error) {
+	switch typ {
+	case tBooleanTrue, tBooleanFalse:
+		b, err := r.byte()
+		return b == tBooleanTrue, err
+	case tByte:
+		b, err := r.byte()
+		return int64(int8(b)), err
+	case tI16, tI32, tI64:
+		v, err := r.varint()
+		return zigzag(v), err
+	case tDouble:
+		if r.pos+8 > len(r.buf) {
+			return nil, errShort
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.buf[r.pos:]))
+		r.pos += 8
+		return v, nil
+	case tBinary:
+		n, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(r.buf)-r.pos) {
+			return nil, errShort
+		}
+		b := r.buf[r.pos : r.pos+int(n)]
+		r.pos += int(n)
+		return b, nil
+	case tList, tSet:
+		header, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, elem := uint64(header>>4), header&0x0f
+		if size == 15 {
+			if size, err = r.varint(); err != nil {
+				return nil, err
+			}
+		}
+		if size > uint64(len(r.buf)-r.pos) {
+			return nil, errShort // Every element takes at least a byte
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			if list[i], err = r.value(elem); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case tMap:
+		size, err := r.varint()
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		types, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < size; i++ {
+			if _, err := r.value(types >> 4); err != nil {
+				return nil, err
+			}
+			if _, err := r.value(types & 0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil // No map Parquet reads here
+	case tStruct:
+		return r.readStruct()
+	default:
+		return nil, fmt.Errorf("parquet: unknown thrift type %d", typ)
+	}
+}
+
+func (r *thriftReader) byte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, errShort
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *thriftReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, errShort
+	}
+	r.pos += n
+	return v, nil
+}
+
+func zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// int returns an integer field, 0 when unset
+func (s tstruct) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+// has reports whether a field is set
+func (s tstruct) has(id int16) bool {
+	_, ok := s[id]
+	return ok
+}
+
+func (s tstruct) bool(id int16, fallback bool) bool {
+	if v, ok := s[id].(bool); ok {
+		return v
+	}
+	return fallback
+}
+
+func (s tstruct) string(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s tstruct) strct(id int16) tstruct {
+	v, _ := s[id].(tstruct)
+	return v
+}
+
+func (s tstruct) list(id int16) []interface{} {
+	v, _ := s[id].([]interface{})
+	return v
+}
@@ -0,0 +1,276 @@
+// Package preview tracks ephemeral preview namespaces against a cost cap
+// and a maximum age, warning their owner and then tearing them down.
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cost-detector/pkg/alerts"
+	"cost-detector/pkg/kube"
+	"cost-detector/pkg/ledger"
+	"cost-detector/pkg/models"
+)
+
+const (
+	// EphemeralLabel marks a namespace as a preview environment when "true"
+	EphemeralLabel = "cost-detector.io/ephemeral"
+	// CostCapAnnotation overrides the dollar cap for one namespace, e.g. "40"
+	CostCapAnnotation = "cost-detector.io/cost-cap"
+	// MaxAgeAnnotation overrides the maximum age for one namespace, e.g. "168h"
+	MaxAgeAnnotation = "cost-detector.io/max-age"
+	// OwnerAnnotation names who to notify, e.g. the pull request author; the
+	// namespace's team label is used without it
+	OwnerAnnotation = "cost-detector.io/owner"
+	// TeardownAnnotation records when an environment over its cap will be deleted
+	TeardownAnnotation = "cost-detector.io/teardown-at"
+)
+
+// Environment is one preview namespace and how it stands against its limits
+type Environment struct {
+	Namespace   string     `json:"namespace"`
+	Owner       string     `json:"owner"`
+	Created     time.Time  `json:"created"`
+	AgeHours    float64    `json:"ageHours"`
+	Cost        float64    `json:"cost"`      // Accrued since the ledger first saw the namespace
+	CostSince   time.Time  `json:"costSince"` // Creation, unless the ledger started later
+	CostPerHr   float64    `json:"costPerHr"`
+	CostCap     float64    `json:"costCap"`
+	MaxAgeHours float64    `json:"maxAgeHours"`
+	Exceeded    string     `json:"exceeded,omitempty"` // Which limit was hit
+	TeardownAt  *time.Time `json:"teardownAt,omitempty"`
+}
+
+// Manager checks preview namespaces and tears down those over their limits
+// once the grace period after warning their owner has passed
+type Manager struct {
+	CostCap  float64       // Default dollar cap per environment
+	MaxAge   time.Duration // Default maximum age
+	Grace    time.Duration // Time between warning the owner and deleting the namespace
+	Teardown bool          // Delete namespaces; when false, only warn
+
+	client *kube.Client
+	ledger *ledger.Ledger
+	mu     sync.RWMutex
+	envs   map[string]Environment
+}
+
+// NewManager creates a manager with default limits for every environment
+func NewManager(client *kube.Client, l *ledger.Ledger, costCap float64, maxAge time.Duration, grace time.Duration) *Manager {
+	return &Manager{
+		CostCap:  costCap,
+		MaxAge:   maxAge,
+		Grace:    grace,
+		Teardown: true,
+		client:   client,
+		ledger:   l,
+		envs:     make(map[string]Environment),
+	}
+}
+
+// Check lists preview namespaces and acts on each: warn the owner and
+// schedule a teardown when a limit is hit, delete it once the teardown time
+// has passed, and cancel the teardown when its limits were raised. It returns
+// the notifications to send, including the final cost of each environment
+// that was torn down or deleted by someone else.
+func (m *Manager) Check(ctx context.Context, now time.Time) ([]*models.CostAlert, error) {
+	var namespaces kube.NamespaceList
+	path := kube.NamespacesPath + "?labelSelector=" + url.QueryEscape(EphemeralLabel+"=true")
+	if err := m.client.Get(ctx, path, &namespaces); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	previous := m.envs
+	m.mu.RUnlock()
+
+	var notices []*models.CostAlert
+	var errs []error
+	envs := make(map[string]Environment)
+	tornDown := make(map[string]bool)
+	for _, ns := range namespaces.Items {
+		if ns.Metadata.DeletionTimestamp != "" {
+			continue // Terminating; reported as deleted below
+		}
+		env := m.environment(ns, now)
+		name := env.Namespace
+
+		switch {
+		case env.Exceeded == "" && env.TeardownAt != nil:
+			if err := m.setTeardown(ctx, name, nil); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				break
+			}
+			env.TeardownAt = nil
+			notices = append(notices, alert(env, alerts.SeverityInfo, "Its limits were raised; the scheduled teardown is cancelled."))
+
+		case env.Exceeded != "" && env.TeardownAt == nil:
+			at := now.Add(m.Grace).UTC().Truncate(time.Second)
+			if err := m.setTeardown(ctx, name, &at); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				break
+			}
+			env.TeardownAt = &at
+			action := "will be deleted"
+			if !m.Teardown {
+				action = "is due for deletion"
+			}
+			notices = append(notices, alert(env, alerts.SeverityWarning, fmt.Sprintf(
+				"%s. It %s at %s; raise %s or %s on the namespace to keep it.",
+				capitalize(env.Exceeded), action, at.Format(time.RFC3339), CostCapAnnotation, MaxAgeAnnotation)))
+
+		case env.Exceeded != "" && m.Teardown && !now.Before(*env.TeardownAt):
+			if err := m.client.Delete(ctx, kube.NamespacePath(name)); err != nil && !kube.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				break
+			}
+			notices = append(notices, alert(env, alerts.SeverityWarning, fmt.Sprintf(
+				"Torn down after %s because %s. %s", formatAge(env.AgeHours), env.Exceeded, finalCost(env))))
+			tornDown[name] = true
+			continue
+		}
+		envs[name] = env
+	}
+
+	// Environments deleted since the last check, e.g. when the pull request merged
+	for name, env := range previous {
+		if _, ok := envs[name]; ok || tornDown[name] {
+			continue
+		}
+		if cost, _, ok := m.ledger.Accrued(name, now); ok {
+			env.Cost = cost
+		}
+		notices = append(notices, alert(env, alerts.SeverityInfo, fmt.Sprintf(
+			"Deleted after %s. %s", formatAge(now.Sub(env.Created).Hours()), finalCost(env))))
+	}
+
+	m.mu.Lock()
+	m.envs = envs
+	m.mu.Unlock()
+	return notices, errors.Join(errs...)
+}
+
+// Environments returns the tracked preview environments, most expensive first
+func (m *Manager) Environments() []Environment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	envs := make([]Environment, 0, len(m.envs))
+	for _, env := range m.envs {
+		envs = append(envs, env)
+	}
+	sort.Slice(envs, func(i, j int) bool {
+		if envs[i].Cost != envs[j].Cost {
+			return envs[i].Cost > envs[j].Cost
+		}
+		return envs[i].Namespace < envs[j].Namespace
+	})
+	return envs
+}
+
+// environment reads a namespace's owner, limits and cost so far.
+// Unparseable annotations fall back to the defaults.
+func (m *Manager) environment(ns kube.Namespace, now time.Time) Environment {
+	meta := ns.Metadata
+	env := Environment{
+		Namespace:   meta.Name,
+		Owner:       meta.Annotations[OwnerAnnotation],
+		CostCap:     m.CostCap,
+		MaxAgeHours: m.MaxAge.Hours(),
+	}
+	if env.Owner == "" {
+		env.Owner = meta.Labels[models.TeamLabel]
+	}
+	if env.Owner == "" {
+		env.Owner = models.UnknownTeam
+	}
+	if created, err := time.Parse(time.RFC3339, meta.CreationTimestamp); err == nil {
+		env.Created = created
+		env.AgeHours = now.Sub(created).Hours()
+	}
+	if limit, err := strconv.ParseFloat(strings.TrimPrefix(meta.Annotations[CostCapAnnotation], "$"), 64); err == nil && limit > 0 {
+		env.CostCap = limit
+	}
+	if limit, err := time.ParseDuration(meta.Annotations[MaxAgeAnnotation]); err == nil && limit > 0 {
+		env.MaxAgeHours = limit.Hours()
+	}
+	if at, err := time.Parse(time.RFC3339, meta.Annotations[TeardownAnnotation]); err == nil {
+		env.TeardownAt = &at
+	}
+
+	env.CostSince = env.Created
+	if cost, since, ok := m.ledger.Accrued(meta.Name, now); ok {
+		env.Cost = cost
+		if since.After(env.CostSince) {
+			env.CostSince = since
+		}
+	}
+	if last := m.ledger.Last(); last != nil {
+		env.CostPerHr = last.Namespaces[meta.Name].CostPerHr
+	}
+
+	switch {
+	case env.CostCap > 0 && env.Cost >= env.CostCap:
+		env.Exceeded = fmt.Sprintf("its cost $%.2f reached its $%.2f cap", env.Cost, env.CostCap)
+	case env.MaxAgeHours > 0 && env.AgeHours >= env.MaxAgeHours:
+		env.Exceeded = fmt.Sprintf("its age %s reached its %s maximum", formatAge(env.AgeHours), formatAge(env.MaxAgeHours))
+	}
+	return env
+}
+
+// setTeardown records or, with a nil time, removes the teardown time on a namespace
+func (m *Manager) setTeardown(ctx context.Context, name string, at *time.Time) error {
+	var value interface{} // null removes the annotation
+	if at != nil {
+		value = at.Format(time.RFC3339)
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{TeardownAnnotation: value},
+		},
+	}
+	return m.client.MergePatch(ctx, kube.NamespacePath(name), patch)
+}
+
+// alert builds a notification about an environment for its owner
+func alert(env Environment, severity string, message string) *models.CostAlert {
+	return &models.CostAlert{
+		Team:      env.Owner,
+		Service:   "namespace/" + env.Namespace,
+		Kind:      models.AlertPreview,
+		CostPerHr: env.CostPerHr,
+		Severity:  severity,
+		Message:   "Preview environment " + env.Namespace + ": " + message,
+	}
+}
+
+// finalCost describes what an environment cost over its life
+func finalCost(env Environment) string {
+	if !env.CostSince.IsZero() && env.CostSince.After(env.Created.Add(time.Minute)) {
+		return fmt.Sprintf("Final cost: $%.2f (since %s).", env.Cost, env.CostSince.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("Final cost: $%.2f.", env.Cost)
+}
+
+// formatAge prints hours as days and hours, e.g. "3d4h"
+func formatAge(hours float64) string {
+	h := int(hours)
+	if h < 24 {
+		return fmt.Sprintf("%dh", h)
+	}
+	return fmt.Sprintf("%dd%dh", h/24, h%24)
+}
+
+// capitalize upper-cases the first letter of a sentence
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
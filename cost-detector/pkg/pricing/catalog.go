@@ -0,0 +1,153 @@
+package pricing
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"cost-detector/pkg/models"
+)
+
+// Capacity types a node can be launched with
+const (
+	OnDemand = "on-demand"
+	Spot     = "spot"
+)
+
+// Node labels that carry the capacity type (Karpenter and EKS managed node groups)
+const (
+	KarpenterCapacityTypeLabel = "karpenter.sh/capacity-type"     // "spot" / "on-demand"
+	EKSCapacityTypeLabel       = "eks.amazonaws.com/capacityType" // "SPOT" / "ON_DEMAND"
+	InstanceTypeLabel          = "node.kubernetes.io/instance-type"
+)
+
+// InstanceType is an EC2 instance type and what it costs
+type InstanceType struct {
+	Name     string  `json:"name"`     // e.g. "m5.xlarge"
+	CPU      float64 `json:"cpu"`      // vCPUs
+	Memory   float64 `json:"memory"`   // Memory (GiB)
+	Arch     string  `json:"arch"`     // "amd64" or "arm64" (Graviton)
+	OnDemand float64 `json:"onDemand"` // On-demand price per hour
+	Spot     float64 `json:"spot"`     // Typical spot price per hour
+}
+
+// Price returns the hourly price for a capacity type
+func (t InstanceType) Price(capacityType string) float64 {
+	if capacityType == Spot && t.Spot > 0 {
+		return t.Spot
+	}
+	return t.OnDemand
+}
+
+// Catalog holds the instance types we know prices for
+type Catalog struct {
+	mu    sync.RWMutex
+	types map[string]InstanceType
+}
+
+// NewCatalog creates a catalog from a list of instance types
+func NewCatalog(types []InstanceType) *Catalog {
+	c := &Catalog{types: make(map[string]InstanceType)}
+	for _, t := range types {
+		c.types[t.Name] = t
+	}
+	return c
+}
+
+// DefaultCatalog returns us-east-1 Linux prices for common EKS node types.
+// Spot prices are typical recent averages and drift over time.
+func DefaultCatalog() *Catalog {
+	return NewCatalog([]InstanceType{
+		// General purpose (Intel)
+		{Name: "t3.large", CPU: 2, Memory: 8, Arch: "amd64", OnDemand: 0.0832, Spot: 0.0250},
+		{Name: "t3.xlarge", CPU: 4, Memory: 16, Arch: "amd64", OnDemand: 0.1664, Spot: 0.0500},
+		{Name: "m5.large", CPU: 2, Memory: 8, Arch: "amd64", OnDemand: 0.096, Spot: 0.0350},
+		{Name: "m5.xlarge", CPU: 4, Memory: 16, Arch: "amd64", OnDemand: 0.192, Spot: 0.0700},
+		{Name: "m5.2xlarge", CPU: 8, Memory: 32, Arch: "amd64", OnDemand: 0.384, Spot: 0.1400},
+		{Name: "m5.4xlarge", CPU: 16, Memory: 64, Arch: "amd64", OnDemand: 0.768, Spot: 0.2800},
+		{Name: "m5.8xlarge", CPU: 32, Memory: 128, Arch: "amd64", OnDemand: 1.536, Spot: 0.5600},
+		// Compute optimized (Intel)
+		{Name: "c5.large", CPU: 2, Memory: 4, Arch: "amd64", OnDemand: 0.085, Spot: 0.0320},
+		{Name: "c5.xlarge", CPU: 4, Memory: 8, Arch: "amd64", OnDemand: 0.17, Spot: 0.0640},
+		{Name: "c5.2xlarge", CPU: 8, Memory: 16, Arch: "amd64", OnDemand: 0.34, Spot: 0.1280},
+		{Name: "c5.4xlarge", CPU: 16, Memory: 32, Arch: "amd64", OnDemand: 0.68, Spot: 0.2560},
+		// Memory optimized (Intel)
+		{Name: "r5.large", CPU: 2, Memory: 16, Arch: "amd64", OnDemand: 0.126, Spot: 0.0400},
+		{Name: "r5.xlarge", CPU: 4, Memory: 32, Arch: "amd64", OnDemand: 0.252, Spot: 0.0800},
+		{Name: "r5.2xlarge", CPU: 8, Memory: 64, Arch: "amd64", OnDemand: 0.504, Spot: 0.1600},
+		{Name: "r5.4xlarge", CPU: 16, Memory: 128, Arch: "amd64", OnDemand: 1.008, Spot: 0.3200},
+		// Graviton
+		{Name: "m6g.large", CPU: 2, Memory: 8, Arch: "arm64", OnDemand: 0.077, Spot: 0.0300},
+		{Name: "m6g.xlarge", CPU: 4, Memory: 16, Arch: "arm64", OnDemand: 0.154, Spot: 0.0600},
+		{Name: "m6g.2xlarge", CPU: 8, Memory: 32, Arch: "arm64", OnDemand: 0.308, Spot: 0.1200},
+		{Name: "m6g.4xlarge", CPU: 16, Memory: 64, Arch: "arm64", OnDemand: 0.616, Spot: 0.2400},
+		{Name: "m6g.8xlarge", CPU: 32, Memory: 128, Arch: "arm64", OnDemand: 1.232, Spot: 0.4800},
+		{Name: "c6g.large", CPU: 2, Memory: 4, Arch: "arm64", OnDemand: 0.068, Spot: 0.0270},
+		{Name: "c6g.xlarge", CPU: 4, Memory: 8, Arch: "arm64", OnDemand: 0.136, Spot: 0.0540},
+		{Name: "c6g.2xlarge", CPU: 8, Memory: 16, Arch: "arm64", OnDemand: 0.272, Spot: 0.1080},
+		{Name: "c6g.4xlarge", CPU: 16, Memory: 32, Arch: "arm64", OnDemand: 0.544, Spot: 0.2160},
+		{Name: "r6g.large", CPU: 2, Memory: 16, Arch: "arm64", OnDemand: 0.1008, Spot: 0.0350},
+		{Name: "r6g.xlarge", CPU: 4, Memory: 32, Arch: "arm64", OnDemand: 0.2016, Spot: 0.0700},
+		{Name: "r6g.2xlarge", CPU: 8, Memory: 64, Arch: "arm64", OnDemand: 0.4032, Spot: 0.1400},
+		{Name: "r6g.4xlarge", CPU: 16, Memory: 128, Arch: "arm64", OnDemand: 0.8064, Spot: 0.2800},
+	})
+}
+
+// Lookup finds an instance type by name
+func (c *Catalog) Lookup(name string) (InstanceType, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, ok := c.types[name]
+	return t, ok
+}
+
+// Set adds or replaces an instance type
+func (c *Catalog) Set(t InstanceType) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.types[t.Name] = t
+}
+
+// Types returns every instance type, sorted by on-demand price
+func (c *Catalog) Types() []InstanceType {
+	c.mu.RLock()
+	types := make([]InstanceType, 0, len(c.types))
+	for _, t := range c.types {
+		types = append(types, t)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].OnDemand != types[j].OnDemand {
+			return types[i].OnDemand < types[j].OnDemand
+		}
+		return types[i].Name < types[j].Name
+	})
+	return types
+}
+
+// CapacityType reads a node's capacity type from its labels, defaulting to on-demand
+func CapacityType(node *models.Node) string {
+	if strings.EqualFold(node.Labels[KarpenterCapacityTypeLabel], Spot) ||
+		strings.EqualFold(node.Labels[EKSCapacityTypeLabel], "SPOT") {
+		return Spot
+	}
+	return OnDemand
+}
+
+// NodeInstanceType returns a node's instance type, falling back to its label
+func NodeInstanceType(node *models.Node) string {
+	if node.InstanceType != "" {
+		return node.InstanceType
+	}
+	return node.Labels[InstanceTypeLabel]
+}
+
+// NodePrice returns the hourly price of a node, and false if its type isn't in the catalog
+func (c *Catalog) NodePrice(node *models.Node) (float64, bool) {
+	t, ok := c.Lookup(NodeInstanceType(node))
+	if !ok {
+		return 0, false
+	}
+	return t.Price(CapacityType(node)), true
+}
@@ -0,0 +1,166 @@
+package pricing
+
+import (
+	"math"
+	"strings"
+
+	"cost-detector/pkg/models"
+)
+
+// Fargate on-demand prices in us-east-1 (Linux/x86)
+const (
+	DefaultFargateVCPUPrice = 0.04048  // per vCPU per hour
+	DefaultFargateGBPrice   = 0.004445 // per GB per hour
+)
+
+// FargateComputeTypeLabel marks nodes that are really Fargate micro-VMs
+const FargateComputeTypeLabel = "eks.amazonaws.com/compute-type"
+
+// Strategy prices a pod. PodCost returns false when the strategy does not
+// apply to the pod, so the next strategy can be tried.
+type Strategy interface {
+	Name() string
+	PodCost(pod *models.Pod, node *models.Node) (float64, bool)
+}
+
+// IsFargate reports whether a node is a Fargate micro-VM
+func IsFargate(node *models.Node) bool {
+	return node != nil && (node.Labels[FargateComputeTypeLabel] == "fargate" || strings.HasPrefix(node.Name, "fargate-"))
+}
+
+// NodeCapacityPricing charges a pod its share of the EC2 node it runs on,
+// using the node's on-demand or spot price. The node price is split between
+// CPU and memory in the same ratio AWS uses for Fargate, so a pod asking for
+// half the node's CPU pays for half of the node's CPU cost.
+type NodeCapacityPricing struct {
+	catalog *Catalog
+}
+
+// NewNodeCapacityPricing creates node-capacity pricing backed by a catalog
+func NewNodeCapacityPricing(catalog *Catalog) *NodeCapacityPricing {
+	return &NodeCapacityPricing{catalog: catalog}
+}
+
+// Name identifies the strategy
+func (p *NodeCapacityPricing) Name() string { return "node-capacity" }
+
+// PodCost prices the pod's share of its node
+func (p *NodeCapacityPricing) PodCost(pod *models.Pod, node *models.Node) (float64, bool) {
+	if node == nil || IsFargate(node) {
+		return 0, false
+	}
+	t, ok := p.catalog.Lookup(NodeInstanceType(node))
+	if !ok {
+		return 0, false
+	}
+
+	cpu, memory := node.CPU, node.Memory
+	if cpu <= 0 || memory <= 0 {
+		cpu, memory = t.CPU, t.Memory
+	}
+	price := t.Price(CapacityType(node))
+
+	cpuWeight := cpu * DefaultFargateVCPUPrice / (cpu*DefaultFargateVCPUPrice + memory*DefaultFargateGBPrice)
+	cpuCost := price * cpuWeight * pod.CPU / cpu
+	memoryCost := price * (1 - cpuWeight) * pod.Memory / memory
+	return cpuCost + memoryCost, true
+}
+
+// FargatePricing charges Fargate pods per vCPU and GB, rounded up to the
+// sizes Fargate actually provisions
+type FargatePricing struct {
+	VCPUPrice float64 // Per vCPU per hour
+	GBPrice   float64 // Per GB per hour
+}
+
+// NewFargatePricing creates Fargate pricing
+func NewFargatePricing(vcpuPrice float64, gbPrice float64) *FargatePricing {
+	return &FargatePricing{VCPUPrice: vcpuPrice, GBPrice: gbPrice}
+}
+
+// Name identifies the strategy
+func (p *FargatePricing) Name() string { return "fargate" }
+
+// PodCost prices a Fargate pod
+func (p *FargatePricing) PodCost(pod *models.Pod, node *models.Node) (float64, bool) {
+	if !IsFargate(node) {
+		return 0, false
+	}
+	cpu, memory := FargateSize(pod.CPU, pod.Memory)
+	return cpu*p.VCPUPrice + memory*p.GBPrice, true
+}
+
+// fargateSizes are the vCPU and memory (GB) configurations Fargate offers,
+// smallest first
+var fargateSizes = []struct {
+	vcpu   float64
+	memory []float64
+}{
+	{0.25, []float64{0.5, 1, 2}},
+	{0.5, memorySteps(1, 4, 1)},
+	{1, memorySteps(2, 8, 1)},
+	{2, memorySteps(4, 16, 1)},
+	{4, memorySteps(8, 30, 1)},
+	{8, memorySteps(16, 60, 4)},
+	{16, memorySteps(32, 120, 8)},
+}
+
+// memorySteps lists memory sizes from min to max GB in steps of step
+func memorySteps(min float64, max float64, step float64) []float64 {
+	var sizes []float64
+	for gb := min; gb <= max; gb += step {
+		sizes = append(sizes, gb)
+	}
+	return sizes
+}
+
+// FargateSize returns the smallest Fargate configuration a pod fits in.
+// Fargate adds 0.25 GB for the kubelet and kube-proxy to the pod's memory;
+// a pod needing more memory than a vCPU size allows gets more vCPU. Pods
+// bigger than the largest configuration are priced at 16 vCPU with memory
+// rounded up to 8 GB.
+func FargateSize(cpu float64, memory float64) (float64, float64) {
+	gb := memory + 0.25
+	for _, size := range fargateSizes {
+		if cpu > size.vcpu {
+			continue
+		}
+		for _, m := range size.memory {
+			if gb <= m {
+				return size.vcpu, m
+			}
+		}
+	}
+	largest := fargateSizes[len(fargateSizes)-1]
+	return largest.vcpu, math.Max(largest.memory[0], math.Ceil(gb/8)*8)
+}
+
+// SavingsPlanPricing applies an amortized Savings Plan discount to the
+// covered share of on-demand usage priced by another strategy. Spot usage
+// is never covered by a Savings Plan.
+type SavingsPlanPricing struct {
+	Base     Strategy
+	Discount float64 // Savings Plan discount off on-demand, e.g. 0.28 for 28%
+	Coverage float64 // Share of on-demand usage the commitment covers, 0 to 1
+}
+
+// NewSavingsPlanPricing wraps a strategy with a Savings Plan discount
+func NewSavingsPlanPricing(base Strategy, discount float64, coverage float64) *SavingsPlanPricing {
+	return &SavingsPlanPricing{Base: base, Discount: discount, Coverage: coverage}
+}
+
+// Name identifies the strategy
+func (p *SavingsPlanPricing) Name() string { return p.Base.Name() + "+savings-plan" }
+
+// PodCost prices the pod with the base strategy, then discounts the covered share
+func (p *SavingsPlanPricing) PodCost(pod *models.Pod, node *models.Node) (float64, bool) {
+	cost, ok := p.Base.PodCost(pod, node)
+	if !ok {
+		return 0, false
+	}
+	if node != nil && !IsFargate(node) && CapacityType(node) == Spot {
+		return cost, true
+	}
+	coverage := math.Min(math.Max(p.Coverage, 0), 1)
+	return cost*(1-coverage) + cost*coverage*(1-p.Discount), true
+}
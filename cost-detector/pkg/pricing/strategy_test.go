@@ -0,0 +1,50 @@
+package pricing
+
+import "testing"
+
+func TestFargateSize(t *testing.T) {
+	tests := []struct {
+		cpu, memory      float64
+		wantVCPU, wantGB float64
+	}{
+		// Smallest configuration
+		{0, 0, 0.25, 0.5},
+		{0.1, 0.25, 0.25, 0.5},
+		{0.25, 0.5, 0.25, 1},
+		{0.25, 1.75, 0.25, 2},
+
+		// More memory than a vCPU size allows moves up to the next one
+		{0.25, 1.8, 0.5, 3},
+		{0.25, 3.75, 0.5, 4},
+		{0.25, 10, 2, 11},
+		{1, 8, 2, 9},
+		{2, 16, 4, 17},
+		{4, 30, 8, 32},
+
+		// Each vCPU size's memory minimum
+		{0.5, 0.25, 0.5, 1},
+		{1, 0.5, 1, 2},
+		{2, 1, 2, 4},
+		{4, 1, 4, 8},
+		{8, 1, 8, 16},
+		{16, 1, 16, 32},
+
+		// 1 GB steps up to 4 vCPU, then 4 GB at 8 vCPU and 8 GB at 16 vCPU
+		{1, 2.5, 1, 3},
+		{4, 20.5, 4, 21},
+		{8, 16.5, 8, 20},
+		{8, 57, 8, 60},
+		{16, 33, 16, 40},
+		{16, 119.75, 16, 120},
+
+		// Bigger than any configuration
+		{32, 1, 16, 32},
+		{16, 130, 16, 136},
+	}
+	for _, tt := range tests {
+		vcpu, gb := FargateSize(tt.cpu, tt.memory)
+		if vcpu != tt.wantVCPU || gb != tt.wantGB {
+			t.Errorf("FargateSize(%g, %g) = %g vCPU, %g GB, want %g vCPU, %g GB", tt.cpu, tt.memory, vcpu, gb, tt.wantVCPU, tt.wantGB)
+		}
+	}
+}
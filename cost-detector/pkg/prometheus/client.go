@@ -0,0 +1,148 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client queries a Prometheus-compatible HTTP API (Prometheus, Thanos,
+// VictoriaMetrics, Amazon Managed Prometheus behind a SigV4 proxy, ...)
+type Client struct {
+	BaseURL string // e.g. "http://prometheus-server.monitoring:80"
+	Token   string // Bearer token, empty when not needed
+	HTTP    *http.Client
+}
+
+// Sample is one series of an instant query result
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+	Time   time.Time
+}
+
+// NewClient creates a client for a Prometheus URL
+func NewClient(baseURL string, token string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Token:   token,
+		HTTP:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// response is the envelope every Prometheus API answer comes in
+type response struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// Query runs an instant query at a point in time; a zero time means now.
+// Vector and scalar results are supported.
+func (c *Client) Query(ctx context.Context, query string, at time.Time) ([]Sample, error) {
+	params := url.Values{"query": {query}}
+	if !at.IsZero() {
+		params.Set("time", strconv.FormatFloat(float64(at.UnixNano())/1e9, 'f', 3, 64))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/v1/query?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var r response
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("prometheus query %q: %s: %s", query, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if r.Status != "success" {
+		return nil, fmt.Errorf("prometheus query %q: %s: %s", query, r.ErrorType, r.Error)
+	}
+
+	switch r.Data.ResultType {
+	case "vector":
+		var vector []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]interface{}    `json:"value"`
+		}
+		if err := json.Unmarshal(r.Data.Result, &vector); err != nil {
+			return nil, fmt.Errorf("prometheus query %q: %w", query, err)
+		}
+		samples := make([]Sample, 0, len(vector))
+		for _, v := range vector {
+			sample, err := parseValue(v.Value)
+			if err != nil {
+				return nil, fmt.Errorf("prometheus query %q: %w", query, err)
+			}
+			sample.Labels = v.Metric
+			samples = append(samples, sample)
+		}
+		return samples, nil
+
+	case "scalar":
+		var scalar [2]interface{}
+		if err := json.Unmarshal(r.Data.Result, &scalar); err != nil {
+			return nil, fmt.Errorf("prometheus query %q: %w", query, err)
+		}
+		sample, err := parseValue(scalar)
+		if err != nil {
+			return nil, fmt.Errorf("prometheus query %q: %w", query, err)
+		}
+		return []Sample{sample}, nil
+
+	default:
+		return nil, fmt.Errorf("prometheus query %q: unsupported result type %q", query, r.Data.ResultType)
+	}
+}
+
+// Sum runs an instant query and adds up every series in the result
+func (c *Client) Sum(ctx context.Context, query string, at time.Time) (float64, error) {
+	samples, err := c.Query(ctx, query, at)
+	if err != nil {
+		return 0, err
+	}
+	total := 0.0
+	for _, s := range samples {
+		total += s.Value
+	}
+	return total, nil
+}
+
+// parseValue reads a [<unix seconds>, "<value>"] pair
+func parseValue(pair [2]interface{}) (Sample, error) {
+	ts, ok := pair[0].(float64)
+	if !ok {
+		return Sample{}, fmt.Errorf("bad sample timestamp %v", pair[0])
+	}
+	s, ok := pair[1].(string)
+	if !ok {
+		return Sample{}, fmt.Errorf("bad sample value %v", pair[1])
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Sample{}, err
+	}
+	sec := int64(ts)
+	return Sample{Value: value, Time: time.Unix(sec, int64((ts-float64(sec))*1e9)).UTC()}, nil
+}
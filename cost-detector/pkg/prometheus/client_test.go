@@ -0,0 +1,84 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer answers instant queries with a canned response body
+func newTestServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q, want the bearer token", got)
+		}
+		if got := r.URL.Query().Get("query"); got != "sum(rate(orders_total[5m]))" {
+			t.Errorf("query = %q", got)
+		}
+		if got := r.URL.Query().Get("time"); got != "1767225600.000" {
+			t.Errorf("time = %q, want 1767225600.000", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+var at = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestQueryVector(t *testing.T) {
+	server := newTestServer(t, `{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"pod":"checkout-1"},"value":[1767225600.5,"4.25"]},
+		{"metric":{"pod":"checkout-2"},"value":[1767225600.5,"5.75"]}]}}`)
+	client := NewClient(server.URL+"/", "secret")
+
+	samples, err := client.Query(context.Background(), "sum(rate(orders_total[5m]))", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 || samples[0].Labels["pod"] != "checkout-1" || samples[0].Value != 4.25 {
+		t.Fatalf("samples = %+v", samples)
+	}
+	if want := at.Add(500 * time.Millisecond); !samples[0].Time.Equal(want) {
+		t.Errorf("time = %s, want %s", samples[0].Time, want)
+	}
+	total, err := client.Sum(context.Background(), "sum(rate(orders_total[5m]))", at)
+	if err != nil || total != 10 {
+		t.Errorf("Sum = %g, %v, want 10", total, err)
+	}
+}
+
+func TestQueryScalar(t *testing.T) {
+	server := newTestServer(t, `{"status":"success","data":{"resultType":"scalar","result":[1767225600,"12"]}}`)
+	total, err := NewClient(server.URL, "secret").Sum(context.Background(), "sum(rate(orders_total[5m]))", at)
+	if err != nil || total != 12 {
+		t.Errorf("Sum = %g, %v, want 12", total, err)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, tt := range []struct {
+		body string
+		want string
+	}{
+		{`{"status":"error","errorType":"bad_data","error":"parse error"}`, "bad_data: parse error"},
+		{`{"status":"success","data":{"resultType":"matrix","result":[]}}`, `unsupported result type "matrix"`},
+		{`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1767225600,"many"]}]}}`, "invalid syntax"},
+		{`upstream timed out`, "upstream timed out"},
+	} {
+		server := newTestServer(t, tt.body)
+		_, err := NewClient(server.URL, "secret").Query(context.Background(), "sum(rate(orders_total[5m]))", at)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Query with %s: error %v, want %q", tt.body, err, tt.want)
+		}
+	}
+}
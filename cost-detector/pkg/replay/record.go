@@ -0,0 +1,159 @@
+// Package replay records the watcher's pod and node events to a file and
+// plays them back through the calculator, alerter and notifier on a fake
+// clock, so alerting can be reproduced and regression-tested offline.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"cost-detector/pkg/clock"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/watcher"
+)
+
+// Kinds of record
+const (
+	KindPod    = "pod"
+	KindNode   = "node"
+	KindSynced = "synced" // The state so far is what the detector started with
+)
+
+// Record is one line of a recording
+type Record struct {
+	Time time.Time         `json:"time"`
+	Kind string            `json:"kind"`
+	Type watcher.EventType `json:"type,omitempty"`
+	Pod  *models.Pod       `json:"pod,omitempty"`
+	Node *models.Node      `json:"node,omitempty"`
+}
+
+// Recorder appends every pod and node event a watcher sees to a file as
+// JSON lines
+type Recorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	clock  clock.Clock
+	closed bool
+	err    error // First write error; recording stops there
+	count  int
+}
+
+// NewRecorder starts recording a watcher's events to path, replacing the
+// file. It first writes the nodes and pods the watcher already has and a
+// synced marker, so a replay starts from the same state.
+func NewRecorder(path string, w *watcher.Watcher, c clock.Clock) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{file: file, clock: c}
+
+	// Register first so no event is missed; one racing with the snapshot
+	// below is recorded twice, which replays the same
+	w.OnNodeEvent(func(e watcher.NodeEvent) {
+		r.write(Record{Kind: KindNode, Type: e.Type, Node: e.Node})
+	})
+	w.OnEvent(func(e watcher.Event) {
+		r.write(Record{Kind: KindPod, Type: e.Type, Pod: e.Pod})
+	})
+	for _, node := range w.Nodes() {
+		r.write(Record{Kind: KindNode, Type: watcher.PodAdded, Node: node})
+	}
+	for _, pod := range w.Pods() {
+		r.write(Record{Kind: KindPod, Type: watcher.PodAdded, Pod: pod})
+	}
+	r.write(Record{Kind: KindSynced})
+	if err := r.Err(); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// write appends a record stamped with the current time
+func (r *Recorder) write(record Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.err != nil {
+		return
+	}
+	record.Time = r.clock.Now().UTC()
+	data, err := json.Marshal(record)
+	if err == nil {
+		_, err = r.file.Write(append(data, '\n'))
+	}
+	if err != nil {
+		r.err = err
+		return
+	}
+	r.count++
+}
+
+// Count returns how many records were written
+func (r *Recorder) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count
+}
+
+// Err returns the write error that stopped the recording, if any
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close stops recording and closes the file
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return r.err
+	}
+	r.closed = true
+	if err := r.file.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// Read reads a recording. A torn last line (the detector stopped mid-write) is skipped.
+func Read(in io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 1<<20), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			if !scanner.Scan() {
+				break // Torn last line
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if record.Kind == KindPod && record.Pod == nil || record.Kind == KindNode && record.Node == nil {
+			return nil, fmt.Errorf("line %d: %s record without a %s", line, record.Kind, record.Kind)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// ReadFile reads a recording from a file
+func ReadFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return records, nil
+}
@@ -0,0 +1,213 @@
+package replay
+
+import (
+	"context"
+	"time"
+
+	"cost-detector/pkg/alerts"
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/clock"
+	"cost-detector/pkg/costpolicy"
+	"cost-detector/pkg/index"
+	"cost-detector/pkg/logger"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/notify"
+	"cost-detector/pkg/teams"
+	"cost-detector/pkg/watcher"
+)
+
+// Sent is an alert or digest the replay handed to the sender, at the recorded
+// time it went out
+type Sent struct {
+	Time  time.Time         `json:"time"`
+	Alert *models.CostAlert `json:"alert"`
+}
+
+// Result summarizes a replay
+type Result struct {
+	From     time.Time `json:"from"` // Recorded time of the first and last record
+	To       time.Time `json:"to"`
+	Records  int       `json:"records"`
+	Checks   int       `json:"budgetChecks"`
+	Alerts   []Sent    `json:"alerts"`
+	Resolved []Sent    `json:"resolved"` // Budget alerts that stopped firing; Alert has only Service and Kind set
+}
+
+// Replayer plays a recording through the same pipeline the detector runs:
+// pods are priced by Calculator into a cost index, pods going over the
+// threshold alert as they change, budgets are checked every BudgetInterval
+// of recorded time, and alerts go through a notify.Scheduler on recorded
+// time to the sender
+type Replayer struct {
+	Speed          float64            // Recorded time per wall-clock time, e.g. 3600 plays an hour a second; 0 is as fast as possible
+	BudgetInterval time.Duration      // Recorded time between budget checks
+	NotifyInterval time.Duration      // Recorded time between checks for digests that are due
+	Notify         notify.Preferences // Digest window and quiet hours for the default channel
+	IndexLabels    []string           // Pod label keys the index keeps totals for
+	Owner          func(pod *models.Pod) string
+	Log            *logger.Logger
+
+	calculator *calculator.Calculator
+	alerter    *alerts.Alerter
+	sender     teams.Sender
+}
+
+// NewReplayer creates a replayer feeding calc, alerter and sender
+func NewReplayer(calc *calculator.Calculator, alerter *alerts.Alerter, sender teams.Sender) *Replayer {
+	return &Replayer{
+		BudgetInterval: time.Minute,
+		NotifyInterval: time.Second,
+		Notify:         notify.Preferences{Window: time.Minute, Location: time.UTC},
+		Owner:          (*models.Pod).Team,
+		Log:            logger.NewLogger(logger.LevelInfo, logger.FormatText),
+		calculator:     calc,
+		alerter:        alerter,
+		sender:         sender,
+	}
+}
+
+// Run replays records in order until they run out or ctx is done. The
+// calculator's nodes are replaced by the recorded ones.
+func (r *Replayer) Run(ctx context.Context, records []Record) (*Result, error) {
+	result := &Result{Alerts: []Sent{}, Resolved: []Sent{}}
+	if len(records) == 0 {
+		return result, nil
+	}
+	result.From, result.To = records[0].Time, records[len(records)-1].Time
+	fake := clock.NewFake(result.From)
+
+	watchr := watcher.NewWatcher("replay")
+	r.calculator.Nodes = watchr
+	costIndex := index.NewIndex(watchr, r.calculator, r.IndexLabels)
+	// Alerts go through the detector's scheduler on recorded time, so
+	// digests and quiet hours come out as they would have
+	scheduler := notify.NewScheduler(&recording{result: result, clock: fake, sender: r.sender}, r.alerter, fake, r.Log)
+	scheduler.Defaults = r.Notify
+	send := func(alert *models.CostAlert) {
+		if err := scheduler.SendAlert(alert); err != nil {
+			r.Log.Error("Sending alert failed", "service", alert.Service, "kind", alert.Kind, "route", alert.Route, "error", err)
+		}
+	}
+
+	// Pods changing after startup alert as they go over the threshold;
+	// handlers run under the index lock, so alerts are sent after each record
+	var pending []*models.CostAlert
+	watchPods := func() {
+		costIndex.OnChange(func(c index.Change) {
+			if c.Type == watcher.PodDeleted {
+				return
+			}
+			if alert := r.alerter.CheckPodChange(c.Pod, c.Old, r.Owner(c.Pod), c.Cost, c.OldCost, fake.Now()); alert != nil {
+				pending = append(pending, alert)
+			}
+		})
+	}
+
+	firing := alerts.NewFiring()
+	synced := false
+	nextCheck, nextTick := result.From, result.From
+	// advance moves recorded time up to until, checking budgets once synced
+	// and sending digests as they fall due, in the order they'd have happened
+	advance := func(until time.Time) {
+		for {
+			check := synced && r.BudgetInterval > 0 && !nextCheck.After(until)
+			tick := r.NotifyInterval > 0 && !nextTick.After(until)
+			if check && (!tick || !nextCheck.After(nextTick)) {
+				fake.Set(nextCheck)
+				alerted, resolved := firing.Update(costpolicy.CheckBudgets(r.alerter, costIndex, nextCheck))
+				for _, alert := range alerted {
+					send(alert)
+				}
+				for _, alert := range resolved {
+					result.Resolved = append(result.Resolved, Sent{Time: nextCheck, Alert: &models.CostAlert{Service: alert.Service, Kind: alert.Kind}})
+				}
+				result.Checks++
+				nextCheck = nextCheck.Add(r.BudgetInterval)
+			} else if tick {
+				fake.Set(nextTick)
+				scheduler.Tick()
+				nextTick = nextTick.Add(r.NotifyInterval)
+			} else {
+				break
+			}
+		}
+		fake.Set(until)
+	}
+
+	start := time.Now()
+	for _, record := range records {
+		if err := r.wait(ctx, start, result.From, record.Time); err != nil {
+			return result, err
+		}
+		advance(record.Time)
+
+		switch record.Kind {
+		case KindNode:
+			if record.Type == watcher.PodDeleted {
+				watchr.DeleteNode(record.Node.Name)
+			} else {
+				watchr.AddNode(record.Node)
+			}
+		case KindPod:
+			if record.Type == watcher.PodDeleted {
+				watchr.Delete(record.Pod.Namespace, record.Pod.Name)
+			} else {
+				watchr.Add(record.Pod)
+			}
+		case KindSynced:
+			if synced {
+				break
+			}
+			// Startup: every pod is checked once, as the detector does
+			// after its first sync
+			synced = true
+			for _, pod := range watchr.Pods() {
+				if alert := r.alerter.CheckPod(pod, r.Owner(pod), r.calculator.CalculatePodCost(pod), fake.Now()); alert != nil {
+					send(alert)
+				}
+			}
+			watchPods()
+			advance(record.Time)
+		}
+		result.Records++
+
+		for _, alert := range pending {
+			send(alert)
+		}
+		pending = pending[:0]
+	}
+	advance(result.To)
+	// Digests still waiting go out, as they do when the detector shuts down
+	scheduler.Flush()
+	return result, nil
+}
+
+// recording hands alerts to a sender, adding them to the result at the
+// recorded time they went out
+type recording struct {
+	result *Result
+	clock  clock.Clock
+	sender teams.Sender
+}
+
+// SendAlert records and sends an alert
+func (s *recording) SendAlert(alert *models.CostAlert) error {
+	s.result.Alerts = append(s.result.Alerts, Sent{Time: s.clock.Now(), Alert: alert})
+	return s.sender.SendAlert(alert)
+}
+
+// wait sleeps until a record is due at Speed
+func (r *Replayer) wait(ctx context.Context, start time.Time, from time.Time, at time.Time) error {
+	if r.Speed <= 0 {
+		return ctx.Err()
+	}
+	due := start.Add(time.Duration(float64(at.Sub(from)) / r.Speed))
+	timer := time.NewTimer(time.Until(due))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,337 @@
+package simulator
+
+import (
+	"sort"
+	"strings"
+
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/pricing"
+)
+
+// Per-node resources kept back for the kubelet, system daemons and eviction thresholds
+const (
+	defaultReservedCPU    = 0.1  // cores
+	defaultReservedMemory = 0.75 // GiB
+)
+
+// Scenario is a what-if question asked of the simulator
+type Scenario struct {
+	SpotNamespaces []string `json:"spotNamespaces,omitempty"` // Namespaces moved to spot capacity
+	Graviton       bool     `json:"graviton,omitempty"`       // Only use arm64 (Graviton) instance types
+	Families       []string `json:"families,omitempty"`       // Only use these families, e.g. "m5", "c6g"
+}
+
+// PlannedNodes is a group of identical nodes in a plan
+type PlannedNodes struct {
+	InstanceType string  `json:"instanceType"`
+	CapacityType string  `json:"capacityType"` // "on-demand" or "spot"
+	Count        int     `json:"count"`
+	CostPerHr    float64 `json:"costPerHr"` // Total for the group
+}
+
+// Plan is the cheapest node set the simulator found for a scenario
+type Plan struct {
+	Scenario       Scenario       `json:"scenario"`
+	Nodes          []PlannedNodes `json:"nodes"`
+	NodeCount      int            `json:"nodeCount"`
+	CostPerHr      float64        `json:"costPerHr"`        // Planned node cost
+	CurrentNodes   int            `json:"currentNodes"`     // Nodes running today
+	CurrentCost    float64        `json:"currentCostPerHr"` // Cost of today's nodes (0 if unknown)
+	SavingsPerHr   float64        `json:"savingsPerHr"`
+	SavingsPercent float64        `json:"savingsPercent"`
+	Unschedulable  []string       `json:"unschedulable,omitempty"` // Pods too big for any allowed type
+}
+
+// Simulator bin-packs pods onto a catalog of instance types
+type Simulator struct {
+	catalog        *pricing.Catalog
+	ReservedCPU    float64 // Cores reserved on every node
+	ReservedMemory float64 // GiB reserved on every node
+}
+
+// NewSimulator creates a new consolidation simulator
+func NewSimulator(catalog *pricing.Catalog) *Simulator {
+	return &Simulator{
+		catalog:        catalog,
+		ReservedCPU:    defaultReservedCPU,
+		ReservedMemory: defaultReservedMemory,
+	}
+}
+
+// node is a node being filled during packing
+type node struct {
+	instanceType pricing.InstanceType
+	freeCPU      float64
+	freeMemory   float64
+	pods         []*models.Pod
+}
+
+// Run finds the cheapest node set that fits every pod under a scenario and
+// compares it with the nodes running today
+func (s *Simulator) Run(pods []*models.Pod, currentNodes []*models.Node, scenario Scenario) *Plan {
+	// Fargate pods don't run on nodes we could consolidate
+	fargate := make(map[string]bool)
+	var ec2Nodes []*models.Node
+	for _, n := range currentNodes {
+		if pricing.IsFargate(n) {
+			fargate[n.Name] = true
+		} else {
+			ec2Nodes = append(ec2Nodes, n)
+		}
+	}
+	currentNodes = ec2Nodes
+	plan := &Plan{Scenario: scenario, CurrentNodes: len(currentNodes)}
+
+	spotNamespaces := make(map[string]bool)
+	for _, ns := range scenario.SpotNamespaces {
+		spotNamespaces[ns] = true
+	}
+	var onDemandPods, spotPods []*models.Pod
+	for _, pod := range pods {
+		if fargate[pod.NodeName] {
+			continue
+		}
+		if spotNamespaces[pod.Namespace] {
+			spotPods = append(spotPods, pod)
+		} else {
+			onDemandPods = append(onDemandPods, pod)
+		}
+	}
+
+	types := s.allowedTypes(scenario, currentNodes)
+	for _, pool := range []struct {
+		capacityType string
+		pods         []*models.Pod
+	}{{pricing.OnDemand, onDemandPods}, {pricing.Spot, spotPods}} {
+		if len(pool.pods) == 0 {
+			continue
+		}
+		nodes, unschedulable := s.cheapestPacking(pool.pods, types, pool.capacityType)
+		plan.Unschedulable = append(plan.Unschedulable, unschedulable...)
+		plan.Nodes = append(plan.Nodes, groupNodes(nodes, pool.capacityType)...)
+	}
+
+	for _, group := range plan.Nodes {
+		plan.NodeCount += group.Count
+		plan.CostPerHr += group.CostPerHr
+	}
+
+	known := true
+	for _, n := range currentNodes {
+		price, ok := s.catalog.NodePrice(n)
+		if !ok {
+			known = false
+			break
+		}
+		plan.CurrentCost += price
+	}
+	if !known {
+		plan.CurrentCost = 0
+	}
+	if plan.CurrentCost > 0 {
+		plan.SavingsPerHr = plan.CurrentCost - plan.CostPerHr
+		plan.SavingsPercent = plan.SavingsPerHr / plan.CurrentCost * 100
+	}
+	return plan
+}
+
+// allowedTypes filters the catalog by the scenario's architecture and
+// families. Without the Graviton question the plan keeps the architectures
+// the cluster runs today (amd64 if unknown), since images may not be multi-arch.
+func (s *Simulator) allowedTypes(scenario Scenario, currentNodes []*models.Node) []pricing.InstanceType {
+	families := make(map[string]bool)
+	for _, f := range scenario.Families {
+		families[f] = true
+	}
+
+	archs := map[string]bool{"arm64": true}
+	if !scenario.Graviton {
+		archs = make(map[string]bool)
+		for _, n := range currentNodes {
+			if t, ok := s.catalog.Lookup(pricing.NodeInstanceType(n)); ok {
+				archs[t.Arch] = true
+			}
+		}
+		if len(archs) == 0 {
+			archs["amd64"] = true
+		}
+	}
+
+	var types []pricing.InstanceType
+	for _, t := range s.catalog.Types() {
+		if !archs[t.Arch] {
+			continue
+		}
+		if len(families) > 0 && !families[family(t.Name)] {
+			continue
+		}
+		types = append(types, t)
+	}
+	return types
+}
+
+// cheapestPacking tries every instance type as the primary node type and
+// keeps the cheapest result. Each packing is first-fit decreasing, then every
+// node is right-sized to the cheapest type that still holds its pods, so the
+// result can mix types.
+func (s *Simulator) cheapestPacking(pods []*models.Pod, types []pricing.InstanceType, capacityType string) ([]*node, []string) {
+	sorted := make([]*models.Pod, len(pods))
+	copy(sorted, pods)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return s.size(sorted[i]) > s.size(sorted[j])
+	})
+
+	var best []*node
+	var bestUnschedulable []string
+	bestCost := -1.0
+	for _, primary := range types {
+		nodes, unschedulable := s.pack(sorted, primary, types, capacityType)
+		for _, n := range nodes {
+			s.rightSize(n, types, capacityType)
+		}
+		cost := nodesCost(nodes, capacityType)
+		if bestCost < 0 || len(unschedulable) < len(bestUnschedulable) ||
+			(len(unschedulable) == len(bestUnschedulable) && cost < bestCost) {
+			best, bestUnschedulable, bestCost = nodes, unschedulable, cost
+		}
+	}
+	return best, bestUnschedulable
+}
+
+// pack places pods first-fit onto nodes of the primary type, falling back to
+// the cheapest type at the pool's capacity type that fits for pods too big for it
+func (s *Simulator) pack(sorted []*models.Pod, primary pricing.InstanceType, types []pricing.InstanceType, capacityType string) ([]*node, []string) {
+	var nodes []*node
+	var unschedulable []string
+
+	for _, pod := range sorted {
+		placed := false
+		for _, n := range nodes {
+			if n.fits(pod) {
+				n.place(pod)
+				placed = true
+				break
+			}
+		}
+		if placed {
+			continue
+		}
+
+		t := primary
+		if !s.fitsEmpty(pod, t) {
+			var ok bool
+			if t, ok = s.smallestFitting([]*models.Pod{pod}, types, capacityType); !ok {
+				unschedulable = append(unschedulable, pod.Namespace+"/"+pod.Name)
+				continue
+			}
+		}
+		n := s.newNode(t)
+		n.place(pod)
+		nodes = append(nodes, n)
+	}
+	return nodes, unschedulable
+}
+
+// rightSize moves a node to the cheapest type that holds all of its pods
+func (s *Simulator) rightSize(n *node, types []pricing.InstanceType, capacityType string) {
+	t, ok := s.smallestFitting(n.pods, types, capacityType)
+	if !ok || t.Price(capacityType) >= n.instanceType.Price(capacityType) {
+		return
+	}
+	resized := s.newNode(t)
+	for _, pod := range n.pods {
+		resized.place(pod)
+	}
+	*n = *resized
+}
+
+// smallestFitting returns the cheapest type that can hold all the given pods
+func (s *Simulator) smallestFitting(pods []*models.Pod, types []pricing.InstanceType, capacityType string) (pricing.InstanceType, bool) {
+	cpu, memory := 0.0, 0.0
+	for _, pod := range pods {
+		cpu += pod.CPU
+		memory += pod.Memory
+	}
+
+	var best pricing.InstanceType
+	found := false
+	for _, t := range types {
+		if t.CPU-s.ReservedCPU < cpu || t.Memory-s.ReservedMemory < memory {
+			continue
+		}
+		if !found || t.Price(capacityType) < best.Price(capacityType) {
+			best, found = t, true
+		}
+	}
+	return best, found
+}
+
+// newNode creates an empty node of a type
+func (s *Simulator) newNode(t pricing.InstanceType) *node {
+	return &node{
+		instanceType: t,
+		freeCPU:      t.CPU - s.ReservedCPU,
+		freeMemory:   t.Memory - s.ReservedMemory,
+	}
+}
+
+// fitsEmpty reports whether a pod fits on an empty node of a type
+func (s *Simulator) fitsEmpty(pod *models.Pod, t pricing.InstanceType) bool {
+	return pod.CPU <= t.CPU-s.ReservedCPU && pod.Memory <= t.Memory-s.ReservedMemory
+}
+
+// size ranks pods for first-fit decreasing; 1 core is weighted like 4 GiB
+func (s *Simulator) size(pod *models.Pod) float64 {
+	return pod.CPU*4 + pod.Memory
+}
+
+func (n *node) fits(pod *models.Pod) bool {
+	return pod.CPU <= n.freeCPU && pod.Memory <= n.freeMemory
+}
+
+func (n *node) place(pod *models.Pod) {
+	n.freeCPU -= pod.CPU
+	n.freeMemory -= pod.Memory
+	n.pods = append(n.pods, pod)
+}
+
+// nodesCost totals the hourly price of a set of nodes
+func nodesCost(nodes []*node, capacityType string) float64 {
+	total := 0.0
+	for _, n := range nodes {
+		total += n.instanceType.Price(capacityType)
+	}
+	return total
+}
+
+// groupNodes counts nodes per instance type, most expensive group first
+func groupNodes(nodes []*node, capacityType string) []PlannedNodes {
+	groups := make(map[string]*PlannedNodes)
+	for _, n := range nodes {
+		g, ok := groups[n.instanceType.Name]
+		if !ok {
+			g = &PlannedNodes{InstanceType: n.instanceType.Name, CapacityType: capacityType}
+			groups[n.instanceType.Name] = g
+		}
+		g.Count++
+		g.CostPerHr += n.instanceType.Price(capacityType)
+	}
+
+	result := make([]PlannedNodes, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CostPerHr != result[j].CostPerHr {
+			return result[i].CostPerHr > result[j].CostPerHr
+		}
+		return result[i].InstanceType < result[j].InstanceType
+	})
+	return result
+}
+
+// family returns the family part of an instance type ("m5" for "m5.xlarge")
+func family(instanceType string) string {
+	name, _, _ := strings.Cut(instanceType, ".")
+	return name
+}
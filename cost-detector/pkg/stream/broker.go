@@ -0,0 +1,176 @@
+package stream
+
+import (
+	"sync"
+	"time"
+
+	"cost-detector/pkg/index"
+	"cost-detector/pkg/watcher"
+)
+
+// Kinds of cost event
+const (
+	PodCreated  = "created"
+	PodDeleted  = "deleted"
+	PodResized  = "resized"  // Requests changed
+	PodRepriced = "repriced" // Same requests, different price (moved node, new pricing)
+)
+
+// DefaultBuffer is how many events a subscriber may fall behind before it is dropped
+const DefaultBuffer = 256
+
+// Event is a change in cost caused by a pod coming, going or changing size
+type Event struct {
+	ID                 uint64    `json:"id"`
+	Type               string    `json:"type"`
+	Time               time.Time `json:"time"`
+	Namespace          string    `json:"namespace"`
+	Pod                string    `json:"pod"`
+	Workload           string    `json:"workload"`
+	Team               string    `json:"team"`
+	Node               string    `json:"node,omitempty"`
+	CPU                float64   `json:"cpu"`
+	Memory             float64   `json:"memory"`
+	OldCostPerHr       float64   `json:"oldCostPerHr"`
+	CostPerHr          float64   `json:"costPerHr"`
+	DeltaPerHr         float64   `json:"deltaPerHr"`
+	NamespaceCostPerHr float64   `json:"namespaceCostPerHr"` // Namespace total after the change
+	ClusterCostPerHr   float64   `json:"clusterCostPerHr"`   // Cluster total after the change
+}
+
+// Snapshot is the cost of every namespace at a point in time, sent when a client connects
+type Snapshot struct {
+	ID               uint64             `json:"id"` // Last event included
+	Time             time.Time          `json:"time"`
+	Namespaces       map[string]float64 `json:"namespaces"`
+	ClusterCostPerHr float64            `json:"clusterCostPerHr"`
+}
+
+// Subscription receives events until it is closed or falls behind
+type Subscription struct {
+	Events    <-chan Event
+	events    chan Event
+	namespace string
+	dropped   bool
+}
+
+// Broker turns index changes into cost events and fans them out to
+// subscribers. Publishing never blocks: a subscriber whose buffer is full is
+// dropped, and its client reconnects for a fresh snapshot.
+type Broker struct {
+	Buffer int // Events a subscriber may fall behind
+
+	index *index.Index
+
+	mu          sync.Mutex
+	lastID      uint64
+	subscribers map[*Subscription]bool
+}
+
+// NewBroker creates a broker fed by the index's changes
+func NewBroker(idx *index.Index) *Broker {
+	b := &Broker{
+		Buffer:      DefaultBuffer,
+		index:       idx,
+		subscribers: make(map[*Subscription]bool),
+	}
+	idx.OnChange(b.handle)
+	return b
+}
+
+// handle publishes the cost change of one pod
+func (b *Broker) handle(c index.Change) {
+	var eventType string
+	switch {
+	case c.Type == watcher.PodDeleted:
+		eventType = PodDeleted
+	case c.Old == nil:
+		eventType = PodCreated
+	case c.Old.CPU != c.Pod.CPU || c.Old.Memory != c.Pod.Memory:
+		eventType = PodResized
+	case c.Cost != c.OldCost:
+		eventType = PodRepriced
+	default:
+		return
+	}
+
+	pod := c.Pod
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	b.publish(Event{
+		ID:                 b.lastID,
+		Type:               eventType,
+		Time:               time.Now().UTC(),
+		Namespace:          pod.Namespace,
+		Pod:                pod.Name,
+		Workload:           pod.Workload,
+		Team:               pod.Team(),
+		Node:               pod.NodeName,
+		CPU:                pod.CPU,
+		Memory:             pod.Memory,
+		OldCostPerHr:       c.OldCost,
+		CostPerHr:          c.Cost,
+		DeltaPerHr:         c.Cost - c.OldCost,
+		NamespaceCostPerHr: c.Namespace.CostPerHr,
+		ClusterCostPerHr:   c.Cluster.CostPerHr,
+	})
+}
+
+// publish hands an event to every subscriber without blocking; callers hold b.mu
+func (b *Broker) publish(e Event) {
+	for sub := range b.subscribers {
+		if sub.namespace != "" && sub.namespace != e.Namespace {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			// Too slow: drop it rather than hold up the watcher
+			sub.dropped = true
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Subscribe returns a snapshot of current totals and a subscription for
+// events after it. An empty namespace subscribes to every namespace.
+func (b *Broker) Subscribe(namespace string) (*Snapshot, *Subscription) {
+	events := make(chan Event, b.Buffer)
+	sub := &Subscription{Events: events, events: events, namespace: namespace}
+	snapshot := &Snapshot{Time: time.Now().UTC(), Namespaces: make(map[string]float64)}
+
+	// Subscribe while the index is locked so no change falls between the
+	// snapshot and the first event
+	summaries, cluster, _ := b.index.Snapshot(index.ByNamespace, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.subscribers[sub] = true
+		snapshot.ID = b.lastID
+	})
+	for _, summary := range summaries {
+		if namespace == "" || summary.Name == namespace {
+			snapshot.Namespaces[summary.Name] = summary.CostPerHr
+		}
+	}
+	snapshot.ClusterCostPerHr = cluster.CostPerHr
+	return snapshot, sub
+}
+
+// Unsubscribe stops a subscription; it is safe to call after it was dropped
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[sub] {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Dropped reports whether the subscription was closed for falling behind
+func (b *Broker) Dropped(sub *Subscription) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return sub.dropped
+}
@@ -1,33 +1,116 @@
 package teams
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"cost-detector/pkg/logger"
 	"cost-detector/pkg/models"
 )
 
+// Sender sends cost alerts
+type Sender interface {
+	SendAlert(alert *models.CostAlert) error
+}
+
 // TeamsClient sends messages to Microsoft Teams
 type TeamsClient struct {
 	WebhookURL string
+	HTTP       *http.Client
+	Log        *logger.Logger // Where alerts go without a webhook; stdout by default
 }
 
 // NewTeamsClient creates a new Teams client
 func NewTeamsClient(webhookURL string) *TeamsClient {
 	return &TeamsClient{
 		WebhookURL: webhookURL,
+		HTTP:       &http.Client{Timeout: 30 * time.Second},
+		Log:        logger.NewLogger(logger.LevelInfo, logger.FormatText),
 	}
 }
 
-// SendAlert sends a cost alert to Teams
+// themeColors colors the card's edge by severity
+var themeColors = map[string]string{"info": "2B88D8", "warning": "FFB900", "critical": "D13438"}
+
+// SendAlert posts a cost alert to its route's webhook, or the default one.
+// Without a webhook the alert is only logged.
 func (tc *TeamsClient) SendAlert(alert *models.CostAlert) error {
-	message := fmt.Sprintf(
-		"🚨 COST ALERT\nTeam: %s\nService: %s\nCost/Hr: $%.2f\nSeverity: %s",
-		alert.Team,
-		alert.Service,
-		alert.CostPerHr,
-		alert.Severity,
-	)
-	
-	fmt.Printf("Would send to Teams: %s\n", message)
-	// TODO: Actually call Teams API with webhook
+	webhook := alert.WebhookURL
+	if webhook == "" {
+		webhook = tc.WebhookURL
+	}
+	if webhook == "" {
+		tc.Log.Info("Would send to Teams", fields(alert)...)
+		return nil
+	}
+
+	body, err := json.Marshal(card(alert))
+	if err != nil {
+		return err
+	}
+	resp, err := tc.HTTP.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("teams webhook: %s: %s", resp.Status, strings.TrimSpace(string(reply)))
+	}
 	return nil
 }
+
+// fields lists an alert's contents as log fields
+func fields(alert *models.CostAlert) []interface{} {
+	keyvals := []interface{}{"team", alert.Team, "service", alert.Service, "kind", alert.Kind,
+		"costPerHr", alert.CostPerHr, "severity", alert.Severity}
+	if alert.Route != "" {
+		keyvals = append(keyvals, "route", alert.Route)
+	}
+	if alert.Message != "" {
+		keyvals = append(keyvals, "message", alert.Message)
+	}
+	if len(alert.Actions) > 0 {
+		actions := make([]string, 0, len(alert.Actions))
+		for _, action := range alert.Actions {
+			actions = append(actions, action.Title+": "+action.URL)
+		}
+		keyvals = append(keyvals, "actions", actions)
+	}
+	return keyvals
+}
+
+// card formats an alert as a Teams message card with its action links as buttons
+func card(alert *models.CostAlert) map[string]interface{} {
+	facts := []map[string]string{
+		{"name": "Service", "value": alert.Service},
+		{"name": "Cost/Hr", "value": fmt.Sprintf("$%.2f", alert.CostPerHr)},
+		{"name": "Severity", "value": alert.Severity},
+	}
+	if alert.Team != "" {
+		facts = append([]map[string]string{{"name": "Team", "value": alert.Team}}, facts...)
+	}
+	actions := make([]map[string]interface{}, 0, len(alert.Actions))
+	for _, action := range alert.Actions {
+		actions = append(actions, map[string]interface{}{
+			"@type":   "OpenUri",
+			"name":    action.Title,
+			"targets": []map[string]string{{"os": "default", "uri": action.URL}},
+		})
+	}
+	return map[string]interface{}{
+		"@type":           "MessageCard",
+		"@context":        "https://schema.org/extensions",
+		"summary":         "Cost alert: " + alert.Service,
+		"title":           "🚨 Cost alert: " + alert.Service,
+		"themeColor":      themeColors[alert.Severity],
+		"text":            strings.ReplaceAll(alert.Message, "\n", "\n\n"), // Teams needs blank lines for line breaks
+		"sections":        []map[string]interface{}{{"facts": facts}},
+		"potentialAction": actions,
+	}
+}
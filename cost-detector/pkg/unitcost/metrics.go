@@ -0,0 +1,54 @@
+package unitcost
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Metric is a business throughput metric a service's cost is divided by
+type Metric struct {
+	Service   string  `json:"service"`   // Name to report, defaults to the workload
+	Namespace string  `json:"namespace"` // Namespace of the workload
+	Workload  string  `json:"workload"`  // Deployment, StatefulSet, ... whose pods are costed
+	Unit      string  `json:"unit"`      // What is counted, e.g. "requests" or "orders"
+	Per       float64 `json:"per"`       // Units the cost is quoted per, e.g. 1000
+	Query     string  `json:"query"`     // PromQL returning units per second
+}
+
+// LoadMetrics reads the metrics file, a JSON list of Metric:
+//
+//	[{"namespace": "payments", "workload": "checkout", "unit": "requests", "per": 1000,
+//	  "query": "sum(rate(http_requests_total{namespace=\"payments\",service=\"checkout\"}[5m]))"}]
+func LoadMetrics(path string) ([]Metric, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var metrics []Metric
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range metrics {
+		m := &metrics[i]
+		if m.Namespace == "" || m.Workload == "" || m.Query == "" {
+			return nil, fmt.Errorf("%s: metric %d needs namespace, workload and query", path, i+1)
+		}
+		if m.Service == "" {
+			m.Service = m.Workload
+		}
+		if m.Unit == "" {
+			m.Unit = "requests"
+		}
+		if m.Per <= 0 {
+			m.Per = 1000
+		}
+		if seen[m.Service] {
+			return nil, fmt.Errorf("%s: service %q is listed twice", path, m.Service)
+		}
+		seen[m.Service] = true
+	}
+	return metrics, nil
+}
@@ -0,0 +1,306 @@
+package unitcost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/prometheus"
+)
+
+// Labels that change on every rollout of a Deployment, StatefulSet or DaemonSet
+var revisionLabels = []string{"pod-template-hash", "controller-revision-hash"}
+
+// PodSource provides the pods being costed
+type PodSource interface {
+	Pods() []*models.Pod
+}
+
+// Point is one sample of a service's unit cost
+type Point struct {
+	Time        time.Time `json:"time"`
+	CostPerHr   float64   `json:"costPerHr"`
+	UnitsPerSec float64   `json:"unitsPerSec"`
+	CostPerUnit float64   `json:"costPerUnit"` // Cost per Metric.Per units; 0 when there was no traffic
+}
+
+// Series is a service's unit cost over time
+type Series struct {
+	Service   string  `json:"service"`
+	Namespace string  `json:"namespace"`
+	Workload  string  `json:"workload"`
+	Team      string  `json:"team"`
+	Unit      string  `json:"unit"`
+	Per       float64 `json:"per"`
+	Points    []Point `json:"points"`
+}
+
+// Regression is a sharp rise in cost per unit after a deploy
+type Regression struct {
+	Service         string    `json:"service"`
+	Namespace       string    `json:"namespace"`
+	Workload        string    `json:"workload"`
+	Team            string    `json:"team"`
+	Unit            string    `json:"unit"`
+	Per             float64   `json:"per"`
+	Revision        string    `json:"revision"`
+	DeployedAt      time.Time `json:"deployedAt"`
+	Before          float64   `json:"before"` // Median cost per unit before the deploy
+	After           float64   `json:"after"`  // Median cost per unit after it
+	IncreasePercent float64   `json:"increasePercent"`
+	CostPerHr       float64   `json:"costPerHr"` // Service cost when the regression was found
+}
+
+// Message describes the regression for an alert
+func (r Regression) Message() string {
+	return fmt.Sprintf("Cost per %g %s of %s rose %.0f%% after deploy %s: $%.4g -> $%.4g",
+		r.Per, r.Unit, r.Service, r.IncreasePercent, r.Revision, r.Before, r.After)
+}
+
+// series is a service's samples and rollout state
+type series struct {
+	Series
+	revisions map[string]bool // Revisions seen so far
+	deploy    *deploy         // Latest deploy waiting to be checked
+}
+
+type deploy struct {
+	at       time.Time
+	revision string
+}
+
+// Tracker divides each service's allocated cost by its throughput, keeps
+// the result as a time series and flags regressions after deploys
+type Tracker struct {
+	Retention time.Duration // How long points are kept
+	Window    time.Duration // How long before and after a deploy to compare
+	Threshold float64       // Rise in cost per unit that counts as a regression, e.g. 0.25
+
+	metrics    []Metric
+	prom       *prometheus.Client
+	pods       PodSource
+	calculator *calculator.Calculator
+
+	mu          sync.RWMutex
+	series      map[string]*series
+	regressions []Regression
+}
+
+// NewTracker creates a unit cost tracker
+func NewTracker(metrics []Metric, prom *prometheus.Client, pods PodSource, calc *calculator.Calculator) *Tracker {
+	t := &Tracker{
+		Retention:  24 * time.Hour,
+		Window:     15 * time.Minute,
+		Threshold:  0.25,
+		metrics:    metrics,
+		prom:       prom,
+		pods:       pods,
+		calculator: calc,
+		series:     make(map[string]*series),
+	}
+	for _, m := range metrics {
+		t.series[m.Service] = &series{
+			Series:    Series{Service: m.Service, Namespace: m.Namespace, Workload: m.Workload, Unit: m.Unit, Per: m.Per},
+			revisions: make(map[string]bool),
+		}
+	}
+	return t
+}
+
+// Sample records one point per service and returns regressions found.
+// A failing query skips that service rather than the whole sample.
+func (t *Tracker) Sample(ctx context.Context, now time.Time) ([]Regression, error) {
+	pods := t.pods.Pods()
+	var found []Regression
+	var errs []error
+	for _, m := range t.metrics {
+		units, err := t.prom.Sum(ctx, m.Query, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.Service, err))
+			continue
+		}
+		if math.IsNaN(units) || math.IsInf(units, 0) || units < 0 {
+			units = 0
+		}
+
+		cost, team, revisions := 0.0, models.UnknownTeam, make(map[string]bool)
+		for _, pod := range pods {
+			if pod.Namespace != m.Namespace || pod.Workload != m.Workload {
+				continue
+			}
+			cost += t.calculator.CalculatePodCost(pod)
+			team = pod.Team()
+			for _, label := range revisionLabels {
+				if rev := pod.Labels[label]; rev != "" {
+					revisions[rev] = true
+				}
+			}
+		}
+
+		point := Point{Time: now.UTC(), CostPerHr: cost, UnitsPerSec: units}
+		if units > 0 {
+			point.CostPerUnit = cost / (units * 3600) * m.Per
+		}
+
+		t.mu.Lock()
+		s := t.series[m.Service]
+		s.Team = team
+		s.Points = append(s.Points, point)
+		t.noteDeploy(s, revisions, now)
+		if r, ok := t.check(s, now); ok {
+			found = append(found, r)
+			t.regressions = append(t.regressions, r)
+		}
+		t.prune(s, now)
+		t.mu.Unlock()
+	}
+	return found, errors.Join(errs...)
+}
+
+// noteDeploy starts watching for a regression when a new revision shows up;
+// callers hold t.mu
+func (t *Tracker) noteDeploy(s *series, revisions map[string]bool, now time.Time) {
+	first := len(s.revisions) == 0
+	for rev := range revisions {
+		if s.revisions[rev] {
+			continue
+		}
+		s.revisions[rev] = true
+		if !first {
+			s.deploy = &deploy{at: now, revision: rev}
+		}
+	}
+}
+
+// check compares cost per unit before and after the pending deploy once a
+// full window has passed; callers hold t.mu
+func (t *Tracker) check(s *series, now time.Time) (Regression, bool) {
+	if s.deploy == nil || now.Sub(s.deploy.at) < t.Window {
+		return Regression{}, false
+	}
+	d := s.deploy
+	s.deploy = nil
+
+	var before, after []float64
+	for _, p := range s.Points {
+		if p.CostPerUnit <= 0 {
+			continue
+		}
+		switch {
+		case p.Time.Before(d.at) && !p.Time.Before(d.at.Add(-t.Window)):
+			before = append(before, p.CostPerUnit)
+		case !p.Time.Before(d.at):
+			after = append(after, p.CostPerUnit)
+		}
+	}
+	if len(before) == 0 || len(after) == 0 {
+		return Regression{}, false
+	}
+	b, a := median(before), median(after)
+	if a <= b*(1+t.Threshold) {
+		return Regression{}, false
+	}
+	return Regression{
+		Service: s.Service, Namespace: s.Namespace, Workload: s.Workload, Team: s.Team,
+		Unit: s.Unit, Per: s.Per, Revision: d.revision, DeployedAt: d.at,
+		Before: b, After: a, IncreasePercent: (a - b) / b * 100,
+		CostPerHr: s.Points[len(s.Points)-1].CostPerHr,
+	}, true
+}
+
+// prune drops points and regressions older than the retention; callers hold t.mu
+func (t *Tracker) prune(s *series, now time.Time) {
+	cutoff := now.Add(-t.Retention)
+	i := 0
+	for i < len(s.Points) && s.Points[i].Time.Before(cutoff) {
+		i++
+	}
+	s.Points = s.Points[i:]
+
+	kept := t.regressions[:0]
+	for _, r := range t.regressions {
+		if !r.DeployedAt.Before(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	t.regressions = kept
+}
+
+// Latest returns every service with only its most recent point, most
+// expensive per unit first
+func (t *Tracker) Latest() []Series {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	latest := make([]Series, 0, len(t.series))
+	for _, s := range t.series {
+		l := s.Series
+		l.Points = nil
+		if n := len(s.Points); n > 0 {
+			l.Points = []Point{s.Points[n-1]}
+		}
+		latest = append(latest, l)
+	}
+	sort.Slice(latest, func(i, j int) bool {
+		ci, cj := lastCostPerUnit(latest[i]), lastCostPerUnit(latest[j])
+		if ci != cj {
+			return ci > cj
+		}
+		return latest[i].Service < latest[j].Service
+	})
+	return latest
+}
+
+// Series returns a service's points since a time
+func (t *Tracker) Series(service string, since time.Time) (Series, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	s, ok := t.series[service]
+	if !ok {
+		return Series{}, false
+	}
+	out := s.Series
+	out.Points = nil
+	for _, p := range s.Points {
+		if !p.Time.Before(since) {
+			out.Points = append(out.Points, p)
+		}
+	}
+	return out, true
+}
+
+// Regressions returns the regressions found within the retention, newest first
+func (t *Tracker) Regressions() []Regression {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	regressions := make([]Regression, len(t.regressions))
+	for i, r := range t.regressions {
+		regressions[len(regressions)-1-i] = r
+	}
+	return regressions
+}
+
+func lastCostPerUnit(s Series) float64 {
+	if len(s.Points) == 0 {
+		return 0
+	}
+	return s.Points[len(s.Points)-1].CostPerUnit
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
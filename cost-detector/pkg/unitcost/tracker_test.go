@@ -0,0 +1,184 @@
+package unitcost
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/models"
+	"cost-detector/pkg/prometheus"
+)
+
+const ordersQuery = `sum(rate(orders_total{namespace="shop"}[5m]))`
+
+// throughput serves canned instant query results: the orders per second
+// set for the moment, split over two series
+type throughput struct {
+	mu     sync.Mutex
+	orders float64
+	fail   bool
+}
+
+func (tp *throughput) set(orders float64) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.orders = orders
+}
+
+func (tp *throughput) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if r.URL.Path != "/api/v1/query" || r.URL.Query().Get("query") != ordersQuery {
+		http.Error(w, `{"status":"error","errorType":"bad_data","error":"unexpected query"}`, http.StatusBadRequest)
+		return
+	}
+	if tp.fail {
+		http.Error(w, `{"status":"error","errorType":"timeout","error":"query timed out"}`, http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"pod":"checkout-1"},"value":[%s,"%g"]},
+		{"metric":{"pod":"checkout-2"},"value":[%s,"%g"]}]}}`,
+		r.URL.Query().Get("time"), tp.orders/2, r.URL.Query().Get("time"), tp.orders/2)
+}
+
+// pods is the checkout deployment at some revision, plus a pod of another workload
+type pods struct {
+	mu       sync.Mutex
+	revision string
+}
+
+func (p *pods) Pods() []*models.Pod {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	checkout := func(name string) *models.Pod {
+		return &models.Pod{
+			Name: name, Namespace: "shop", Workload: "checkout", CPU: 1, // $0.05/hr at the flat rate
+			Labels: map[string]string{models.TeamLabel: "web", "pod-template-hash": p.revision},
+		}
+	}
+	other := &models.Pod{Name: "search-1", Namespace: "shop", Workload: "search", CPU: 10}
+	return []*models.Pod{checkout("checkout-" + p.revision + "-1"), checkout("checkout-" + p.revision + "-2"), other}
+}
+
+func (p *pods) deploy(revision string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.revision = revision
+}
+
+func newTestTracker(t *testing.T) (*Tracker, *throughput, *pods) {
+	t.Helper()
+	tp := &throughput{}
+	server := httptest.NewServer(tp)
+	t.Cleanup(server.Close)
+	source := &pods{revision: "5f7d9"}
+	metrics := []Metric{{Service: "checkout", Namespace: "shop", Workload: "checkout", Unit: "orders", Per: 1000, Query: ordersQuery}}
+	return NewTracker(metrics, prometheus.NewClient(server.URL, ""), source, calculator.NewCalculator()), tp, source
+}
+
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestSampleDividesCostByThroughput(t *testing.T) {
+	tracker, tp, _ := newTestTracker(t)
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	// $0.10/hr over 20 orders/s is $0.10 per 72,000 orders
+	tp.set(20)
+	if _, err := tracker.Sample(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	// No traffic has no cost per unit rather than an infinite one
+	tp.set(0)
+	if _, err := tracker.Sample(context.Background(), now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	series, ok := tracker.Series("checkout", now)
+	if !ok || len(series.Points) != 2 {
+		t.Fatalf("Series = %+v, %v", series, ok)
+	}
+	point := series.Points[0]
+	if !near(point.CostPerHr, 0.10) || point.UnitsPerSec != 20 || !near(point.CostPerUnit, 0.10/72000*1000) {
+		t.Errorf("point = %+v, want $0.10/hr, 20 orders/s and $%.6f per 1000 orders", point, 0.10/72000*1000)
+	}
+	if series.Team != "web" {
+		t.Errorf("team = %q, want web", series.Team)
+	}
+	if idle := series.Points[1]; idle.CostPerUnit != 0 || !near(idle.CostPerHr, 0.10) {
+		t.Errorf("idle point = %+v, want the cost and no cost per unit", idle)
+	}
+}
+
+func TestSampleKeepsGoingWhenAQueryFails(t *testing.T) {
+	tracker, tp, _ := newTestTracker(t)
+	tp.fail = true
+	if _, err := tracker.Sample(context.Background(), time.Now()); err == nil {
+		t.Fatal("Sample didn't report the failed query")
+	}
+	if series, _ := tracker.Series("checkout", time.Time{}); len(series.Points) != 0 {
+		t.Errorf("a failed query recorded %+v", series.Points)
+	}
+}
+
+func TestRegressionAfterDeploy(t *testing.T) {
+	tracker, tp, source := newTestTracker(t)
+	start := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	var found []Regression
+	sample := func(minute int) {
+		t.Helper()
+		regressions, err := tracker.Sample(context.Background(), start.Add(time.Duration(minute)*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		found = append(found, regressions...)
+	}
+
+	// A deploy that keeps the cost per order is not a regression
+	tp.set(20)
+	for minute := 0; minute < 20; minute++ {
+		sample(minute)
+	}
+	source.deploy("6a8e1")
+	for minute := 20; minute < 40; minute++ {
+		sample(minute)
+	}
+	if len(found) != 0 {
+		t.Fatalf("regressions without a change in cost per order: %+v", found)
+	}
+
+	// One that halves the orders for the same cost doubles it, found once
+	// the window after the deploy has passed
+	source.deploy("7b9f2")
+	tp.set(10)
+	for minute := 40; minute < 55; minute++ {
+		sample(minute)
+	}
+	if len(found) != 0 {
+		t.Fatalf("regression reported before the window passed: %+v", found)
+	}
+	for minute := 55; minute < 60; minute++ {
+		sample(minute)
+	}
+	if len(found) != 1 {
+		t.Fatalf("found %d regressions, want 1: %+v", len(found), found)
+	}
+	r := found[0]
+	if r.Service != "checkout" || r.Team != "web" || r.Revision != "7b9f2" || !r.DeployedAt.Equal(start.Add(40*time.Minute)) {
+		t.Errorf("regression = %+v", r)
+	}
+	if !near(r.Before, 0.10/72000*1000) || !near(r.After, 0.10/36000*1000) || !near(r.IncreasePercent, 100) {
+		t.Errorf("regression went from $%g to $%g per 1000 orders (+%g%%), want double", r.Before, r.After, r.IncreasePercent)
+	}
+	if got := tracker.Regressions(); len(got) != 1 || got[0].Revision != "7b9f2" {
+		t.Errorf("Regressions() = %+v", got)
+	}
+}
@@ -0,0 +1,141 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"cost-detector/pkg/kube"
+)
+
+// watchTimeout is how long the API server keeps one watch open
+const watchTimeout = 5 * time.Minute
+
+// listWatch lists a collection, then watches it from the list's
+// resourceVersion, listing again when the watch falls too far behind.
+// Errors back off exponentially up to a minute.
+func (w *Watcher) listWatch(ctx context.Context, collection string, path string,
+	sync func(raw json.RawMessage) (string, error), apply func(event kube.WatchEvent) error) {
+	defer w.done.Done()
+	backoff := time.Second
+	resourceVersion := ""
+	for ctx.Err() == nil {
+		var err error
+		if resourceVersion == "" {
+			var list json.RawMessage
+			if err = w.Client.Get(ctx, path, &list); err == nil {
+				resourceVersion, err = sync(list)
+			}
+			if err == nil {
+				w.markSynced(collection)
+				backoff = time.Second
+			}
+		} else {
+			err = w.Client.Watch(ctx, path, resourceVersion, watchTimeout, func(event kube.WatchEvent) error {
+				var meta struct {
+					Metadata kube.ObjectMeta `json:"metadata"`
+				}
+				if err := json.Unmarshal(event.Object, &meta); err != nil {
+					return err
+				}
+				if event.Type != kube.WatchBookmark {
+					if err := apply(event); err != nil {
+						return err
+					}
+				}
+				resourceVersion = meta.Metadata.ResourceVersion
+				backoff = time.Second
+				return nil
+			})
+			if kube.IsGone(err) {
+				resourceVersion, err = "", nil // Too old; list again
+			}
+		}
+		if err == nil || ctx.Err() != nil {
+			continue
+		}
+
+		w.Log.Warning("Watch failed, retrying", "collection", collection, "retryIn", backoff.String(), "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > time.Minute {
+			backoff = time.Minute
+		}
+	}
+}
+
+// syncPods replaces the known pods with a list, notifying handlers of
+// every change, and returns the list's resourceVersion
+func (w *Watcher) syncPods(raw json.RawMessage) (string, error) {
+	var list kube.PodList
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return "", err
+	}
+	listed := make(map[string]bool, len(list.Items))
+	for i := range list.Items {
+		pod := list.Items[i].ToModel()
+		listed[podKey(pod)] = true
+		w.Add(pod)
+	}
+	for _, pod := range w.Pods() {
+		if !listed[podKey(pod)] {
+			w.Delete(pod.Namespace, pod.Name)
+		}
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+// syncNodes replaces the known nodes with a list, notifying node handlers
+// of nodes that were added, changed or removed, and returns the list's
+// resourceVersion
+func (w *Watcher) syncNodes(raw json.RawMessage) (string, error) {
+	var list kube.NodeList
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return "", err
+	}
+	listed := make(map[string]bool, len(list.Items))
+	for i := range list.Items {
+		node := list.Items[i].ToModel()
+		listed[node.Name] = true
+		if old, ok := w.Node(node.Name); !ok || !reflect.DeepEqual(old, node) {
+			w.AddNode(node)
+		}
+	}
+	for _, node := range w.Nodes() {
+		if !listed[node.Name] {
+			w.DeleteNode(node.Name)
+		}
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+// applyPod applies one pod watch event
+func (w *Watcher) applyPod(event kube.WatchEvent) error {
+	var pod kube.Pod
+	if err := json.Unmarshal(event.Object, &pod); err != nil {
+		return err
+	}
+	if event.Type == kube.WatchDeleted {
+		w.Delete(pod.Metadata.Namespace, pod.Metadata.Name)
+	} else {
+		w.Add(pod.ToModel())
+	}
+	return nil
+}
+
+// applyNode applies one node watch event
+func (w *Watcher) applyNode(event kube.WatchEvent) error {
+	var node kube.Node
+	if err := json.Unmarshal(event.Object, &node); err != nil {
+		return err
+	}
+	if event.Type == kube.WatchDeleted {
+		w.DeleteNode(node.Metadata.Name)
+	} else {
+		w.AddNode(node.ToModel())
+	}
+	return nil
+}
@@ -1,29 +1,259 @@
 package watcher
 
-import "fmt"
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"cost-detector/pkg/kube"
+	"cost-detector/pkg/logger"
+	"cost-detector/pkg/models"
+)
+
+// EventType is the kind of change the watcher saw
+type EventType string
+
+const (
+	PodAdded   EventType = "added"
+	PodUpdated EventType = "updated"
+	PodDeleted EventType = "deleted"
+)
+
+// Event is a single pod change seen by the watcher
+type Event struct {
+	Type EventType
+	Pod  *models.Pod // Pod after the change (the removed pod for PodDeleted)
+	Old  *models.Pod // Pod before the change, nil for PodAdded
+}
+
+// Handler is called for every event the watcher sees
+type Handler func(Event)
+
+// NodeEvent is a single node change seen by the watcher
+type NodeEvent struct {
+	Type EventType // PodAdded, PodUpdated or PodDeleted, as for pods
+	Node *models.Node
+}
+
+// NodeHandler is called for every node event
+type NodeHandler func(NodeEvent)
 
 // Watcher monitors pod creation and deletion events
 type Watcher struct {
 	ClusterName string
+	// Client lists and watches pods and nodes; without one, pods and nodes
+	// only come from Add and AddNode
+	Client *kube.Client
+	Log    *logger.Logger // Where watch failures are reported; stdout by default
+
+	mu           sync.RWMutex
+	pods         map[string]*models.Pod  // Current pods keyed by namespace/name
+	nodes        map[string]*models.Node // Current nodes keyed by name
+	handlers     []Handler
+	nodeHandlers []NodeHandler
+
+	synced   map[string]bool // Collections listed since Start
+	syncedCh chan struct{}   // Closed once every collection was listed
+	cancel   context.CancelFunc
+	done     sync.WaitGroup
 }
 
 // NewWatcher creates a new pod watcher
 func NewWatcher(clusterName string) *Watcher {
 	return &Watcher{
 		ClusterName: clusterName,
+		Log:         logger.NewLogger(logger.LevelInfo, logger.FormatText),
+		pods:        make(map[string]*models.Pod),
+		nodes:       make(map[string]*models.Node),
+		synced:      make(map[string]bool),
+		syncedCh:    make(chan struct{}),
 	}
 }
 
-// Start begins watching pod events
+// Start begins watching pod and node events in the background. Without a
+// Client the watcher counts as synced straight away.
 func (w *Watcher) Start() error {
-	fmt.Printf("Starting watcher for cluster: %s\n", w.ClusterName)
-	// TODO: Connect to Kubernetes API
-	// TODO: Watch for pod creation/deletion events
+	w.Log.Info("Starting watcher", "cluster", w.ClusterName)
+	if w.Client == nil {
+		w.markSynced("pods")
+		w.markSynced("nodes")
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.done.Add(2)
+	go w.listWatch(ctx, "pods", kube.PodsPath, w.syncPods, w.applyPod)
+	go w.listWatch(ctx, "nodes", kube.NodesPath, w.syncNodes, w.applyNode)
 	return nil
 }
 
-// Stop stops watching pod events
+// Stop stops watching and waits for the watches to close
 func (w *Watcher) Stop() {
-	fmt.Println("Stopping watcher")
-	// TODO: Clean up connections
+	w.Log.Info("Stopping watcher", "cluster", w.ClusterName)
+	if w.cancel != nil {
+		w.cancel()
+		w.done.Wait()
+	}
+}
+
+// Synced reports whether pods and nodes have been listed since Start
+func (w *Watcher) Synced() bool {
+	select {
+	case <-w.syncedCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitForSync blocks until the watcher has synced or ctx is done
+func (w *Watcher) WaitForSync(ctx context.Context) error {
+	select {
+	case <-w.syncedCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// markSynced records that a collection was listed
+func (w *Watcher) markSynced(collection string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.synced[collection] {
+		return
+	}
+	w.synced[collection] = true
+	if w.synced["pods"] && w.synced["nodes"] {
+		close(w.syncedCh)
+	}
+}
+
+// OnEvent registers a handler that is called for every pod event
+func (w *Watcher) OnEvent(h Handler) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers = append(w.handlers, h)
+}
+
+// Add records a new or changed pod and notifies handlers
+func (w *Watcher) Add(pod *models.Pod) {
+	key := podKey(pod)
+
+	w.mu.Lock()
+	old, exists := w.pods[key]
+	w.pods[key] = pod
+	handlers := w.handlers
+	w.mu.Unlock()
+
+	event := Event{Type: PodAdded, Pod: pod}
+	if exists {
+		event = Event{Type: PodUpdated, Pod: pod, Old: old}
+	}
+	notify(handlers, event)
+}
+
+// Delete forgets a pod and notifies handlers
+func (w *Watcher) Delete(namespace string, name string) {
+	key := namespace + "/" + name
+
+	w.mu.Lock()
+	old, exists := w.pods[key]
+	delete(w.pods, key)
+	handlers := w.handlers
+	w.mu.Unlock()
+
+	if exists {
+		notify(handlers, Event{Type: PodDeleted, Pod: old})
+	}
+}
+
+// Pods returns the pods currently known to the watcher, sorted by namespace and name
+func (w *Watcher) Pods() []*models.Pod {
+	w.mu.RLock()
+	pods := make([]*models.Pod, 0, len(w.pods))
+	for _, pod := range w.pods {
+		pods = append(pods, pod)
+	}
+	w.mu.RUnlock()
+
+	sort.Slice(pods, func(i, j int) bool {
+		return podKey(pods[i]) < podKey(pods[j])
+	})
+	return pods
+}
+
+// OnNodeEvent registers a handler that is called for every node event
+func (w *Watcher) OnNodeEvent(h NodeHandler) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.nodeHandlers = append(w.nodeHandlers, h)
+}
+
+// AddNode records a new or changed node and notifies node handlers
+func (w *Watcher) AddNode(node *models.Node) {
+	w.mu.Lock()
+	_, exists := w.nodes[node.Name]
+	w.nodes[node.Name] = node
+	handlers := w.nodeHandlers
+	w.mu.Unlock()
+
+	event := NodeEvent{Type: PodAdded, Node: node}
+	if exists {
+		event.Type = PodUpdated
+	}
+	for _, h := range handlers {
+		h(event)
+	}
+}
+
+// DeleteNode forgets a node and notifies node handlers
+func (w *Watcher) DeleteNode(name string) {
+	w.mu.Lock()
+	old, exists := w.nodes[name]
+	delete(w.nodes, name)
+	handlers := w.nodeHandlers
+	w.mu.Unlock()
+
+	if exists {
+		for _, h := range handlers {
+			h(NodeEvent{Type: PodDeleted, Node: old})
+		}
+	}
+}
+
+// Node looks up a node by name
+func (w *Watcher) Node(name string) (*models.Node, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	node, ok := w.nodes[name]
+	return node, ok
+}
+
+// Nodes returns the nodes currently known to the watcher, sorted by name
+func (w *Watcher) Nodes() []*models.Node {
+	w.mu.RLock()
+	nodes := make([]*models.Node, 0, len(w.nodes))
+	for _, node := range w.nodes {
+		nodes = append(nodes, node)
+	}
+	w.mu.RUnlock()
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes
+}
+
+// podKey identifies a pod across events
+func podKey(pod *models.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
+
+// notify calls every handler with the event
+func notify(handlers []Handler, event Event) {
+	for _, h := range handlers {
+		h(event)
+	}
 }
@@ -0,0 +1,172 @@
+package writeback
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"cost-detector/pkg/calculator"
+	"cost-detector/pkg/kube"
+	"cost-detector/pkg/models"
+)
+
+// Annotations written onto pods and namespaces
+const (
+	HourlyCostAnnotation = "cost-detector.io/hourly-cost" // e.g. "0.4200"
+	UpdatedAtAnnotation  = "cost-detector.io/updated-at"  // RFC 3339 timestamp
+)
+
+// Writer patches computed hourly cost onto pods and namespaces as annotations.
+// Objects are only patched when their cost changed, at most once per
+// MinInterval each, and never faster than QPS patches per second overall.
+type Writer struct {
+	client      *kube.Client
+	calculator  *calculator.Calculator
+	MinInterval time.Duration // Minimum time between patches of the same object
+	limiter     *rateLimiter
+
+	mu      sync.Mutex
+	written map[string]written // Last value written, keyed by API path
+}
+
+// written is the last annotation value patched onto an object
+type written struct {
+	value string
+	at    time.Time
+}
+
+// NewWriter creates a new annotation writer
+func NewWriter(client *kube.Client, calc *calculator.Calculator, minInterval time.Duration, qps float64) *Writer {
+	return &Writer{
+		client:      client,
+		calculator:  calc,
+		MinInterval: minInterval,
+		limiter:     newRateLimiter(qps),
+		written:     make(map[string]written),
+	}
+}
+
+// Sync writes the current cost of every pod and namespace. It returns the
+// number of objects patched and the first error seen.
+func (w *Writer) Sync(ctx context.Context, pods []*models.Pod) (int, error) {
+	patched := 0
+	var firstErr error
+	record := func(ok bool, err error) {
+		if ok {
+			patched++
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, pod := range pods {
+		cost := w.calculator.CalculatePodCost(pod)
+		record(w.write(ctx, kube.PodPath(pod.Namespace, pod.Name), cost))
+	}
+
+	namespaces, err := w.calculator.Summarize(pods, calculator.GroupByNamespace)
+	if err != nil {
+		return patched, err
+	}
+	for _, ns := range namespaces {
+		record(w.write(ctx, kube.NamespacePath(ns.Name), ns.CostPerHr))
+	}
+
+	w.forgetMissing(pods, namespaces)
+	return patched, firstErr
+}
+
+// write patches one object if its cost changed and it is due for an update
+func (w *Writer) write(ctx context.Context, path string, cost float64) (bool, error) {
+	value := fmt.Sprintf("%.4f", cost)
+	now := time.Now()
+
+	w.mu.Lock()
+	last, seen := w.written[path]
+	w.mu.Unlock()
+	if seen && (last.value == value || now.Sub(last.at) < w.MinInterval) {
+		return false, nil
+	}
+
+	if err := w.limiter.wait(ctx); err != nil {
+		return false, err
+	}
+	err := w.client.PatchAnnotations(ctx, path, map[string]string{
+		HourlyCostAnnotation: value,
+		UpdatedAtAnnotation:  now.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		if kube.IsNotFound(err) {
+			// The object went away between the scan and the patch
+			return false, nil
+		}
+		return false, err
+	}
+
+	w.mu.Lock()
+	w.written[path] = written{value: value, at: now}
+	w.mu.Unlock()
+	return true, nil
+}
+
+// forgetMissing drops remembered values for objects that no longer exist
+func (w *Writer) forgetMissing(pods []*models.Pod, namespaces []models.CostSummary) {
+	current := make(map[string]bool, len(pods)+len(namespaces))
+	for _, pod := range pods {
+		current[kube.PodPath(pod.Namespace, pod.Name)] = true
+	}
+	for _, ns := range namespaces {
+		current[kube.NamespacePath(ns.Name)] = true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for path := range w.written {
+		if !current[path] {
+			delete(w.written, path)
+		}
+	}
+}
+
+// rateLimiter is a token bucket allowing qps requests per second with a burst of one second
+type rateLimiter struct {
+	mu     sync.Mutex
+	qps    float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(qps float64) *rateLimiter {
+	if qps <= 0 {
+		qps = 1
+	}
+	return &rateLimiter{qps: qps, tokens: qps, last: time.Now()}
+}
+
+// wait blocks until a token is available or the context is cancelled
+func (r *rateLimiter) wait(ctx context.Context) error {
+	for {
+		r.mu.Lock()
+		now := time.Now()
+		r.tokens += now.Sub(r.last).Seconds() * r.qps
+		if r.tokens > r.qps {
+			r.tokens = r.qps
+		}
+		r.last = now
+		if r.tokens >= 1 {
+			r.tokens--
+			r.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - r.tokens) / r.qps * float64(time.Second))
+		r.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
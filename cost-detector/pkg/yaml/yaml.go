@@ -0,0 +1,582 @@
+// Package yaml decodes the subset of YAML used by configuration files,
+// Backstage catalogs and Kubernetes manifests: block mappings and sequences,
+// plain and quoted scalars, flow collections on one line, literal and folded
+// block scalars, comments and multiple documents. Anchors, aliases, tags and
+// complex keys are not supported.
+//
+// Documents are converted to JSON so they decode into structs through their
+// `json` tags.
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Unmarshal decodes a single YAML document into out, using out's json tags
+func Unmarshal(data []byte, out interface{}) error {
+	return unmarshal(data, out, false)
+}
+
+// UnmarshalStrict is Unmarshal, but fields out doesn't have are an error,
+// so typos in configuration files are reported instead of ignored
+func UnmarshalStrict(data []byte, out interface{}) error {
+	return unmarshal(data, out, true)
+}
+
+func unmarshal(data []byte, out interface{}, strict bool) error {
+	docs, err := Documents(data)
+	if err != nil {
+		return err
+	}
+	switch len(docs) {
+	case 0:
+		return fmt.Errorf("yaml: empty document")
+	case 1:
+		dec := json.NewDecoder(bytes.NewReader(docs[0]))
+		if strict {
+			dec.DisallowUnknownFields()
+		}
+		if err := dec.Decode(out); err != nil {
+			return fmt.Errorf("yaml: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("yaml: expected one document, found %d", len(docs))
+	}
+}
+
+// Documents converts every document in a YAML stream to JSON. Empty
+// documents are skipped.
+func Documents(data []byte) ([]json.RawMessage, error) {
+	var docs []json.RawMessage
+	for _, lines := range splitDocuments(data) {
+		p := &parser{lines: lines}
+		p.skip()
+		if p.done() {
+			continue
+		}
+		value, err := p.node(p.lines[p.pos].indent)
+		if err != nil {
+			return nil, err
+		}
+		if p.skip(); !p.done() {
+			return nil, p.errorf("unexpected content %q", p.lines[p.pos].text)
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, raw)
+	}
+	return docs, nil
+}
+
+// line is one source line
+type line struct {
+	num    int    // 1-based line number in the file
+	raw    string // Line as written
+	indent int    // Leading spaces
+	text   string // Content without indentation and comments; "" for blank lines
+	tab    bool   // Indented with a tab, which YAML forbids
+}
+
+// splitDocuments breaks a stream on "---" and "..." markers
+func splitDocuments(data []byte) [][]line {
+	var docs [][]line
+	var current []line
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if raw == "---" || strings.HasPrefix(raw, "--- ") || raw == "..." {
+			docs = append(docs, current)
+			current = nil
+			continue
+		}
+		if strings.HasPrefix(raw, "%") && len(current) == 0 {
+			continue // Directive such as %YAML 1.2
+		}
+		trimmed := strings.TrimLeft(raw, " ")
+		current = append(current, line{
+			num:    i + 1,
+			raw:    raw,
+			indent: len(raw) - len(trimmed),
+			text:   strings.TrimSpace(stripComment(trimmed)),
+			tab:    strings.HasPrefix(trimmed, "\t"),
+		})
+	}
+	return append(docs, current)
+}
+
+// stripComment removes a trailing "# comment" that isn't inside quotes
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || s[i-1] == ' ' || s[i-1] == '[' || s[i-1] == '{' || s[i-1] == ',' || s[i-1] == ':' {
+				quote = c
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+type parser struct {
+	lines []line
+	pos   int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.lines)
+}
+
+// skip moves past blank and comment-only lines
+func (p *parser) skip() {
+	for !p.done() && p.lines[p.pos].text == "" {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	num := 0
+	if !p.done() {
+		num = p.lines[p.pos].num
+	} else if len(p.lines) > 0 {
+		num = p.lines[len(p.lines)-1].num
+	}
+	return fmt.Errorf("yaml: line %d: %s", num, fmt.Sprintf(format, args...))
+}
+
+// node parses the block node starting at the current line
+func (p *parser) node(indent int) (interface{}, error) {
+	l := p.lines[p.pos]
+	if l.tab {
+		return nil, p.errorf("tabs are not allowed for indentation")
+	}
+	if isSequenceItem(l.text) {
+		return p.sequence(indent)
+	}
+	if _, _, ok := splitKey(l.text); ok {
+		return p.mapping(indent)
+	}
+	p.pos++
+	return scalar(l.text, l.num)
+}
+
+// mapping parses "key: value" lines at one indentation
+func (p *parser) mapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for p.skip(); !p.done(); p.skip() {
+		l := p.lines[p.pos]
+		if l.tab {
+			return nil, p.errorf("tabs are not allowed for indentation")
+		}
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.errorf("bad indentation")
+		}
+		if isSequenceItem(l.text) {
+			break
+		}
+		key, rest, ok := splitKey(l.text)
+		if !ok {
+			return nil, p.errorf("expected \"key: value\", got %q", l.text)
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+
+		value, err := p.value(indent, rest, l.num, true)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// sequence parses "- item" lines at one indentation
+func (p *parser) sequence(indent int) (interface{}, error) {
+	items := []interface{}{}
+	for p.skip(); !p.done(); p.skip() {
+		l := p.lines[p.pos]
+		if l.tab {
+			return nil, p.errorf("tabs are not allowed for indentation")
+		}
+		if l.indent < indent || !isSequenceItem(l.text) {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.errorf("bad indentation")
+		}
+
+		rest := strings.TrimLeft(l.text[1:], " ")
+		if rest == "" {
+			p.pos++
+			value, err := p.value(indent, "", l.num, false)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+			continue
+		}
+
+		// "- key: value" or "- - item" starts a nested block on this line:
+		// reparse the line as if the item began at its own column
+		if _, _, isKey := splitKey(rest); isKey || isSequenceItem(rest) {
+			offset := l.indent + (len(l.text) - len(rest))
+			p.lines[p.pos].indent = offset
+			p.lines[p.pos].text = rest
+			value, err := p.node(offset)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+			continue
+		}
+
+		p.pos++
+		value, err := p.inline(rest, l.num, indent)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+	}
+	return items, nil
+}
+
+// value parses what follows "key:" or "-": an inline value, a block scalar,
+// or a nested block on the following lines
+func (p *parser) value(indent int, rest string, num int, inMapping bool) (interface{}, error) {
+	if rest != "" {
+		return p.inline(rest, num, indent)
+	}
+	p.skip()
+	if p.done() {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent > indent {
+		return p.node(next.indent)
+	}
+	// A mapping's sequence value may sit at the key's own indentation
+	if inMapping && next.indent == indent && isSequenceItem(next.text) {
+		return p.sequence(indent)
+	}
+	return nil, nil
+}
+
+// inline parses a value written on the same line, which may open a block scalar
+func (p *parser) inline(s string, num int, indent int) (interface{}, error) {
+	if s[0] == '|' || s[0] == '>' {
+		return p.blockScalar(s, indent)
+	}
+	return scalar(s, num)
+}
+
+// blockScalar reads a literal (|) or folded (>) scalar from the following lines
+func (p *parser) blockScalar(header string, parent int) (interface{}, error) {
+	folded := header[0] == '>'
+	chomp := byte(0)
+	for _, c := range header[1:] {
+		switch {
+		case c == '-' || c == '+':
+			chomp = byte(c)
+		case c >= '1' && c <= '9':
+			// Explicit indentation indicators are accepted and ignored
+		default:
+			return nil, p.errorf("bad block scalar header %q", header)
+		}
+	}
+
+	var content []string
+	blockIndent := -1
+	for !p.done() {
+		l := p.lines[p.pos]
+		blank := strings.TrimSpace(l.raw) == ""
+		if !blank {
+			if l.indent <= parent {
+				break
+			}
+			if blockIndent < 0 {
+				blockIndent = l.indent
+			}
+			if l.indent < blockIndent {
+				break
+			}
+		}
+		if blank {
+			content = append(content, "")
+		} else {
+			content = append(content, l.raw[blockIndent:])
+		}
+		p.pos++
+	}
+
+	// Trailing blank lines only matter for "keep" chomping
+	end := len(content)
+	for end > 0 && content[end-1] == "" {
+		end--
+	}
+	trailing := len(content) - end
+	content = content[:end]
+
+	var text string
+	if folded {
+		var b strings.Builder
+		for i, c := range content {
+			switch {
+			case i == 0:
+			case c == "" || content[i-1] == "":
+				b.WriteString("\n")
+			case strings.HasPrefix(c, " "):
+				b.WriteString("\n")
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(c)
+		}
+		text = b.String()
+	} else {
+		text = strings.Join(content, "\n")
+	}
+
+	switch chomp {
+	case '-':
+	case '+':
+		text += strings.Repeat("\n", trailing+1)
+	default:
+		if text != "" {
+			text += "\n"
+		}
+	}
+	return text, nil
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitKey splits "key: value" at the first ": " outside quotes and flow
+// collections. The value is "" when the line ends at the colon.
+func splitKey(text string) (string, string, bool) {
+	if text == "" || text[0] == '[' || text[0] == '{' || text[0] == '-' && isSequenceItem(text) {
+		return "", "", false
+	}
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == ':' && (i == len(text)-1 || text[i+1] == ' '):
+			key := strings.TrimSpace(text[:i])
+			if key == "" {
+				return "", "", false
+			}
+			if k, err := scalar(key, 0); err == nil {
+				if s, ok := k.(string); ok {
+					key = s
+				}
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+var numberPattern = regexp.MustCompile(`^[-+]?(\d+(\.\d*)?|\.\d+)([eE][-+]?\d+)?$`)
+
+// scalar resolves a plain, quoted or flow value
+func scalar(s string, num int) (interface{}, error) {
+	errorf := func(format string, args ...interface{}) error {
+		return fmt.Errorf("yaml: line %d: %s", num, fmt.Sprintf(format, args...))
+	}
+	switch {
+	case s == "":
+		return nil, nil
+	case s[0] == '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, errorf("bad double-quoted string %s", s)
+		}
+		return v, nil
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return nil, errorf("bad single-quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case s[0] == '[' || s[0] == '{':
+		f := &flow{s: s}
+		v, err := f.value()
+		if err != nil {
+			return nil, errorf("%v", err)
+		}
+		if f.skipSpace(); f.i != len(f.s) {
+			return nil, errorf("unexpected %q after flow collection", f.s[f.i:])
+		}
+		return v, nil
+	case s[0] == '&' || s[0] == '*':
+		return nil, errorf("anchors and aliases are not supported")
+	case s[0] == '!':
+		return nil, errorf("tags are not supported")
+	}
+
+	switch s {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	case ".inf", "+.inf", "-.inf", ".nan", ".Inf", ".NaN":
+		return nil, errorf("infinity and NaN are not supported")
+	}
+	if numberPattern.MatchString(s) {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return json.Number(strconv.FormatInt(i, 10)), nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+		}
+	}
+	return s, nil
+}
+
+// flow parses a one-line flow collection such as [a, "b"] or {k: v}
+type flow struct {
+	s string
+	i int
+}
+
+func (f *flow) skipSpace() {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+}
+
+func (f *flow) value() (interface{}, error) {
+	f.skipSpace()
+	if f.i >= len(f.s) {
+		return nil, fmt.Errorf("unterminated flow collection")
+	}
+	switch f.s[f.i] {
+	case '[':
+		f.i++
+		items := []interface{}{}
+		for {
+			f.skipSpace()
+			if f.i < len(f.s) && f.s[f.i] == ']' {
+				f.i++
+				return items, nil
+			}
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		f.i++
+		m := make(map[string]interface{})
+		for {
+			f.skipSpace()
+			if f.i < len(f.s) && f.s[f.i] == '}' {
+				f.i++
+				return m, nil
+			}
+			k, err := f.token(true)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				key = fmt.Sprint(k)
+			}
+			f.skipSpace()
+			if f.i >= len(f.s) || f.s[f.i] != ':' {
+				return nil, fmt.Errorf("expected ':' after flow key %q", key)
+			}
+			f.i++
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return f.token(false)
+	}
+}
+
+// separator consumes "," or leaves the closing bracket for the caller
+func (f *flow) separator(closing byte) error {
+	f.skipSpace()
+	if f.i < len(f.s) && f.s[f.i] == ',' {
+		f.i++
+		return nil
+	}
+	if f.i < len(f.s) && f.s[f.i] == closing {
+		return nil
+	}
+	return fmt.Errorf("expected ',' or '%c' in flow collection", closing)
+}
+
+// token reads one scalar inside a flow collection
+func (f *flow) token(isKey bool) (interface{}, error) {
+	f.skipSpace()
+	start := f.i
+	if f.i < len(f.s) && (f.s[f.i] == '"' || f.s[f.i] == '\'') {
+		quote := f.s[f.i]
+		for f.i++; f.i < len(f.s); f.i++ {
+			if f.s[f.i] == '\\' && quote == '"' {
+				f.i++
+				continue
+			}
+			if f.s[f.i] == quote {
+				if quote == '\'' && f.i+1 < len(f.s) && f.s[f.i+1] == '\'' {
+					f.i++
+					continue
+				}
+				f.i++
+				return scalar(f.s[start:f.i], 0)
+			}
+		}
+		return nil, fmt.Errorf("unterminated quoted string in flow collection")
+	}
+	for f.i < len(f.s) {
+		c := f.s[f.i]
+		if c == ',' || c == ']' || c == '}' || (isKey && c == ':') {
+			break
+		}
+		f.i++
+	}
+	return scalar(strings.TrimSpace(f.s[start:f.i]), 0)
+}
@@ -0,0 +1,3 @@
+module quantity
+
+go 1.22.5
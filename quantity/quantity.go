@@ -0,0 +1,396 @@
+package quantity
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Format is how a quantity is written, following Kubernetes
+type Format string
+
+const (
+	DecimalSI       Format = "DecimalSI"       // e.g. "500m", "12k", "1M"
+	BinarySI        Format = "BinarySI"        // e.g. "512Mi", "2Gi"
+	DecimalExponent Format = "DecimalExponent" // e.g. "12e6"
+)
+
+// Byte sizes for converting memory quantities
+const (
+	GiB = 1 << 30 // Gibibyte, the unit EC2 and Fargate memory is sold in
+	GB  = 1e9     // Gigabyte
+)
+
+// ErrFormat is returned for strings that aren't Kubernetes quantities
+var ErrFormat = errors.New("quantities must match the regular expression '^([+-]?[0-9.]+)([eEinumkKMGTP]*[-+]?[0-9]*)$'")
+
+// Quantity is a Kubernetes resource quantity such as "500m" CPU or "512Mi"
+// memory. It is exact down to nano units (1n); finer values are rounded
+// away from zero on parse, as Kubernetes does. The zero value is 0.
+type Quantity struct {
+	nanos  *big.Int // Value in units of 10^-9
+	Format Format
+}
+
+var (
+	bigNano = big.NewInt(1e9)
+	big10   = big.NewInt(10)
+	big1024 = big.NewInt(1024)
+)
+
+// decimalSuffixes maps decimal SI suffixes to their power of ten
+var decimalSuffixes = map[string]int{
+	"n": -9, "u": -6, "m": -3, "": 0, "k": 3, "M": 6, "G": 9, "T": 12, "P": 15, "E": 18,
+}
+
+// binarySuffixes maps binary SI suffixes to their power of 1024
+var binarySuffixes = map[string]int{
+	"Ki": 1, "Mi": 2, "Gi": 3, "Ti": 4, "Pi": 5, "Ei": 6,
+}
+
+// Parse reads a quantity such as "1.5", "250m", "1Gi" or "12e6"
+func Parse(s string) (Quantity, error) {
+	str := strings.TrimSpace(s)
+	if str == "" {
+		return Quantity{}, fmt.Errorf("parsing quantity %q: %w", s, ErrFormat)
+	}
+
+	// Split into sign, number and suffix
+	negative := false
+	pos := 0
+	if str[0] == '+' || str[0] == '-' {
+		negative = str[0] == '-'
+		pos++
+	}
+	start := pos
+	seenDot := false
+	for pos < len(str) && (isDigit(str[pos]) || (str[pos] == '.' && !seenDot)) {
+		seenDot = seenDot || str[pos] == '.'
+		pos++
+	}
+	number, suffix := str[start:pos], str[pos:]
+	whole, fraction, _ := strings.Cut(number, ".")
+	if whole == "" && fraction == "" {
+		return Quantity{}, fmt.Errorf("parsing quantity %q: %w", s, ErrFormat)
+	}
+
+	format, base, exponent, err := parseSuffix(suffix)
+	if err != nil {
+		return Quantity{}, fmt.Errorf("parsing quantity %q: %w", s, err)
+	}
+
+	// value = digits * 10^-len(fraction) * base^exponent, in nanos
+	digits, ok := new(big.Int).SetString("0"+whole+fraction, 10)
+	if !ok {
+		return Quantity{}, fmt.Errorf("parsing quantity %q: %w", s, ErrFormat)
+	}
+	numerator := new(big.Int).Mul(digits, bigNano)
+	denominator := pow(big10, len(fraction))
+	if base == 10 {
+		if exponent >= 0 {
+			numerator.Mul(numerator, pow(big10, exponent))
+		} else {
+			denominator.Mul(denominator, pow(big10, -exponent))
+		}
+	} else {
+		numerator.Mul(numerator, pow(big1024, exponent))
+	}
+
+	nanos := divRoundUp(numerator, denominator)
+	if negative {
+		nanos.Neg(nanos)
+	}
+	return Quantity{nanos: nanos, Format: format}, nil
+}
+
+// MustParse is Parse that panics on error, for constants
+func MustParse(s string) Quantity {
+	q, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// parseSuffix returns the format and scale a suffix stands for
+func parseSuffix(suffix string) (Format, int, int, error) {
+	if exponent, ok := decimalSuffixes[suffix]; ok {
+		return DecimalSI, 10, exponent, nil
+	}
+	if exponent, ok := binarySuffixes[suffix]; ok {
+		return BinarySI, 1024, exponent, nil
+	}
+	if len(suffix) > 1 && (suffix[0] == 'e' || suffix[0] == 'E') {
+		exponent, err := strconv.Atoi(suffix[1:])
+		if err != nil {
+			return "", 0, 0, ErrFormat
+		}
+		return DecimalExponent, 10, exponent, nil
+	}
+	return "", 0, 0, ErrFormat
+}
+
+// NewQuantity creates a quantity of whole units, e.g. bytes or cores
+func NewQuantity(value int64, format Format) Quantity {
+	return Quantity{nanos: new(big.Int).Mul(big.NewInt(value), bigNano), Format: format}
+}
+
+// NewMilliQuantity creates a quantity of thousandths, e.g. millicores
+func NewMilliQuantity(milli int64, format Format) Quantity {
+	return Quantity{nanos: new(big.Int).Mul(big.NewInt(milli), big.NewInt(1e6)), Format: format}
+}
+
+// FromFloat creates a quantity from a float, rounded away from zero to nano precision
+func FromFloat(value float64, format Format) Quantity {
+	r := new(big.Rat).SetFloat64(value)
+	if r == nil {
+		return Quantity{Format: format}
+	}
+	r.Mul(r, new(big.Rat).SetInt(bigNano))
+	return Quantity{nanos: divRoundUp(r.Num(), r.Denom()), Format: format}
+}
+
+// FromGiB creates a binary memory quantity from GiB
+func FromGiB(gib float64) Quantity {
+	return FromFloat(gib*GiB, BinarySI)
+}
+
+// value returns the nanos, treating the zero Quantity as 0
+func (q Quantity) value() *big.Int {
+	if q.nanos == nil {
+		return new(big.Int)
+	}
+	return q.nanos
+}
+
+// IsZero reports whether the quantity is 0
+func (q Quantity) IsZero() bool {
+	return q.value().Sign() == 0
+}
+
+// Sign returns -1, 0 or +1
+func (q Quantity) Sign() int {
+	return q.value().Sign()
+}
+
+// Cmp compares two quantities, returning -1, 0 or +1
+func (q Quantity) Cmp(other Quantity) int {
+	return q.value().Cmp(other.value())
+}
+
+// Equal reports whether two quantities have the same value, whatever their format
+func (q Quantity) Equal(other Quantity) bool {
+	return q.Cmp(other) == 0
+}
+
+// Add returns q + other, keeping q's format (or other's if q has none)
+func (q Quantity) Add(other Quantity) Quantity {
+	return Quantity{nanos: new(big.Int).Add(q.value(), other.value()), Format: q.format(other)}
+}
+
+// Sub returns q - other, keeping q's format (or other's if q has none)
+func (q Quantity) Sub(other Quantity) Quantity {
+	return Quantity{nanos: new(big.Int).Sub(q.value(), other.value()), Format: q.format(other)}
+}
+
+// Mul returns q multiplied by a whole number
+func (q Quantity) Mul(n int64) Quantity {
+	return Quantity{nanos: new(big.Int).Mul(q.value(), big.NewInt(n)), Format: q.Format}
+}
+
+// MulFraction returns q * num / den, rounded away from zero to nano
+// precision, e.g. MulFraction(150, 100) for a 50% increase
+func (q Quantity) MulFraction(num int64, den int64) Quantity {
+	numerator := new(big.Int).Mul(q.value(), big.NewInt(num))
+	denominator := big.NewInt(den)
+	if den < 0 {
+		numerator.Neg(numerator)
+		denominator.Neg(denominator)
+	}
+	return Quantity{nanos: divRoundUp(numerator, denominator), Format: q.Format}
+}
+
+// Max returns the larger of two quantities
+func Max(a Quantity, b Quantity) Quantity {
+	if a.Cmp(b) >= 0 {
+		return a
+	}
+	return b
+}
+
+// format picks the format for the result of arithmetic
+func (q Quantity) format(other Quantity) Format {
+	if q.Format == "" {
+		return other.Format
+	}
+	return q.Format
+}
+
+// Value returns the quantity in whole units, rounded away from zero as
+// Kubernetes does, and clamped to the int64 range
+func (q Quantity) Value() int64 {
+	return clampInt64(divRoundUp(q.value(), bigNano))
+}
+
+// MilliValue returns the quantity in thousandths, rounded away from zero and
+// clamped to the int64 range
+func (q Quantity) MilliValue() int64 {
+	return clampInt64(divRoundUp(q.value(), big.NewInt(1e6)))
+}
+
+// AsFloat64 returns the quantity as a float, e.g. cores for CPU or bytes for memory
+func (q Quantity) AsFloat64() float64 {
+	f, _ := new(big.Rat).SetFrac(q.value(), bigNano).Float64()
+	return f
+}
+
+// GiB returns a memory quantity in GiB (2^30 bytes)
+func (q Quantity) GiB() float64 {
+	return q.AsFloat64() / GiB
+}
+
+// GB returns a memory quantity in GB (10^9 bytes)
+func (q Quantity) GB() float64 {
+	return q.AsFloat64() / GB
+}
+
+// String formats the quantity the way Kubernetes canonicalizes it:
+// "1.5" CPU becomes "1500m", "1024Mi" becomes "1Gi" and "0.5Gi" becomes "512Mi"
+func (q Quantity) String() string {
+	v := q.value()
+	if v.Sign() == 0 {
+		return "0"
+	}
+	sign := ""
+	if v.Sign() < 0 {
+		sign = "-"
+	}
+	abs := new(big.Int).Abs(v)
+
+	format := q.Format
+	switch format {
+	case DecimalSI, DecimalExponent:
+	case BinarySI:
+		// Small and fractional values read better as decimal
+		whole, rem := new(big.Int).QuoRem(abs, bigNano, new(big.Int))
+		if rem.Sign() != 0 || whole.Cmp(big1024) < 0 {
+			format = DecimalSI
+		} else {
+			mantissa, exponent := removeFactors(whole, big1024, 6)
+			return sign + mantissa.String() + binarySuffix(exponent)
+		}
+	default:
+		format = DecimalExponent
+	}
+
+	// Strip trailing zeros, then move the exponent down to a multiple of 3
+	mantissa, zeros := removeFactors(abs, big10, -1)
+	exponent := zeros - 9
+	if extra := ((exponent % 3) + 3) % 3; extra != 0 {
+		mantissa.Mul(mantissa, pow(big10, extra))
+		exponent -= extra
+	}
+	return sign + mantissa.String() + decimalSuffix(exponent, format)
+}
+
+// decimalSuffix returns the suffix for a power of ten
+func decimalSuffix(exponent int, format Format) string {
+	if format == DecimalSI {
+		for suffix, e := range decimalSuffixes {
+			if e == exponent {
+				return suffix
+			}
+		}
+	}
+	if exponent == 0 {
+		return ""
+	}
+	return "e" + strconv.Itoa(exponent)
+}
+
+// binarySuffix returns the suffix for a power of 1024
+func binarySuffix(exponent int) string {
+	for suffix, e := range binarySuffixes {
+		if e == exponent {
+			return suffix
+		}
+	}
+	return ""
+}
+
+// MarshalJSON writes the quantity as a JSON string, like Kubernetes
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(q.String())), nil
+}
+
+// UnmarshalJSON reads a quantity from a JSON string or number
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	str := string(data)
+	if str == "null" {
+		*q = Quantity{}
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(str); err == nil {
+		str = unquoted
+	}
+	parsed, err := Parse(str)
+	if err != nil {
+		return err
+	}
+	*q = parsed
+	return nil
+}
+
+// removeFactors divides out factor as often as possible (at most max times,
+// unlimited when max < 0) and returns the result and the count
+func removeFactors(v *big.Int, factor *big.Int, max int) (*big.Int, int) {
+	result := new(big.Int).Set(v)
+	if result.Sign() == 0 {
+		return result, 0
+	}
+	count := 0
+	q, r := new(big.Int), new(big.Int)
+	for max < 0 || count < max {
+		q.QuoRem(result, factor, r)
+		if r.Sign() != 0 {
+			break
+		}
+		result.Set(q)
+		count++
+	}
+	return result, count
+}
+
+// divRoundUp divides rounding away from zero; den must be positive
+func divRoundUp(num *big.Int, den *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() > 0 {
+		q.Add(q, big.NewInt(1))
+	} else if r.Sign() < 0 {
+		q.Sub(q, big.NewInt(1))
+	}
+	return q
+}
+
+// clampInt64 converts to int64, saturating instead of wrapping
+func clampInt64(v *big.Int) int64 {
+	if v.IsInt64() {
+		return v.Int64()
+	}
+	if v.Sign() < 0 {
+		return math.MinInt64
+	}
+	return math.MaxInt64
+}
+
+// pow returns base^n for n >= 0
+func pow(base *big.Int, n int) *big.Int {
+	return new(big.Int).Exp(base, big.NewInt(int64(n)), nil)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,221 @@
+package quantity
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		// Canonical forms, as Kubernetes writes them
+		{"0", "0"},
+		{"1", "1"},
+		{"1.5", "1500m"},
+		{"250m", "250m"},
+		{"0.1", "100m"},
+		{"1000m", "1"},
+		{"2000m", "2"},
+		{"+1.5", "1500m"},
+		{"-1.5", "-1500m"},
+		{"12k", "12k"},
+		{"1000k", "1M"},
+		{"1G", "1G"},
+
+		// Binary suffixes
+		{"0.5Gi", "512Mi"},
+		{"1024Mi", "1Gi"},
+		{"1536Mi", "1536Mi"},
+		{"1Ki", "1Ki"},
+		{"2048Ki", "2Mi"},
+		{"1Ei", "1Ei"},
+		{"0.5Ki", "512"}, // Below 1024, decimal reads better
+		{"0.1Ki", "102400m"},
+
+		// Exponents
+		{"1e3", "1e3"},
+		{"1E3", "1e3"},
+		{"12e6", "12e6"},
+		{"1.5e3", "1500"},
+		{"1e-3", "1e-3"},
+		{"100e-3", "100e-3"},
+
+		// Finer than nano rounds away from zero
+		{"1n", "1n"},
+		{"0.1n", "1n"},
+		{"1.5n", "2n"},
+		{"-0.1n", "-1n"},
+		{"1.0000000001", "1000000001n"},
+		{"0.0000000001", "1n"},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got := q.String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.in, got, tt.want)
+		}
+		// The canonical form parses back to the same value
+		again, err := Parse(q.String())
+		if err != nil {
+			t.Errorf("Parse(%q) of canonical %q: %v", tt.in, q.String(), err)
+			continue
+		}
+		if !again.Equal(q) {
+			t.Errorf("%q round-tripped through %q to %s", tt.in, q.String(), again)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{"", " ", "abc", "1x", "1Gib", "1.2.3", "--1", "1e", "1eX", ".", "m", "1 Gi"} {
+		if q, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) = %s, want an error", in, q)
+		} else if !errors.Is(err, ErrFormat) {
+			t.Errorf("Parse(%q) error %v doesn't wrap ErrFormat", in, err)
+		}
+	}
+}
+
+func TestValues(t *testing.T) {
+	tests := []struct {
+		in      string
+		value   int64
+		milli   int64
+		float   float64
+		gib, gb float64
+	}{
+		{"1.5", 2, 1500, 1.5, 1.5 / GiB, 1.5 / GB},
+		{"100m", 1, 100, 0.1, 0.1 / GiB, 0.1 / GB},
+		{"-100m", -1, -100, -0.1, -0.1 / GiB, -0.1 / GB},
+		{"1Gi", GiB, GiB * 1000, GiB, 1, GiB / GB},
+		{"1G", GB, GB * 1000, GB, GB / GiB, 1},
+		{"1n", 1, 1, 1e-9, 1e-9 / GiB, 1e-9 / GB},
+	}
+	for _, tt := range tests {
+		q := MustParse(tt.in)
+		if got := q.Value(); got != tt.value {
+			t.Errorf("%s.Value() = %d, want %d", tt.in, got, tt.value)
+		}
+		if got := q.MilliValue(); got != tt.milli {
+			t.Errorf("%s.MilliValue() = %d, want %d", tt.in, got, tt.milli)
+		}
+		if got := q.AsFloat64(); got != tt.float {
+			t.Errorf("%s.AsFloat64() = %g, want %g", tt.in, got, tt.float)
+		}
+		if got := q.GiB(); got != tt.gib {
+			t.Errorf("%s.GiB() = %g, want %g", tt.in, got, tt.gib)
+		}
+		if got := q.GB(); got != tt.gb {
+			t.Errorf("%s.GB() = %g, want %g", tt.in, got, tt.gb)
+		}
+	}
+
+	if got := MustParse("10E").Value(); got != 9223372036854775807 {
+		t.Errorf("10E.Value() = %d, want it clamped to MaxInt64", got)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Quantity
+		want string
+	}{
+		{"100m+900m", MustParse("100m").Add(MustParse("900m")), "1"},
+		{"1Gi+512Mi", MustParse("1Gi").Add(MustParse("512Mi")), "1536Mi"},
+		{"512Mi+512Mi", MustParse("512Mi").Add(MustParse("512Mi")), "1Gi"},
+		{"0+1Gi", Quantity{}.Add(MustParse("1Gi")), "1Gi"},
+		{"1-250m", MustParse("1").Sub(MustParse("250m")), "750m"},
+		{"250m-1", MustParse("250m").Sub(MustParse("1")), "-750m"},
+		{"1Gi-1Gi", MustParse("1Gi").Sub(MustParse("1Gi")), "0"},
+		{"250m*4", MustParse("250m").Mul(4), "1"},
+		{"512Mi*2", MustParse("512Mi").Mul(2), "1Gi"},
+		{"1*150/100", MustParse("1").MulFraction(150, 100), "1500m"},
+		{"1Gi*1/2", MustParse("1Gi").MulFraction(1, 2), "512Mi"},
+		{"1n*1/3", MustParse("1n").MulFraction(1, 3), "1n"},
+		{"-1n*1/3", MustParse("-1n").MulFraction(1, 3), "-1n"},
+		{"1*1/-4", MustParse("1").MulFraction(1, -4), "-250m"},
+		{"Max(1, 999m)", Max(MustParse("1"), MustParse("999m")), "1"},
+		{"Max(1Gi, 1025Mi)", Max(MustParse("1Gi"), MustParse("1025Mi")), "1025Mi"},
+	}
+	for _, tt := range tests {
+		if got := tt.got.String(); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if !MustParse("100m").Add(MustParse("900m")).Equal(MustParse("1")) {
+		t.Error(`"100m"+"900m" != "1"`)
+	}
+	if !MustParse("1Gi").Equal(MustParse("1024Mi")) || !MustParse("1.5").Equal(MustParse("1500m")) {
+		t.Error("Equal compares values whatever the format")
+	}
+	if MustParse("1").Cmp(MustParse("1001m")) != -1 || MustParse("1").Sign() != 1 || !(Quantity{}).IsZero() {
+		t.Error("Cmp, Sign or IsZero is wrong")
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Quantity
+		want string
+	}{
+		{"NewQuantity(2, DecimalSI)", NewQuantity(2, DecimalSI), "2"},
+		{"NewQuantity(1073741824, BinarySI)", NewQuantity(1<<30, BinarySI), "1Gi"},
+		{"NewMilliQuantity(1500, DecimalSI)", NewMilliQuantity(1500, DecimalSI), "1500m"},
+		{"FromFloat(0.25, DecimalSI)", FromFloat(0.25, DecimalSI), "250m"},
+		{"FromFloat(1e-10, DecimalSI)", FromFloat(1e-10, DecimalSI), "1n"},
+		{"FromGiB(0.5)", FromGiB(0.5), "512Mi"},
+		{"FromGiB(2)", FromGiB(2), "2Gi"},
+	}
+	for _, tt := range tests {
+		if got := tt.got.String(); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var list ResourceList
+	if err := json.Unmarshal([]byte(`{"cpu": "1.5", "memory": "0.5Gi", "pods": 110}`), &list); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"cpu":"1500m","memory":"512Mi","pods":"110"}`; string(data) != want {
+		t.Errorf("marshalled %s, want %s", data, want)
+	}
+
+	var q Quantity
+	if err := json.Unmarshal([]byte(`"1x"`), &q); err == nil {
+		t.Error(`unmarshalling "1x" succeeded`)
+	}
+}
+
+func TestPodRequests(t *testing.T) {
+	containers := []ResourceRequirements{
+		{Requests: ResourceList{CPU: MustParse("250m"), Memory: MustParse("256Mi")}},
+		{Limits: ResourceList{CPU: MustParse("500m"), Memory: MustParse("768Mi")}}, // Requests default to limits
+	}
+	initContainers := []ResourceRequirements{
+		{Requests: ResourceList{CPU: MustParse("2"), Memory: MustParse("128Mi")}},
+	}
+	overhead := ResourceList{CPU: MustParse("100m")}
+
+	got := PodRequests(containers, initContainers, overhead)
+	if cpu := got.CPU().String(); cpu != "2100m" {
+		t.Errorf("CPU = %s, want 2100m (largest init container plus overhead)", cpu)
+	}
+	if memory := got.Memory().String(); memory != "1Gi" {
+		t.Errorf("memory = %s, want 1Gi (sum of containers)", memory)
+	}
+}
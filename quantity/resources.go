@@ -0,0 +1,81 @@
+package quantity
+
+// Resource names used in requests and limits
+const (
+	CPU              = "cpu"
+	Memory           = "memory"
+	EphemeralStorage = "ephemeral-storage"
+)
+
+// ResourceList maps resource names to quantities, like a container's
+// "requests" or "limits" in a pod spec
+type ResourceList map[string]Quantity
+
+// CPU returns the CPU quantity, 0 if unset
+func (l ResourceList) CPU() Quantity {
+	return l[CPU]
+}
+
+// Memory returns the memory quantity, 0 if unset
+func (l ResourceList) Memory() Quantity {
+	return l[Memory]
+}
+
+// Add returns the sum of two resource lists
+func (l ResourceList) Add(other ResourceList) ResourceList {
+	sum := make(ResourceList, len(l))
+	for name, q := range l {
+		sum[name] = q
+	}
+	for name, q := range other {
+		sum[name] = sum[name].Add(q)
+	}
+	return sum
+}
+
+// Max returns the larger quantity of each resource in two lists
+func (l ResourceList) Max(other ResourceList) ResourceList {
+	max := make(ResourceList, len(l))
+	for name, q := range l {
+		max[name] = q
+	}
+	for name, q := range other {
+		max[name] = Max(max[name], q)
+	}
+	return max
+}
+
+// ResourceRequirements are a container's requests and limits, with the same
+// JSON shape as a pod spec's "resources" field
+type ResourceRequirements struct {
+	Requests ResourceList `json:"requests,omitempty"`
+	Limits   ResourceList `json:"limits,omitempty"`
+}
+
+// EffectiveRequests returns what a container is guaranteed: its requests,
+// falling back to its limits for resources with only a limit set (Kubernetes
+// defaults requests to limits)
+func (r ResourceRequirements) EffectiveRequests() ResourceList {
+	effective := make(ResourceList, len(r.Requests))
+	for name, q := range r.Limits {
+		effective[name] = q
+	}
+	for name, q := range r.Requests {
+		effective[name] = q
+	}
+	return effective
+}
+
+// PodRequests returns the resources the scheduler reserves for a pod: the sum
+// of its containers' requests, or the largest init container's request if
+// that is higher, plus any pod overhead (e.g. from a RuntimeClass)
+func PodRequests(containers []ResourceRequirements, initContainers []ResourceRequirements, overhead ResourceList) ResourceList {
+	sum := ResourceList{}
+	for _, c := range containers {
+		sum = sum.Add(c.EffectiveRequests())
+	}
+	for _, c := range initContainers {
+		sum = sum.Max(c.EffectiveRequests())
+	}
+	return sum.Add(overhead)
+}